@@ -0,0 +1,101 @@
+// Command binance-signerd is reference signing daemon holding Binance API
+// secret outside of trading process.
+//
+// It serves pkg.HTTPSigner protocol on TCP address or Unix socket:
+//
+//	binance-signerd -key-type ed25519 -key-file key.pem -listen unix:/run/signerd.sock \
+//		-endpoints "POST api/v3/order,DELETE api/v3/order,order.place" -symbols BNBBTC,ETHBTC
+//
+// With -stdio it signs single request read from standard input, which is how
+// pkg.CommandSigner runs it.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/signerd"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8089", "TCP address or unix:<path> to listen on")
+	stdio := flag.Bool("stdio", false, "sign single request from standard input")
+	keyType := flag.String("key-type", "hmac", "key type: hmac, ed25519 or rsa")
+	keyFile := flag.String("key-file", "", "file with HMAC secret or PEM encoded private key")
+	endpoints := flag.String("endpoints", "", "comma separated endpoints allowed to be signed")
+	symbols := flag.String("symbols", "", "comma separated symbols allowed to be signed, any if empty")
+	flag.Parse()
+
+	var logger log.Logger
+	logger = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	logger = log.With(logger, "time", log.DefaultTimestampUTC)
+
+	signer, err := loadSigner(*keyType, *keyFile)
+	if err != nil {
+		level.Error(logger).Log("msg", "unable to load key", "err", err)
+		os.Exit(1)
+	}
+	server := signerd.NewServer(signer, signerd.Policy{
+		Endpoints: splitList(*endpoints),
+		Symbols:   splitList(*symbols),
+	}, logger)
+
+	if *stdio {
+		if err := server.ServeStdio(os.Stdin, os.Stdout); err != nil {
+			level.Error(logger).Log("err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	network, address := "tcp", *listen
+	if strings.HasPrefix(address, "unix:") {
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+		os.Remove(address)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		level.Error(logger).Log("msg", "unable to listen", "err", err)
+		os.Exit(1)
+	}
+	level.Info(logger).Log("msg", "listening", "network", network, "address", address)
+	if err := http.Serve(l, server); err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+}
+
+func loadSigner(keyType, keyFile string) (pkg.Signer, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	switch keyType {
+	case "ed25519":
+		return pkg.NewEd25519SignerFromPEM(key)
+	case "rsa":
+		return pkg.NewRSASignerFromPEM(key)
+	case "hmac":
+		return &pkg.HmacSigner{Key: []byte(strings.TrimSpace(string(key)))}, nil
+	default:
+		return nil, fmt.Errorf("unknown key type %q", keyType)
+	}
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
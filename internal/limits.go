@@ -0,0 +1,4 @@
+package internal
+
+// TradesLimit is maximal number of trades returned by single MyTrades call.
+const TradesLimit = 1000
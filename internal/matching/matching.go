@@ -0,0 +1,62 @@
+// Package matching holds order rules shared by the simulated exchange of
+// paper trading and backtesting and by the fake exchange of binancetest.
+package matching
+
+import (
+	"math"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Epsilon is tolerance of amount comparisons, absorbing float rounding.
+const Epsilon = 1e-12
+
+// Crosses reports whether order of side limited by limit executes at price.
+func Crosses(side pkg.OrderSide, limit, price float64) bool {
+	if side == pkg.SideBuy {
+		return price <= limit+Epsilon
+	}
+	return price >= limit-Epsilon
+}
+
+// Clean rounds amount close to zero to zero.
+func Clean(amount float64) float64 {
+	if math.Abs(amount) < Epsilon {
+		return 0
+	}
+	return amount
+}
+
+// IsStop reports whether orders of type wait for stop price to be reached.
+func IsStop(orderType pkg.OrderType) bool {
+	switch orderType {
+	case pkg.TypeStopLoss, pkg.TypeStopLossLimit, pkg.TypeTakeProfit, pkg.TypeTakeProfitLimit:
+		return true
+	}
+	return false
+}
+
+// IsMarket reports whether orders of type execute at any price.
+func IsMarket(orderType pkg.OrderType) bool {
+	switch orderType {
+	case pkg.TypeMarket, pkg.TypeStopLoss, pkg.TypeTakeProfit:
+		return true
+	}
+	return false
+}
+
+// Triggered reports whether last trade price reached stopPrice of stop
+// order of type and side.
+func Triggered(orderType pkg.OrderType, side pkg.OrderSide, stopPrice, last float64) bool {
+	stopLoss := orderType == pkg.TypeStopLoss || orderType == pkg.TypeStopLossLimit
+	// Sell stop loss and buy take profit trigger when price falls.
+	if (side == pkg.SideSell) == stopLoss {
+		return last <= stopPrice
+	}
+	return last >= stopPrice
+}
+
+// Remaining returns quantity of order not executed yet.
+func Remaining(origQty, executedQty float64) float64 {
+	return origQty - executedQty
+}
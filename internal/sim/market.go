@@ -0,0 +1,243 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/retirero/go-binance/internal/matching"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// market is the latest market data of symbol.
+type market struct {
+	symbol  string
+	hasBook bool
+	bid     float64
+	ask     float64
+	// bidQty and askQty are quantities at the best prices not taken by
+	// orders of the account since the last book update.
+	bidQty  float64
+	askQty  float64
+	hasLast bool
+	last    float64
+	// tradeQty is quantity of the last trade not credited to resting orders
+	// of the account yet.
+	tradeQty float64
+}
+
+func (e *Exchange) market(symbol string) *market {
+	m, ok := e.markets[symbol]
+	if !ok {
+		m = &market{symbol: symbol}
+		e.markets[symbol] = m
+	}
+	return m
+}
+
+// opposite returns the best price order of side can take and quantity
+// available at it. Without book it's the last trade price.
+func (m *market) opposite(side pkg.OrderSide) (float64, float64, bool) {
+	switch {
+	case m.hasBook && side == pkg.SideBuy:
+		return m.ask, m.askQty, m.ask > 0
+	case m.hasBook:
+		return m.bid, m.bidQty, m.bid > 0
+	case m.hasLast:
+		return m.last, m.tradeQty, true
+	}
+	return 0, 0, false
+}
+
+// take consumes qty at the best price opposite to side.
+func (m *market) take(side pkg.OrderSide, qty float64) {
+	switch {
+	case m.hasBook && side == pkg.SideBuy:
+		m.askQty = matching.Clean(m.askQty - qty)
+	case m.hasBook:
+		m.bidQty = matching.Clean(m.bidQty - qty)
+	default:
+		m.tradeQty = matching.Clean(m.tradeQty - qty)
+	}
+}
+
+// UpdateBook sets the best bid and ask of symbol and matches orders against
+// them.
+func (e *Exchange) UpdateBook(symbol string, bid, bidQty, ask, askQty float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := e.market(symbol)
+	m.hasBook = true
+	m.bid, m.bidQty = bid, bidQty
+	m.ask, m.askQty = ask, askQty
+	e.match(m)
+}
+
+// UpdateTrade records market trade of symbol, triggers stop orders reached
+// by its price and fills resting orders it traded through.
+func (e *Exchange) UpdateTrade(symbol string, price, qty float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := e.market(symbol)
+	m.hasLast = true
+	m.last = price
+	m.tradeQty = qty
+	e.match(m)
+	m.tradeQty = 0
+}
+
+// Match matches orders of symbol against the latest market data. It's
+// called after latency of orders elapsed.
+func (e *Exchange) Match(symbol string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.match(e.market(symbol))
+}
+
+func (e *Exchange) match(m *market) {
+	for _, o := range e.orders {
+		if o.symbol == m.symbol {
+			e.evaluate(m, o)
+		}
+	}
+}
+
+// evaluate matches active order against market data.
+func (e *Exchange) evaluate(m *market, o *order) {
+	if !o.active() || e.cfg.Now().Before(o.activeAt) {
+		return
+	}
+	if o.isStop() && !o.triggered {
+		if !m.hasLast || !o.triggeredBy(m.last) {
+			return
+		}
+		o.triggered = true
+	}
+	if o.resting {
+		e.make(m, o)
+		return
+	}
+
+	price, available, ok := m.opposite(o.side)
+	marketable := ok && (o.isMarket() || matching.Crosses(o.side, o.price, price))
+	if o.orderType == pkg.TypeLimitMaker && marketable {
+		// Book moved while order was on its way.
+		e.expire(o)
+		return
+	}
+	if marketable {
+		qty := o.remaining()
+		if e.cfg.PartialFills {
+			qty = math.Min(qty, available)
+		}
+		if o.timeInForce == pkg.FOK && qty < o.remaining()-matching.Epsilon {
+			e.expire(o)
+			return
+		}
+		if qty > matching.Epsilon {
+			m.take(o.side, qty)
+			if e.cfg.Slippage != nil {
+				price = e.cfg.Slippage(o.side, price, qty)
+			}
+			e.fill(o, price, qty, false)
+		}
+	}
+	switch {
+	case !o.active() || o.isMarket():
+		// Remainder of market order takes liquidity of next updates.
+	case o.timeInForce == pkg.IOC || o.timeInForce == pkg.FOK:
+		e.expire(o)
+	default:
+		o.resting = true
+	}
+}
+
+// make fills resting order as maker, if book or trade moved through its
+// price.
+func (e *Exchange) make(m *market, o *order) {
+	qty := 0.0
+	if price, available, ok := m.opposite(o.side); ok && m.hasBook && matching.Crosses(o.side, o.price, price) {
+		qty = o.remaining()
+		if e.cfg.PartialFills {
+			qty = math.Min(qty, available)
+		}
+		m.take(o.side, qty)
+	}
+	if m.tradeQty > 0 && matching.Crosses(o.side, o.price, m.last) {
+		credit := o.remaining() - qty
+		if e.cfg.PartialFills {
+			traded := m.tradeQty
+			if math.Abs(m.last-o.price) <= matching.Epsilon {
+				traded *= e.cfg.QueueShare
+			}
+			credit = math.Min(credit, traded)
+			m.tradeQty = matching.Clean(m.tradeQty - credit)
+		}
+		qty += credit
+	}
+	if qty > matching.Epsilon {
+		e.fill(o, o.price, qty, true)
+	}
+}
+
+// fill executes qty of order at price, moving funds and charging
+// commission in the received asset.
+func (e *Exchange) fill(o *order, price, qty float64, maker bool) {
+	base, quote, _ := e.assets(o.symbol)
+	fee := e.cfg.TakerFee
+	if maker {
+		fee = e.cfg.MakerFee
+	}
+	now := e.cfg.Now()
+	e.lastTradeID++
+	f := &Fill{
+		Symbol:   o.symbol,
+		TradeID:  e.lastTradeID,
+		OrderID:  o.orderID,
+		Side:     o.side,
+		Price:    price,
+		Qty:      qty,
+		QuoteQty: price * qty,
+		Time:     now,
+		IsMaker:  maker,
+	}
+
+	paid, paidAmount, received, receivedAmount := base, qty, quote, f.QuoteQty
+	reserved := qty
+	if o.side == pkg.SideBuy {
+		paid, paidAmount, received, receivedAmount = quote, f.QuoteQty, base, qty
+		reserved = qty * o.lockPrice
+	}
+	pb := e.balance(paid)
+	if o.locked > 0 {
+		reserved = math.Min(reserved, o.locked)
+		o.locked = matching.Clean(o.locked - reserved)
+		pb.Locked = matching.Clean(pb.Locked - reserved)
+		pb.Free = matching.Clean(pb.Free + reserved - paidAmount)
+	} else {
+		pb.Free = matching.Clean(pb.Free - paidAmount)
+	}
+	f.Commission = receivedAmount * fee
+	f.CommissionAsset = received
+	e.balance(received).Free += receivedAmount - f.Commission
+	e.fills = append(e.fills, f)
+
+	o.executedQty += qty
+	o.cumQuoteQty += f.QuoteQty
+	o.updateTime = now
+	o.status = pkg.StatusPartiallyFilled
+	if o.remaining() <= matching.Epsilon {
+		o.status = pkg.StatusFilled
+	}
+	e.publishReport(o, pkg.ExecutionTrade, "", f)
+	if o.status == pkg.StatusFilled {
+		e.release(o)
+	}
+	e.publishBalances(base, quote)
+}
+
+// expire expires remainder of order.
+func (e *Exchange) expire(o *order) {
+	o.status = pkg.StatusExpired
+	o.updateTime = e.cfg.Now()
+	e.release(o)
+	e.publishReport(o, pkg.ExecutionExpired, "", nil)
+}
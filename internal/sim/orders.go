@@ -0,0 +1,480 @@
+package sim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/retirero/go-binance/internal/matching"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// order is order of the account.
+type order struct {
+	symbol        string
+	orderID       int64
+	clientOrderID string
+	side          pkg.OrderSide
+	orderType     pkg.OrderType
+	timeInForce   pkg.TimeInForce
+	price         float64
+	stopPrice     float64
+	origQty       float64
+	executedQty   float64
+	cumQuoteQty   float64
+	status        pkg.OrderStatus
+	time          time.Time
+	updateTime    time.Time
+	// activeAt is time order reaches the exchange, see Config.Latency.
+	activeAt time.Time
+	// triggered is set once stop price of stop order was reached.
+	triggered bool
+	// resting is set once limit order was matched without crossing the
+	// book, so it waits for the market as maker.
+	resting bool
+	// locked is amount of funds still locked by the order, lockPrice the
+	// price funds of buy order were locked at.
+	locked    float64
+	lockPrice float64
+}
+
+func (o *order) active() bool {
+	return o.status == pkg.StatusNew || o.status == pkg.StatusPartiallyFilled
+}
+
+func (o *order) remaining() float64 {
+	return matching.Remaining(o.origQty, o.executedQty)
+}
+
+// isStop reports whether order waits for stop price to be reached.
+func (o *order) isStop() bool {
+	return matching.IsStop(o.orderType)
+}
+
+// isMarket reports whether order executes at any price.
+func (o *order) isMarket() bool {
+	return matching.IsMarket(o.orderType)
+}
+
+// triggeredBy reports whether last trade price reached stop price of order.
+func (o *order) triggeredBy(last float64) bool {
+	return matching.Triggered(o.orderType, o.side, o.stopPrice, last)
+}
+
+func (o *order) executedOrder() *pkg.ExecutedOrder {
+	return &pkg.ExecutedOrder{
+		Symbol:        o.symbol,
+		OrderID:       int(o.orderID),
+		ClientOrderID: o.clientOrderID,
+		Price:         o.price,
+		OrigQty:       o.origQty,
+		ExecutedQty:   o.executedQty,
+		Status:        o.status,
+		TimeInForce:   o.timeInForce,
+		Type:          o.orderType,
+		Side:          o.side,
+		StopPrice:     o.stopPrice,
+		Time:          o.time,
+	}
+}
+
+// orderTypes lists supported order types with flags of their mandatory
+// params.
+var orderTypes = map[pkg.OrderType]struct {
+	price       bool
+	stopPrice   bool
+	timeInForce bool
+}{
+	pkg.TypeLimit:           {price: true, timeInForce: true},
+	pkg.TypeMarket:          {},
+	pkg.TypeStopLoss:        {stopPrice: true},
+	pkg.TypeStopLossLimit:   {price: true, stopPrice: true, timeInForce: true},
+	pkg.TypeTakeProfit:      {stopPrice: true},
+	pkg.TypeTakeProfitLimit: {price: true, stopPrice: true, timeInForce: true},
+	pkg.TypeLimitMaker:      {price: true},
+}
+
+// newOrder validates request and returns the order, not placed yet.
+func (e *Exchange) newOrder(nor pkg.NewOrderRequest) (*order, error) {
+	if nor.Symbol == "" {
+		return nil, errMandatory("symbol")
+	}
+	base, quote, ok := e.assets(nor.Symbol)
+	if !ok {
+		return nil, errInvalidSymbol
+	}
+	o := &order{
+		symbol:        nor.Symbol,
+		clientOrderID: nor.NewClientOrderID,
+		side:          nor.Side,
+		orderType:     nor.Type,
+		timeInForce:   nor.TimeInForce,
+		price:         nor.Price,
+		stopPrice:     nor.StopPrice,
+		origQty:       nor.Quantity,
+		status:        pkg.StatusNew,
+	}
+	switch {
+	case o.side == "":
+		return nil, errMandatory("side")
+	case o.side != pkg.SideBuy && o.side != pkg.SideSell:
+		return nil, apiError(-1117, "Invalid side.")
+	case o.orderType == "":
+		return nil, errMandatory("type")
+	}
+	flags, ok := orderTypes[o.orderType]
+	if !ok {
+		return nil, apiError(-1116, "Invalid orderType.")
+	}
+	if o.origQty <= 0 {
+		return nil, errMandatory("quantity")
+	}
+	if flags.price && o.price <= 0 {
+		return nil, errMandatory("price")
+	}
+	if flags.stopPrice && o.stopPrice <= 0 {
+		return nil, errMandatory("stopPrice")
+	}
+	if flags.timeInForce {
+		switch o.timeInForce {
+		case "":
+			return nil, errMandatory("timeInForce")
+		case pkg.GTC, pkg.IOC, pkg.FOK:
+		default:
+			return nil, apiError(-1115, "Invalid timeInForce.")
+		}
+	} else {
+		o.timeInForce = pkg.GTC
+	}
+	if !flags.price {
+		o.price = 0
+	}
+	if !flags.stopPrice {
+		o.stopPrice = 0
+	}
+	for _, other := range e.orders {
+		if other.active() && o.clientOrderID != "" && other.clientOrderID == o.clientOrderID {
+			return nil, apiError(-2010, "Duplicate order sent.")
+		}
+	}
+
+	m := e.market(o.symbol)
+	if o.orderType == pkg.TypeLimitMaker {
+		if price, _, ok := m.opposite(o.side); ok && matching.Crosses(o.side, o.price, price) {
+			return nil, apiError(-2010, "Order would immediately match and take.")
+		}
+	}
+	if o.isStop() && m.hasLast && o.triggeredBy(m.last) {
+		return nil, apiError(-2010, "Stop price would trigger immediately.")
+	}
+
+	asset, required := base, o.origQty
+	if o.side == pkg.SideBuy {
+		asset = quote
+		switch {
+		case o.orderType == pkg.TypeMarket:
+			price, _, ok := m.opposite(o.side)
+			if !ok {
+				return nil, apiError(-2010, "Market has no price to execute market order.")
+			}
+			required = o.origQty * price
+		case o.isMarket():
+			o.lockPrice = o.stopPrice
+		default:
+			o.lockPrice = o.price
+		}
+		if o.orderType != pkg.TypeMarket {
+			required = o.origQty * o.lockPrice
+		}
+	}
+	if e.balance(asset).Free < required-matching.Epsilon {
+		return nil, errInsufficientBalance
+	}
+	return o, nil
+}
+
+// NewOrderTest validates order request like NewOrder without placing it.
+func (e *Exchange) NewOrderTest(nor pkg.NewOrderRequest) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.newOrder(nor)
+	return err
+}
+
+// NewOrder places order. Unless Config.Latency is set, it's matched against
+// the market right away.
+func (e *Exchange) NewOrder(nor pkg.NewOrderRequest) (*pkg.ProcessedOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, err := e.newOrder(nor)
+	if err != nil {
+		return nil, err
+	}
+	e.lastOrderID++
+	o.orderID = e.lastOrderID
+	if o.clientOrderID == "" {
+		o.clientOrderID = newClientOrderID()
+	}
+	o.time = e.cfg.Now()
+	o.updateTime = o.time
+	o.activeAt = o.time.Add(e.cfg.Latency)
+	e.orders = append(e.orders, o)
+
+	e.lock(o)
+	e.publishReport(o, pkg.ExecutionNew, "", nil)
+	m := e.market(o.symbol)
+	e.evaluate(m, o)
+	return &pkg.ProcessedOrder{
+		Symbol:        o.symbol,
+		OrderID:       o.orderID,
+		ClientOrderID: o.clientOrderID,
+		TransactTime:  o.time,
+	}, nil
+}
+
+func newClientOrderID() string {
+	b := make([]byte, 11)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// lock moves funds needed by order from free to locked. Market orders spend
+// free funds as they fill.
+func (e *Exchange) lock(o *order) {
+	if o.orderType == pkg.TypeMarket {
+		return
+	}
+	base, quote, _ := e.assets(o.symbol)
+	asset, amount := base, o.origQty
+	if o.side == pkg.SideBuy {
+		asset, amount = quote, o.origQty*o.lockPrice
+	}
+	b := e.balance(asset)
+	b.Free = matching.Clean(b.Free - amount)
+	b.Locked += amount
+	o.locked = amount
+	e.publishBalances(asset)
+}
+
+// release unlocks funds still locked by finished order.
+func (e *Exchange) release(o *order) {
+	if o.locked == 0 {
+		return
+	}
+	base, quote, _ := e.assets(o.symbol)
+	asset := base
+	if o.side == pkg.SideBuy {
+		asset = quote
+	}
+	b := e.balance(asset)
+	b.Locked = matching.Clean(b.Locked - o.locked)
+	b.Free += o.locked
+	o.locked = 0
+	e.publishBalances(asset)
+}
+
+// findOrder returns order of symbol identified by orderID or clientOrderID.
+func (e *Exchange) findOrder(symbol string, orderID int64, clientOrderID string) (*order, error) {
+	if symbol == "" {
+		return nil, errMandatory("symbol")
+	}
+	if orderID == 0 && clientOrderID == "" {
+		return nil, errOrderParams
+	}
+	for i := len(e.orders) - 1; i >= 0; i-- {
+		o := e.orders[i]
+		if o.symbol != symbol {
+			continue
+		}
+		if (orderID != 0 && o.orderID == orderID) || (orderID == 0 && o.clientOrderID == clientOrderID) {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+// QueryOrder returns order of the account.
+func (e *Exchange) QueryOrder(qor pkg.QueryOrderRequest) (*pkg.ExecutedOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, err := e.findOrder(qor.Symbol, qor.OrderID, qor.OrigClientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, errNoSuchOrder
+	}
+	return o.executedOrder(), nil
+}
+
+// CancelOrder cancels active order.
+func (e *Exchange) CancelOrder(cor pkg.CancelOrderRequest) (*pkg.CanceledOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, err := e.findOrder(cor.Symbol, cor.OrderID, cor.OrigClientOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil || !o.active() {
+		return nil, errUnknownOrder
+	}
+	cancelID := cor.NewClientOrderID
+	if cancelID == "" {
+		cancelID = newClientOrderID()
+	}
+	o.status = pkg.StatusCancelled
+	o.updateTime = e.cfg.Now()
+	e.release(o)
+	e.publishReport(o, pkg.ExecutionCanceled, cancelID, nil)
+	return &pkg.CanceledOrder{
+		Symbol:            o.symbol,
+		OrigClientOrderID: o.clientOrderID,
+		OrderID:           o.orderID,
+		ClientOrderID:     cancelID,
+	}, nil
+}
+
+// OpenOrders returns active orders of symbol, or of all symbols if it's
+// empty.
+func (e *Exchange) OpenOrders(oor pkg.OpenOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var orders []*pkg.ExecutedOrder
+	for _, o := range e.orders {
+		if o.active() && (oor.Symbol == "" || o.symbol == oor.Symbol) {
+			orders = append(orders, o.executedOrder())
+		}
+	}
+	return orders, nil
+}
+
+// AllOrders returns orders of symbol from OrderID on, or the most recent
+// ones if it's zero.
+func (e *Exchange) AllOrders(aor pkg.AllOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if aor.Symbol == "" {
+		return nil, errMandatory("symbol")
+	}
+	var orders []*pkg.ExecutedOrder
+	for _, o := range e.orders {
+		if o.symbol == aor.Symbol && o.orderID >= aor.OrderID {
+			orders = append(orders, o.executedOrder())
+		}
+	}
+	limit := limitOrDefault(aor.Limit)
+	if len(orders) > limit {
+		if aor.OrderID != 0 {
+			orders = orders[:limit]
+		} else {
+			orders = orders[len(orders)-limit:]
+		}
+	}
+	return orders, nil
+}
+
+func limitOrDefault(limit int) int {
+	if limit <= 0 {
+		return 500
+	}
+	return limit
+}
+
+// Account returns balances and commission rates of the account.
+func (e *Exchange) Account(ar pkg.AccountRequest) (*pkg.Account, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return &pkg.Account{
+		MakerCommision: int64(e.cfg.MakerFee*10000 + 0.5),
+		TakerCommision: int64(e.cfg.TakerFee*10000 + 0.5),
+		CanTrade:       true,
+		Balances:       e.sortedBalances(),
+	}, nil
+}
+
+// MyTrades returns fills of symbol from FromID on, or the most recent ones
+// if it's zero.
+func (e *Exchange) MyTrades(mtr pkg.MyTradesRequest) ([]*pkg.Trade, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if mtr.Symbol == "" {
+		return nil, errMandatory("symbol")
+	}
+	var trades []*pkg.Trade
+	for _, f := range e.fills {
+		if f.Symbol != mtr.Symbol || f.TradeID < mtr.FromID ||
+			(!mtr.StartTime.IsZero() && f.Time.Before(mtr.StartTime)) ||
+			(!mtr.EndTime.IsZero() && f.Time.After(mtr.EndTime)) {
+			continue
+		}
+		trades = append(trades, &pkg.Trade{
+			Symbol:          f.Symbol,
+			ID:              f.TradeID,
+			OrderID:         f.OrderID,
+			OrderListID:     -1,
+			Price:           f.Price,
+			Qty:             f.Qty,
+			QuoteQty:        f.QuoteQty,
+			Commission:      f.Commission,
+			CommissionAsset: f.CommissionAsset,
+			Time:            f.Time,
+			IsBuyer:         f.Side == pkg.SideBuy,
+			IsMaker:         f.IsMaker,
+			IsBestMatch:     true,
+		})
+	}
+	limit := limitOrDefault(mtr.Limit)
+	if len(trades) > limit {
+		if mtr.FromID != 0 || !mtr.StartTime.IsZero() {
+			trades = trades[:limit]
+		} else {
+			trades = trades[len(trades)-limit:]
+		}
+	}
+	return trades, nil
+}
+
+// publishReport sends executionReport event of order. cancelID is client
+// order ID of cancel request, f the fill of TRADE execution.
+func (e *Exchange) publishReport(o *order, execType pkg.ExecutionType, cancelID string, f *Fill) {
+	er := &pkg.ExecutionReportEvent{
+		WSEvent: pkg.WSEvent{
+			Type:   "executionReport",
+			Time:   o.updateTime,
+			Symbol: o.symbol,
+		},
+		ClientOrderID:       o.clientOrderID,
+		Side:                o.side,
+		OrderType:           o.orderType,
+		TimeInForce:         o.timeInForce,
+		Quantity:            o.origQty,
+		Price:               o.price,
+		StopPrice:           o.stopPrice,
+		OrderListID:         -1,
+		ExecutionType:       execType,
+		Status:              o.status,
+		RejectReason:        "NONE",
+		OrderID:             o.orderID,
+		CumulativeFilledQty: o.executedQty,
+		TransactionTime:     o.updateTime,
+		TradeID:             -1,
+		IsWorking:           o.active() && (!o.isStop() || o.triggered),
+		OrderCreationTime:   o.time,
+		CumulativeQuoteQty:  o.cumQuoteQty,
+		WorkingTime:         o.time,
+	}
+	if cancelID != "" {
+		er.ClientOrderID = cancelID
+		er.OrigClientOrderID = o.clientOrderID
+	}
+	if f != nil {
+		er.LastExecutedQty = f.Qty
+		er.LastExecutedPrice = f.Price
+		er.LastQuoteQty = f.QuoteQty
+		er.Commission = f.Commission
+		er.CommissionAsset = f.CommissionAsset
+		er.TradeID = f.TradeID
+		er.IsMaker = f.IsMaker
+	}
+	e.publish(er)
+}
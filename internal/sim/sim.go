@@ -0,0 +1,192 @@
+// Package sim simulates spot account of single user trading against external
+// market data. It backs paper trading and backtesting services, which feed
+// it with book tickers and trades and drive its clock.
+package sim
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/retirero/go-binance/internal"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Config configures Exchange.
+type Config struct {
+	// Now is clock of the exchange, time.Now by default.
+	Now func() time.Time
+	// MakerFee and TakerFee are commission rates, e.g. 0.001 for 0.1%.
+	// Commission is charged in the received asset.
+	MakerFee float64
+	TakerFee float64
+	// Latency delays matching of new orders. Exchange doesn't schedule
+	// anything, orders become eligible on the first Match, UpdateBook or
+	// UpdateTrade after the latency elapsed.
+	Latency time.Duration
+	// PartialFills limits fills by quantity quoted at the best price and by
+	// traded quantity. Without it, orders fill fully once price reaches
+	// them.
+	PartialFills bool
+	// QueueShare is share of quantity traded exactly at price of resting
+	// order credited to it with PartialFills, modelling its queue position.
+	QueueShare float64
+	// Slippage, if set, returns execution price of taker fill of qty at
+	// quoted price.
+	Slippage func(side pkg.OrderSide, price, qty float64) float64
+	// Symbols maps symbols to their base and quote asset. Other symbols are
+	// split by well known quote assets.
+	Symbols map[string][2]string
+	// Publish, if set, receives user data events. It's called with
+	// Exchange locked and must not call Exchange.
+	Publish func(pkg.UserDataEvent)
+}
+
+// Exchange is simulated exchange account. It's safe for concurrent use.
+type Exchange struct {
+	cfg Config
+
+	mu          sync.Mutex
+	balances    map[string]*pkg.Balance
+	markets     map[string]*market
+	orders      []*order
+	fills       []*Fill
+	lastOrderID int64
+	lastTradeID int64
+}
+
+// Fill is execution of order of the account.
+type Fill struct {
+	Symbol          string
+	TradeID         int64
+	OrderID         int64
+	Side            pkg.OrderSide
+	Price           float64
+	Qty             float64
+	QuoteQty        float64
+	Commission      float64
+	CommissionAsset string
+	Time            time.Time
+	IsMaker         bool
+}
+
+// New creates Exchange with empty balances.
+func New(cfg Config) *Exchange {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Exchange{
+		cfg:      cfg,
+		balances: make(map[string]*pkg.Balance),
+		markets:  make(map[string]*market),
+	}
+}
+
+// assets returns base and quote asset of symbol. Symbols not configured in
+// Config.Symbols are split at well known quote asset.
+func (e *Exchange) assets(symbol string) (string, string, bool) {
+	if a, ok := e.cfg.Symbols[symbol]; ok {
+		return a[0], a[1], true
+	}
+	return internal.SplitSymbol(symbol)
+}
+
+// SetBalance sets free amount of asset. Locked amount is kept.
+func (e *Exchange) SetBalance(asset string, free float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.balance(asset).Free = free
+}
+
+// Balances returns balances of all assets ordered by asset.
+func (e *Exchange) Balances() []*pkg.Balance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sortedBalances()
+}
+
+func (e *Exchange) balance(asset string) *pkg.Balance {
+	b, ok := e.balances[asset]
+	if !ok {
+		b = &pkg.Balance{Asset: asset}
+		e.balances[asset] = b
+	}
+	return b
+}
+
+// sortedBalances returns copies of balances ordered by asset.
+func (e *Exchange) sortedBalances() []*pkg.Balance {
+	var balances []*pkg.Balance
+	for _, b := range e.balances {
+		c := *b
+		balances = append(balances, &c)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+	return balances
+}
+
+// Fills returns all fills of the account, oldest first.
+func (e *Exchange) Fills() []*Fill {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var fills []*Fill
+	for _, f := range e.fills {
+		c := *f
+		fills = append(fills, &c)
+	}
+	return fills
+}
+
+// LastPrice returns price of the last trade of symbol.
+func (e *Exchange) LastPrice(symbol string) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.markets[symbol]
+	if !ok || !m.hasLast {
+		return 0, false
+	}
+	return m.last, true
+}
+
+func (e *Exchange) publish(ude pkg.UserDataEvent) {
+	if e.cfg.Publish != nil {
+		e.cfg.Publish(ude)
+	}
+}
+
+// publishBalances sends outboundAccountPosition event with balances of
+// assets.
+func (e *Exchange) publishBalances(assets ...string) {
+	now := e.cfg.Now()
+	ape := &pkg.AccountPositionEvent{
+		WSEvent: pkg.WSEvent{
+			Type: "outboundAccountPosition",
+			Time: now,
+		},
+		LastUpdateTime: now,
+	}
+	sort.Strings(assets)
+	for _, a := range assets {
+		b := *e.balance(a)
+		ape.Balances = append(ape.Balances, &b)
+	}
+	e.publish(ape)
+}
+
+func apiError(code int, message string) error {
+	return &pkg.Error{Code: code, Message: message}
+}
+
+var (
+	errInvalidSymbol       = apiError(-1121, "Invalid symbol.")
+	errInsufficientBalance = apiError(-2010, "Account has insufficient balance for requested action.")
+	errUnknownOrder        = apiError(-2011, "Unknown order sent.")
+	errNoSuchOrder         = apiError(-2013, "Order does not exist.")
+	errOrderParams         = apiError(-1102, "Param 'origClientOrderId' or 'orderId' must be sent, but both were empty/null!")
+)
+
+func errMandatory(param string) error {
+	return apiError(-1102, "Mandatory parameter '"+param+"' was not sent, was empty/null, or malformed.")
+}
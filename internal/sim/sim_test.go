@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExchange(cfg Config) (*Exchange, *time.Time, *[]pkg.UserDataEvent) {
+	now := time.Unix(1600000000, 0)
+	var events []pkg.UserDataEvent
+	cfg.Now = func() time.Time { return now }
+	cfg.Publish = func(ude pkg.UserDataEvent) { events = append(events, ude) }
+	e := New(cfg)
+	e.SetBalance("BTC", 1)
+	e.SetBalance("BNB", 10)
+	e.UpdateBook("BNBBTC", 0.002, 5, 0.0021, 5)
+	e.UpdateTrade("BNBBTC", 0.00205, 1)
+	return e, &now, &events
+}
+
+func place(t *testing.T, e *Exchange, nor pkg.NewOrderRequest) *pkg.ExecutedOrder {
+	t.Helper()
+	nor.Symbol = "BNBBTC"
+	po, err := e.NewOrder(nor)
+	require.NoError(t, err)
+	eo, err := e.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrderID: po.OrderID})
+	require.NoError(t, err)
+	return eo
+}
+
+func TestStopOrders(t *testing.T) {
+	e, _, _ := newTestExchange(Config{})
+
+	_, err := e.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideSell, Type: pkg.TypeStopLoss, Quantity: 1, StopPrice: 0.0021})
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Stop price would trigger immediately."}, err)
+
+	stop := place(t, e, pkg.NewOrderRequest{Side: pkg.SideSell, Type: pkg.TypeStopLoss, Quantity: 1, StopPrice: 0.0019})
+	takeProfit := place(t, e, pkg.NewOrderRequest{Side: pkg.SideSell, Type: pkg.TypeTakeProfitLimit,
+		TimeInForce: pkg.GTC, Quantity: 1, StopPrice: 0.0025, Price: 0.0026})
+	e.UpdateBook("BNBBTC", 0.0018, 5, 0.0019, 5)
+	assert.Equal(t, pkg.StatusNew, e.orders[stop.OrderID-1].status)
+
+	e.UpdateTrade("BNBBTC", 0.0019, 1)
+	assert.Equal(t, pkg.StatusFilled, e.orders[stop.OrderID-1].status)
+	assert.Equal(t, 0.0018, e.fills[0].Price)
+
+	// Triggered take profit rests above the market.
+	e.UpdateBook("BNBBTC", 0.0025, 5, 0.00255, 5)
+	e.UpdateTrade("BNBBTC", 0.0025, 1)
+	assert.Equal(t, pkg.StatusNew, e.orders[takeProfit.OrderID-1].status)
+	e.UpdateTrade("BNBBTC", 0.0027, 1)
+	assert.Equal(t, pkg.StatusFilled, e.orders[takeProfit.OrderID-1].status)
+	assert.Equal(t, 0.0026, e.fills[1].Price)
+	assert.True(t, e.fills[1].IsMaker)
+}
+
+func TestTimeInForce(t *testing.T) {
+	e, _, _ := newTestExchange(Config{PartialFills: true})
+
+	_, err := e.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideBuy, Type: pkg.TypeLimitMaker, Quantity: 1, Price: 0.0021})
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Order would immediately match and take."}, err)
+
+	fok := place(t, e, pkg.NewOrderRequest{Side: pkg.SideBuy, Type: pkg.TypeLimit, TimeInForce: pkg.FOK, Quantity: 6, Price: 0.0021})
+	assert.Equal(t, pkg.StatusExpired, fok.Status)
+	ioc := place(t, e, pkg.NewOrderRequest{Side: pkg.SideBuy, Type: pkg.TypeLimit, TimeInForce: pkg.IOC, Quantity: 6, Price: 0.0021})
+	assert.Equal(t, pkg.StatusExpired, ioc.Status)
+	assert.Equal(t, 5.0, ioc.ExecutedQty)
+
+	b := e.Balances()
+	assert.Equal(t, "BNB", b[0].Asset)
+	assert.InDelta(t, 15, b[0].Free, 1e-12)
+	assert.InDelta(t, 1-5*0.0021, b[1].Free, 1e-12)
+	assert.Zero(t, b[1].Locked)
+}
+
+func TestLatency(t *testing.T) {
+	e, now, events := newTestExchange(Config{Latency: time.Second, TakerFee: 0.001})
+
+	maker := place(t, e, pkg.NewOrderRequest{Side: pkg.SideBuy, Type: pkg.TypeLimitMaker, Quantity: 1, Price: 0.00205})
+	market := place(t, e, pkg.NewOrderRequest{Side: pkg.SideBuy, Type: pkg.TypeMarket, Quantity: 1})
+	e.UpdateBook("BNBBTC", 0.0019, 5, 0.002, 5)
+	assert.Equal(t, pkg.StatusNew, e.orders[market.OrderID-1].status)
+
+	*now = now.Add(time.Second)
+	e.Match("BNBBTC")
+	// Book moved below the maker order while it was on its way.
+	assert.Equal(t, pkg.StatusExpired, e.orders[maker.OrderID-1].status)
+	assert.Equal(t, pkg.StatusFilled, e.orders[market.OrderID-1].status)
+	require.Len(t, e.fills, 1)
+	assert.Equal(t, 0.002, e.fills[0].Price)
+	assert.Equal(t, 0.001, e.fills[0].Commission)
+
+	var trade *pkg.ExecutionReportEvent
+	for _, ude := range *events {
+		if er, ok := ude.(*pkg.ExecutionReportEvent); ok && er.ExecutionType == pkg.ExecutionTrade {
+			trade = er
+		}
+	}
+	require.NotNil(t, trade)
+	assert.Equal(t, *now, trade.TransactionTime)
+}
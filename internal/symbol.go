@@ -0,0 +1,17 @@
+package internal
+
+import "strings"
+
+// quoteAssets are well known quote assets, longest first.
+var quoteAssets = []string{"FDUSD", "USDT", "USDC", "BUSD", "TUSD", "BTC", "ETH", "BNB", "EUR", "TRY"}
+
+// SplitSymbol returns base and quote asset of symbol quoted in well known
+// asset.
+func SplitSymbol(symbol string) (string, string, bool) {
+	for _, quote := range quoteAssets {
+		if strings.HasSuffix(symbol, quote) && len(symbol) > len(quote) {
+			return strings.TrimSuffix(symbol, quote), quote, true
+		}
+	}
+	return "", "", false
+}
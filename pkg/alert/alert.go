@@ -0,0 +1,454 @@
+// Package alert notifies about market conditions observed on streams of
+// pkg.Service.
+//
+// Rules pair symbol with declarative Condition. Engine subscribes streams
+// needed by its rules, shared by rules of the same symbol, and delivers
+// alerts of satisfied conditions to sinks:
+//
+//	engine := alert.New(ctx, service,
+//		alert.WithSink(alert.Webhook("https://example.com/hook", nil)),
+//		alert.WithRateLimit(10, time.Minute))
+//	defer engine.Close()
+//	err := engine.Add(
+//		alert.Rule{Name: "btc 70k", Symbol: "BTCUSDT", Condition: alert.CrossesAbove{Price: 70000}},
+//		alert.Rule{Name: "eth move", Symbol: "ETHBTC", Condition: alert.PercentChange{Window: 24 * time.Hour, Percent: 5}},
+//	)
+//
+// Conditions fire when they become satisfied, not while they stay so. Alerts
+// of the same rule are further suppressed for cooldown after the last one and
+// all alerts are subject to rate limit of the Engine.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// DefaultCooldown is minimal time between alerts of the same rule.
+const DefaultCooldown = time.Minute
+
+// resubscribeDelay is time waited before stopped stream is subscribed again.
+const resubscribeDelay = 5 * time.Second
+
+// bookLevel is depth of book streams watched for spreads.
+const bookLevel = 5
+
+// Alert is notification of satisfied condition.
+type Alert struct {
+	// Rule is name of the rule.
+	Rule   string `json:"rule"`
+	Symbol string `json:"symbol"`
+	// Message describes what happened.
+	Message string `json:"message"`
+	// Value is observed value of the condition: price, percent change,
+	// spread in basis points or volume.
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Rule is Condition watched on market of Symbol.
+type Rule struct {
+	// Name identifies the rule, it must be unique within Engine.
+	Name      string
+	Symbol    string
+	Condition Condition
+	// Cooldown is minimal time between alerts of the rule, engine's cooldown
+	// if zero.
+	Cooldown time.Duration
+}
+
+type rule struct {
+	Rule
+	source   stream
+	evaluate evaluator
+	lastSent time.Time
+}
+
+type streamKind int
+
+const (
+	tradeStream streamKind = iota
+	depthStream
+	klineStream
+)
+
+// stream identifies market stream evaluated by conditions.
+type stream struct {
+	kind     streamKind
+	symbol   string
+	interval pkg.Interval
+}
+
+func (s stream) String() string {
+	switch s.kind {
+	case depthStream:
+		return fmt.Sprintf("%s@depth%d", s.symbol, bookLevel)
+	case klineStream:
+		return fmt.Sprintf("%s@kline_%s", s.symbol, s.interval)
+	}
+	return s.symbol + "@aggTrade"
+}
+
+// feed is subscription of stream with rules evaluated on its events.
+type feed struct {
+	sub   *pkg.Subscription
+	rules []*rule
+}
+
+// Engine evaluates rules on market streams and notifies sinks.
+type Engine struct {
+	service  pkg.Service
+	logger   log.Logger
+	sinks    []Sink
+	cooldown time.Duration
+	limit    int
+	per      time.Duration
+	now      func() time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	rules   map[string]*rule
+	streams map[stream]*feed
+	sent    []time.Time
+	pending []*Alert
+	signal  chan struct{}
+}
+
+// Option configures Engine.
+type Option func(*Engine)
+
+// WithSink adds sink alerts are delivered to. Sinks are called one at a time
+// in order of alerts.
+func WithSink(s Sink) Option {
+	return func(e *Engine) {
+		e.sinks = append(e.sinks, s)
+	}
+}
+
+// WithCooldown sets minimal time between alerts of the same rule, see
+// DefaultCooldown.
+func WithCooldown(d time.Duration) Option {
+	return func(e *Engine) {
+		e.cooldown = d
+	}
+}
+
+// WithRateLimit limits alerts of all rules to n per period. Alerts over the
+// limit are dropped. There's no limit by default.
+func WithRateLimit(n int, per time.Duration) Option {
+	return func(e *Engine) {
+		e.limit = n
+		e.per = per
+	}
+}
+
+// WithLogger sets logger of stream and sink failures and dropped alerts.
+func WithLogger(logger log.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// New creates Engine watching streams of service. It runs until ctx is done
+// or Close is called.
+func New(ctx context.Context, service pkg.Service, opts ...Option) *Engine {
+	ctx, cancel := context.WithCancel(ctx)
+	e := &Engine{
+		service:  service,
+		logger:   log.NewNopLogger(),
+		cooldown: DefaultCooldown,
+		now:      time.Now,
+		ctx:      ctx,
+		cancel:   cancel,
+		rules:    make(map[string]*rule),
+		streams:  make(map[stream]*feed),
+		signal:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	go e.dispatch()
+	return e
+}
+
+// Close stops streams of the Engine. Alerts not yet delivered are dropped.
+func (e *Engine) Close() error {
+	e.cancel()
+	e.mu.Lock()
+	subs := make([]*pkg.Subscription, 0, len(e.streams))
+	for key, f := range e.streams {
+		subs = append(subs, f.sub)
+		delete(e.streams, key)
+	}
+	e.mu.Unlock()
+	// Handlers lock e.mu, so streams are closed without holding it.
+	for _, sub := range subs {
+		sub.Close()
+	}
+	return nil
+}
+
+// Add starts watching rules. Conditions over past data, like PercentChange
+// and VolumeSpike, are warmed up with klines of the symbol.
+func (e *Engine) Add(rules ...Rule) error {
+	for _, r := range rules {
+		if err := e.add(r); err != nil {
+			return errors.Wrapf(err, "unable to add rule %q", r.Name)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) add(r Rule) error {
+	switch {
+	case r.Name == "":
+		return errors.New("name is empty")
+	case r.Symbol == "":
+		return errors.New("symbol is empty")
+	case r.Condition == nil:
+		return errors.New("condition is nil")
+	}
+	e.mu.Lock()
+	_, exists := e.rules[r.Name]
+	e.mu.Unlock()
+	if exists {
+		return errors.New("rule already exists")
+	}
+	evaluate, err := r.Condition.start(e.service, r.Symbol, e.now())
+	if err != nil {
+		return err
+	}
+
+	rl := &rule{Rule: r, source: r.Condition.source(r.Symbol), evaluate: evaluate}
+	var sub *pkg.Subscription
+	for {
+		inserted, used, err := e.insert(rl, sub)
+		if sub != nil && !used {
+			sub.Close()
+		}
+		if err != nil || inserted {
+			return err
+		}
+		// Stream isn't watched yet. It's dialed without holding e.mu and
+		// the rule is inserted again, in case it was changed meanwhile.
+		if sub, err = e.subscribe(rl.source); err != nil {
+			return errors.Wrapf(err, "unable to subscribe %s", rl.source)
+		}
+	}
+}
+
+// insert adds rl to feed of its stream. If the stream isn't watched, the
+// feed is created with sub and used reports it, unless sub is nil, in which
+// case rl isn't inserted.
+func (e *Engine) insert(rl *rule, sub *pkg.Subscription) (inserted, used bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ctx.Err() != nil {
+		return false, false, errors.New("alert engine closed")
+	}
+	if _, ok := e.rules[rl.Name]; ok {
+		return false, false, errors.New("rule already exists")
+	}
+	f, ok := e.streams[rl.source]
+	if !ok {
+		if sub == nil {
+			return false, false, nil
+		}
+		f = &feed{sub: sub}
+		e.streams[rl.source] = f
+		go e.watch(rl.source, f)
+		used = true
+	}
+	f.rules = append(f.rules, rl)
+	e.rules[rl.Name] = rl
+	return true, used, nil
+}
+
+// Remove stops watching rule of name. Streams no longer needed by any rule
+// are closed.
+func (e *Engine) Remove(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rl, ok := e.rules[name]
+	if !ok {
+		return
+	}
+	delete(e.rules, name)
+	f := e.streams[rl.source]
+	for i, other := range f.rules {
+		if other == rl {
+			f.rules = append(f.rules[:i:i], f.rules[i+1:]...)
+			break
+		}
+	}
+	if len(f.rules) == 0 {
+		delete(e.streams, rl.source)
+		go f.sub.Close()
+	}
+}
+
+func (e *Engine) subscribe(key stream) (*pkg.Subscription, error) {
+	h := pkg.StreamHandler{
+		OnError: func(err error) {
+			level.Error(e.logger).Log("alert", "stream", "stream", key, "err", err)
+		},
+	}
+	switch key.kind {
+	case tradeStream:
+		h.OnTrade = func(ate *pkg.AggTradeEvent) {
+			e.handle(key, ate)
+		}
+		return e.service.SubscribeTrade(pkg.TradeWebsocketRequest{Symbol: key.symbol}, h)
+	case depthStream:
+		h.OnDepth = func(de *pkg.DepthEvent) {
+			e.handle(key, de)
+		}
+		return e.service.SubscribeDepth(pkg.DepthWebsocketRequest{
+			Symbol:      key.symbol,
+			Level:       bookLevel,
+			UpdateSpeed: 100 * time.Millisecond,
+		}, h)
+	default:
+		h.OnKline = func(ke *pkg.KlineEvent) {
+			e.handle(key, ke)
+		}
+		return e.service.SubscribeKline(pkg.KlineWebsocketRequest{Symbol: key.symbol, Interval: key.interval}, h)
+	}
+}
+
+// watch subscribes stream of f again once its subscription stops, until
+// the stream is removed.
+func (e *Engine) watch(key stream, f *feed) {
+	for {
+		select {
+		case <-f.sub.Done():
+		case <-e.ctx.Done():
+			return
+		}
+		e.mu.Lock()
+		current := e.streams[key]
+		e.mu.Unlock()
+		if current != f {
+			return
+		}
+		level.Error(e.logger).Log("alert", "stream stopped", "stream", key, "err", f.sub.Err())
+
+		for {
+			select {
+			case <-time.After(resubscribeDelay):
+			case <-e.ctx.Done():
+				return
+			}
+			e.mu.Lock()
+			current := e.streams[key] == f
+			e.mu.Unlock()
+			if !current {
+				return
+			}
+			sub, err := e.subscribe(key)
+			if err != nil {
+				level.Error(e.logger).Log("alert", "subscribe", "stream", key, "err", err)
+				continue
+			}
+			e.mu.Lock()
+			current = e.streams[key] == f
+			if current {
+				f.sub = sub
+			}
+			e.mu.Unlock()
+			if !current {
+				sub.Close()
+				return
+			}
+			break
+		}
+	}
+}
+
+// handle evaluates rules of stream key on event and queues their alerts.
+func (e *Engine) handle(key stream, event interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f, ok := e.streams[key]
+	if !ok {
+		return
+	}
+	for _, rl := range f.rules {
+		value, message, fired := rl.evaluate(event)
+		if !fired {
+			continue
+		}
+		now := e.now()
+		cooldown := rl.Cooldown
+		if cooldown == 0 {
+			cooldown = e.cooldown
+		}
+		if !rl.lastSent.IsZero() && now.Sub(rl.lastSent) < cooldown {
+			level.Debug(e.logger).Log("alert", "cooldown", "rule", rl.Name, "message", message)
+			continue
+		}
+		if !e.allow(now) {
+			level.Warn(e.logger).Log("alert", "rate limited", "rule", rl.Name, "message", message)
+			continue
+		}
+		rl.lastSent = now
+		e.pending = append(e.pending, &Alert{
+			Rule:    rl.Name,
+			Symbol:  rl.Symbol,
+			Message: message,
+			Value:   value,
+			Time:    now,
+		})
+		select {
+		case e.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// allow records alert sent at now if it's within rate limit.
+func (e *Engine) allow(now time.Time) bool {
+	if e.limit <= 0 {
+		return true
+	}
+	i := 0
+	for i < len(e.sent) && now.Sub(e.sent[i]) >= e.per {
+		i++
+	}
+	e.sent = e.sent[i:]
+	if len(e.sent) >= e.limit {
+		return false
+	}
+	e.sent = append(e.sent, now)
+	return true
+}
+
+// dispatch delivers queued alerts to sinks in order.
+func (e *Engine) dispatch() {
+	for {
+		select {
+		case <-e.signal:
+		case <-e.ctx.Done():
+			return
+		}
+		e.mu.Lock()
+		alerts := e.pending
+		e.pending = nil
+		e.mu.Unlock()
+		for _, a := range alerts {
+			for _, s := range e.sinks {
+				if err := s.Notify(e.ctx, a); err != nil {
+					level.Error(e.logger).Log("alert", "notify", "rule", a.Rule, "err", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T, opts ...Option) (*binancetest.Server, *Engine, chan *Alert) {
+	srv := binancetest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddSymbol("BNBUSDT", "BNB", "USDT")
+	service := pkg.NewAPIService("", "", nil, nil, context.Background(), pkg.WithEnvironment(srv.Environment()))
+
+	alerts := make(chan *Alert, 10)
+	opts = append([]Option{WithSink(SinkFunc(func(ctx context.Context, a *Alert) error {
+		alerts <- a
+		return nil
+	}))}, opts...)
+	engine := New(context.Background(), service, opts...)
+	t.Cleanup(func() { engine.Close() })
+	return srv, engine, alerts
+}
+
+func next(t *testing.T, alerts chan *Alert) *Alert {
+	t.Helper()
+	select {
+	case a := <-alerts:
+		return a
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert not received")
+	}
+	return nil
+}
+
+func pushPrices(srv *binancetest.Server, prices ...float64) {
+	for _, p := range prices {
+		srv.PushAggTrade("BNBUSDT", &pkg.AggTrade{Price: p, Quantity: 1, Timestamp: time.Now()})
+	}
+}
+
+// clock is manually advanced time of Engine.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCrosses(t *testing.T) {
+	srv, engine, alerts := newTestEngine(t, WithCooldown(0))
+	require.NoError(t, engine.Add(
+		Rule{Name: "above", Symbol: "BNBUSDT", Condition: CrossesAbove{Price: 100}},
+		Rule{Name: "below", Symbol: "BNBUSDT", Condition: CrossesBelow{Price: 90}},
+	))
+
+	pushPrices(srv, 95, 101, 102, 89)
+	a := next(t, alerts)
+	assert.Equal(t, "above", a.Rule)
+	assert.Equal(t, "BNBUSDT", a.Symbol)
+	assert.Equal(t, 101.0, a.Value)
+	assert.Equal(t, "BNBUSDT crossed above 100 at 101", a.Message)
+	a = next(t, alerts)
+	assert.Equal(t, "below", a.Rule)
+	assert.Equal(t, 89.0, a.Value)
+
+	err := engine.Add(Rule{Name: "above", Symbol: "BNBUSDT", Condition: CrossesBelow{Price: 80}})
+	assert.EqualError(t, err, `unable to add rule "above": rule already exists`)
+	assert.Error(t, engine.Add(Rule{Name: "no symbol", Condition: CrossesBelow{Price: 80}}))
+
+	engine.Remove("below")
+	pushPrices(srv, 91, 88, 101)
+	assert.Equal(t, "above", next(t, alerts).Rule)
+}
+
+func TestCloseWhileHandlerWaits(t *testing.T) {
+	srv, engine, _ := newTestEngine(t)
+	require.NoError(t, engine.Add(Rule{Name: "above", Symbol: "BNBUSDT", Condition: CrossesAbove{Price: 100}}))
+
+	// Close and then handler of the pushed trade wait for the lock held
+	// here, so Close gets it while the handler is running.
+	engine.mu.Lock()
+	closed := make(chan struct{})
+	go func() {
+		engine.Close()
+		close(closed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	pushPrices(srv, 101)
+	time.Sleep(50 * time.Millisecond)
+	engine.mu.Unlock()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine not closed")
+	}
+}
+
+// waitLog waits for log entry with value.
+func waitLog(t *testing.T, logs chan []interface{}, value string) {
+	t.Helper()
+	for {
+		select {
+		case keyvals := <-logs:
+			for _, v := range keyvals {
+				if v == value {
+					return
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not logged", value)
+		}
+	}
+}
+
+func TestCooldownAndRateLimit(t *testing.T) {
+	c := &clock{now: time.Now()}
+	logs := make(chan []interface{}, 10)
+	logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+		logs <- keyvals
+		return nil
+	})
+	srv, engine, alerts := newTestEngine(t, WithRateLimit(2, time.Minute), WithLogger(logger))
+	engine.now = c.Now
+	require.NoError(t, engine.Add(
+		Rule{Name: "above", Symbol: "BNBUSDT", Condition: CrossesAbove{Price: 100}, Cooldown: time.Hour},
+		Rule{Name: "below", Symbol: "BNBUSDT", Condition: CrossesBelow{Price: 100}, Cooldown: time.Second},
+	))
+
+	pushPrices(srv, 99, 101, 99)
+	assert.Equal(t, 101.0, next(t, alerts).Value)
+	assert.Equal(t, 99.0, next(t, alerts).Value)
+	c.Add(2 * time.Second)
+	// Above is in cooldown, below out of it but over rate limit.
+	pushPrices(srv, 101, 98)
+	waitLog(t, logs, "cooldown")
+	waitLog(t, logs, "rate limited")
+	c.Add(time.Minute)
+	pushPrices(srv, 101, 97)
+	a := next(t, alerts)
+	assert.Equal(t, "below", a.Rule)
+	assert.Equal(t, 97.0, a.Value)
+	c.Add(time.Hour)
+	pushPrices(srv, 102)
+	a = next(t, alerts)
+	assert.Equal(t, "above", a.Rule)
+	assert.Equal(t, 102.0, a.Value)
+}
+
+func TestPercentChange(t *testing.T) {
+	srv, engine, alerts := newTestEngine(t, WithCooldown(0))
+	now := time.Now()
+	for i := 10; i > 0; i-- {
+		open := now.Add(-time.Duration(i) * time.Minute).Truncate(time.Minute)
+		srv.AddKlines("BNBUSDT", pkg.Minute, &pkg.Kline{OpenTime: open, Open: 100, Close: 100})
+	}
+	require.NoError(t, engine.Add(
+		Rule{Name: "up", Symbol: "BNBUSDT", Condition: PercentChange{Window: 5 * time.Minute, Percent: 5}},
+		Rule{Name: "down", Symbol: "BNBUSDT", Condition: PercentChange{Window: 5 * time.Minute, Percent: -3}},
+	))
+
+	pushPrices(srv, 104, 106)
+	a := next(t, alerts)
+	assert.Equal(t, "up", a.Rule)
+	assert.InDelta(t, 6, a.Value, 1e-9)
+	assert.Equal(t, "BNBUSDT changed 6.00% over 5m0s to 106", a.Message)
+	// Fires again only once the change gets below threshold.
+	pushPrices(srv, 107, 96, 97, 98, 95)
+	a = next(t, alerts)
+	assert.Equal(t, "down", a.Rule)
+	assert.InDelta(t, -4, a.Value, 1e-9)
+	a = next(t, alerts)
+	assert.Equal(t, "down", a.Rule)
+	assert.InDelta(t, -5, a.Value, 1e-9)
+
+	assert.Error(t, engine.Add(Rule{Name: "zero", Symbol: "BNBUSDT", Condition: PercentChange{Percent: 1}}))
+}
+
+func TestPriceWindow(t *testing.T) {
+	start := time.Date(2020, 9, 13, 0, 0, 0, 0, time.UTC)
+	w := &priceWindow{window: time.Minute}
+	w.add(start, 1)
+	w.add(start.Add(500*time.Millisecond), 2)
+	assert.Len(t, w.samples, 1)
+	w.add(start.Add(30*time.Second), 3)
+	w.add(start.Add(time.Minute), 4)
+	assert.Equal(t, 2.0, w.open())
+	w.add(start.Add(80*time.Second), 5)
+	assert.Equal(t, 2.0, w.open())
+	w.add(start.Add(95*time.Second), 5)
+	assert.Equal(t, 3.0, w.open())
+	w.add(start.Add(5*time.Minute), 6)
+	assert.Equal(t, 5.0, w.open())
+	assert.Len(t, w.samples, 2)
+}
+
+func TestSpreadWidening(t *testing.T) {
+	srv, engine, alerts := newTestEngine(t, WithCooldown(0))
+	require.NoError(t, engine.Add(Rule{Name: "spread", Symbol: "BNBUSDT", Condition: SpreadWidening{BasisPoints: 50}}))
+
+	var levels [2]float64
+	book := func(bid, ask float64) {
+		// Remove the previous levels.
+		srv.PushDepth("BNBUSDT", []*pkg.Order{{Price: levels[0]}}, []*pkg.Order{{Price: levels[1]}})
+		srv.PushDepth("BNBUSDT", []*pkg.Order{{Price: bid, Quantity: 1}}, []*pkg.Order{{Price: ask, Quantity: 1}})
+		levels = [2]float64{bid, ask}
+	}
+	book(99.9, 100.1)
+	book(99.5, 100.5)
+	a := next(t, alerts)
+	assert.Equal(t, "spread", a.Rule)
+	assert.InDelta(t, 100, a.Value, 1e-9)
+	book(99.4, 100.6)
+	book(99.9, 100.1)
+	book(99.7, 100.3)
+	assert.InDelta(t, 60, next(t, alerts).Value, 1e-9)
+}
+
+func TestVolumeSpike(t *testing.T) {
+	srv, engine, alerts := newTestEngine(t, WithCooldown(0))
+	start := time.Now().Truncate(time.Minute).Add(-3 * time.Minute)
+	kline := func(i int, volume float64) *pkg.Kline {
+		open := start.Add(time.Duration(i) * time.Minute)
+		return &pkg.Kline{OpenTime: open, CloseTime: open.Add(time.Minute - time.Millisecond), Volume: volume}
+	}
+	srv.AddKlines("BNBUSDT", pkg.Minute, kline(0, 10), kline(1, 20), kline(2, 30))
+	require.NoError(t, engine.Add(Rule{
+		Name:      "volume",
+		Symbol:    "BNBUSDT",
+		Condition: VolumeSpike{Interval: pkg.Minute, Periods: 2, Multiple: 3},
+	}))
+
+	// Average of 20 and 30.
+	srv.PushKline("BNBUSDT", pkg.Minute, kline(3, 50), false)
+	srv.PushKline("BNBUSDT", pkg.Minute, kline(3, 75), false)
+	srv.PushKline("BNBUSDT", pkg.Minute, kline(3, 80), true)
+	a := next(t, alerts)
+	assert.Equal(t, 75.0, a.Value)
+	assert.Equal(t, "BNBUSDT 1m volume 75 is 3.0 times average of 2 klines", a.Message)
+	// Average of 30 and 80.
+	srv.PushKline("BNBUSDT", pkg.Minute, kline(4, 160), true)
+	srv.PushKline("BNBUSDT", pkg.Minute, kline(5, 400), true)
+	assert.Equal(t, 400.0, next(t, alerts).Value)
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan *Alert, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var a Alert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&a))
+		received <- &a
+	}))
+	defer hook.Close()
+	srv, engine, _ := newTestEngine(t, WithSink(Webhook(hook.URL, nil)))
+	require.NoError(t, engine.Add(Rule{Name: "above", Symbol: "BNBUSDT", Condition: CrossesAbove{Price: 100}}))
+
+	pushPrices(srv, 99, 100)
+	select {
+	case a := <-received:
+		assert.Equal(t, "above", a.Rule)
+		assert.Equal(t, "BNBUSDT", a.Symbol)
+		assert.Equal(t, 100.0, a.Value)
+		assert.False(t, a.Time.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	err := Webhook(failing.URL, nil).Notify(context.Background(), &Alert{Rule: "above"})
+	assert.EqualError(t, err, "webhook responded with 503 Service Unavailable")
+}
@@ -0,0 +1,250 @@
+package alert
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Condition is declarative condition of market, one of CrossesAbove,
+// CrossesBelow, PercentChange, SpreadWidening and VolumeSpike.
+type Condition interface {
+	// source returns stream the condition is evaluated on.
+	source(symbol string) stream
+	// start returns evaluator of the condition on market of symbol, warmed
+	// up with history before now.
+	start(service pkg.Service, symbol string, now time.Time) (evaluator, error)
+}
+
+// evaluator is called with events of condition's stream. It returns
+// observed value, its description and whether the condition fired.
+type evaluator func(event interface{}) (value float64, message string, fired bool)
+
+// edge fires when condition becomes satisfied.
+type edge bool
+
+func (e *edge) next(satisfied bool) bool {
+	fired := satisfied && !bool(*e)
+	*e = edge(satisfied)
+	return fired
+}
+
+// CrossesAbove fires when trade price rises from below Price to Price or
+// above.
+type CrossesAbove struct {
+	Price float64
+}
+
+func (c CrossesAbove) source(symbol string) stream {
+	return stream{kind: tradeStream, symbol: symbol}
+}
+
+func (c CrossesAbove) start(service pkg.Service, symbol string, now time.Time) (evaluator, error) {
+	prev := math.NaN()
+	return func(event interface{}) (float64, string, bool) {
+		price := event.(*pkg.AggTradeEvent).Price
+		fired := prev < c.Price && price >= c.Price
+		prev = price
+		return price, fmt.Sprintf("%s crossed above %v at %v", symbol, c.Price, price), fired
+	}, nil
+}
+
+// CrossesBelow fires when trade price falls from above Price to Price or
+// below.
+type CrossesBelow struct {
+	Price float64
+}
+
+func (c CrossesBelow) source(symbol string) stream {
+	return stream{kind: tradeStream, symbol: symbol}
+}
+
+func (c CrossesBelow) start(service pkg.Service, symbol string, now time.Time) (evaluator, error) {
+	prev := math.NaN()
+	return func(event interface{}) (float64, string, bool) {
+		price := event.(*pkg.AggTradeEvent).Price
+		fired := prev > c.Price && price <= c.Price
+		prev = price
+		return price, fmt.Sprintf("%s crossed below %v at %v", symbol, c.Price, price), fired
+	}, nil
+}
+
+// PercentChange fires when trade price changes by Percent over Window:
+// rises by at least Percent if it's positive, falls by at least -Percent if
+// it's negative. Prices over Window are warmed up with klines.
+type PercentChange struct {
+	Window  time.Duration
+	Percent float64
+}
+
+// warmupIntervals are kline intervals prices are warmed up with, the finest
+// one covering window with single request is used.
+var warmupIntervals = []pkg.Interval{
+	pkg.Minute, pkg.FiveMinutes, pkg.FifteenMinutes, pkg.Hour, pkg.FourHours, pkg.Day,
+}
+
+// maxKlines is limit of klines returned by single request.
+const maxKlines = 1000
+
+type sample struct {
+	time  time.Time
+	price float64
+}
+
+// priceWindow holds prices over window, sampled at most once a second, with
+// the last one before window being its opening price.
+type priceWindow struct {
+	window  time.Duration
+	samples []sample
+}
+
+func (w *priceWindow) add(t time.Time, price float64) {
+	if n := len(w.samples); n > 0 && t.Sub(w.samples[n-1].time) < time.Second {
+		w.samples[n-1].price = price
+	} else {
+		w.samples = append(w.samples, sample{time: t, price: price})
+	}
+	cutoff := t.Add(-w.window)
+	i := 0
+	for i+1 < len(w.samples) && !w.samples[i+1].time.After(cutoff) {
+		i++
+	}
+	w.samples = w.samples[i:]
+}
+
+func (w *priceWindow) open() float64 {
+	return w.samples[0].price
+}
+
+func (c PercentChange) source(symbol string) stream {
+	return stream{kind: tradeStream, symbol: symbol}
+}
+
+func (c PercentChange) start(service pkg.Service, symbol string, now time.Time) (evaluator, error) {
+	if c.Window <= 0 {
+		return nil, errors.New("window must be positive")
+	}
+	w := &priceWindow{window: c.Window}
+	interval := warmupIntervals[len(warmupIntervals)-1]
+	for _, i := range warmupIntervals {
+		if c.Window/i.Duration() <= maxKlines {
+			interval = i
+			break
+		}
+	}
+	klines, err := service.Klines(pkg.KlinesRequest{
+		Symbol:    symbol,
+		Interval:  interval,
+		StartTime: now.Add(-c.Window).UnixNano() / int64(time.Millisecond),
+		Limit:     maxKlines,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to warm up prices")
+	}
+	for _, k := range klines {
+		w.add(k.OpenTime, k.Open)
+	}
+
+	var satisfied edge
+	return func(event interface{}) (float64, string, bool) {
+		ate := event.(*pkg.AggTradeEvent)
+		w.add(ate.Timestamp, ate.Price)
+		change := (ate.Price - w.open()) / w.open() * 100
+		fired := satisfied.next((c.Percent >= 0 && change >= c.Percent) || (c.Percent < 0 && change <= c.Percent))
+		return change, fmt.Sprintf("%s changed %.2f%% over %s to %v", symbol, change, c.Window, ate.Price), fired
+	}, nil
+}
+
+// SpreadWidening fires when spread between the best bid and ask widens to
+// BasisPoints of their midpoint or more.
+type SpreadWidening struct {
+	BasisPoints float64
+}
+
+func (c SpreadWidening) source(symbol string) stream {
+	return stream{kind: depthStream, symbol: symbol}
+}
+
+func (c SpreadWidening) start(service pkg.Service, symbol string, now time.Time) (evaluator, error) {
+	var satisfied edge
+	return func(event interface{}) (float64, string, bool) {
+		de := event.(*pkg.DepthEvent)
+		if len(de.Bids) == 0 || len(de.Asks) == 0 {
+			return 0, "", false
+		}
+		bid, ask := de.Bids[0].Price, de.Asks[0].Price
+		spread := (ask - bid) / ((ask + bid) / 2) * 10000
+		fired := satisfied.next(spread >= c.BasisPoints)
+		return spread, fmt.Sprintf("%s spread widened to %.2f bps, %v/%v", symbol, spread, bid, ask), fired
+	}, nil
+}
+
+// VolumeSpike fires when volume of kline of Interval reaches Multiple of
+// average volume of Periods preceding klines, at most once per kline.
+// Average is warmed up with klines.
+type VolumeSpike struct {
+	Interval pkg.Interval
+	Periods  int
+	Multiple float64
+}
+
+func (c VolumeSpike) source(symbol string) stream {
+	return stream{kind: klineStream, symbol: symbol, interval: c.Interval}
+}
+
+func (c VolumeSpike) start(service pkg.Service, symbol string, now time.Time) (evaluator, error) {
+	if c.Periods <= 0 {
+		return nil, errors.New("periods must be positive")
+	}
+	klines, err := service.Klines(pkg.KlinesRequest{
+		Symbol:   symbol,
+		Interval: c.Interval,
+		Limit:    c.Periods + 1,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to warm up volumes")
+	}
+	var volumes []float64
+	var last, fired time.Time
+	add := func(openTime time.Time, volume float64) {
+		if !openTime.After(last) {
+			return
+		}
+		volumes = append(volumes, volume)
+		if len(volumes) > c.Periods {
+			volumes = volumes[1:]
+		}
+		last = openTime
+	}
+	for _, k := range klines {
+		if !k.CloseTime.After(now) {
+			add(k.OpenTime, k.Volume)
+		}
+	}
+
+	return func(event interface{}) (float64, string, bool) {
+		ke := event.(*pkg.KlineEvent)
+		defer func() {
+			if ke.Final {
+				add(ke.OpenTime, ke.Volume)
+			}
+		}()
+		if len(volumes) < c.Periods || fired.Equal(ke.OpenTime) {
+			return ke.Volume, "", false
+		}
+		average := 0.0
+		for _, v := range volumes {
+			average += v
+		}
+		average /= float64(len(volumes))
+		if average == 0 || ke.Volume < c.Multiple*average {
+			return ke.Volume, "", false
+		}
+		fired = ke.OpenTime
+		return ke.Volume, fmt.Sprintf("%s %s volume %v is %.1f times average of %d klines",
+			symbol, c.Interval, ke.Volume, ke.Volume/average, c.Periods), true
+	}, nil
+}
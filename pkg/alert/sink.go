@@ -0,0 +1,71 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// Sink delivers alerts.
+type Sink interface {
+	Notify(ctx context.Context, a *Alert) error
+}
+
+// SinkFunc is function used as Sink, e.g. callback of the application.
+type SinkFunc func(ctx context.Context, a *Alert) error
+
+// Notify calls f.
+func (f SinkFunc) Notify(ctx context.Context, a *Alert) error {
+	return f(ctx, a)
+}
+
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+// Webhook returns Sink posting alerts as JSON objects to url. Responses with
+// other than 2xx status are reported as errors. Nil client means
+// http.DefaultClient.
+func Webhook(url string, client *http.Client) Sink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhook{url: url, client: client}
+}
+
+func (w *webhook) Notify(ctx context.Context, a *Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal alert")
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "unable to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "webhook request failed")
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Errorf("webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+// Log returns Sink logging alerts at info level.
+func Log(logger log.Logger) Sink {
+	return SinkFunc(func(ctx context.Context, a *Alert) error {
+		return level.Info(logger).Log("alert", a.Rule, "symbol", a.Symbol, "value", a.Value, "message", a.Message)
+	})
+}
@@ -0,0 +1,843 @@
+// Package backtest replays market history through pkg.Service.
+//
+// Engine serves market data calls as of its simulated clock, drives kline and
+// trade streams from stored Data and fills orders of a simulated account at
+// historical prices. Strategy subscribes to streams of the Engine before Run
+// and trades from its handlers, the same way it would against the real
+// exchange:
+//
+//	engine := backtest.New(data,
+//		backtest.WithBalance("USDT", 1000),
+//		backtest.WithFees(0.001, 0.001),
+//		backtest.WithSlippage(backtest.FixedSlippage(5)))
+//	engine.SubscribeKline(pkg.KlineWebsocketRequest{Symbol: "BNBUSDT", Interval: pkg.Hour},
+//		pkg.StreamHandler{OnKline: strategy.OnKline})
+//	report, err := engine.Run(ctx)
+//
+// Handlers given to Subscribe methods run synchronously: the clock doesn't
+// move until they return, so results don't depend on scheduling. Only they
+// make runs deterministic. Channels of Websocket methods are unbuffered and
+// the clock moves as soon as the event is received, not when the consumer is
+// done with it: calls made after receiving an event happen before the next
+// event of the channel is received, but may already see prices of the next
+// step.
+//
+// Klines are replayed at their close time. Unless there are trades of the
+// symbol, prices move along klines of the shortest interval, from open through
+// the nearer extreme and the other extreme to close, each step trading quarter
+// of the volume. Order book isn't stored, it's synthesized at the last price.
+package backtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/internal"
+	"github.com/retirero/go-binance/internal/sim"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// ListenKey is listen key of the only user data stream of Engine.
+const ListenKey = "backtest"
+
+// DefaultSampleInterval is default interval of equity curve samples.
+const DefaultSampleInterval = time.Hour
+
+var (
+	errInvalidSymbol = &pkg.Error{Code: -1121, Message: "Invalid symbol."}
+	errNoDepth       = errors.New("depth streams are not supported by backtest")
+)
+
+// SlippageModel returns execution price of taker fill of qty at quoted
+// price.
+type SlippageModel func(side pkg.OrderSide, price, qty float64) float64
+
+// FixedSlippage moves execution price against taker by bps basis points.
+func FixedSlippage(bps float64) SlippageModel {
+	return func(side pkg.OrderSide, price, qty float64) float64 {
+		if side == pkg.SideBuy {
+			return price * (1 + bps/10000)
+		}
+		return price * (1 - bps/10000)
+	}
+}
+
+// Engine is pkg.Service replaying market history.
+type Engine struct {
+	data           *Data
+	cfg            sim.Config
+	balances       map[string]float64
+	quoteAsset     string
+	sampleInterval time.Duration
+	start          time.Time
+	end            time.Time
+	ex             *sim.Exchange
+	events         []*event
+	// done is closed when Run finishes, releasing stream channels.
+	done chan struct{}
+
+	clockMu sync.RWMutex
+	now     time.Time
+
+	mu        sync.Mutex
+	prices    map[string]float64
+	qtys      map[string]float64
+	subs      []*subscriber
+	ran       bool
+	equity    []EquityPoint
+	nextPoint time.Time
+
+	// pendingMu guards pending separately, as exchange publishes events
+	// with its lock held.
+	pendingMu sync.Mutex
+	pending   []pkg.UserDataEvent
+}
+
+// subscriber is stream subscribed to Engine.
+type subscriber struct {
+	symbol   string
+	interval pkg.Interval
+	trades   bool
+	userData bool
+	feed     *pkg.StreamFeed
+	sub      *pkg.Subscription
+	// ack is signalled when handler of delivered event returns.
+	ack chan struct{}
+}
+
+// Option configures Engine.
+type Option func(*Engine)
+
+// WithBalance sets initial free amount of asset.
+func WithBalance(asset string, free float64) Option {
+	return func(e *Engine) {
+		e.balances[asset] = free
+	}
+}
+
+// WithFees sets maker and taker commission rates, e.g. 0.001 for 0.1%.
+// Commission is charged in the received asset. There are no fees by default.
+func WithFees(maker, taker float64) Option {
+	return func(e *Engine) {
+		e.cfg.MakerFee = maker
+		e.cfg.TakerFee = taker
+	}
+}
+
+// WithSlippage sets model of taker execution prices. By default takers
+// execute at the last price.
+func WithSlippage(m SlippageModel) Option {
+	return func(e *Engine) {
+		e.cfg.Slippage = m
+	}
+}
+
+// WithLatency delays matching of new orders by d of simulated time.
+func WithLatency(d time.Duration) Option {
+	return func(e *Engine) {
+		e.cfg.Latency = d
+	}
+}
+
+// WithPartialFills limits fills by traded quantity. Orders placed between
+// price steps, e.g. in kline handlers, then wait for the next step. Resting
+// order is credited with queueShare of quantity traded exactly at its price.
+func WithPartialFills(queueShare float64) Option {
+	return func(e *Engine) {
+		e.cfg.PartialFills = true
+		e.cfg.QueueShare = queueShare
+	}
+}
+
+// WithSymbol sets base and quote asset of replayed symbol. Without it,
+// orders of symbol whose assets can't be told from the name are rejected and
+// its price isn't used to value equity.
+func WithSymbol(symbol, base, quote string) Option {
+	return func(e *Engine) {
+		e.cfg.Symbols[symbol] = [2]string{base, quote}
+	}
+}
+
+// WithQuoteAsset sets asset equity is valued in, USDT by default.
+func WithQuoteAsset(asset string) Option {
+	return func(e *Engine) {
+		e.quoteAsset = asset
+	}
+}
+
+// WithSampleInterval sets interval of equity curve samples.
+func WithSampleInterval(d time.Duration) Option {
+	return func(e *Engine) {
+		e.sampleInterval = d
+	}
+}
+
+// WithPeriod limits replay to history from start until end; zero values
+// don't limit it. Earlier history is still served by market data calls, e.g.
+// to warm indicators up.
+func WithPeriod(start, end time.Time) Option {
+	return func(e *Engine) {
+		e.start = start
+		e.end = end
+	}
+}
+
+// New creates Engine replaying data. Its clock is set to start of the
+// replayed period.
+func New(data *Data, opts ...Option) *Engine {
+	e := &Engine{
+		data:           data,
+		cfg:            sim.Config{Symbols: make(map[string][2]string)},
+		balances:       make(map[string]float64),
+		quoteAsset:     "USDT",
+		sampleInterval: DefaultSampleInterval,
+		done:           make(chan struct{}),
+		prices:         make(map[string]float64),
+		qtys:           make(map[string]float64),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.cfg.Now = e.clock
+	e.cfg.Publish = e.publish
+	e.ex = sim.New(e.cfg)
+	for asset, free := range e.balances {
+		e.ex.SetBalance(asset, free)
+	}
+
+	all := data.timeline()
+	if e.start.IsZero() && len(all) > 0 {
+		e.start = all[0].time
+		if k := all[0].kline; k != nil {
+			e.start = k.OpenTime
+		}
+	}
+	e.now = e.start
+	for _, ev := range all {
+		switch {
+		case ev.time.Before(e.start):
+			if ev.prices {
+				e.move(ev)
+			}
+		case e.end.IsZero() || ev.time.Before(e.end):
+			e.events = append(e.events, ev)
+		}
+	}
+	// Prices of symbols without earlier history open at the first price of
+	// the replayed period.
+	for _, ev := range e.events {
+		if _, ok := e.prices[ev.symbol]; ok || !ev.prices {
+			continue
+		}
+		var price float64
+		if ev.trade != nil {
+			price = ev.trade.Price
+		} else {
+			price = ev.kline.Open
+		}
+		e.prices[ev.symbol] = price
+		e.ex.UpdateTrade(ev.symbol, price, 0)
+	}
+	return e
+}
+
+func (e *Engine) clock() time.Time {
+	e.clockMu.RLock()
+	defer e.clockMu.RUnlock()
+	return e.now
+}
+
+// Run replays history, delivering events to subscribers, and reports
+// results of the account. Streams of the Engine stop when it returns. If ctx
+// is done, Run stops and returns its error.
+func (e *Engine) Run(ctx context.Context) (*Report, error) {
+	e.mu.Lock()
+	if e.ran {
+		e.mu.Unlock()
+		return nil, errors.New("backtest already ran")
+	}
+	e.ran = true
+	initial := e.valuation()
+	e.equity = []EquityPoint{{Time: e.start, Equity: initial}}
+	e.nextPoint = e.start.Add(e.sampleInterval)
+	e.mu.Unlock()
+	defer e.finish(ctx)
+
+	for _, ev := range e.events {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		e.sample(ev.time)
+		e.clockMu.Lock()
+		e.now = ev.time
+		e.clockMu.Unlock()
+		if ev.prices {
+			e.move(ev)
+			e.flush(ctx)
+		}
+		e.deliver(ctx, ev)
+		e.flush(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	end := e.clock()
+	e.sample(end)
+	e.mu.Lock()
+	if last := e.equity[len(e.equity)-1]; last.Time.Before(end) {
+		e.equity = append(e.equity, EquityPoint{Time: end, Equity: e.valuation()})
+	}
+	equity := e.equity
+	e.mu.Unlock()
+	return newReport(e.start, end, e.quoteAsset, e.sampleInterval, equity, e.ex.Fills(), e.ex.Balances()), nil
+}
+
+// finish ends streams once Run returns.
+func (e *Engine) finish(ctx context.Context) {
+	close(e.done)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.subs {
+		s.feed.End(ctx.Err())
+	}
+}
+
+// move feeds prices of event to the exchange.
+func (e *Engine) move(ev *event) {
+	price, qty := 0.0, 0.0
+	if ev.trade != nil {
+		price, qty = ev.trade.Price, ev.trade.Quantity
+		e.ex.UpdateTrade(ev.symbol, price, qty)
+	} else {
+		qty = ev.kline.Volume / 4
+		for _, price = range path(ev.kline) {
+			e.ex.UpdateTrade(ev.symbol, price, qty)
+		}
+	}
+	e.mu.Lock()
+	e.prices[ev.symbol] = price
+	e.qtys[ev.symbol] = qty
+	e.mu.Unlock()
+}
+
+// sample records equity at sample times up to t.
+func (e *Engine) sample(t time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for !e.nextPoint.After(t) {
+		e.equity = append(e.equity, EquityPoint{Time: e.nextPoint, Equity: e.valuation()})
+		e.nextPoint = e.nextPoint.Add(e.sampleInterval)
+	}
+}
+
+// valuation returns value of balances in quote asset at the last prices.
+// Assets without market to the quote asset are not counted. It's called
+// with Engine locked.
+func (e *Engine) valuation() float64 {
+	total := 0.0
+	for _, b := range e.ex.Balances() {
+		total += (b.Free + b.Locked) * e.rate(b.Asset)
+	}
+	return total
+}
+
+func (e *Engine) rate(asset string) float64 {
+	if asset == e.quoteAsset {
+		return 1
+	}
+	for symbol, price := range e.prices {
+		base, quote, ok := e.assets(symbol)
+		switch {
+		case !ok:
+		case base == asset && quote == e.quoteAsset:
+			return price
+		case base == e.quoteAsset && quote == asset && price > 0:
+			return 1 / price
+		}
+	}
+	return 0
+}
+
+// assets returns base and quote asset of symbol.
+func (e *Engine) assets(symbol string) (string, string, bool) {
+	if a, ok := e.cfg.Symbols[symbol]; ok {
+		return a[0], a[1], true
+	}
+	return internal.SplitSymbol(symbol)
+}
+
+// deliver passes event to its subscribers, waiting for their handlers.
+func (e *Engine) deliver(ctx context.Context, ev *event) {
+	var payload interface{}
+	if ev.trade != nil {
+		payload = &pkg.AggTradeEvent{
+			WSEvent:  pkg.WSEvent{Type: "aggTrade", Time: ev.time, Symbol: ev.symbol},
+			AggTrade: *ev.trade,
+		}
+	} else {
+		k := *ev.kline
+		k.CloseTime = ev.time
+		payload = &pkg.KlineEvent{
+			WSEvent:  pkg.WSEvent{Type: "kline", Time: ev.time, Symbol: ev.symbol},
+			Interval: ev.interval,
+			Final:    true,
+			Kline:    k,
+		}
+	}
+	for _, s := range e.subscribers() {
+		if s.symbol == ev.symbol && s.trades == (ev.trade != nil) && s.interval == ev.interval {
+			e.send(ctx, s, payload)
+		}
+	}
+}
+
+// flush delivers user data events queued by the exchange, including those
+// caused by handlers of delivered events.
+func (e *Engine) flush(ctx context.Context) {
+	for {
+		e.pendingMu.Lock()
+		events := e.pending
+		e.pending = nil
+		e.pendingMu.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, ude := range events {
+			for _, s := range e.subscribers() {
+				if s.userData {
+					e.send(ctx, s, ude)
+				}
+			}
+		}
+	}
+}
+
+func (e *Engine) subscribers() []*subscriber {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*subscriber(nil), e.subs...)
+}
+
+func (e *Engine) send(ctx context.Context, s *subscriber, event interface{}) {
+	select {
+	case <-s.feed.Done():
+		return
+	default:
+	}
+	s.feed.Push("", event)
+	select {
+	case <-s.ack:
+	case <-s.feed.Done():
+	case <-ctx.Done():
+	}
+}
+
+// publish queues event of the exchange until the current step ends.
+func (e *Engine) publish(ude pkg.UserDataEvent) {
+	e.pendingMu.Lock()
+	defer e.pendingMu.Unlock()
+	e.pending = append(e.pending, ude)
+}
+
+func (e *Engine) subscribe(s *subscriber, opts pkg.StreamOptions, handle func(event interface{})) *pkg.Subscription {
+	s.ack = make(chan struct{}, 1)
+	s.feed, s.sub = pkg.NewStreamFeed(context.Background(), opts, func(event interface{}) {
+		handle(event)
+		select {
+		case s.ack <- struct{}{}:
+		default:
+		}
+	})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.done:
+		s.feed.End(nil)
+	default:
+		e.subs = append(e.subs, s)
+	}
+	return s.sub
+}
+
+// Ping does nothing.
+func (e *Engine) Ping() error {
+	return nil
+}
+
+// Time returns simulated time.
+func (e *Engine) Time() (time.Time, error) {
+	return e.clock(), nil
+}
+
+// OrderBook returns book synthesized at the last price of symbol, with
+// quantity of the last trade on both sides.
+func (e *Engine) OrderBook(obr pkg.OrderBookRequest) (*pkg.OrderBook, error) {
+	if !e.data.hasSymbol(obr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ob := &pkg.OrderBook{Bids: []*pkg.Order{}, Asks: []*pkg.Order{}}
+	if price, ok := e.prices[obr.Symbol]; ok {
+		ob.Bids = append(ob.Bids, &pkg.Order{Price: price, Quantity: e.qtys[obr.Symbol]})
+		ob.Asks = append(ob.Asks, &pkg.Order{Price: price, Quantity: e.qtys[obr.Symbol]})
+	}
+	return ob, nil
+}
+
+// AggTrades returns trades of symbol which happened until simulated time.
+func (e *Engine) AggTrades(atr pkg.AggTradesRequest) ([]*pkg.AggTrade, error) {
+	if !e.data.hasSymbol(atr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	now := e.clock()
+	limit := limitOrDefault(atr.Limit)
+	trades := []*pkg.AggTrade{}
+	for _, t := range e.data.AggTrades[atr.Symbol] {
+		if t.Timestamp.After(now) {
+			break
+		}
+		ts := internal.UnixMillis(t.Timestamp)
+		if int64(t.ID) < atr.FromID || (atr.StartTime != 0 && ts < atr.StartTime) || (atr.EndTime != 0 && ts > atr.EndTime) {
+			continue
+		}
+		if len(trades) == limit {
+			break
+		}
+		c := *t
+		trades = append(trades, &c)
+	}
+	return trades, nil
+}
+
+// Klines returns klines of symbol closed until simulated time.
+func (e *Engine) Klines(kr pkg.KlinesRequest) ([]*pkg.Kline, error) {
+	if !e.data.hasSymbol(kr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	now := e.clock()
+	klines := []*pkg.Kline{}
+	for _, k := range e.data.Klines[kr.Symbol][kr.Interval] {
+		ct := closeTime(k, kr.Interval)
+		if ct.After(now) {
+			break
+		}
+		ts := internal.UnixMillis(k.OpenTime)
+		if (kr.StartTime != 0 && ts < kr.StartTime) || (kr.EndTime != 0 && ts > kr.EndTime) {
+			continue
+		}
+		c := *k
+		c.CloseTime = ct
+		klines = append(klines, &c)
+	}
+	// Without StartTime the most recent klines are returned.
+	if limit := limitOrDefault(kr.Limit); len(klines) > limit {
+		if kr.StartTime != 0 {
+			klines = klines[:limit]
+		} else {
+			klines = klines[len(klines)-limit:]
+		}
+	}
+	return klines, nil
+}
+
+// Ticker24 returns statistics of symbol over 24 hours until simulated time,
+// computed from events driving its price.
+func (e *Engine) Ticker24(tr pkg.TickerRequest) (*pkg.Ticker24, error) {
+	if !e.data.hasSymbol(tr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	now := e.clock()
+	from := now.Add(-24 * time.Hour)
+	t := &pkg.Ticker24{OpenTime: from, CloseTime: now}
+	quoteVolume := 0.0
+	add := func(open, high, low, close, volume float64, ft time.Time) {
+		if t.Count == 0 {
+			t.OpenPrice, t.HighPrice, t.LowPrice = open, high, low
+			t.OpenTime = ft
+		}
+		if high > t.HighPrice {
+			t.HighPrice = high
+		}
+		if low < t.LowPrice {
+			t.LowPrice = low
+		}
+		t.LastPrice = close
+		t.Volume += volume
+		quoteVolume += volume * (high + low + close) / 3
+		t.Count++
+	}
+	if trades := e.data.AggTrades[tr.Symbol]; len(trades) > 0 {
+		for _, at := range trades {
+			if at.Timestamp.After(now) {
+				break
+			}
+			if at.Timestamp.After(from) {
+				add(at.Price, at.Price, at.Price, at.Price, at.Quantity, at.Timestamp)
+				if t.FirstID == 0 {
+					t.FirstID = at.ID
+				}
+				t.LastID = at.ID
+			}
+		}
+	} else {
+		interval := shortest(e.data.Klines[tr.Symbol])
+		for _, k := range e.data.Klines[tr.Symbol][interval] {
+			if closeTime(k, interval).After(now) {
+				break
+			}
+			if !k.OpenTime.Before(from) {
+				add(k.Open, k.High, k.Low, k.Close, k.Volume, k.OpenTime)
+			}
+		}
+	}
+	if t.Count > 0 {
+		t.PriceChange = t.LastPrice - t.OpenPrice
+		t.PriceChangePercent = t.PriceChange / t.OpenPrice * 100
+		if t.Volume > 0 {
+			t.WeightedAvgPrice = quoteVolume / t.Volume
+		}
+		t.BidPrice, t.AskPrice = t.LastPrice, t.LastPrice
+	}
+	return t, nil
+}
+
+func shortest(intervals map[pkg.Interval][]*pkg.Kline) pkg.Interval {
+	var s pkg.Interval
+	for interval := range intervals {
+		if s == "" || interval.Duration() < s.Duration() {
+			s = interval
+		}
+	}
+	return s
+}
+
+// TickerAllPrices returns the last prices of symbols.
+func (e *Engine) TickerAllPrices() ([]*pkg.PriceTicker, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var tickers []*pkg.PriceTicker
+	for symbol, price := range e.prices {
+		tickers = append(tickers, &pkg.PriceTicker{Symbol: symbol, Price: price})
+	}
+	sort.Slice(tickers, func(i, j int) bool {
+		return tickers[i].Symbol < tickers[j].Symbol
+	})
+	return tickers, nil
+}
+
+// TickerAllBooks returns books of symbols synthesized at the last prices.
+func (e *Engine) TickerAllBooks() ([]*pkg.BookTicker, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var tickers []*pkg.BookTicker
+	for symbol, price := range e.prices {
+		qty := e.qtys[symbol]
+		tickers = append(tickers, &pkg.BookTicker{Symbol: symbol, BidPrice: price, BidQty: qty, AskPrice: price, AskQty: qty})
+	}
+	sort.Slice(tickers, func(i, j int) bool {
+		return tickers[i].Symbol < tickers[j].Symbol
+	})
+	return tickers, nil
+}
+
+// NewOrder places simulated order.
+func (e *Engine) NewOrder(or pkg.NewOrderRequest) (*pkg.ProcessedOrder, error) {
+	if !e.data.hasSymbol(or.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	return e.ex.NewOrder(or)
+}
+
+// NewOrderTest validates order request like NewOrder without placing it.
+func (e *Engine) NewOrderTest(or pkg.NewOrderRequest) error {
+	if !e.data.hasSymbol(or.Symbol) {
+		return errInvalidSymbol
+	}
+	return e.ex.NewOrderTest(or)
+}
+
+// QueryOrder returns simulated order.
+func (e *Engine) QueryOrder(qor pkg.QueryOrderRequest) (*pkg.ExecutedOrder, error) {
+	return e.ex.QueryOrder(qor)
+}
+
+// CancelOrder cancels simulated order.
+func (e *Engine) CancelOrder(cor pkg.CancelOrderRequest) (*pkg.CanceledOrder, error) {
+	return e.ex.CancelOrder(cor)
+}
+
+// OpenOrders returns active simulated orders.
+func (e *Engine) OpenOrders(oor pkg.OpenOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	return e.ex.OpenOrders(oor)
+}
+
+// AllOrders returns simulated orders of symbol.
+func (e *Engine) AllOrders(aor pkg.AllOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	return e.ex.AllOrders(aor)
+}
+
+// Account returns simulated balances.
+func (e *Engine) Account(ar pkg.AccountRequest) (*pkg.Account, error) {
+	return e.ex.Account(ar)
+}
+
+// MyTrades returns fills of simulated orders.
+func (e *Engine) MyTrades(mtr pkg.MyTradesRequest) ([]*pkg.Trade, error) {
+	return e.ex.MyTrades(mtr)
+}
+
+// Withdraw fails, simulated funds can't be withdrawn.
+func (e *Engine) Withdraw(wr pkg.WithdrawRequest) (*pkg.WithdrawResult, error) {
+	return nil, errors.New("withdrawals are not supported by backtest")
+}
+
+// DepositHistory returns no deposits.
+func (e *Engine) DepositHistory(hr pkg.HistoryRequest) ([]*pkg.Deposit, error) {
+	return []*pkg.Deposit{}, nil
+}
+
+// WithdrawHistory returns no withdrawals.
+func (e *Engine) WithdrawHistory(hr pkg.HistoryRequest) ([]*pkg.Withdrawal, error) {
+	return []*pkg.Withdrawal{}, nil
+}
+
+// StartUserDataStream returns stream with ListenKey.
+func (e *Engine) StartUserDataStream() (*pkg.Stream, error) {
+	return &pkg.Stream{ListenKey: ListenKey}, nil
+}
+
+// KeepAliveUserDataStream does nothing.
+func (e *Engine) KeepAliveUserDataStream(s *pkg.Stream) error {
+	return nil
+}
+
+// CloseUserDataStream does nothing.
+func (e *Engine) CloseUserDataStream(s *pkg.Stream) error {
+	return nil
+}
+
+// DepthWebsocket fails, history has no order book.
+func (e *Engine) DepthWebsocket(dwr pkg.DepthWebsocketRequest) (chan *pkg.DepthEvent, chan struct{}, error) {
+	return nil, nil, errNoDepth
+}
+
+// KlineWebsocket streams klines of symbol and interval as they close. Unlike
+// SubscribeKline, it doesn't wait for the consumer to act on received kline.
+func (e *Engine) KlineWebsocket(kwr pkg.KlineWebsocketRequest) (chan *pkg.KlineEvent, chan struct{}, error) {
+	kech := make(chan *pkg.KlineEvent)
+	sub, err := e.SubscribeKline(kwr, pkg.StreamHandler{
+		OnKline: func(ke *pkg.KlineEvent) {
+			select {
+			case kech <- ke:
+			case <-e.done:
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return kech, doneChan(sub), nil
+}
+
+// TradeWebsocket streams trades of symbol. Unlike SubscribeTrade, it doesn't
+// wait for the consumer to act on received trade.
+func (e *Engine) TradeWebsocket(twr pkg.TradeWebsocketRequest) (chan *pkg.AggTradeEvent, chan struct{}, error) {
+	aech := make(chan *pkg.AggTradeEvent)
+	sub, err := e.SubscribeTrade(twr, pkg.StreamHandler{
+		OnTrade: func(ae *pkg.AggTradeEvent) {
+			select {
+			case aech <- ae:
+			case <-e.done:
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return aech, doneChan(sub), nil
+}
+
+// UserDataWebsocket streams simulated user data events. Unlike
+// SubscribeUserData, it doesn't wait for the consumer to act on received
+// event.
+func (e *Engine) UserDataWebsocket(udwr pkg.UserDataWebsocketRequest) (chan pkg.UserDataEvent, chan struct{}, error) {
+	udech := make(chan pkg.UserDataEvent)
+	sub, err := e.SubscribeUserData(udwr, pkg.StreamHandler{
+		OnUserData: func(ude pkg.UserDataEvent) {
+			select {
+			case udech <- ude:
+			case <-e.done:
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return udech, doneChan(sub), nil
+}
+
+func doneChan(sub *pkg.Subscription) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		<-sub.Done()
+		close(done)
+	}()
+	return done
+}
+
+// SubscribeDepth fails, history has no order book.
+func (e *Engine) SubscribeDepth(dwr pkg.DepthWebsocketRequest, h pkg.StreamHandler) (*pkg.Subscription, error) {
+	return nil, errNoDepth
+}
+
+// SubscribeKline calls h.OnKline with klines of symbol and interval as they
+// close.
+func (e *Engine) SubscribeKline(kwr pkg.KlineWebsocketRequest, h pkg.StreamHandler) (*pkg.Subscription, error) {
+	if !e.data.hasSymbol(kwr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	s := &subscriber{symbol: kwr.Symbol, interval: kwr.Interval}
+	return e.subscribe(s, kwr.StreamOptions, func(event interface{}) {
+		if h.OnKline != nil {
+			h.OnKline(event.(*pkg.KlineEvent))
+		}
+	}), nil
+}
+
+// SubscribeTrade calls h.OnTrade with trades of symbol.
+func (e *Engine) SubscribeTrade(twr pkg.TradeWebsocketRequest, h pkg.StreamHandler) (*pkg.Subscription, error) {
+	if !e.data.hasSymbol(twr.Symbol) {
+		return nil, errInvalidSymbol
+	}
+	s := &subscriber{symbol: twr.Symbol, trades: true}
+	return e.subscribe(s, twr.StreamOptions, func(event interface{}) {
+		if h.OnTrade != nil {
+			h.OnTrade(event.(*pkg.AggTradeEvent))
+		}
+	}), nil
+}
+
+// SubscribeUserData calls h.OnUserData with simulated user data events.
+func (e *Engine) SubscribeUserData(udwr pkg.UserDataWebsocketRequest, h pkg.StreamHandler) (*pkg.Subscription, error) {
+	if udwr.ListenKey != ListenKey {
+		return nil, errors.Errorf("unknown listen key %q", udwr.ListenKey)
+	}
+	s := &subscriber{userData: true}
+	return e.subscribe(s, udwr.StreamOptions, func(event interface{}) {
+		if h.OnUserData != nil {
+			h.OnUserData(event.(pkg.UserDataEvent))
+		}
+	}), nil
+}
+
+func limitOrDefault(limit int) int {
+	if limit <= 0 {
+		return 500
+	}
+	return limit
+}
@@ -0,0 +1,245 @@
+package backtest
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Unix(1600000000, 0)
+
+func testData() *Data {
+	d := NewData()
+	d.AddKlines("BNBUSDT", pkg.Minute,
+		&pkg.Kline{OpenTime: t0.Add(4 * time.Minute), Open: 10, High: 10, Low: 8, Close: 9, Volume: 100},
+		&pkg.Kline{OpenTime: t0, Open: 10, High: 11, Low: 9, Close: 10.5, Volume: 100},
+		&pkg.Kline{OpenTime: t0.Add(time.Minute), Open: 10.5, High: 12, Low: 10, Close: 11.5, Volume: 100},
+		&pkg.Kline{OpenTime: t0.Add(2 * time.Minute), Open: 11.5, High: 13, Low: 11, Close: 12, Volume: 100},
+		&pkg.Kline{OpenTime: t0.Add(3 * time.Minute), Open: 12, High: 12.5, Low: 10, Close: 10, Volume: 100},
+	)
+	return d
+}
+
+func TestRun(t *testing.T) {
+	engine := New(testData(),
+		WithBalance("USDT", 100),
+		WithFees(0, 0.001),
+		WithSampleInterval(time.Minute))
+	var service pkg.Service = engine
+
+	var reports []*pkg.ExecutionReportEvent
+	_, err := service.SubscribeUserData(pkg.UserDataWebsocketRequest{ListenKey: ListenKey}, pkg.StreamHandler{
+		OnUserData: func(ude pkg.UserDataEvent) {
+			if er, ok := ude.(*pkg.ExecutionReportEvent); ok && er.ExecutionType == pkg.ExecutionTrade {
+				reports = append(reports, er)
+			}
+		},
+	})
+	require.NoError(t, err)
+	var closes []float64
+	_, err = service.SubscribeKline(pkg.KlineWebsocketRequest{Symbol: "BNBUSDT", Interval: pkg.Minute}, pkg.StreamHandler{
+		OnKline: func(ke *pkg.KlineEvent) {
+			assert.True(t, ke.Final)
+			now, err := service.Time()
+			require.NoError(t, err)
+			assert.Equal(t, ke.CloseTime, now)
+			klines, err := service.Klines(pkg.KlinesRequest{Symbol: "BNBUSDT", Interval: pkg.Minute})
+			require.NoError(t, err)
+			assert.Len(t, klines, len(closes)+1)
+			closes = append(closes, ke.Close)
+			if len(closes) != 1 {
+				return
+			}
+
+			_, err = service.NewOrder(pkg.NewOrderRequest{Symbol: "BNBUSDT", Side: pkg.SideBuy, Type: pkg.TypeMarket, Quantity: 5})
+			require.NoError(t, err)
+			_, err = service.NewOrder(pkg.NewOrderRequest{
+				Symbol:      "BNBUSDT",
+				Side:        pkg.SideSell,
+				Type:        pkg.TypeLimit,
+				TimeInForce: pkg.GTC,
+				Quantity:    4.995,
+				Price:       12.8,
+			})
+			require.NoError(t, err)
+		},
+	})
+	require.NoError(t, err)
+
+	report, err := engine.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []float64{10.5, 11.5, 12, 10, 9}, closes)
+
+	require.Len(t, reports, 2)
+	assert.Equal(t, 10.5, reports[0].LastExecutedPrice)
+	assert.Equal(t, 12.8, reports[1].LastExecutedPrice)
+	assert.True(t, reports[1].IsMaker)
+	require.Len(t, report.Trades, 2)
+	assert.Equal(t, pkg.SideBuy, report.Trades[0].Side)
+	assert.Equal(t, 0.005, report.Trades[0].Commission)
+	assert.Equal(t, t0.Add(3*time.Minute-time.Millisecond), report.Trades[1].Time)
+
+	final := 100 - 52.5 + 4.995*12.8
+	assert.Equal(t, t0, report.Start)
+	assert.Equal(t, t0.Add(5*time.Minute-time.Millisecond), report.End)
+	assert.Equal(t, 100.0, report.InitialEquity)
+	assert.InDelta(t, final, report.FinalEquity, 1e-9)
+	assert.InDelta(t, final/100-1, report.Return, 1e-9)
+	require.Len(t, report.Equity, 6)
+	assert.InDelta(t, 47.5+4.995*10.5, report.Equity[1].Equity, 1e-9)
+	assert.InDelta(t, 47.5+4.995*11.5, report.Equity[2].Equity, 1e-9)
+	assert.InDelta(t, (100-(47.5+4.995*10.5))/100, report.MaxDrawdown, 1e-9)
+	assert.True(t, report.Sharpe > 0)
+
+	_, err = engine.Run(context.Background())
+	assert.Error(t, err)
+}
+
+func TestKlineWebsocket(t *testing.T) {
+	engine := New(testData(), WithBalance("USDT", 100))
+	var service pkg.Service = engine
+
+	klines, done, err := service.KlineWebsocket(pkg.KlineWebsocketRequest{Symbol: "BNBUSDT", Interval: pkg.Minute})
+	require.NoError(t, err)
+	received := make(chan int)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-klines:
+				n++
+				if n != 1 {
+					continue
+				}
+				// Order is placed before the next kline is received, so
+				// it's resting when price dips in the last kline.
+				_, err := service.NewOrder(pkg.NewOrderRequest{
+					Symbol:      "BNBUSDT",
+					Side:        pkg.SideBuy,
+					Type:        pkg.TypeLimit,
+					TimeInForce: pkg.GTC,
+					Quantity:    2,
+					Price:       9.5,
+				})
+				assert.NoError(t, err)
+			case <-done:
+				received <- n
+				return
+			}
+		}
+	}()
+
+	report, err := engine.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 5, <-received)
+	require.Len(t, report.Trades, 1)
+	assert.Equal(t, 9.5, report.Trades[0].Price)
+	assert.True(t, report.Trades[0].IsMaker)
+	assert.Equal(t, t0.Add(5*time.Minute-time.Millisecond), report.Trades[0].Time)
+}
+
+func TestMarketData(t *testing.T) {
+	d := testData()
+	d.AddKlines("BNBUSDT", pkg.FiveMinutes, &pkg.Kline{OpenTime: t0, Open: 10, High: 13, Low: 8, Close: 9, Volume: 500})
+	engine := New(d, WithPeriod(t0.Add(2*time.Minute), time.Time{}))
+
+	// History before the period is served, but not replayed.
+	klines, err := engine.Klines(pkg.KlinesRequest{Symbol: "BNBUSDT", Interval: pkg.Minute})
+	require.NoError(t, err)
+	require.Len(t, klines, 2)
+	assert.Equal(t, t0.Add(2*time.Minute-time.Millisecond), klines[1].CloseTime)
+	prices, err := engine.TickerAllPrices()
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.PriceTicker{{Symbol: "BNBUSDT", Price: 11.5}}, prices)
+	ob, err := engine.OrderBook(pkg.OrderBookRequest{Symbol: "BNBUSDT"})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Order{{Price: 11.5, Quantity: 25}}, ob.Asks)
+	_, err = engine.Klines(pkg.KlinesRequest{Symbol: "ETHUSDT", Interval: pkg.Minute})
+	assert.Equal(t, errInvalidSymbol, err)
+	_, _, err = engine.DepthWebsocket(pkg.DepthWebsocketRequest{Symbol: "BNBUSDT"})
+	assert.Error(t, err)
+
+	var intervals []pkg.Interval
+	for _, interval := range []pkg.Interval{pkg.Minute, pkg.FiveMinutes} {
+		_, err := engine.SubscribeKline(pkg.KlineWebsocketRequest{Symbol: "BNBUSDT", Interval: interval}, pkg.StreamHandler{
+			OnKline: func(ke *pkg.KlineEvent) { intervals = append(intervals, ke.Interval) },
+		})
+		require.NoError(t, err)
+	}
+	_, err = engine.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []pkg.Interval{pkg.Minute, pkg.Minute, pkg.Minute, pkg.FiveMinutes}, intervals)
+
+	t24, err := engine.Ticker24(pkg.TickerRequest{Symbol: "BNBUSDT"})
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, t24.OpenPrice)
+	assert.Equal(t, 13.0, t24.HighPrice)
+	assert.Equal(t, 8.0, t24.LowPrice)
+	assert.Equal(t, 9.0, t24.LastPrice)
+	assert.Equal(t, 500.0, t24.Volume)
+	assert.Equal(t, 5, t24.Count)
+}
+
+func TestTrades(t *testing.T) {
+	d := NewData()
+	d.AddAggTrades("BNBBTC",
+		&pkg.AggTrade{Price: 0.002, Quantity: 1, Timestamp: t0},
+		&pkg.AggTrade{Price: 0.0019, Quantity: 1, Timestamp: t0.Add(time.Second)},
+		&pkg.AggTrade{Price: 0.0018, Quantity: 1, Timestamp: t0.Add(2 * time.Second)},
+	)
+	path := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, d.Save(path))
+	d, err := LoadData(path)
+	require.NoError(t, err)
+
+	engine := New(d, WithBalance("BNB", 2), WithQuoteAsset("BTC"), WithSlippage(FixedSlippage(100)))
+	var trades []*pkg.AggTradeEvent
+	_, err = engine.SubscribeTrade(pkg.TradeWebsocketRequest{Symbol: "BNBBTC"}, pkg.StreamHandler{
+		OnTrade: func(ate *pkg.AggTradeEvent) {
+			trades = append(trades, ate)
+			if ate.ID != 1 {
+				return
+			}
+			_, err := engine.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideSell, Type: pkg.TypeStopLoss, Quantity: 2, StopPrice: 0.0019})
+			require.NoError(t, err)
+		},
+	})
+	require.NoError(t, err)
+
+	report, err := engine.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, trades, 3)
+	assert.Equal(t, 3, trades[2].ID)
+	require.Len(t, report.Trades, 1)
+	assert.InDelta(t, 0.0019*0.99, report.Trades[0].Price, 1e-12)
+	assert.WithinDuration(t, t0.Add(time.Second), report.Trades[0].Time, 0)
+	assert.InDelta(t, 0.004, report.InitialEquity, 1e-12)
+	assert.InDelta(t, 2*0.0019*0.99, report.FinalEquity, 1e-12)
+
+	atr, err := engine.AggTrades(pkg.AggTradesRequest{Symbol: "BNBBTC", FromID: 2})
+	require.NoError(t, err)
+	assert.Len(t, atr, 2)
+}
+
+func TestStatistics(t *testing.T) {
+	day := 24 * time.Hour
+	equity := []EquityPoint{
+		{Time: t0, Equity: 100},
+		{Time: t0.Add(day), Equity: 110},
+		{Time: t0.Add(2 * day), Equity: 99},
+		{Time: t0.Add(3 * day), Equity: 108.9},
+		{Time: t0.Add(3*day + time.Hour), Equity: 50},
+	}
+	assert.InDelta(t, math.Sqrt(365)/(2*math.Sqrt(3)), sharpe(equity[:4], day), 1e-9)
+	// The last, shorter period is left out.
+	assert.InDelta(t, math.Sqrt(365)/(2*math.Sqrt(3)), sharpe(equity, day), 1e-9)
+	assert.InDelta(t, 0.1, maxDrawdown(equity[:4]), 1e-12)
+	assert.InDelta(t, 1-50/110.0, maxDrawdown(equity), 1e-12)
+	assert.Zero(t, sharpe(equity[:2], day))
+}
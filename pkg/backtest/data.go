@@ -0,0 +1,157 @@
+package backtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Data is market history replayed by Engine. It can be collected with
+// Klines and AggTrades calls and stored with Save.
+type Data struct {
+	// Klines are klines by symbol and interval, ordered by open time.
+	Klines map[string]map[pkg.Interval][]*pkg.Kline
+	// AggTrades are aggregated trades by symbol, ordered by time.
+	AggTrades map[string][]*pkg.AggTrade
+}
+
+// NewData creates empty Data.
+func NewData() *Data {
+	return &Data{
+		Klines:    make(map[string]map[pkg.Interval][]*pkg.Kline),
+		AggTrades: make(map[string][]*pkg.AggTrade),
+	}
+}
+
+// LoadData reads Data saved by Save.
+func LoadData(path string) (*Data, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read data")
+	}
+	d := NewData()
+	if err := json.Unmarshal(raw, d); err != nil {
+		return nil, errors.Wrap(err, "unable to decode data")
+	}
+	return d, nil
+}
+
+// Save writes Data as JSON to path.
+func (d *Data) Save(path string) error {
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode data")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, raw, 0644), "unable to write data")
+}
+
+// AddKlines adds klines of symbol and interval.
+func (d *Data) AddKlines(symbol string, interval pkg.Interval, klines ...*pkg.Kline) {
+	if d.Klines[symbol] == nil {
+		d.Klines[symbol] = make(map[pkg.Interval][]*pkg.Kline)
+	}
+	all := append(d.Klines[symbol][interval], klines...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].OpenTime.Before(all[j].OpenTime)
+	})
+	d.Klines[symbol][interval] = all
+}
+
+// AddAggTrades adds aggregated trades of symbol. Trades without ID are
+// numbered after the last one.
+func (d *Data) AddAggTrades(symbol string, trades ...*pkg.AggTrade) {
+	all := d.AggTrades[symbol]
+	for _, t := range trades {
+		if t.ID == 0 {
+			t.ID = len(all) + 1
+		}
+		all = append(all, t)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Timestamp.Before(all[j].Timestamp)
+	})
+	d.AggTrades[symbol] = all
+}
+
+func (d *Data) hasSymbol(symbol string) bool {
+	return len(d.Klines[symbol]) > 0 || len(d.AggTrades[symbol]) > 0
+}
+
+// closeTime returns close time of kline, derived from interval if it's not
+// set.
+func closeTime(k *pkg.Kline, interval pkg.Interval) time.Time {
+	if !k.CloseTime.IsZero() {
+		return k.CloseTime
+	}
+	return k.OpenTime.Add(interval.Duration() - time.Millisecond)
+}
+
+// event is single step of replayed history, closed kline or trade.
+type event struct {
+	time     time.Time
+	symbol   string
+	interval pkg.Interval
+	kline    *pkg.Kline
+	trade    *pkg.AggTrade
+	// prices marks events driving prices of symbol: trades if there are
+	// any, klines of the shortest interval otherwise.
+	prices bool
+}
+
+// timeline returns events of d ordered by time. Trades precede klines
+// closing at the same time, shorter klines precede longer ones.
+func (d *Data) timeline() []*event {
+	var events []*event
+	for symbol, trades := range d.AggTrades {
+		for _, t := range trades {
+			events = append(events, &event{time: t.Timestamp, symbol: symbol, trade: t, prices: true})
+		}
+	}
+	for symbol, intervals := range d.Klines {
+		var shortest pkg.Interval
+		for interval := range intervals {
+			if shortest == "" || interval.Duration() < shortest.Duration() {
+				shortest = interval
+			}
+		}
+		for interval, klines := range intervals {
+			prices := interval == shortest && len(d.AggTrades[symbol]) == 0
+			for _, k := range klines {
+				events = append(events, &event{
+					time:     closeTime(k, interval),
+					symbol:   symbol,
+					interval: interval,
+					kline:    k,
+					prices:   prices,
+				})
+			}
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.time.Equal(b.time) {
+			return a.time.Before(b.time)
+		}
+		if (a.trade != nil) != (b.trade != nil) {
+			return a.trade != nil
+		}
+		if a.interval != b.interval {
+			return a.interval.Duration() < b.interval.Duration()
+		}
+		return a.symbol < b.symbol
+	})
+	return events
+}
+
+// path returns prices kline most likely traded through, open, the nearer
+// extreme, the other extreme and close.
+func path(k *pkg.Kline) []float64 {
+	if k.Close >= k.Open {
+		return []float64{k.Open, k.Low, k.High, k.Close}
+	}
+	return []float64{k.Open, k.High, k.Low, k.Close}
+}
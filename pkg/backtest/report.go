@@ -0,0 +1,135 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/retirero/go-binance/internal/sim"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// year is length of year used to annualize Sharpe ratio; crypto markets
+// trade every day.
+const year = 365 * 24 * time.Hour
+
+// Report is result of backtest.
+type Report struct {
+	Start      time.Time
+	End        time.Time
+	QuoteAsset string
+	// InitialEquity and FinalEquity are values of balances in QuoteAsset.
+	InitialEquity float64
+	FinalEquity   float64
+	// Return is relative change of equity, e.g. 0.1 for 10% gain.
+	Return float64
+	// MaxDrawdown is the largest relative decline of equity from its
+	// previous peak, e.g. 0.2 for 20%.
+	MaxDrawdown float64
+	// Sharpe is annualized Sharpe ratio of equity returns between samples,
+	// with zero risk free rate.
+	Sharpe float64
+	// Equity is equity curve sampled in regular intervals, plus the final
+	// equity.
+	Equity   []EquityPoint
+	Trades   []*Trade
+	Balances []*pkg.Balance
+}
+
+// EquityPoint is value of balances at given time.
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// Trade is execution of order of the simulated account.
+type Trade struct {
+	Symbol          string
+	ID              int64
+	OrderID         int64
+	Side            pkg.OrderSide
+	Price           float64
+	Qty             float64
+	QuoteQty        float64
+	Commission      float64
+	CommissionAsset string
+	Time            time.Time
+	IsMaker         bool
+}
+
+func newReport(start, end time.Time, quoteAsset string, interval time.Duration, equity []EquityPoint, fills []*sim.Fill, balances []*pkg.Balance) *Report {
+	r := &Report{
+		Start:      start,
+		End:        end,
+		QuoteAsset: quoteAsset,
+		Equity:     equity,
+		Balances:   balances,
+	}
+	for _, f := range fills {
+		r.Trades = append(r.Trades, &Trade{
+			Symbol:          f.Symbol,
+			ID:              f.TradeID,
+			OrderID:         f.OrderID,
+			Side:            f.Side,
+			Price:           f.Price,
+			Qty:             f.Qty,
+			QuoteQty:        f.QuoteQty,
+			Commission:      f.Commission,
+			CommissionAsset: f.CommissionAsset,
+			Time:            f.Time,
+			IsMaker:         f.IsMaker,
+		})
+	}
+	if len(equity) == 0 {
+		return r
+	}
+	r.InitialEquity = equity[0].Equity
+	r.FinalEquity = equity[len(equity)-1].Equity
+	if r.InitialEquity != 0 {
+		r.Return = r.FinalEquity/r.InitialEquity - 1
+	}
+	r.MaxDrawdown = maxDrawdown(equity)
+	r.Sharpe = sharpe(equity, interval)
+	return r
+}
+
+func maxDrawdown(equity []EquityPoint) float64 {
+	peak, drawdown := 0.0, 0.0
+	for _, p := range equity {
+		if p.Equity > peak {
+			peak = p.Equity
+		}
+		if peak > 0 {
+			drawdown = math.Max(drawdown, (peak-p.Equity)/peak)
+		}
+	}
+	return drawdown
+}
+
+// sharpe returns annualized Sharpe ratio of returns between samples taken
+// every interval. The final sample, which can be closer, is left out.
+func sharpe(equity []EquityPoint, interval time.Duration) float64 {
+	var returns []float64
+	for i := 1; i < len(equity); i++ {
+		if equity[i].Time.Sub(equity[i-1].Time) != interval || equity[i-1].Equity == 0 {
+			continue
+		}
+		returns = append(returns, equity[i].Equity/equity[i-1].Equity-1)
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return 0
+	}
+	return mean / std * math.Sqrt(float64(year)/float64(interval))
+}
@@ -65,7 +65,16 @@ type Binance interface {
 	DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEvent, chan struct{}, error)
 	KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, chan struct{}, error)
 	TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeEvent, chan struct{}, error)
-	UserDataWebsocket(udwr UserDataWebsocketRequest) (chan *AccountEvent, chan struct{}, error)
+	UserDataWebsocket(udwr UserDataWebsocketRequest) (chan UserDataEvent, chan struct{}, error)
+
+	// SubscribeDepth calls h.OnDepth with depth stream events.
+	SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (*Subscription, error)
+	// SubscribeKline calls h.OnKline with kline stream events.
+	SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (*Subscription, error)
+	// SubscribeTrade calls h.OnTrade with aggregated trade stream events.
+	SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (*Subscription, error)
+	// SubscribeUserData calls h.OnUserData with user data stream events.
+	SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (*Subscription, error)
 }
 
 type binance struct {
@@ -107,9 +116,17 @@ type OrderBook struct {
 	Asks         []*Order
 }
 
+// DepthEvent represents depth stream event.
+//
+// For diff streams Bids and Asks hold price levels changed between
+// FirstUpdateID and FinalUpdateID, with zero Quantity meaning removed level.
+// For partial book streams OrderBook holds full top Level price levels, both
+// update IDs equal OrderBook.LastUpdateID and Time is left zero, because
+// Binance doesn't send event time for snapshots.
 type DepthEvent struct {
 	WSEvent
-	UpdateID int
+	FirstUpdateID int
+	FinalUpdateID int
 	OrderBook
 }
 
@@ -384,11 +401,6 @@ type Account struct {
 	Balances        []*Balance
 }
 
-type AccountEvent struct {
-	WSEvent
-	Account
-}
-
 // Balance groups balance-related information.
 type Balance struct {
 	Asset  string
@@ -403,18 +415,29 @@ func (b *binance) Account(ar AccountRequest) (*Account, error) {
 
 // MyTradesRequest represents MyTrades request data.
 type MyTradesRequest struct {
-	Symbol     string
-	Limit      int
-	FromID     int64
+	Symbol string
+	Limit  int
+	FromID int64
+	// StartTime and EndTime limit trades to time range, at most 24 hours
+	// long. They can't be combined with FromID.
+	StartTime  time.Time
+	EndTime    time.Time
 	RecvWindow time.Duration
 	Timestamp  time.Time
 }
 
 // Trade represents data about trade.
 type Trade struct {
-	ID              int64
-	Price           float64
-	Qty             float64
+	Symbol  string
+	ID      int64
+	OrderID int64
+	// OrderListID is ID of order list of the order, -1 if it's not part of
+	// any.
+	OrderListID int64
+	Price       float64
+	Qty         float64
+	// QuoteQty is zero if Binance didn't report it.
+	QuoteQty        float64
 	Commission      float64
 	CommissionAsset string
 	Time            time.Time
@@ -464,6 +487,8 @@ type Deposit struct {
 	InsertTime time.Time
 	Amount     float64
 	Asset      string
+	Address    string
+	TxID       string
 	Status     int
 }
 
@@ -474,12 +499,14 @@ func (b *binance) DepositHistory(hr HistoryRequest) ([]*Deposit, error) {
 
 // Withdrawal represents withdrawal data.
 type Withdrawal struct {
-	Amount    float64
-	Address   string
-	TxID      string
-	Asset     string
-	ApplyTime time.Time
-	Status    int
+	Amount float64
+	// TransactionFee is fee paid in Asset on top of Amount.
+	TransactionFee float64
+	Address        string
+	TxID           string
+	Asset          string
+	ApplyTime      time.Time
+	Status         int
 }
 
 // WithdrawHistory lists withdraw data.
@@ -515,8 +542,16 @@ type WSEvent struct {
 	Symbol string
 }
 
+// DepthWebsocketRequest represents DepthWebsocket request data.
+//
+// If Level is set (5, 10 or 20), partial book snapshots are streamed instead
+// of diff updates. UpdateSpeed can be set to 100ms for faster updates,
+// otherwise events are pushed every 1000ms. Other values are rejected.
 type DepthWebsocketRequest struct {
-	Symbol string
+	Symbol      string
+	Level       int
+	UpdateSpeed time.Duration
+	StreamOptions
 }
 
 func (b *binance) DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEvent, chan struct{}, error) {
@@ -526,6 +561,7 @@ func (b *binance) DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEvent, c
 type KlineWebsocketRequest struct {
 	Symbol   string
 	Interval Interval
+	StreamOptions
 }
 
 func (b *binance) KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, chan struct{}, error) {
@@ -534,6 +570,7 @@ func (b *binance) KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, c
 
 type TradeWebsocketRequest struct {
 	Symbol string
+	StreamOptions
 }
 
 func (b *binance) TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeEvent, chan struct{}, error) {
@@ -542,8 +579,125 @@ func (b *binance) TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeEvent
 
 type UserDataWebsocketRequest struct {
 	ListenKey string
+	StreamOptions
 }
 
-func (b *binance) UserDataWebsocket(udwr UserDataWebsocketRequest) (chan *AccountEvent, chan struct{}, error) {
+func (b *binance) UserDataWebsocket(udwr UserDataWebsocketRequest) (chan UserDataEvent, chan struct{}, error) {
 	return b.Service.UserDataWebsocket(udwr)
 }
+
+// SubscribeDepth calls h.OnDepth with depth stream events.
+func (b *binance) SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	return b.Service.SubscribeDepth(dwr, h)
+}
+
+// SubscribeKline calls h.OnKline with kline stream events.
+func (b *binance) SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	return b.Service.SubscribeKline(kwr, h)
+}
+
+// SubscribeTrade calls h.OnTrade with aggregated trade stream events.
+func (b *binance) SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	return b.Service.SubscribeTrade(twr, h)
+}
+
+// SubscribeUserData calls h.OnUserData with user data stream events.
+func (b *binance) SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	return b.Service.SubscribeUserData(udwr, h)
+}
+
+// UserDataEvent represents single user data stream event.
+//
+// Use type switch to get the concrete event, which is one of
+// *AccountPositionEvent, *BalanceUpdateEvent, *ExecutionReportEvent,
+// *ListStatusEvent or *ListenKeyExpiredEvent.
+type UserDataEvent interface {
+	userDataEvent()
+}
+
+// AccountPositionEvent represents outboundAccountPosition event, sent with
+// balances of assets changed by the account update.
+type AccountPositionEvent struct {
+	WSEvent
+	LastUpdateTime time.Time
+	Balances       []*Balance
+}
+
+// BalanceUpdateEvent represents balanceUpdate event, sent on deposits,
+// withdrawals and transfers.
+type BalanceUpdateEvent struct {
+	WSEvent
+	Asset     string
+	Delta     float64
+	ClearTime time.Time
+}
+
+// ExecutionReportEvent represents executionReport event, sent on every order
+// update.
+type ExecutionReportEvent struct {
+	WSEvent
+	ClientOrderID           string
+	Side                    OrderSide
+	OrderType               OrderType
+	TimeInForce             TimeInForce
+	Quantity                float64
+	Price                   float64
+	StopPrice               float64
+	IcebergQty              float64
+	OrderListID             int64
+	OrigClientOrderID       string
+	ExecutionType           ExecutionType
+	Status                  OrderStatus
+	RejectReason            string
+	OrderID                 int64
+	LastExecutedQty         float64
+	CumulativeFilledQty     float64
+	LastExecutedPrice       float64
+	Commission              float64
+	CommissionAsset         string
+	TransactionTime         time.Time
+	TradeID                 int64
+	IsWorking               bool
+	IsMaker                 bool
+	OrderCreationTime       time.Time
+	CumulativeQuoteQty      float64
+	LastQuoteQty            float64
+	QuoteOrderQty           float64
+	WorkingTime             time.Time
+	SelfTradePreventionMode string
+	PreventedMatchID        int64
+}
+
+// ListStatusEvent represents listStatus event, sent on order list (OCO)
+// updates.
+type ListStatusEvent struct {
+	WSEvent
+	OrderListID       int64
+	ContingencyType   ContingencyType
+	ListStatusType    ListStatusType
+	ListOrderStatus   ListOrderStatus
+	ListRejectReason  string
+	ListClientOrderID string
+	TransactionTime   time.Time
+	Orders            []*ListStatusOrder
+}
+
+// ListStatusOrder represents order belonging to order list.
+type ListStatusOrder struct {
+	Symbol        string
+	OrderID       int64
+	ClientOrderID string
+}
+
+// ListenKeyExpiredEvent represents listenKeyExpired event, sent when stream
+// listen key is no longer valid and stream is about to be closed.
+type ListenKeyExpiredEvent struct {
+	WSEvent
+	ListenKey string
+}
+
+func (*AccountPositionEvent) userDataEvent()  {}
+func (*BalanceUpdateEvent) userDataEvent()    {}
+func (*ExecutionReportEvent) userDataEvent()  {}
+func (*ListStatusEvent) userDataEvent()       {}
+func (*ListenKeyExpiredEvent) userDataEvent() {}
@@ -0,0 +1,434 @@
+package binancetest
+
+import (
+	"math"
+	"sort"
+
+	"github.com/retirero/go-binance/internal/matching"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// update collects changes of single matching engine operation, which are
+// published to streams by flush.
+type update struct {
+	sym    *symbol
+	bids   map[float64]bool
+	asks   map[float64]bool
+	trades []*pkg.AggTrade
+	assets map[string]bool
+}
+
+func newUpdate(sym *symbol) *update {
+	return &update{
+		sym:    sym,
+		bids:   make(map[float64]bool),
+		asks:   make(map[float64]bool),
+		assets: make(map[string]bool),
+	}
+}
+
+func (u *update) touchLevel(side pkg.OrderSide, price float64) {
+	if side == pkg.SideBuy {
+		u.bids[price] = true
+	} else {
+		u.asks[price] = true
+	}
+}
+
+func (u *update) touchAssets(assets ...string) {
+	for _, a := range assets {
+		u.assets[a] = true
+	}
+}
+
+// flush sends trades, changed price levels and changed balances of u to
+// streams.
+func (s *Server) flush(u *update) {
+	sym := u.sym
+	for _, t := range u.trades {
+		s.publishAggTrade(sym, t)
+	}
+	if len(u.bids) > 0 || len(u.asks) > 0 {
+		first := sym.lastUpdateID + 1
+		sym.lastUpdateID++
+		s.publishDepth(sym, first, sym.changedLevels(pkg.SideBuy, u.bids), sym.changedLevels(pkg.SideSell, u.asks))
+	}
+	if len(u.assets) > 0 {
+		now := s.now()
+		ape := &pkg.AccountPositionEvent{
+			WSEvent: pkg.WSEvent{
+				Type: "outboundAccountPosition",
+				Time: now,
+			},
+			LastUpdateTime: now,
+		}
+		var assets []string
+		for a := range u.assets {
+			assets = append(assets, a)
+		}
+		sort.Strings(assets)
+		for _, a := range assets {
+			b := *s.balance(a)
+			ape.Balances = append(ape.Balances, &b)
+		}
+		s.publishUserData(ape)
+	}
+}
+
+// changedLevels returns current quantity of price levels, ordered like the
+// book side.
+func (sym *symbol) changedLevels(side pkg.OrderSide, prices map[float64]bool) []*pkg.Order {
+	var levels []*pkg.Order
+	for price := range prices {
+		levels = append(levels, &pkg.Order{Price: price, Quantity: sym.levelQty(side, price)})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		if side == pkg.SideBuy {
+			return levels[i].Price > levels[j].Price
+		}
+		return levels[i].Price < levels[j].Price
+	})
+	return levels
+}
+
+func opposite(side pkg.OrderSide) pkg.OrderSide {
+	if side == pkg.SideBuy {
+		return pkg.SideSell
+	}
+	return pkg.SideBuy
+}
+
+// isStop reports whether order waits for stop price to be reached.
+func (o *order) isStop() bool {
+	return matching.IsStop(o.orderType)
+}
+
+// isMarket reports whether order executes at any price.
+func (o *order) isMarket() bool {
+	return matching.IsMarket(o.orderType)
+}
+
+// triggeredBy reports whether last trade price reached stop price of order.
+func (o *order) triggeredBy(last float64) bool {
+	return matching.Triggered(o.orderType, o.side, o.stopPrice, last)
+}
+
+func (o *order) remaining() float64 {
+	return matching.Remaining(o.origQty, o.executedQty)
+}
+
+// lockedAsset returns asset locked by order.
+func (sym *symbol) lockedAsset(o *order) string {
+	if o.side == pkg.SideBuy {
+		return sym.quoteAsset
+	}
+	return sym.baseAsset
+}
+
+// available returns quantity of resting orders order o can match.
+func (sym *symbol) available(o *order) float64 {
+	var qty float64
+	for _, m := range *sym.book(opposite(o.side)) {
+		if !o.isMarket() && !matching.Crosses(o.side, o.price, m.price) {
+			break
+		}
+		qty += m.remaining()
+	}
+	return qty
+}
+
+// marketCost estimates quote amount needed by market buy order.
+func (sym *symbol) marketCost(o *order) float64 {
+	var cost float64
+	remaining := o.origQty
+	for _, m := range sym.asks {
+		qty := math.Min(remaining, m.remaining())
+		cost += qty * m.price
+		remaining -= qty
+		if remaining <= matching.Epsilon {
+			break
+		}
+	}
+	return cost
+}
+
+// checkOrder checks order against book, last price and balances.
+func (s *Server) checkOrder(sym *symbol, o *order) *apiError {
+	if o.orderType == pkg.TypeLimitMaker {
+		if book := *sym.book(opposite(o.side)); len(book) > 0 && matching.Crosses(o.side, o.price, book[0].price) {
+			return errorf(400, -2010, "Order would immediately match and take.")
+		}
+	}
+	if o.isStop() {
+		if last, ok := sym.lastPrice(); ok && o.triggeredBy(last) {
+			return errorf(400, -2010, "Stop price would trigger immediately.")
+		}
+	}
+
+	switch {
+	case o.side == pkg.SideSell:
+		o.lockPrice = 0
+	case o.orderType == pkg.TypeMarket:
+		o.lockPrice = 0
+	case o.isMarket():
+		o.lockPrice = o.stopPrice
+	default:
+		o.lockPrice = o.price
+	}
+	required := o.origQty
+	if o.side == pkg.SideBuy {
+		required = o.origQty * o.lockPrice
+		if o.orderType == pkg.TypeMarket {
+			required = sym.marketCost(o)
+		}
+	}
+	if s.balance(sym.lockedAsset(o)).Free < required-matching.Epsilon {
+		return errInsufficientBalance
+	}
+	return nil
+}
+
+// lock moves funds needed by order from free to locked. Market orders spend
+// free funds as they fill.
+func (s *Server) lock(sym *symbol, o *order, u *update) {
+	if o.orderType == pkg.TypeMarket {
+		return
+	}
+	amount := o.origQty
+	if o.side == pkg.SideBuy {
+		amount = o.origQty * o.lockPrice
+	}
+	asset := sym.lockedAsset(o)
+	b := s.balance(asset)
+	b.Free = matching.Clean(b.Free - amount)
+	b.Locked += amount
+	o.locked = amount
+	u.touchAssets(asset)
+}
+
+// release unlocks funds still locked by finished order.
+func (s *Server) release(sym *symbol, o *order, u *update) {
+	if o.locked == 0 {
+		return
+	}
+	asset := sym.lockedAsset(o)
+	b := s.balance(asset)
+	b.Locked = matching.Clean(b.Locked - o.locked)
+	b.Free += o.locked
+	o.locked = 0
+	u.touchAssets(asset)
+}
+
+// spend takes amount of asset paid by order, using up to reserved of its
+// locked funds and free funds for the rest.
+func (s *Server) spend(o *order, asset string, amount, reserved float64) {
+	reserved = math.Min(reserved, o.locked)
+	b := s.balance(asset)
+	o.locked = matching.Clean(o.locked - reserved)
+	b.Locked = matching.Clean(b.Locked - reserved)
+	b.Free = matching.Clean(b.Free + reserved - amount)
+}
+
+// submit executes order against the book. Depending on order type and time
+// in force, unfilled remainder rests in the book or expires. Stop orders
+// wait for trigger. It returns fills of the order.
+func (s *Server) submit(sym *symbol, o *order, u *update) []*trade {
+	if o.isStop() && !o.isWorking {
+		return nil
+	}
+	if o.timeInForce == pkg.FOK && sym.available(o) < o.origQty-matching.Epsilon {
+		s.expire(sym, o, u)
+		return nil
+	}
+	fills := s.match(sym, o, u)
+	if o.remaining() <= matching.Epsilon {
+		return fills
+	}
+	if o.isMarket() || o.timeInForce == pkg.IOC || o.timeInForce == pkg.FOK {
+		s.expire(sym, o, u)
+		return fills
+	}
+	sym.insert(o)
+	u.touchLevel(o.side, o.price)
+	return fills
+}
+
+// match fills order o against resting orders in price-time priority.
+func (s *Server) match(sym *symbol, o *order, u *update) []*trade {
+	var fills []*trade
+	book := sym.book(opposite(o.side))
+	for o.remaining() > matching.Epsilon && len(*book) > 0 {
+		m := (*book)[0]
+		if !o.isMarket() && !matching.Crosses(o.side, o.price, m.price) {
+			break
+		}
+		qty := math.Min(o.remaining(), m.remaining())
+		price := m.price
+		sym.lastTradeID++
+		tradeID := sym.lastTradeID
+
+		if t := s.fill(sym, o, qty, price, false, tradeID, u); t != nil {
+			fills = append(fills, t)
+		}
+		s.fill(sym, m, qty, price, true, tradeID, u)
+		if m.remaining() <= matching.Epsilon {
+			sym.remove(m)
+		}
+		u.touchLevel(m.side, price)
+
+		at := &pkg.AggTrade{
+			Price:          price,
+			Quantity:       qty,
+			FirstTradeID:   int(tradeID),
+			LastTradeID:    int(tradeID),
+			Timestamp:      s.now(),
+			BuyerMaker:     m.side == pkg.SideBuy,
+			BestPriceMatch: true,
+		}
+		sym.addAggTrade(at)
+		u.trades = append(u.trades, at)
+	}
+	return fills
+}
+
+// fill executes qty of order at price. Fills of orders placed through the
+// API update balances, record user trade and send execution report, which
+// is returned.
+func (s *Server) fill(sym *symbol, o *order, qty, price float64, isMaker bool, tradeID int64, u *update) *trade {
+	quoteQty := qty * price
+	o.executedQty += qty
+	o.cummulativeQuoteQty += quoteQty
+	o.updateTime = s.now()
+	if o.remaining() <= matching.Epsilon {
+		o.status = pkg.StatusFilled
+	} else {
+		o.status = pkg.StatusPartiallyFilled
+	}
+	if o.external {
+		return nil
+	}
+
+	rate := float64(s.takerCommission) / 10000
+	if isMaker {
+		rate = float64(s.makerCommission) / 10000
+	}
+	t := &trade{
+		symbol:      sym.name,
+		id:          tradeID,
+		orderID:     o.orderID,
+		orderListID: o.orderListID,
+		price:       price,
+		qty:         qty,
+		quoteQty:    quoteQty,
+		time:        o.updateTime,
+		isBuyer:     o.side == pkg.SideBuy,
+		isMaker:     isMaker,
+	}
+	if o.side == pkg.SideBuy {
+		s.spend(o, sym.quoteAsset, quoteQty, qty*o.lockPrice)
+		t.commission = qty * rate
+		t.commissionAsset = sym.baseAsset
+		s.balance(sym.baseAsset).Free += qty - t.commission
+	} else {
+		s.spend(o, sym.baseAsset, qty, qty)
+		t.commission = quoteQty * rate
+		t.commissionAsset = sym.quoteAsset
+		s.balance(sym.quoteAsset).Free += quoteQty - t.commission
+	}
+	u.touchAssets(sym.baseAsset, sym.quoteAsset)
+	s.trades = append(s.trades, t)
+	s.publishExecutionReport(o, pkg.ExecutionTrade, "", t)
+
+	if o.list != nil {
+		s.listTriggered(sym, o, u)
+	}
+	if o.status == pkg.StatusFilled {
+		s.release(sym, o, u)
+	}
+	return t
+}
+
+// expire ends order which can't be filled any more.
+func (s *Server) expire(sym *symbol, o *order, u *update) {
+	o.status = pkg.StatusExpired
+	o.updateTime = s.now()
+	o.isWorking = false
+	if o.external {
+		return
+	}
+	if sym.remove(o) {
+		u.touchLevel(o.side, o.price)
+	}
+	s.release(sym, o, u)
+	s.publishExecutionReport(o, pkg.ExecutionExpired, "", nil)
+}
+
+// cancel cancels active order, cancelID being client order ID of the cancel
+// request.
+func (s *Server) cancel(sym *symbol, o *order, cancelID string, u *update) {
+	o.status = pkg.StatusCancelled
+	o.updateTime = s.now()
+	o.isWorking = false
+	if sym.remove(o) {
+		u.touchLevel(o.side, o.price)
+	}
+	s.release(sym, o, u)
+	s.publishExecutionReport(o, pkg.ExecutionCanceled, cancelID, nil)
+}
+
+// triggerStops triggers stop orders of symbol whose stop price was reached by
+// the last trade, which may trigger further orders.
+func (s *Server) triggerStops(sym *symbol, u *update) {
+	for {
+		last, ok := sym.lastPrice()
+		if !ok {
+			return
+		}
+		var triggered *order
+		for _, o := range s.orders {
+			if o.symbol == sym.name && o.active() && o.isStop() && !o.isWorking && o.triggeredBy(last) {
+				triggered = o
+				break
+			}
+		}
+		if triggered == nil {
+			return
+		}
+		triggered.isWorking = true
+		triggered.updateTime = s.now()
+		if triggered.list != nil {
+			s.listTriggered(sym, triggered, u)
+		}
+		s.submit(sym, triggered, u)
+	}
+}
+
+// PlaceExternalOrder places order of other market participant, which
+// matches orders in the book, including those placed through the API.
+// Remainder of limit order rests in the book, zero price places market
+// order.
+func (s *Server) PlaceExternalOrder(name string, side pkg.OrderSide, price, quantity float64) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	o := &order{
+		symbol:      sym.name,
+		orderID:     s.nextID(),
+		orderListID: -1,
+		external:    true,
+		side:        side,
+		orderType:   pkg.TypeLimit,
+		timeInForce: pkg.GTC,
+		price:       price,
+		origQty:     quantity,
+		status:      pkg.StatusNew,
+		isWorking:   true,
+	}
+	if price == 0 {
+		o.orderType = pkg.TypeMarket
+	}
+	u := newUpdate(sym)
+	s.submit(sym, o, u)
+	s.triggerStops(sym, u)
+	s.flush(u)
+}
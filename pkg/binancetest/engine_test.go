@@ -0,0 +1,304 @@
+package binancetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedRequest sends request signed by the test key and decodes the
+// response into v.
+func signedRequest(t *testing.T, srv *Server, method, endpoint string, params url.Values, v interface{}) int {
+	t.Helper()
+	params.Set("timestamp", strconv.FormatInt(millis(time.Now()), 10))
+	payload := params.Encode()
+	payload += "&signature=" + (&pkg.HmacSigner{Key: []byte(testSecret)}).Sign([]byte(payload))
+	req, err := http.NewRequest(method, srv.URL+"/"+endpoint, strings.NewReader(payload))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-MBX-APIKEY", testAPIKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func balances(srv *Server) map[string]*pkg.Balance {
+	res := make(map[string]*pkg.Balance)
+	for _, b := range srv.Balances() {
+		res[b.Asset] = b
+	}
+	return res
+}
+
+func TestMatching(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC", nil, []*pkg.Order{{Price: 0.0021, Quantity: 3}, {Price: 0.0022, Quantity: 4}})
+	srv.SetBalance("BTC", 1)
+
+	diffs, _, err := service.DepthWebsocket(pkg.DepthWebsocketRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	trades, _, err := service.TradeWebsocket(pkg.TradeWebsocketRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+
+	buy, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:    "BNBBTC",
+		Side:      pkg.SideBuy,
+		Type:      pkg.TypeMarket,
+		Quantity:  4,
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	eo, ok := srv.Order(buy.OrderID)
+	require.True(t, ok)
+	assert.Equal(t, pkg.StatusFilled, eo.Status)
+	assert.Equal(t, 4.0, eo.ExecutedQty)
+
+	first := receive(t, trades).(*pkg.AggTradeEvent)
+	assert.Equal(t, 0.0021, first.Price)
+	assert.Equal(t, 3.0, first.Quantity)
+	assert.False(t, first.BuyerMaker)
+	assert.Equal(t, 0.0022, receive(t, trades).(*pkg.AggTradeEvent).Price)
+	diff := receive(t, diffs).(*pkg.DepthEvent)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0021, Quantity: 0}, {Price: 0.0022, Quantity: 3}}, diff.Asks)
+
+	b := balances(srv)
+	assert.InDelta(t, 4*0.999, b["BNB"].Free, 1e-9)
+	assert.InDelta(t, 1-3*0.0021-0.0022, b["BTC"].Free, 1e-9)
+	mine, err := service.MyTrades(pkg.MyTradesRequest{Symbol: "BNBBTC", Timestamp: time.Now()})
+	require.NoError(t, err)
+	require.Len(t, mine, 2)
+	assert.Equal(t, "BNBBTC", mine[0].Symbol)
+	assert.Equal(t, int64(-1), mine[0].OrderListID)
+	assert.InDelta(t, 3*0.0021, mine[0].QuoteQty, 1e-12)
+	assert.True(t, mine[0].IsBuyer)
+	assert.False(t, mine[0].IsMaker)
+	assert.InDelta(t, 0.003, mine[0].Commission, 1e-9)
+	assert.Equal(t, "BNB", mine[0].CommissionAsset)
+	ranged, err := service.MyTrades(pkg.MyTradesRequest{
+		Symbol:    "BNBBTC",
+		StartTime: mine[0].Time,
+		Limit:     1,
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	require.Len(t, ranged, 1)
+	assert.Equal(t, mine[0].ID, ranged[0].ID)
+	ranged, err = service.MyTrades(pkg.MyTradesRequest{
+		Symbol:    "BNBBTC",
+		StartTime: mine[0].Time.Add(-time.Hour),
+		EndTime:   mine[0].Time.Add(-time.Minute),
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, ranged)
+	_, err = service.MyTrades(pkg.MyTradesRequest{
+		Symbol:    "BNBBTC",
+		StartTime: mine[0].Time.Add(-25 * time.Hour),
+		EndTime:   mine[0].Time,
+		Timestamp: time.Now(),
+	})
+	assert.Equal(t, &pkg.Error{Code: -1127, Message: "More than 24 hours between startTime and endTime."}, err)
+
+	sell, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideSell,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    2,
+		Price:       0.0021,
+		Timestamp:   time.Now(),
+	})
+	require.NoError(t, err)
+	srv.PlaceExternalOrder("BNBBTC", pkg.SideBuy, 0.0021, 1)
+
+	eo, err = service.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrderID: sell.OrderID, Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.StatusPartiallyFilled, eo.Status)
+	assert.Equal(t, 1.0, eo.ExecutedQty)
+	open, err := service.OpenOrders(pkg.OpenOrdersRequest{Symbol: "BNBBTC", Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Len(t, open, 1)
+	ob, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0021, Quantity: 1}, {Price: 0.0022, Quantity: 3}}, ob.Asks)
+
+	acc, err := service.Account(pkg.AccountRequest{Timestamp: time.Now()})
+	require.NoError(t, err)
+	for _, b := range acc.Balances {
+		if b.Asset == "BNB" {
+			assert.InDelta(t, 1, b.Locked, 1e-9)
+			assert.InDelta(t, 4*0.999-2, b.Free, 1e-9)
+		}
+	}
+
+	_, err = service.CancelOrder(pkg.CancelOrderRequest{Symbol: "BNBBTC", OrderID: sell.OrderID, Timestamp: time.Now()})
+	require.NoError(t, err)
+	b = balances(srv)
+	assert.InDelta(t, 4*0.999-1, b["BNB"].Free, 1e-9)
+	assert.Zero(t, b["BNB"].Locked)
+}
+
+func TestTimeInForce(t *testing.T) {
+	srv, service := newTestService(t, WithCommission(0, 0))
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.0019, Quantity: 1}}, []*pkg.Order{{Price: 0.0021, Quantity: 3}})
+	srv.SetBalance("BTC", 1)
+
+	order := func(tif pkg.TimeInForce, typ pkg.OrderType, price float64) (*pkg.ExecutedOrder, error) {
+		po, err := service.NewOrder(pkg.NewOrderRequest{
+			Symbol:      "BNBBTC",
+			Side:        pkg.SideBuy,
+			Type:        typ,
+			TimeInForce: tif,
+			Quantity:    5,
+			Price:       price,
+			Timestamp:   time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		eo, _ := srv.Order(po.OrderID)
+		return eo, nil
+	}
+
+	fok, err := order(pkg.FOK, pkg.TypeLimit, 0.0021)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.StatusExpired, fok.Status)
+	assert.Zero(t, fok.ExecutedQty)
+
+	ioc, err := order(pkg.IOC, pkg.TypeLimit, 0.0021)
+	require.NoError(t, err)
+	assert.Equal(t, pkg.StatusExpired, ioc.Status)
+	assert.Equal(t, 3.0, ioc.ExecutedQty)
+
+	srv.SetOrderBook("BNBBTC", nil, []*pkg.Order{{Price: 0.0021, Quantity: 1}})
+	_, err = order("", pkg.TypeLimitMaker, 0.0021)
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Order would immediately match and take."}, err)
+	_, err = order(pkg.GTC, pkg.TypeLimit, 1)
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Account has insufficient balance for requested action."}, err)
+
+	b := balances(srv)
+	assert.InDelta(t, 3, b["BNB"].Free, 1e-9)
+	assert.InDelta(t, 1-3*0.0021, b["BTC"].Free, 1e-9)
+	assert.Zero(t, b["BTC"].Locked)
+}
+
+func TestStopOrders(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.0018, Quantity: 5}}, nil)
+	srv.AddAggTrades("BNBBTC", &pkg.AggTrade{Price: 0.002, Quantity: 1})
+	srv.SetBalance("BNB", 1)
+
+	_, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:    "BNBBTC",
+		Side:      pkg.SideSell,
+		Type:      pkg.TypeStopLoss,
+		Quantity:  1,
+		StopPrice: 0.0021,
+		Timestamp: time.Now(),
+	})
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Stop price would trigger immediately."}, err)
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:    "BNBBTC",
+		Side:      pkg.SideSell,
+		Type:      pkg.TypeStopLoss,
+		Quantity:  1,
+		StopPrice: 0.0019,
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	eo, _ := srv.Order(po.OrderID)
+	assert.Equal(t, pkg.StatusNew, eo.Status)
+
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.00195, Quantity: 1})
+	eo, _ = srv.Order(po.OrderID)
+	assert.Equal(t, pkg.StatusNew, eo.Status)
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.0019, Quantity: 1})
+	eo, _ = srv.Order(po.OrderID)
+	assert.Equal(t, pkg.StatusFilled, eo.Status)
+
+	b := balances(srv)
+	assert.Zero(t, b["BNB"].Free)
+	assert.Zero(t, b["BNB"].Locked)
+	assert.InDelta(t, 0.0018*0.999, b["BTC"].Free, 1e-9)
+	prices, err := service.TickerAllPrices()
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.PriceTicker{{Symbol: "BNBBTC", Price: 0.0018}}, prices)
+}
+
+func TestOCO(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.AddAggTrades("BNBBTC", &pkg.AggTrade{Price: 0.002, Quantity: 1})
+	srv.SetBalance("BNB", 1)
+
+	s, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	events, _, err := service.UserDataWebsocket(pkg.UserDataWebsocketRequest{ListenKey: s.ListenKey})
+	require.NoError(t, err)
+
+	params := url.Values{
+		"symbol":               {"BNBBTC"},
+		"side":                 {"SELL"},
+		"quantity":             {"1"},
+		"price":                {"0.0019"},
+		"stopPrice":            {"0.0018"},
+		"stopLimitPrice":       {"0.0017"},
+		"stopLimitTimeInForce": {"GTC"},
+	}
+	var apiErr pkg.Error
+	assert.Equal(t, 400, signedRequest(t, srv, "POST", "api/v3/order/oco", params, &apiErr))
+	assert.Equal(t, pkg.Error{Code: -2010, Message: "The relationship of the prices for the orders is not correct."}, apiErr)
+
+	params.Set("price", "0.0025")
+	params.Set("listClientOrderId", "my-list")
+	var list struct {
+		OrderListID     int64
+		ListStatusType  pkg.ListStatusType
+		ListOrderStatus pkg.ListOrderStatus
+		Orders          []struct {
+			OrderID int64
+		}
+	}
+	require.Equal(t, 200, signedRequest(t, srv, "POST", "api/v3/order/oco", params, &list))
+	assert.Equal(t, pkg.ListStatusExecStarted, list.ListStatusType)
+	require.Len(t, list.Orders, 2)
+	stop, limit := list.Orders[0].OrderID, list.Orders[1].OrderID
+	assert.Equal(t, pkg.ExecutionNew, receive(t, events).(*pkg.ExecutionReportEvent).ExecutionType)
+	assert.Equal(t, pkg.ExecutionNew, receive(t, events).(*pkg.ExecutionReportEvent).ExecutionType)
+	ls := receive(t, events).(*pkg.ListStatusEvent)
+	assert.Equal(t, "my-list", ls.ListClientOrderID)
+	assert.Equal(t, pkg.ListOrderStatusExecuting, ls.ListOrderStatus)
+	assert.Equal(t, 1.0, balances(srv)["BNB"].Locked)
+
+	srv.PlaceExternalOrder("BNBBTC", pkg.SideBuy, 0.0025, 2)
+	eo, _ := srv.Order(limit)
+	assert.Equal(t, pkg.StatusFilled, eo.Status)
+	eo, _ = srv.Order(stop)
+	assert.Equal(t, pkg.StatusExpired, eo.Status)
+	b := balances(srv)
+	assert.Zero(t, b["BNB"].Locked)
+	assert.InDelta(t, 0.0025*0.999, b["BTC"].Free, 1e-9)
+
+	params = url.Values{"orderListId": {strconv.FormatInt(list.OrderListID, 10)}}
+	require.Equal(t, 200, signedRequest(t, srv, "GET", "api/v3/orderList", params, &list))
+	assert.Equal(t, pkg.ListStatusAllDone, list.ListStatusType)
+	assert.Equal(t, pkg.ListOrderStatusAllDone, list.ListOrderStatus)
+
+	ob, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0025, Quantity: 1}}, ob.Bids)
+}
@@ -0,0 +1,292 @@
+package binancetest
+
+import (
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/retirero/go-binance/internal/matching"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// orderList is OCO order list, i.e. limit maker order and stop loss order of
+// which only one executes.
+type orderList struct {
+	id              int64
+	clientID        string
+	symbol          string
+	statusType      pkg.ListStatusType
+	orderStatus     pkg.ListOrderStatus
+	orders          []*order
+	transactionTime time.Time
+}
+
+func (s *Server) newOCO(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if sym.baseAsset == "" {
+		return nil, errInvalidSymbol
+	}
+	side := pkg.OrderSide(params.Get("side"))
+	switch side {
+	case "":
+		return nil, errMandatory("side")
+	case pkg.SideBuy, pkg.SideSell:
+	default:
+		return nil, errorf(400, -1117, "Invalid side.")
+	}
+	var quantity, price, stopPrice, stopLimitPrice float64
+	for _, f := range []struct {
+		dst  *float64
+		name string
+	}{
+		{&quantity, "quantity"},
+		{&price, "price"},
+		{&stopPrice, "stopPrice"},
+		{&stopLimitPrice, "stopLimitPrice"},
+	} {
+		if *f.dst, apiErr = floatParam(params, f.name); apiErr != nil {
+			return nil, apiErr
+		}
+		if *f.dst <= 0 && f.name != "stopLimitPrice" {
+			return nil, errMandatory(f.name)
+		}
+	}
+
+	limit := &order{
+		symbol:        sym.name,
+		clientOrderID: params.Get("limitClientOrderId"),
+		side:          side,
+		orderType:     pkg.TypeLimitMaker,
+		timeInForce:   pkg.GTC,
+		price:         price,
+		origQty:       quantity,
+		status:        pkg.StatusNew,
+	}
+	stop := &order{
+		symbol:        sym.name,
+		clientOrderID: params.Get("stopClientOrderId"),
+		side:          side,
+		orderType:     pkg.TypeStopLoss,
+		timeInForce:   pkg.GTC,
+		stopPrice:     stopPrice,
+		origQty:       quantity,
+		status:        pkg.StatusNew,
+	}
+	if stopLimitPrice != 0 {
+		stop.orderType = pkg.TypeStopLossLimit
+		stop.price = stopLimitPrice
+		stop.timeInForce = pkg.TimeInForce(params.Get("stopLimitTimeInForce"))
+		switch stop.timeInForce {
+		case "":
+			return nil, errMandatory("stopLimitTimeInForce")
+		case pkg.GTC, pkg.IOC, pkg.FOK:
+		default:
+			return nil, errorf(400, -1115, "Invalid timeInForce.")
+		}
+	}
+	for _, o := range s.orders {
+		if o.active() && o.clientOrderID != "" && (o.clientOrderID == limit.clientOrderID || o.clientOrderID == stop.clientOrderID) {
+			return nil, errorf(400, -2010, "Duplicate order sent.")
+		}
+	}
+
+	// Limit price must be above and stop price below the last price for
+	// sell lists, the other way around for buy lists.
+	lower, upper := stopPrice, price
+	if side == pkg.SideBuy {
+		lower, upper = price, stopPrice
+	}
+	last, ok := sym.lastPrice()
+	if lower >= upper || (ok && (lower >= last || upper <= last)) {
+		return nil, errorf(400, -2010, "The relationship of the prices for the orders is not correct.")
+	}
+	for _, o := range []*order{limit, stop} {
+		if apiErr := s.checkOrder(sym, o); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	// The limit order locks funds of both orders, enough for either of them.
+	limit.lockPrice = math.Max(limit.lockPrice, stop.lockPrice)
+	stop.lockPrice = limit.lockPrice
+	if side == pkg.SideBuy && s.balance(sym.quoteAsset).Free < quantity*limit.lockPrice-matching.Epsilon {
+		return nil, errInsufficientBalance
+	}
+
+	l := &orderList{
+		id:              int64(len(s.lists) + 1),
+		clientID:        params.Get("listClientOrderId"),
+		symbol:          sym.name,
+		statusType:      pkg.ListStatusExecStarted,
+		orderStatus:     pkg.ListOrderStatusExecuting,
+		orders:          []*order{stop, limit},
+		transactionTime: s.now(),
+	}
+	if l.clientID == "" {
+		l.clientID = newClientOrderID()
+	}
+	s.lists = append(s.lists, l)
+	for _, o := range l.orders {
+		o.orderListID = l.id
+		o.list = l
+		s.addOrder(o)
+	}
+	limit.isWorking = true
+
+	u := newUpdate(sym)
+	s.lock(sym, limit, u)
+	for _, o := range l.orders {
+		s.publishExecutionReport(o, pkg.ExecutionNew, "", nil)
+	}
+	s.publishListStatus(l)
+	s.submit(sym, limit, u)
+	s.flush(u)
+	return s.listResponse(l, true), nil
+}
+
+// listTriggered expires other orders of the list of order o, which started
+// executing. Funds locked by the list move to o.
+func (s *Server) listTriggered(sym *symbol, o *order, u *update) {
+	l := o.list
+	if l.statusType == pkg.ListStatusAllDone {
+		return
+	}
+	for _, other := range l.orders {
+		if other == o || !other.active() {
+			continue
+		}
+		o.locked += other.locked
+		other.locked = 0
+		s.expire(sym, other, u)
+	}
+	s.finishList(l)
+}
+
+// cancelList cancels active orders of list, cancelID being client order ID
+// of the cancel request of requested order.
+func (s *Server) cancelList(sym *symbol, l *orderList, requested *order, cancelID string, u *update) {
+	for _, o := range l.orders {
+		if !o.active() {
+			continue
+		}
+		id := newClientOrderID()
+		if o == requested {
+			id = cancelID
+		}
+		s.cancel(sym, o, id, u)
+	}
+	s.finishList(l)
+}
+
+func (s *Server) finishList(l *orderList) {
+	l.statusType = pkg.ListStatusAllDone
+	l.orderStatus = pkg.ListOrderStatusAllDone
+	l.transactionTime = s.now()
+	s.publishListStatus(l)
+}
+
+// findList returns order list identified by orderListId or by client order
+// ID in clientIDParam param.
+func (s *Server) findList(params url.Values, clientIDParam string) (*orderList, *apiError) {
+	id, apiErr := intParam(params, "orderListId", 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	clientID := params.Get(clientIDParam)
+	if id == 0 && clientID == "" {
+		return nil, errorf(400, -1102, "Param '%s' or 'orderListId' must be sent, but both were empty/null!", clientIDParam)
+	}
+	for i := len(s.lists) - 1; i >= 0; i-- {
+		l := s.lists[i]
+		if (id != 0 && l.id == id) || (id == 0 && l.clientID == clientID) {
+			return l, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) queryOrderList(params url.Values) (interface{}, *apiError) {
+	l, apiErr := s.findList(params, "origClientOrderId")
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if l == nil {
+		return nil, errorf(400, -2013, "Order list does not exist.")
+	}
+	return s.listResponse(l, false), nil
+}
+
+func (s *Server) cancelOrderList(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	l, apiErr := s.findList(params, "listClientOrderId")
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if l == nil || l.symbol != sym.name || l.statusType == pkg.ListStatusAllDone {
+		return nil, errorf(400, -2011, "Unknown order sent.")
+	}
+	u := newUpdate(sym)
+	s.cancelList(sym, l, nil, "", u)
+	s.flush(u)
+	return s.listResponse(l, true), nil
+}
+
+// listResponse returns order list as returned by order list requests,
+// with reports of its orders if reports is set.
+func (s *Server) listResponse(l *orderList, reports bool) map[string]interface{} {
+	orders := []map[string]interface{}{}
+	orderReports := []map[string]interface{}{}
+	for _, o := range l.orders {
+		orders = append(orders, map[string]interface{}{
+			"symbol":        o.symbol,
+			"orderId":       o.orderID,
+			"clientOrderId": o.clientOrderID,
+		})
+		orderReports = append(orderReports, s.orderResponse(o, "RESULT", nil))
+	}
+	res := map[string]interface{}{
+		"orderListId":       l.id,
+		"contingencyType":   pkg.ContingencyOCO,
+		"listStatusType":    l.statusType,
+		"listOrderStatus":   l.orderStatus,
+		"listClientOrderId": l.clientID,
+		"transactionTime":   millis(l.transactionTime),
+		"symbol":            l.symbol,
+		"orders":            orders,
+	}
+	if reports {
+		res["orderReports"] = orderReports
+	}
+	return res
+}
+
+// publishListStatus sends listStatus event of list to user data streams.
+func (s *Server) publishListStatus(l *orderList) {
+	e := &pkg.ListStatusEvent{
+		WSEvent: pkg.WSEvent{
+			Type:   "listStatus",
+			Time:   l.transactionTime,
+			Symbol: l.symbol,
+		},
+		OrderListID:       l.id,
+		ContingencyType:   pkg.ContingencyOCO,
+		ListStatusType:    l.statusType,
+		ListOrderStatus:   l.orderStatus,
+		ListRejectReason:  "NONE",
+		ListClientOrderID: l.clientID,
+		TransactionTime:   l.transactionTime,
+	}
+	for _, o := range l.orders {
+		e.Orders = append(e.Orders, &pkg.ListStatusOrder{
+			Symbol:        o.symbol,
+			OrderID:       o.orderID,
+			ClientOrderID: o.clientOrderID,
+		})
+	}
+	s.publishUserData(e)
+}
@@ -0,0 +1,571 @@
+package binancetest
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// symbol holds scripted market data of single symbol.
+type symbol struct {
+	name       string
+	baseAsset  string
+	quoteAsset string
+
+	// bids and asks are resting orders in order of priority, i.e. by price
+	// (descending for bids) and then by order ID.
+	bids         []*order
+	asks         []*order
+	lastUpdateID int
+	lastTradeID  int64
+
+	aggTrades []*pkg.AggTrade
+	klines    map[pkg.Interval][]*pkg.Kline
+	ticker    *pkg.Ticker24
+}
+
+// AddSymbol makes symbol tradable with given base and quote asset. Symbols
+// referenced only by market data setters serve market data, but can't be
+// traded.
+func (s *Server) AddSymbol(name, baseAsset, quoteAsset string) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	sym.baseAsset = baseAsset
+	sym.quoteAsset = quoteAsset
+}
+
+// symbol returns symbol called name, creating it if necessary.
+func (s *Server) symbol(name string) *symbol {
+	sym, ok := s.symbols[name]
+	if !ok {
+		sym = &symbol{
+			name:   name,
+			klines: make(map[pkg.Interval][]*pkg.Kline),
+		}
+		s.symbols[name] = sym
+	}
+	return sym
+}
+
+// symbolParam returns symbol named by symbol param.
+func (s *Server) symbolParam(params url.Values) (*symbol, *apiError) {
+	name := params.Get("symbol")
+	if name == "" {
+		return nil, errMandatory("symbol")
+	}
+	sym, ok := s.symbols[name]
+	if !ok {
+		return nil, errInvalidSymbol
+	}
+	return sym, nil
+}
+
+// sortedSymbols returns all symbols ordered by name.
+func (s *Server) sortedSymbols() []*symbol {
+	var syms []*symbol
+	for _, sym := range s.symbols {
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].name < syms[j].name
+	})
+	return syms
+}
+
+// SetOrderBook replaces liquidity of other market participants in order
+// book of symbol by given price levels. Orders placed through the API are
+// kept. Levels are not matched against each other or against API orders.
+func (s *Server) SetOrderBook(name string, bids, asks []*pkg.Order) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	sym.bids = withoutExternal(sym.bids)
+	sym.asks = withoutExternal(sym.asks)
+	for _, o := range bids {
+		s.setExternal(sym, pkg.SideBuy, o.Price, o.Quantity)
+	}
+	for _, o := range asks {
+		s.setExternal(sym, pkg.SideSell, o.Price, o.Quantity)
+	}
+	sym.lastUpdateID++
+}
+
+// PushDepth sets quantity of other market participants at given price
+// levels of order book of symbol, zero quantity removing it, and sends
+// changed levels to depth streams of the symbol. Partial book streams receive
+// the updated book. Like SetOrderBook, it doesn't match orders; use
+// PlaceExternalOrder to trade against orders placed through the API.
+func (s *Server) PushDepth(name string, bids, asks []*pkg.Order) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	u := newUpdate(sym)
+	for _, o := range bids {
+		s.setExternal(sym, pkg.SideBuy, o.Price, o.Quantity)
+		u.touchLevel(pkg.SideBuy, o.Price)
+	}
+	for _, o := range asks {
+		s.setExternal(sym, pkg.SideSell, o.Price, o.Quantity)
+		u.touchLevel(pkg.SideSell, o.Price)
+	}
+	s.flush(u)
+}
+
+func withoutExternal(orders []*order) []*order {
+	var kept []*order
+	for _, o := range orders {
+		if !o.external {
+			kept = append(kept, o)
+		}
+	}
+	return kept
+}
+
+// setExternal sets remaining quantity of liquidity of other market
+// participants at price, removing it if quantity is zero.
+func (s *Server) setExternal(sym *symbol, side pkg.OrderSide, price, quantity float64) {
+	for _, o := range *sym.book(side) {
+		if o.external && o.price == price {
+			if quantity == 0 {
+				sym.remove(o)
+			} else {
+				o.origQty = o.executedQty + quantity
+			}
+			return
+		}
+	}
+	if quantity == 0 {
+		return
+	}
+	sym.insert(&order{
+		symbol:      sym.name,
+		orderID:     s.nextID(),
+		orderListID: -1,
+		external:    true,
+		side:        side,
+		orderType:   pkg.TypeLimit,
+		timeInForce: pkg.GTC,
+		price:       price,
+		origQty:     quantity,
+		status:      pkg.StatusNew,
+		isWorking:   true,
+	})
+}
+
+// book returns orders of side of the book.
+func (sym *symbol) book(side pkg.OrderSide) *[]*order {
+	if side == pkg.SideBuy {
+		return &sym.bids
+	}
+	return &sym.asks
+}
+
+// insert adds resting order to the book respecting price-time priority.
+func (sym *symbol) insert(o *order) {
+	book := sym.book(o.side)
+	i := sort.Search(len(*book), func(i int) bool {
+		other := (*book)[i]
+		if other.price != o.price {
+			if o.side == pkg.SideBuy {
+				return other.price < o.price
+			}
+			return other.price > o.price
+		}
+		return other.orderID > o.orderID
+	})
+	*book = append(*book, nil)
+	copy((*book)[i+1:], (*book)[i:])
+	(*book)[i] = o
+}
+
+// remove removes order from the book. It returns false if the order wasn't
+// there.
+func (sym *symbol) remove(o *order) bool {
+	book := sym.book(o.side)
+	for i, other := range *book {
+		if other == o {
+			*book = append((*book)[:i], (*book)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// levels aggregates orders into price levels.
+func levels(orders []*order) []*pkg.Order {
+	var levels []*pkg.Order
+	for _, o := range orders {
+		qty := o.remaining()
+		if n := len(levels); n > 0 && levels[n-1].Price == o.price {
+			levels[n-1].Quantity += qty
+			continue
+		}
+		levels = append(levels, &pkg.Order{Price: o.price, Quantity: qty})
+	}
+	return levels
+}
+
+// levelQty returns total remaining quantity of orders of side at price.
+func (sym *symbol) levelQty(side pkg.OrderSide, price float64) float64 {
+	var qty float64
+	for _, o := range *sym.book(side) {
+		if o.price == price {
+			qty += o.remaining()
+		}
+	}
+	return qty
+}
+
+// SetTicker24 sets 24hr statistics of symbol. Its LastPrice is served as
+// symbol price unless there are aggregated trades.
+func (s *Server) SetTicker24(name string, t *pkg.Ticker24) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.symbol(name).ticker = t
+}
+
+// AddAggTrades appends aggregated trades to history of symbol without
+// sending them to streams. Zero IDs are assigned sequentially.
+func (s *Server) AddAggTrades(name string, trades ...*pkg.AggTrade) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	for _, t := range trades {
+		sym.addAggTrade(t)
+	}
+}
+
+// PushAggTrade appends aggregated trade to history of symbol and sends it to
+// aggTrade streams of the symbol. Stop orders whose stop price is reached
+// by the trade are triggered.
+func (s *Server) PushAggTrade(name string, t *pkg.AggTrade) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	u := newUpdate(sym)
+	sym.addAggTrade(t)
+	u.trades = append(u.trades, t)
+	s.triggerStops(sym, u)
+	s.flush(u)
+}
+
+func (sym *symbol) addAggTrade(t *pkg.AggTrade) {
+	if t.ID == 0 {
+		t.ID = len(sym.aggTrades) + 1
+		if n := len(sym.aggTrades); n > 0 {
+			t.ID = sym.aggTrades[n-1].ID + 1
+		}
+	}
+	sym.aggTrades = append(sym.aggTrades, t)
+}
+
+// AddKlines adds klines to history of symbol without sending them to
+// streams. Kline with the same open time as existing one replaces it.
+func (s *Server) AddKlines(name string, interval pkg.Interval, klines ...*pkg.Kline) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	for _, k := range klines {
+		sym.addKline(interval, k)
+	}
+}
+
+// PushKline sends kline to kline streams of symbol and interval. Final
+// klines are also added to history.
+func (s *Server) PushKline(name string, interval pkg.Interval, k *pkg.Kline, final bool) {
+	s.mu.Lock()
+	defer s.unlock()
+	sym := s.symbol(name)
+	if final {
+		sym.addKline(interval, k)
+	}
+	s.publishKline(sym, interval, k, final)
+}
+
+func (sym *symbol) addKline(interval pkg.Interval, k *pkg.Kline) {
+	klines := sym.klines[interval]
+	i := sort.Search(len(klines), func(i int) bool {
+		return !klines[i].OpenTime.Before(k.OpenTime)
+	})
+	if i < len(klines) && klines[i].OpenTime.Equal(k.OpenTime) {
+		klines[i] = k
+		return
+	}
+	klines = append(klines, nil)
+	copy(klines[i+1:], klines[i:])
+	klines[i] = k
+	sym.klines[interval] = klines
+}
+
+// lastPrice returns price of the last aggregated trade, or ticker LastPrice.
+func (sym *symbol) lastPrice() (float64, bool) {
+	if n := len(sym.aggTrades); n > 0 {
+		return sym.aggTrades[n-1].Price, true
+	}
+	if sym.ticker != nil {
+		return sym.ticker.LastPrice, true
+	}
+	return 0, false
+}
+
+func rawLevels(levels []*pkg.Order, limit int) [][]string {
+	raw := [][]string{}
+	for i, o := range levels {
+		if i == limit {
+			break
+		}
+		raw = append(raw, []string{formatFloat(o.Price), formatFloat(o.Quantity)})
+	}
+	return raw
+}
+
+func (s *Server) depth(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	// Binance truncates depth to 5000 levels instead of rejecting larger
+	// limits.
+	if limit, _ := intParam(params, "limit", 0); limit > 5000 {
+		params.Set("limit", "5000")
+	}
+	limit, apiErr := limitParam(params, 100, 5000)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return map[string]interface{}{
+		"lastUpdateId": sym.lastUpdateID,
+		"bids":         rawLevels(levels(sym.bids), int(limit)),
+		"asks":         rawLevels(levels(sym.asks), int(limit)),
+	}, nil
+}
+
+func (s *Server) aggTrades(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	limit, apiErr := limitParam(params, 500, 1000)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	fromID, apiErr := intParam(params, "fromId", 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	start, end, apiErr := timeRange(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	res := []map[string]interface{}{}
+	for _, t := range sym.aggTrades {
+		ts := millis(t.Timestamp)
+		if int64(t.ID) < fromID || (start != 0 && ts < start) || (end != 0 && ts > end) {
+			continue
+		}
+		if int64(len(res)) == limit {
+			break
+		}
+		res = append(res, map[string]interface{}{
+			"a": t.ID,
+			"p": formatFloat(t.Price),
+			"q": formatFloat(t.Quantity),
+			"f": t.FirstTradeID,
+			"l": t.LastTradeID,
+			"T": ts,
+			"m": t.BuyerMaker,
+			"M": t.BestPriceMatch,
+		})
+	}
+	return res, nil
+}
+
+// timeRange returns startTime and endTime params, zero if not present.
+func timeRange(params url.Values) (int64, int64, *apiError) {
+	start, apiErr := intParam(params, "startTime", 0)
+	if apiErr != nil {
+		return 0, 0, apiErr
+	}
+	end, apiErr := intParam(params, "endTime", 0)
+	if apiErr != nil {
+		return 0, 0, apiErr
+	}
+	if start != 0 && end != 0 && start > end {
+		return 0, 0, errorf(400, -1128, "Combination of optional parameters invalid.")
+	}
+	return start, end, nil
+}
+
+func (s *Server) klines(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	interval := pkg.Interval(params.Get("interval"))
+	if interval == "" {
+		return nil, errMandatory("interval")
+	}
+	if !validInterval(interval) {
+		return nil, errorf(400, -1120, "Invalid interval.")
+	}
+	limit, apiErr := limitParam(params, 500, 1000)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	start, end, apiErr := timeRange(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var klines []*pkg.Kline
+	for _, k := range sym.klines[interval] {
+		if (start != 0 && millis(k.OpenTime) < start) || (end != 0 && millis(k.OpenTime) > end) {
+			continue
+		}
+		klines = append(klines, k)
+	}
+	// Without startTime the most recent klines are returned.
+	if int64(len(klines)) > limit {
+		if start != 0 {
+			klines = klines[:limit]
+		} else {
+			klines = klines[int64(len(klines))-limit:]
+		}
+	}
+
+	res := [][]interface{}{}
+	for _, k := range klines {
+		res = append(res, []interface{}{
+			millis(k.OpenTime),
+			formatFloat(k.Open),
+			formatFloat(k.High),
+			formatFloat(k.Low),
+			formatFloat(k.Close),
+			formatFloat(k.Volume),
+			millis(k.CloseTime),
+			formatFloat(k.QuoteAssetVolume),
+			k.NumberOfTrades,
+			formatFloat(k.TakerBuyBaseAssetVolume),
+			formatFloat(k.TakerBuyQuoteAssetVolume),
+			"0",
+		})
+	}
+	return res, nil
+}
+
+func validInterval(interval pkg.Interval) bool {
+	for _, i := range []pkg.Interval{
+		pkg.Minute, pkg.ThreeMinutes, pkg.FiveMinutes, pkg.FifteenMinutes, pkg.ThirtyMinutes,
+		pkg.Hour, pkg.TwoHours, pkg.FourHours, pkg.SixHours, pkg.EightHours, pkg.TwelveHours,
+		pkg.Day, pkg.ThreeDays, pkg.Week, pkg.Month,
+	} {
+		if i == interval {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) ticker24(params url.Values) (interface{}, *apiError) {
+	if params.Get("symbol") == "" {
+		res := []map[string]interface{}{}
+		for _, sym := range s.sortedSymbols() {
+			res = append(res, sym.rawTicker24())
+		}
+		return res, nil
+	}
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return sym.rawTicker24(), nil
+}
+
+func (sym *symbol) rawTicker24() map[string]interface{} {
+	t := sym.ticker
+	if t == nil {
+		t = &pkg.Ticker24{}
+	}
+	return map[string]interface{}{
+		"symbol":             sym.name,
+		"priceChange":        formatFloat(t.PriceChange),
+		"priceChangePercent": strconv.FormatFloat(t.PriceChangePercent, 'f', 3, 64),
+		"weightedAvgPrice":   formatFloat(t.WeightedAvgPrice),
+		"prevClosePrice":     formatFloat(t.PrevClosePrice),
+		"lastPrice":          formatFloat(t.LastPrice),
+		"bidPrice":           formatFloat(t.BidPrice),
+		"askPrice":           formatFloat(t.AskPrice),
+		"openPrice":          formatFloat(t.OpenPrice),
+		"highPrice":          formatFloat(t.HighPrice),
+		"lowPrice":           formatFloat(t.LowPrice),
+		"volume":             formatFloat(t.Volume),
+		"openTime":           millis(t.OpenTime),
+		"closeTime":          millis(t.CloseTime),
+		"firstId":            t.FirstID,
+		"lastId":             t.LastID,
+		"count":              t.Count,
+	}
+}
+
+func (s *Server) tickerPrice(params url.Values) (interface{}, *apiError) {
+	if params.Get("symbol") != "" {
+		sym, apiErr := s.symbolParam(params)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		price, _ := sym.lastPrice()
+		return rawPriceTicker(sym.name, price), nil
+	}
+	res := []map[string]string{}
+	for _, sym := range s.sortedSymbols() {
+		if price, ok := sym.lastPrice(); ok {
+			res = append(res, rawPriceTicker(sym.name, price))
+		}
+	}
+	return res, nil
+}
+
+func rawPriceTicker(name string, price float64) map[string]string {
+	return map[string]string{
+		"symbol": name,
+		"price":  formatFloat(price),
+	}
+}
+
+func (s *Server) bookTicker(params url.Values) (interface{}, *apiError) {
+	if params.Get("symbol") != "" {
+		sym, apiErr := s.symbolParam(params)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		return sym.rawBookTicker(), nil
+	}
+	res := []map[string]string{}
+	for _, sym := range s.sortedSymbols() {
+		if len(sym.bids) > 0 || len(sym.asks) > 0 {
+			res = append(res, sym.rawBookTicker())
+		}
+	}
+	return res, nil
+}
+
+func (sym *symbol) rawBookTicker() map[string]string {
+	bid, ask := &pkg.Order{}, &pkg.Order{}
+	if bids := levels(sym.bids); len(bids) > 0 {
+		bid = bids[0]
+	}
+	if asks := levels(sym.asks); len(asks) > 0 {
+		ask = asks[0]
+	}
+	return map[string]string{
+		"symbol":   sym.name,
+		"bidPrice": formatFloat(bid.Price),
+		"bidQty":   formatFloat(bid.Quantity),
+		"askPrice": formatFloat(ask.Price),
+		"askQty":   formatFloat(ask.Quantity),
+	}
+}
@@ -0,0 +1,660 @@
+package binancetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// order is order placed on the server.
+type order struct {
+	symbol              string
+	orderID             int64
+	orderListID         int64
+	clientOrderID       string
+	price               float64
+	origQty             float64
+	executedQty         float64
+	cummulativeQuoteQty float64
+	status              pkg.OrderStatus
+	timeInForce         pkg.TimeInForce
+	orderType           pkg.OrderType
+	side                pkg.OrderSide
+	stopPrice           float64
+	icebergQty          float64
+	time                time.Time
+	updateTime          time.Time
+	isWorking           bool
+
+	// external orders are liquidity of other market participants, which
+	// don't belong to the account.
+	external bool
+	// locked is amount of funds still locked by the order, lockPrice the
+	// price funds of buy order were locked at.
+	locked    float64
+	lockPrice float64
+	list      *orderList
+}
+
+// active reports whether order can still be filled or canceled.
+func (o *order) active() bool {
+	return o.status == pkg.StatusNew || o.status == pkg.StatusPartiallyFilled
+}
+
+// trade is user trade, i.e. fill of order placed on the server.
+type trade struct {
+	symbol          string
+	id              int64
+	orderID         int64
+	orderListID     int64
+	price           float64
+	qty             float64
+	quoteQty        float64
+	commission      float64
+	commissionAsset string
+	time            time.Time
+	isBuyer         bool
+	isMaker         bool
+}
+
+// orderTypes lists order types accepted by the server with flags of their
+// mandatory params.
+var orderTypes = map[pkg.OrderType]struct {
+	price       bool
+	stopPrice   bool
+	timeInForce bool
+}{
+	"LIMIT":             {price: true, timeInForce: true},
+	"MARKET":            {},
+	"STOP_LOSS":         {stopPrice: true},
+	"STOP_LOSS_LIMIT":   {price: true, stopPrice: true, timeInForce: true},
+	"TAKE_PROFIT":       {stopPrice: true},
+	"TAKE_PROFIT_LIMIT": {price: true, stopPrice: true, timeInForce: true},
+	"LIMIT_MAKER":       {price: true},
+}
+
+// SetBalance sets free amount of asset. Locked amount is kept.
+func (s *Server) SetBalance(asset string, free float64) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.balance(asset).Free = free
+}
+
+// Balances returns balances of all assets ordered by asset.
+func (s *Server) Balances() []*pkg.Balance {
+	s.mu.Lock()
+	defer s.unlock()
+	var balances []*pkg.Balance
+	for _, b := range s.sortedBalances() {
+		c := *b
+		balances = append(balances, &c)
+	}
+	return balances
+}
+
+// balance returns balance of asset, creating it if necessary.
+func (s *Server) balance(asset string) *pkg.Balance {
+	b, ok := s.balances[asset]
+	if !ok {
+		b = &pkg.Balance{Asset: asset}
+		s.balances[asset] = b
+	}
+	return b
+}
+
+func (s *Server) sortedBalances() []*pkg.Balance {
+	var balances []*pkg.Balance
+	for _, b := range s.balances {
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+	return balances
+}
+
+// Orders returns all orders placed on the server ordered by order ID.
+func (s *Server) Orders() []*pkg.ExecutedOrder {
+	s.mu.Lock()
+	defer s.unlock()
+	var orders []*pkg.ExecutedOrder
+	for _, o := range s.orders {
+		orders = append(orders, o.executedOrder())
+	}
+	return orders
+}
+
+// Order returns order with orderID.
+func (s *Server) Order(orderID int64) (*pkg.ExecutedOrder, bool) {
+	s.mu.Lock()
+	defer s.unlock()
+	for _, o := range s.orders {
+		if o.orderID == orderID {
+			return o.executedOrder(), true
+		}
+	}
+	return nil, false
+}
+
+func (o *order) executedOrder() *pkg.ExecutedOrder {
+	return &pkg.ExecutedOrder{
+		Symbol:        o.symbol,
+		OrderID:       int(o.orderID),
+		ClientOrderID: o.clientOrderID,
+		Price:         o.price,
+		OrigQty:       o.origQty,
+		ExecutedQty:   o.executedQty,
+		Status:        o.status,
+		TimeInForce:   o.timeInForce,
+		Type:          o.orderType,
+		Side:          o.side,
+		StopPrice:     o.stopPrice,
+		IcebergQty:    o.icebergQty,
+		Time:          o.time,
+	}
+}
+
+// parseOrder validates new order params and returns the order.
+func (s *Server) parseOrder(params url.Values) (*order, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if sym.baseAsset == "" {
+		return nil, errInvalidSymbol
+	}
+
+	o := &order{
+		symbol:        sym.name,
+		orderListID:   -1,
+		clientOrderID: params.Get("newClientOrderId"),
+		side:          pkg.OrderSide(params.Get("side")),
+		orderType:     pkg.OrderType(params.Get("type")),
+		timeInForce:   pkg.TimeInForce(params.Get("timeInForce")),
+		status:        pkg.StatusNew,
+	}
+	switch {
+	case o.side == "":
+		return nil, errMandatory("side")
+	case o.side != pkg.SideBuy && o.side != pkg.SideSell:
+		return nil, errorf(400, -1117, "Invalid side.")
+	case o.orderType == "":
+		return nil, errMandatory("type")
+	}
+	flags, ok := orderTypes[o.orderType]
+	if !ok {
+		return nil, errorf(400, -1116, "Invalid orderType.")
+	}
+
+	for _, f := range []struct {
+		dst  *float64
+		name string
+	}{
+		{&o.origQty, "quantity"},
+		{&o.price, "price"},
+		{&o.stopPrice, "stopPrice"},
+		{&o.icebergQty, "icebergQty"},
+	} {
+		if *f.dst, apiErr = floatParam(params, f.name); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	if o.origQty <= 0 {
+		return nil, errMandatory("quantity")
+	}
+	if flags.price && o.price <= 0 {
+		return nil, errMandatory("price")
+	}
+	if flags.stopPrice && o.stopPrice <= 0 {
+		return nil, errMandatory("stopPrice")
+	}
+	if flags.timeInForce {
+		switch o.timeInForce {
+		case "":
+			return nil, errMandatory("timeInForce")
+		case pkg.GTC, pkg.IOC, pkg.FOK:
+		default:
+			return nil, errorf(400, -1115, "Invalid timeInForce.")
+		}
+	} else {
+		o.timeInForce = pkg.GTC
+	}
+	if !flags.price {
+		o.price = 0
+	}
+
+	for _, other := range s.orders {
+		if other.active() && other.clientOrderID == o.clientOrderID && o.clientOrderID != "" {
+			return nil, errorf(400, -2010, "Duplicate order sent.")
+		}
+	}
+	return o, nil
+}
+
+func (s *Server) newOrder(params url.Values) (interface{}, *apiError) {
+	o, apiErr := s.parseOrder(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	sym := s.symbols[o.symbol]
+	if apiErr := s.checkOrder(sym, o); apiErr != nil {
+		return nil, apiErr
+	}
+	s.addOrder(o)
+	o.isWorking = !o.isStop()
+
+	u := newUpdate(sym)
+	s.lock(sym, o, u)
+	s.publishExecutionReport(o, pkg.ExecutionNew, "", nil)
+	fills := s.submit(sym, o, u)
+	s.triggerStops(sym, u)
+	s.flush(u)
+	return s.orderResponse(o, params.Get("newOrderRespType"), fills), nil
+}
+
+// addOrder assigns IDs to new order and adds it to orders of the account.
+func (s *Server) addOrder(o *order) {
+	o.orderID = s.nextID()
+	if o.clientOrderID == "" {
+		o.clientOrderID = newClientOrderID()
+	}
+	o.time = s.now()
+	o.updateTime = o.time
+	s.orders = append(s.orders, o)
+}
+
+// orderResponse returns response of new order request of respType, which
+// defaults to FULL for LIMIT and MARKET orders and to ACK for others.
+func (s *Server) orderResponse(o *order, respType string, fills []*trade) map[string]interface{} {
+	if respType == "" {
+		respType = "ACK"
+		if o.orderType == pkg.TypeLimit || o.orderType == pkg.TypeMarket {
+			respType = "FULL"
+		}
+	}
+	res := map[string]interface{}{
+		"symbol":        o.symbol,
+		"orderId":       o.orderID,
+		"orderListId":   o.orderListID,
+		"clientOrderId": o.clientOrderID,
+		"transactTime":  millis(o.updateTime),
+	}
+	if respType == "ACK" {
+		return res
+	}
+	for key, val := range o.raw() {
+		res[key] = val
+	}
+	delete(res, "time")
+	delete(res, "updateTime")
+	delete(res, "isWorking")
+	if respType == "FULL" {
+		rawFills := []map[string]interface{}{}
+		for _, t := range fills {
+			rawFills = append(rawFills, map[string]interface{}{
+				"price":           formatFloat(t.price),
+				"qty":             formatFloat(t.qty),
+				"commission":      formatFloat(t.commission),
+				"commissionAsset": t.commissionAsset,
+				"tradeId":         t.id,
+			})
+		}
+		res["fills"] = rawFills
+	}
+	return res
+}
+
+// raw returns order as returned by order queries.
+func (o *order) raw() map[string]interface{} {
+	return map[string]interface{}{
+		"symbol":                  o.symbol,
+		"orderId":                 o.orderID,
+		"orderListId":             o.orderListID,
+		"clientOrderId":           o.clientOrderID,
+		"price":                   formatFloat(o.price),
+		"origQty":                 formatFloat(o.origQty),
+		"executedQty":             formatFloat(o.executedQty),
+		"cummulativeQuoteQty":     formatFloat(o.cummulativeQuoteQty),
+		"status":                  o.status,
+		"timeInForce":             o.timeInForce,
+		"type":                    o.orderType,
+		"side":                    o.side,
+		"stopPrice":               formatFloat(o.stopPrice),
+		"icebergQty":              formatFloat(o.icebergQty),
+		"time":                    millis(o.time),
+		"updateTime":              millis(o.updateTime),
+		"isWorking":               o.isWorking,
+		"workingTime":             millis(o.time),
+		"origQuoteOrderQty":       formatFloat(0),
+		"selfTradePreventionMode": "NONE",
+	}
+}
+
+func newClientOrderID() string {
+	b := make([]byte, 11)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *Server) newOrderTest(params url.Values) (interface{}, *apiError) {
+	o, apiErr := s.parseOrder(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := s.checkOrder(s.symbols[o.symbol], o); apiErr != nil {
+		return nil, apiErr
+	}
+	return struct{}{}, nil
+}
+
+// findOrder returns order of symbol identified by orderId or
+// origClientOrderId param.
+func (s *Server) findOrder(params url.Values) (*order, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	orderID, apiErr := intParam(params, "orderId", 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	clientOrderID := params.Get("origClientOrderId")
+	if orderID == 0 && clientOrderID == "" {
+		return nil, errorf(400, -1102, "Param 'origClientOrderId' or 'orderId' must be sent, but both were empty/null!")
+	}
+	// The latest order wins, client order IDs can be reused once orders
+	// are done.
+	for i := len(s.orders) - 1; i >= 0; i-- {
+		o := s.orders[i]
+		if o.symbol != sym.name {
+			continue
+		}
+		if (orderID != 0 && o.orderID == orderID) || (orderID == 0 && o.clientOrderID == clientOrderID) {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) queryOrder(params url.Values) (interface{}, *apiError) {
+	o, apiErr := s.findOrder(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if o == nil {
+		return nil, errorf(400, -2013, "Order does not exist.")
+	}
+	return o.raw(), nil
+}
+
+func (s *Server) cancelOrder(params url.Values) (interface{}, *apiError) {
+	o, apiErr := s.findOrder(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if o == nil || !o.active() {
+		return nil, errorf(400, -2011, "Unknown order sent.")
+	}
+	cancelID := params.Get("newClientOrderId")
+	if cancelID == "" {
+		cancelID = newClientOrderID()
+	}
+	sym := s.symbols[o.symbol]
+	u := newUpdate(sym)
+	if o.list != nil {
+		// Canceling an order of a list cancels the whole list.
+		s.cancelList(sym, o.list, o, cancelID, u)
+	} else {
+		s.cancel(sym, o, cancelID, u)
+	}
+	s.flush(u)
+
+	res := o.raw()
+	res["origClientOrderId"] = o.clientOrderID
+	res["clientOrderId"] = cancelID
+	return res, nil
+}
+
+func (s *Server) openOrders(params url.Values) (interface{}, *apiError) {
+	name := params.Get("symbol")
+	if name != "" {
+		if _, apiErr := s.symbolParam(params); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	res := []map[string]interface{}{}
+	for _, o := range s.orders {
+		if o.active() && (name == "" || o.symbol == name) {
+			res = append(res, o.raw())
+		}
+	}
+	return res, nil
+}
+
+func (s *Server) allOrders(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	orderID, apiErr := intParam(params, "orderId", 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	limit, apiErr := limitParam(params, 500, 1000)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	var orders []*order
+	for _, o := range s.orders {
+		if o.symbol == sym.name && o.orderID >= orderID {
+			orders = append(orders, o)
+		}
+	}
+	// Without orderId the most recent orders are returned.
+	if int64(len(orders)) > limit {
+		if orderID != 0 {
+			orders = orders[:limit]
+		} else {
+			orders = orders[int64(len(orders))-limit:]
+		}
+	}
+	res := []map[string]interface{}{}
+	for _, o := range orders {
+		res = append(res, o.raw())
+	}
+	return res, nil
+}
+
+func (s *Server) account(params url.Values) (interface{}, *apiError) {
+	balances := []map[string]string{}
+	for _, b := range s.sortedBalances() {
+		balances = append(balances, map[string]string{
+			"asset":  b.Asset,
+			"free":   formatFloat(b.Free),
+			"locked": formatFloat(b.Locked),
+		})
+	}
+	return map[string]interface{}{
+		"makerCommission":  s.makerCommission,
+		"takerCommission":  s.takerCommission,
+		"buyerCommission":  0,
+		"sellerCommission": 0,
+		"canTrade":         true,
+		"canWithdraw":      true,
+		"canDeposit":       true,
+		"updateTime":       millis(s.now()),
+		"accountType":      "SPOT",
+		"balances":         balances,
+		"permissions":      []string{"SPOT"},
+	}, nil
+}
+
+// millis24h is the longest time range of myTrades in milliseconds.
+const millis24h = 24 * 60 * 60 * 1000
+
+func (s *Server) myTrades(params url.Values) (interface{}, *apiError) {
+	sym, apiErr := s.symbolParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	fromID, apiErr := intParam(params, "fromId", 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	limit, apiErr := limitParam(params, 500, 1000)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	start, end, apiErr := timeRange(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if start != 0 && end != 0 && end-start > millis24h {
+		return nil, errorf(400, -1127, "More than 24 hours between startTime and endTime.")
+	}
+	var trades []*trade
+	for _, t := range s.trades {
+		ts := millis(t.time)
+		if t.symbol == sym.name && t.id >= fromID && (start == 0 || ts >= start) && (end == 0 || ts <= end) {
+			trades = append(trades, t)
+		}
+	}
+	// Without fromId or startTime the most recent trades are returned.
+	if int64(len(trades)) > limit {
+		if fromID != 0 || start != 0 {
+			trades = trades[:limit]
+		} else {
+			trades = trades[int64(len(trades))-limit:]
+		}
+	}
+	res := []map[string]interface{}{}
+	for _, t := range trades {
+		res = append(res, map[string]interface{}{
+			"symbol":          t.symbol,
+			"id":              t.id,
+			"orderId":         t.orderID,
+			"orderListId":     t.orderListID,
+			"price":           formatFloat(t.price),
+			"qty":             formatFloat(t.qty),
+			"quoteQty":        formatFloat(t.quoteQty),
+			"commission":      formatFloat(t.commission),
+			"commissionAsset": t.commissionAsset,
+			"time":            millis(t.time),
+			"isBuyer":         t.isBuyer,
+			"isMaker":         t.isMaker,
+			"isBestMatch":     true,
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) startUserDataStream(params url.Values) (interface{}, *apiError) {
+	// Like Binance, the active listen key of the account is returned if
+	// there's one.
+	for key := range s.listenKeys {
+		return map[string]string{"listenKey": key}, nil
+	}
+	b := make([]byte, 30)
+	rand.Read(b)
+	key := hex.EncodeToString(b)
+	s.listenKeys[key] = true
+	return map[string]string{"listenKey": key}, nil
+}
+
+func (s *Server) listenKeyParam(params url.Values) (string, *apiError) {
+	key := params.Get("listenKey")
+	if key == "" {
+		return "", errMandatory("listenKey")
+	}
+	if !s.listenKeys[key] {
+		return "", errorf(400, -1125, "This listenKey does not exist.")
+	}
+	return key, nil
+}
+
+func (s *Server) keepAliveUserDataStream(params url.Values) (interface{}, *apiError) {
+	if _, apiErr := s.listenKeyParam(params); apiErr != nil {
+		return nil, apiErr
+	}
+	return struct{}{}, nil
+}
+
+func (s *Server) closeUserDataStream(params url.Values) (interface{}, *apiError) {
+	key, apiErr := s.listenKeyParam(params)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	delete(s.listenKeys, key)
+	s.closeStream(key)
+	return struct{}{}, nil
+}
+
+// ExpireListenKey sends listenKeyExpired event to user data streams of the
+// active listen key, closes them and invalidates the key. It returns false if
+// there's no active listen key.
+func (s *Server) ExpireListenKey() bool {
+	s.mu.Lock()
+	defer s.unlock()
+	for key := range s.listenKeys {
+		s.publishUserData(&pkg.ListenKeyExpiredEvent{
+			WSEvent:   pkg.WSEvent{Type: "listenKeyExpired"},
+			ListenKey: key,
+		})
+		delete(s.listenKeys, key)
+		s.closeStream(key)
+		return true
+	}
+	return false
+}
+
+// publishExecutionReport sends executionReport event of order o to user
+// data streams. cancelID is client order ID of cancel request, t the trade
+// of TRADE execution.
+func (s *Server) publishExecutionReport(o *order, execType pkg.ExecutionType, cancelID string, t *trade) {
+	er := &pkg.ExecutionReportEvent{
+		WSEvent: pkg.WSEvent{
+			Type:   "executionReport",
+			Time:   o.updateTime,
+			Symbol: o.symbol,
+		},
+		ClientOrderID:           o.clientOrderID,
+		Side:                    o.side,
+		OrderType:               o.orderType,
+		TimeInForce:             o.timeInForce,
+		Quantity:                o.origQty,
+		Price:                   o.price,
+		StopPrice:               o.stopPrice,
+		IcebergQty:              o.icebergQty,
+		OrderListID:             o.orderListID,
+		ExecutionType:           execType,
+		Status:                  o.status,
+		RejectReason:            "NONE",
+		OrderID:                 o.orderID,
+		CumulativeFilledQty:     o.executedQty,
+		TransactionTime:         o.updateTime,
+		TradeID:                 -1,
+		IsWorking:               o.isWorking,
+		OrderCreationTime:       o.time,
+		CumulativeQuoteQty:      o.cummulativeQuoteQty,
+		WorkingTime:             o.time,
+		SelfTradePreventionMode: "NONE",
+	}
+	if cancelID != "" {
+		er.ClientOrderID = cancelID
+		er.OrigClientOrderID = o.clientOrderID
+	}
+	if t != nil {
+		er.LastExecutedQty = t.qty
+		er.LastExecutedPrice = t.price
+		er.LastQuoteQty = t.quoteQty
+		er.Commission = t.commission
+		er.CommissionAsset = t.commissionAsset
+		er.TradeID = t.id
+		er.IsMaker = t.isMaker
+	}
+	s.publishUserData(er)
+}
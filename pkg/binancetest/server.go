@@ -0,0 +1,483 @@
+// Package binancetest implements in-process fake Binance exchange for
+// integration tests.
+//
+// Server serves REST endpoints and websocket streams used by pkg.Service, so
+// that the real client, including its parsing, signing and stream handling,
+// can be tested offline:
+//
+//	srv := binancetest.NewServer(binancetest.WithHMACKey("key", []byte("secret")))
+//	defer srv.Close()
+//	service := pkg.NewAPIService("", "key", &pkg.HmacSigner{Key: []byte("secret")}, nil, ctx,
+//		pkg.WithEnvironment(srv.Environment()))
+//
+// Signed requests are verified like Binance does, i.e. signature of known API
+// key over query string concatenated with body and timestamp within
+// recvWindow. Failures are reported with Binance error codes and messages.
+//
+// Market data is scripted by tests (SetOrderBook, PushAggTrade, ...), placed
+// orders can be inspected with Orders.
+//
+// Orders placed through the API are matched in price-time priority against
+// the book, which holds scripted liquidity of other market participants
+// alongside resting orders of the account. LIMIT, MARKET, LIMIT_MAKER, stop
+// and OCO orders are supported with GTC, IOC and FOK time in force. Fills
+// update balances, charging commission in the received asset, and are sent
+// to user data, depth and trade streams. Stop orders trigger on trades,
+// either pushed by PushAggTrade or made by the engine. PlaceExternalOrder
+// trades against orders of the account on behalf of other participants.
+package binancetest
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// DefaultRecvWindow is recvWindow applied to signed requests without one.
+const DefaultRecvWindow = 5000
+
+// Option configures Server created by NewServer.
+type Option func(*Server)
+
+// WithHMACKey registers API key with HMAC SHA256 secret.
+func WithHMACKey(apiKey string, secret []byte) Option {
+	return func(s *Server) {
+		s.keys[apiKey] = func(payload, signature string) bool {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write([]byte(payload))
+			expected := hex.EncodeToString(mac.Sum(nil))
+			return hmac.Equal([]byte(expected), []byte(signature))
+		}
+	}
+}
+
+// WithEd25519Key registers API key with Ed25519 public key.
+func WithEd25519Key(apiKey string, pub ed25519.PublicKey) Option {
+	return func(s *Server) {
+		s.keys[apiKey] = func(payload, signature string) bool {
+			sig, err := base64.StdEncoding.DecodeString(signature)
+			return err == nil && ed25519.Verify(pub, []byte(payload), sig)
+		}
+	}
+}
+
+// WithRSAKey registers API key with RSA public key.
+func WithRSAKey(apiKey string, pub *rsa.PublicKey) Option {
+	return func(s *Server) {
+		s.keys[apiKey] = func(payload, signature string) bool {
+			sig, err := base64.StdEncoding.DecodeString(signature)
+			if err != nil {
+				return false
+			}
+			hash := sha256.Sum256([]byte(payload))
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) == nil
+		}
+	}
+}
+
+// WithClock makes Server use now as its clock, both for timestamp
+// verification and for times of responses and events.
+func WithClock(now func() time.Time) Option {
+	return func(s *Server) {
+		s.now = now
+	}
+}
+
+// WithCommission sets maker and taker commission rates of the account in
+// units of 0.01%, 10 (0.1%) by default. Commission is charged in the
+// received asset.
+func WithCommission(maker, taker int64) Option {
+	return func(s *Server) {
+		s.makerCommission = maker
+		s.takerCommission = taker
+	}
+}
+
+// Request is request received by Server.
+type Request struct {
+	Method string
+	// Endpoint is path without leading slash, e.g. "api/v3/order".
+	Endpoint string
+	// Params are query and body params, including signature.
+	Params url.Values
+	APIKey string
+}
+
+// Server is fake Binance exchange.
+type Server struct {
+	// URL is base URL of the server, e.g. http://127.0.0.1:8080.
+	URL string
+
+	srv  *httptest.Server
+	keys map[string]func(payload, signature string) bool
+	now  func() time.Time
+	hub  *hub
+	// publishMu serializes sending of outbox, so that messages are
+	// delivered in order they were published.
+	publishMu sync.Mutex
+
+	mu sync.Mutex
+	// outbox are messages published while holding mu, sent by unlock.
+	outbox []outMessage
+	// queued is set when current holder of mu queued messages.
+	queued   bool
+	requests []Request
+	failures map[string][]failure
+	symbols  map[string]*symbol
+	balances map[string]*pkg.Balance
+	orders   []*order
+	lists    []*orderList
+	trades   []*trade
+	// makerCommission and takerCommission are commission rates in units
+	// of 0.01%.
+	makerCommission int64
+	takerCommission int64
+	// listenKeys are active user data stream listen keys.
+	listenKeys map[string]bool
+	lastID     int64
+}
+
+type failure struct {
+	status int
+	err    pkg.Error
+}
+
+// NewServer starts Server configured by opts. It must be closed by Close.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		keys:       make(map[string]func(payload, signature string) bool),
+		now:        time.Now,
+		hub:        newHub(),
+		failures:   make(map[string][]failure),
+		symbols:    make(map[string]*symbol),
+		balances:   make(map[string]*pkg.Balance),
+		listenKeys: make(map[string]bool),
+
+		makerCommission: 10,
+		takerCommission: 10,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close closes websocket streams and shuts down the server.
+func (s *Server) Close() {
+	s.hub.closeAll()
+	s.srv.Close()
+}
+
+// Environment returns pkg.Environment pointing REST and streams to the server.
+func (s *Server) Environment() pkg.Environment {
+	return pkg.CustomEnvironment(s.URL)
+}
+
+// Requests returns requests received so far, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// FailNext makes the next request to endpoint (e.g. "POST api/v3/order" or
+// just "api/v3/order" for any method) fail with status and Binance error.
+// Subsequent calls queue further failures.
+func (s *Server) FailNext(endpoint string, status int, err pkg.Error) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failure{status: status, err: err})
+}
+
+func (s *Server) nextFailure(method, endpoint string) (failure, bool) {
+	for _, key := range []string{method + " " + endpoint, endpoint} {
+		if fs := s.failures[key]; len(fs) > 0 {
+			s.failures[key] = fs[1:]
+			return fs[0], true
+		}
+	}
+	return failure{}, false
+}
+
+func (s *Server) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+// security is security type of endpoint.
+type security int
+
+const (
+	// public endpoints need neither API key nor signature.
+	public security = iota
+	// userStream endpoints need API key.
+	userStream
+	// signed endpoints need API key, signature and timestamp.
+	signed
+)
+
+type route struct {
+	security security
+	handle   func(s *Server, params url.Values) (interface{}, *apiError)
+}
+
+// routes maps "METHOD endpoint" to its handler.
+var routes = map[string]route{
+	"GET api/v3/ping":              {public, (*Server).ping},
+	"GET api/v3/time":              {public, (*Server).time},
+	"GET api/v3/depth":             {public, (*Server).depth},
+	"GET api/v3/aggTrades":         {public, (*Server).aggTrades},
+	"GET api/v3/klines":            {public, (*Server).klines},
+	"GET api/v3/ticker/24hr":       {public, (*Server).ticker24},
+	"GET api/v3/ticker/price":      {public, (*Server).tickerPrice},
+	"GET api/v3/ticker/bookTicker": {public, (*Server).bookTicker},
+	"POST api/v3/order":            {signed, (*Server).newOrder},
+	"POST api/v3/order/test":       {signed, (*Server).newOrderTest},
+	"GET api/v3/order":             {signed, (*Server).queryOrder},
+	"DELETE api/v3/order":          {signed, (*Server).cancelOrder},
+	"POST api/v3/order/oco":        {signed, (*Server).newOCO},
+	"GET api/v3/orderList":         {signed, (*Server).queryOrderList},
+	"DELETE api/v3/orderList":      {signed, (*Server).cancelOrderList},
+	"GET api/v3/openOrders":        {signed, (*Server).openOrders},
+	"GET api/v3/allOrders":         {signed, (*Server).allOrders},
+	"GET api/v3/account":           {signed, (*Server).account},
+	"GET api/v3/myTrades":          {signed, (*Server).myTrades},
+	"POST api/v3/userDataStream":   {userStream, (*Server).startUserDataStream},
+	"PUT api/v3/userDataStream":    {userStream, (*Server).keepAliveUserDataStream},
+	"DELETE api/v3/userDataStream": {userStream, (*Server).closeUserDataStream},
+}
+
+// apiError is Binance error response.
+type apiError struct {
+	status int
+	pkg.Error
+}
+
+func errorf(status, code int, format string, args ...interface{}) *apiError {
+	return &apiError{
+		status: status,
+		Error:  pkg.Error{Code: code, Message: fmt.Sprintf(format, args...)},
+	}
+}
+
+func errMandatory(param string) *apiError {
+	return errorf(400, -1102, "Mandatory parameter '%s' was not sent, was empty/null, or malformed.", param)
+}
+
+var (
+	errInvalidSymbol    = errorf(400, -1121, "Invalid symbol.")
+	errInvalidSignature = errorf(400, -1022, "Signature for this request is not valid.")
+	errAPIKeyFormat     = errorf(401, -2014, "API-key format invalid.")
+	errInvalidAPIKey    = errorf(401, -2015, "Invalid API-key, IP, or permissions for action.")
+
+	errInsufficientBalance = errorf(400, -2010, "Account has insufficient balance for requested action.")
+)
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/ws/") {
+		s.serveStream(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	endpoint := strings.TrimPrefix(r.URL.Path, "/")
+	params, err := requestParams(r.URL.RawQuery, string(body))
+	if err != nil {
+		writeError(w, errorf(400, -1100, "Illegal characters found in parameter."))
+		return
+	}
+	apiKey := r.Header.Get("X-MBX-APIKEY")
+
+	s.mu.Lock()
+	defer s.unlock()
+	s.requests = append(s.requests, Request{
+		Method:   r.Method,
+		Endpoint: endpoint,
+		Params:   params,
+		APIKey:   apiKey,
+	})
+
+	rt, ok := routes[r.Method+" "+endpoint]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if rt.security != public {
+		if apiErr := s.authenticate(apiKey, rt.security, r.URL.RawQuery, string(body), params); apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+	}
+	if f, ok := s.nextFailure(r.Method, endpoint); ok {
+		writeError(w, &apiError{status: f.status, Error: f.err})
+		return
+	}
+	res, apiErr := rt.handle(s, params)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	json.NewEncoder(w).Encode(res)
+}
+
+// requestParams merges query and body params.
+func requestParams(query, body string) (url.Values, error) {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	bodyParams, err := url.ParseQuery(body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range bodyParams {
+		params[key] = append(params[key], values...)
+	}
+	return params, nil
+}
+
+// authenticate checks API key and, for signed endpoints, signature over
+// totalParams and timestamp.
+func (s *Server) authenticate(apiKey string, sec security, query, body string, params url.Values) *apiError {
+	if apiKey == "" {
+		return errAPIKeyFormat
+	}
+	verify, ok := s.keys[apiKey]
+	if !ok {
+		return errInvalidAPIKey
+	}
+	if sec != signed {
+		return nil
+	}
+
+	signature := params.Get("signature")
+	if signature == "" {
+		return errMandatory("signature")
+	}
+	if !verify(stripSignature(query)+stripSignature(body), signature) {
+		return errInvalidSignature
+	}
+
+	timestamp, err := strconv.ParseInt(params.Get("timestamp"), 10, 64)
+	if err != nil {
+		return errMandatory("timestamp")
+	}
+	recvWindow := int64(DefaultRecvWindow)
+	if raw := params.Get("recvWindow"); raw != "" {
+		if recvWindow, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return errorf(400, -1100, "Illegal characters found in parameter 'recvWindow'; legal range is '^[0-9]{1,20}$'.")
+		}
+		if recvWindow > 60000 {
+			return errorf(400, -1131, "recvWindow must be less than 60000")
+		}
+	}
+	now := millis(s.now())
+	if timestamp >= now+1000 {
+		return errorf(400, -1021, "Timestamp for this request was 1000ms ahead of the server's time.")
+	}
+	if now-timestamp > recvWindow {
+		return errorf(400, -1021, "Timestamp for this request is outside of the recvWindow.")
+	}
+	return nil
+}
+
+// stripSignature removes signature param from URL encoded params.
+func stripSignature(raw string) string {
+	var parts []string
+	for _, part := range strings.Split(raw, "&") {
+		if part != "" && !strings.HasPrefix(part, "signature=") {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func writeError(w http.ResponseWriter, apiErr *apiError) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.WriteHeader(apiErr.status)
+	json.NewEncoder(w).Encode(apiErr.Error)
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// formatFloat formats amounts the way Binance does, with 8 decimals.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 8, 64)
+}
+
+// intParam returns integer param, def if it's not present.
+func intParam(params url.Values, name string, def int64) (int64, *apiError) {
+	raw := params.Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, errorf(400, -1100, "Illegal characters found in parameter '%s'; legal range is '^[0-9]{1,20}$'.", name)
+	}
+	return n, nil
+}
+
+// floatParam returns decimal param, zero if it's not present.
+func floatParam(params url.Values, name string) (float64, *apiError) {
+	raw := params.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, errorf(400, -1100, "Illegal characters found in parameter '%s'; legal range is '^([0-9]{1,20})(\\.[0-9]{1,20})?$'.", name)
+	}
+	return f, nil
+}
+
+// limitParam returns limit param, def if it's not present. Limits out of
+// 1 to max are rejected like Binance does.
+func limitParam(params url.Values, def, max int64) (int64, *apiError) {
+	limit, apiErr := intParam(params, "limit", def)
+	if apiErr != nil {
+		return 0, apiErr
+	}
+	if limit < 1 || limit > max {
+		return 0, errorf(400, -1130, "Data sent for parameter 'limit' is not valid.")
+	}
+	return limit, nil
+}
+
+func (s *Server) ping(params url.Values) (interface{}, *apiError) {
+	return struct{}{}, nil
+}
+
+func (s *Server) time(params url.Values) (interface{}, *apiError) {
+	return map[string]int64{"serverTime": millis(s.now())}, nil
+}
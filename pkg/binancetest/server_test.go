@@ -0,0 +1,188 @@
+package binancetest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAPIKey = "test-key"
+	testSecret = "test-secret"
+)
+
+func newTestService(t *testing.T, opts ...Option) (*Server, pkg.Service) {
+	srv := NewServer(append([]Option{WithHMACKey(testAPIKey, []byte(testSecret))}, opts...)...)
+	t.Cleanup(srv.Close)
+	service := pkg.NewAPIService("", testAPIKey, &pkg.HmacSigner{Key: []byte(testSecret)}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	return srv, service
+}
+
+func TestMarketData(t *testing.T) {
+	srv, service := newTestService(t)
+	open := time.Unix(1600000000, 0)
+	srv.SetOrderBook("BNBBTC",
+		[]*pkg.Order{{Price: 0.0019, Quantity: 2}, {Price: 0.002, Quantity: 1}},
+		[]*pkg.Order{{Price: 0.0022, Quantity: 4}, {Price: 0.0021, Quantity: 3}})
+	srv.AddKlines("BNBBTC", pkg.Minute,
+		&pkg.Kline{OpenTime: open.Add(time.Minute), Close: 2},
+		&pkg.Kline{OpenTime: open, Close: 1})
+	srv.AddAggTrades("BNBBTC", &pkg.AggTrade{Price: 0.00205, Quantity: 1, Timestamp: open})
+	srv.SetTicker24("BNBBTC", &pkg.Ticker24{LastPrice: 0.002, Volume: 100})
+
+	require.NoError(t, service.Ping())
+
+	ob, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC", Limit: 5})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Order{{Price: 0.002, Quantity: 1}, {Price: 0.0019, Quantity: 2}}, ob.Bids)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0021, Quantity: 3}, {Price: 0.0022, Quantity: 4}}, ob.Asks)
+
+	klines, err := service.Klines(pkg.KlinesRequest{Symbol: "BNBBTC", Interval: pkg.Minute})
+	require.NoError(t, err)
+	require.Len(t, klines, 2)
+	assert.Equal(t, 1.0, klines[0].Close)
+	assert.Equal(t, open.Add(time.Minute), klines[1].OpenTime)
+
+	trades, err := service.AggTrades(pkg.AggTradesRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	require.Len(t, trades, 1)
+	assert.Equal(t, 1, trades[0].ID)
+	assert.Equal(t, 0.00205, trades[0].Price)
+
+	t24, err := service.Ticker24(pkg.TickerRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, t24.Volume)
+
+	prices, err := service.TickerAllPrices()
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.PriceTicker{{Symbol: "BNBBTC", Price: 0.00205}}, prices)
+
+	books, err := service.TickerAllBooks()
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.BookTicker{{Symbol: "BNBBTC", BidPrice: 0.002, BidQty: 1, AskPrice: 0.0021, AskQty: 3}}, books)
+
+	_, err = service.OrderBook(pkg.OrderBookRequest{Symbol: "ETHBTC"})
+	assert.Equal(t, &pkg.Error{Code: -1121, Message: "Invalid symbol."}, err)
+}
+
+func TestLimitOutOfRange(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddKlines("BNBBTC", pkg.Minute, &pkg.Kline{OpenTime: time.Unix(1600000000, 0), Close: 1})
+	invalid := &pkg.Error{Code: -1130, Message: "Data sent for parameter 'limit' is not valid."}
+
+	_, err := service.Klines(pkg.KlinesRequest{Symbol: "BNBBTC", Interval: pkg.Minute, Limit: 1001})
+	assert.Equal(t, invalid, err)
+	_, err = service.Klines(pkg.KlinesRequest{Symbol: "BNBBTC", Interval: pkg.Minute, Limit: -1})
+	assert.Equal(t, invalid, err)
+	_, err = service.AggTrades(pkg.AggTradesRequest{Symbol: "BNBBTC", Limit: 1001})
+	assert.Equal(t, invalid, err)
+	_, err = service.MyTrades(pkg.MyTradesRequest{Symbol: "BNBBTC", Limit: 1001, Timestamp: time.Now()})
+	assert.Equal(t, invalid, err)
+	klines, err := service.Klines(pkg.KlinesRequest{Symbol: "BNBBTC", Interval: pkg.Minute, Limit: 1000})
+	require.NoError(t, err)
+	assert.Len(t, klines, 1)
+
+	// Depth is truncated instead.
+	_, err = service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC", Limit: 10000})
+	assert.NoError(t, err)
+}
+
+func TestOrders(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	srv := NewServer(WithEd25519Key("ed-key", pub))
+	defer srv.Close()
+	service := pkg.NewAPIService("", "ed-key", &pkg.Ed25519Signer{Key: priv}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetBalance("BTC", 1)
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:           "BNBBTC",
+		Side:             pkg.SideBuy,
+		Type:             pkg.TypeLimit,
+		TimeInForce:      pkg.GTC,
+		Quantity:         10,
+		Price:            0.002,
+		NewClientOrderID: "my-order",
+		Timestamp:        time.Now(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "my-order", po.ClientOrderID)
+
+	orders := srv.Orders()
+	require.Len(t, orders, 1)
+	assert.Equal(t, pkg.StatusNew, orders[0].Status)
+	assert.Equal(t, 10.0, orders[0].OrigQty)
+
+	eo, err := service.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrigClientOrderID: "my-order", Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, int(po.OrderID), eo.OrderID)
+	assert.Equal(t, 0.002, eo.Price)
+
+	open, err := service.OpenOrders(pkg.OpenOrdersRequest{Symbol: "BNBBTC", Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Len(t, open, 1)
+
+	co, err := service.CancelOrder(pkg.CancelOrderRequest{Symbol: "BNBBTC", OrderID: po.OrderID, Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, "my-order", co.OrigClientOrderID)
+
+	_, err = service.CancelOrder(pkg.CancelOrderRequest{Symbol: "BNBBTC", OrderID: po.OrderID, Timestamp: time.Now()})
+	assert.Equal(t, &pkg.Error{Code: -2011, Message: "Unknown order sent."}, err)
+	_, err = service.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrderID: 42, Timestamp: time.Now()})
+	assert.Equal(t, &pkg.Error{Code: -2013, Message: "Order does not exist."}, err)
+
+	all, err := service.AllOrders(pkg.AllOrdersRequest{Symbol: "BNBBTC", Timestamp: time.Now()})
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, pkg.StatusCancelled, all[0].Status)
+
+	acc, err := service.Account(pkg.AccountRequest{Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Balance{{Asset: "BTC", Free: 1}}, acc.Balances)
+
+	err = service.NewOrderTest(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: "HOLD", Type: pkg.TypeMarket, Quantity: 1, Timestamp: time.Now()})
+	assert.Equal(t, &pkg.Error{Code: -1117, Message: "Invalid side."}, err)
+}
+
+func TestAuthentication(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.002, Quantity: 1}}, nil)
+	srv.SetBalance("BNB", 1)
+
+	_, err := service.Account(pkg.AccountRequest{Timestamp: time.Now().Add(-time.Minute)})
+	assert.Equal(t, &pkg.Error{Code: -1021, Message: "Timestamp for this request is outside of the recvWindow."}, err)
+	_, err = service.Account(pkg.AccountRequest{Timestamp: time.Now().Add(-30 * time.Second), RecvWindow: 45 * time.Second})
+	assert.NoError(t, err)
+
+	wrongSecret := pkg.NewAPIService("", testAPIKey, &pkg.HmacSigner{Key: []byte("wrong")}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	_, err = wrongSecret.Account(pkg.AccountRequest{Timestamp: time.Now()})
+	assert.Equal(t, &pkg.Error{Code: -1022, Message: "Signature for this request is not valid."}, err)
+
+	unknownKey := pkg.NewAPIService("", "unknown", &pkg.HmacSigner{Key: []byte(testSecret)}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	_, err = unknownKey.StartUserDataStream()
+	assert.Equal(t, &pkg.Error{Code: -2015, Message: "Invalid API-key, IP, or permissions for action."}, err)
+
+	srv.FailNext("POST api/v3/order", 503, pkg.Error{Code: -1001, Message: "Internal error; unable to process your request. Please try again."})
+	_, err = service.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideSell, Type: pkg.TypeMarket, Quantity: 1, Timestamp: time.Now()})
+	assert.Equal(t, -1001, err.(*pkg.Error).Code)
+	_, err = service.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideSell, Type: pkg.TypeMarket, Quantity: 1, Timestamp: time.Now()})
+	assert.NoError(t, err)
+
+	requests := srv.Requests()
+	require.NotEmpty(t, requests)
+	last := requests[len(requests)-1]
+	assert.Equal(t, "api/v3/order", last.Endpoint)
+	assert.Equal(t, "SELL", last.Params.Get("side"))
+}
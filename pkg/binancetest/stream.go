@@ -0,0 +1,381 @@
+package binancetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// writeTimeout bounds writes to stream connections, so that client not
+// reading its stream doesn't block the server.
+const writeTimeout = 5 * time.Second
+
+// hub tracks websocket connections by stream name.
+type hub struct {
+	mu       sync.Mutex
+	upgrader websocket.Upgrader
+	streams  map[string]map[*websocket.Conn]bool
+}
+
+func newHub() *hub {
+	return &hub{
+		streams: make(map[string]map[*websocket.Conn]bool),
+	}
+}
+
+// serve upgrades connection of stream name. The connection is registered
+// before handshake response is sent, so events published after client's dial
+// returns are delivered to it.
+func (h *hub) serve(name string, w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	c, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.mu.Unlock()
+		return
+	}
+	if h.streams[name] == nil {
+		h.streams[name] = make(map[*websocket.Conn]bool)
+	}
+	h.streams[name][c] = true
+	h.mu.Unlock()
+
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			break
+		}
+	}
+	h.mu.Lock()
+	delete(h.streams[name], c)
+	h.mu.Unlock()
+	c.Close()
+}
+
+// names returns names of streams with connections.
+func (h *hub) names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var names []string
+	for name, conns := range h.streams {
+		if len(conns) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// publish sends message to connections of stream name.
+func (h *hub) publish(name string, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.streams[name] {
+		c.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := c.WriteMessage(websocket.TextMessage, message); err != nil {
+			c.Close()
+			delete(h.streams[name], c)
+		}
+	}
+}
+
+// closeStream closes connections of stream name.
+func (h *hub) closeStream(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.streams[name] {
+		c.Close()
+	}
+	delete(h.streams, name)
+}
+
+func (h *hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for name, conns := range h.streams {
+		for c := range conns {
+			c.Close()
+		}
+		delete(h.streams, name)
+	}
+}
+
+// serveStream serves /ws/<name> streams. Names without "@" are user data
+// streams and must be active listen keys.
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/ws/")
+	if !strings.Contains(name, "@") {
+		s.mu.Lock()
+		ok := s.listenKeys[name]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "invalid listen key", http.StatusBadRequest)
+			return
+		}
+	}
+	s.hub.serve(name, w, r)
+}
+
+// outMessage is message waiting to be sent to connections of stream, or
+// request to close them if close is set.
+type outMessage struct {
+	stream  string
+	message []byte
+	close   bool
+}
+
+// unlock releases mu and sends messages published while holding it. Writes
+// to connections can block on slow clients, so they are done without mu,
+// not to stall REST requests.
+func (s *Server) unlock() {
+	// Only holder of mu that queued messages waits until they are sent.
+	pending := s.queued
+	s.queued = false
+	s.mu.Unlock()
+	if !pending {
+		return
+	}
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+	// Messages might have been sent by previous holder of publishMu.
+	s.mu.Lock()
+	outbox := s.outbox
+	s.outbox = nil
+	s.mu.Unlock()
+	for _, m := range outbox {
+		if m.close {
+			s.hub.closeStream(m.stream)
+		} else {
+			s.hub.publish(m.stream, m.message)
+		}
+	}
+}
+
+// closeStream queues closing of connections of stream name after messages
+// published before. It must be called with mu held.
+func (s *Server) closeStream(name string) {
+	s.queue(outMessage{stream: name, close: true})
+}
+
+func (s *Server) queue(m outMessage) {
+	s.outbox = append(s.outbox, m)
+	s.queued = true
+}
+
+// Push sends raw message to connections of stream name, e.g. to test
+// handling of malformed messages.
+func (s *Server) Push(name string, message []byte) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.queue(outMessage{stream: name, message: message})
+}
+
+// publishJSON queues message to connections of stream name. It must be
+// called with mu held.
+func (s *Server) publishJSON(name string, v interface{}) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	s.queue(outMessage{stream: name, message: message})
+}
+
+// publishDepth sends diff of order book of sym to diff depth streams and
+// the updated book to partial book streams.
+func (s *Server) publishDepth(sym *symbol, firstUpdateID int, bids, asks []*pkg.Order) {
+	prefix := strings.ToLower(sym.name) + "@depth"
+	for _, name := range s.hub.names() {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		suffix := strings.TrimPrefix(name, prefix)
+		if suffix == "" || strings.HasPrefix(suffix, "@") {
+			s.publishJSON(name, map[string]interface{}{
+				"e": "depthUpdate",
+				"E": millis(s.now()),
+				"s": sym.name,
+				"U": firstUpdateID,
+				"u": sym.lastUpdateID,
+				"b": rawLevels(bids, -1),
+				"a": rawLevels(asks, -1),
+			})
+			continue
+		}
+		level, err := strconv.Atoi(strings.SplitN(suffix, "@", 2)[0])
+		if err != nil {
+			continue
+		}
+		s.publishJSON(name, map[string]interface{}{
+			"lastUpdateId": sym.lastUpdateID,
+			"bids":         rawLevels(levels(sym.bids), level),
+			"asks":         rawLevels(levels(sym.asks), level),
+		})
+	}
+}
+
+func (s *Server) publishAggTrade(sym *symbol, t *pkg.AggTrade) {
+	s.publishJSON(strings.ToLower(sym.name)+"@aggTrade", map[string]interface{}{
+		"e": "aggTrade",
+		"E": millis(s.now()),
+		"s": sym.name,
+		"a": t.ID,
+		"p": formatFloat(t.Price),
+		"q": formatFloat(t.Quantity),
+		"f": t.FirstTradeID,
+		"l": t.LastTradeID,
+		"T": millis(t.Timestamp),
+		"m": t.BuyerMaker,
+		"M": true,
+	})
+}
+
+func (s *Server) publishKline(sym *symbol, interval pkg.Interval, k *pkg.Kline, final bool) {
+	s.publishJSON(strings.ToLower(sym.name)+"@kline_"+string(interval), map[string]interface{}{
+		"e": "kline",
+		"E": millis(s.now()),
+		"s": sym.name,
+		"k": map[string]interface{}{
+			"t": millis(k.OpenTime),
+			"T": millis(k.CloseTime),
+			"s": sym.name,
+			"i": interval,
+			"f": 0,
+			"L": 0,
+			"o": formatFloat(k.Open),
+			"c": formatFloat(k.Close),
+			"h": formatFloat(k.High),
+			"l": formatFloat(k.Low),
+			"v": formatFloat(k.Volume),
+			"n": k.NumberOfTrades,
+			"x": final,
+			"q": formatFloat(k.QuoteAssetVolume),
+			"V": formatFloat(k.TakerBuyBaseAssetVolume),
+			"Q": formatFloat(k.TakerBuyQuoteAssetVolume),
+			"B": "0",
+		},
+	})
+}
+
+// PushUserData sends user data event to user data streams of the active
+// listen key. Zero event time is set to the current time.
+func (s *Server) PushUserData(ude pkg.UserDataEvent) {
+	s.mu.Lock()
+	defer s.unlock()
+	s.publishUserData(ude)
+}
+
+func (s *Server) publishUserData(ude pkg.UserDataEvent) {
+	message := s.userDataMessage(ude)
+	for key := range s.listenKeys {
+		s.publishJSON(key, message)
+	}
+}
+
+// userDataMessage encodes user data event the way Binance sends it.
+func (s *Server) userDataMessage(ude pkg.UserDataEvent) map[string]interface{} {
+	eventTime := func(e pkg.WSEvent) int64 {
+		if e.Time.IsZero() {
+			return millis(s.now())
+		}
+		return millis(e.Time)
+	}
+
+	switch e := ude.(type) {
+	case *pkg.AccountPositionEvent:
+		balances := []map[string]string{}
+		for _, b := range e.Balances {
+			balances = append(balances, map[string]string{
+				"a": b.Asset,
+				"f": formatFloat(b.Free),
+				"l": formatFloat(b.Locked),
+			})
+		}
+		return map[string]interface{}{
+			"e": "outboundAccountPosition",
+			"E": eventTime(e.WSEvent),
+			"u": millis(e.LastUpdateTime),
+			"B": balances,
+		}
+	case *pkg.BalanceUpdateEvent:
+		return map[string]interface{}{
+			"e": "balanceUpdate",
+			"E": eventTime(e.WSEvent),
+			"a": e.Asset,
+			"d": formatFloat(e.Delta),
+			"T": millis(e.ClearTime),
+		}
+	case *pkg.ExecutionReportEvent:
+		var commissionAsset interface{}
+		if e.CommissionAsset != "" {
+			commissionAsset = e.CommissionAsset
+		}
+		return map[string]interface{}{
+			"e": "executionReport",
+			"E": eventTime(e.WSEvent),
+			"s": e.Symbol,
+			"c": e.ClientOrderID,
+			"S": e.Side,
+			"o": e.OrderType,
+			"f": e.TimeInForce,
+			"q": formatFloat(e.Quantity),
+			"p": formatFloat(e.Price),
+			"P": formatFloat(e.StopPrice),
+			"F": formatFloat(e.IcebergQty),
+			"g": e.OrderListID,
+			"C": e.OrigClientOrderID,
+			"x": e.ExecutionType,
+			"X": e.Status,
+			"r": e.RejectReason,
+			"i": e.OrderID,
+			"l": formatFloat(e.LastExecutedQty),
+			"z": formatFloat(e.CumulativeFilledQty),
+			"L": formatFloat(e.LastExecutedPrice),
+			"n": formatFloat(e.Commission),
+			"N": commissionAsset,
+			"T": millis(e.TransactionTime),
+			"t": e.TradeID,
+			"I": 0,
+			"w": e.IsWorking,
+			"m": e.IsMaker,
+			"M": false,
+			"O": millis(e.OrderCreationTime),
+			"Z": formatFloat(e.CumulativeQuoteQty),
+			"Y": formatFloat(e.LastQuoteQty),
+			"Q": formatFloat(e.QuoteOrderQty),
+			"W": millis(e.WorkingTime),
+			"V": e.SelfTradePreventionMode,
+		}
+	case *pkg.ListStatusEvent:
+		orders := []map[string]interface{}{}
+		for _, o := range e.Orders {
+			orders = append(orders, map[string]interface{}{
+				"s": o.Symbol,
+				"i": o.OrderID,
+				"c": o.ClientOrderID,
+			})
+		}
+		return map[string]interface{}{
+			"e": "listStatus",
+			"E": eventTime(e.WSEvent),
+			"s": e.Symbol,
+			"g": e.OrderListID,
+			"c": e.ContingencyType,
+			"l": e.ListStatusType,
+			"L": e.ListOrderStatus,
+			"r": e.ListRejectReason,
+			"C": e.ListClientOrderID,
+			"T": millis(e.TransactionTime),
+			"O": orders,
+		}
+	case *pkg.ListenKeyExpiredEvent:
+		return map[string]interface{}{
+			"e":         "listenKeyExpired",
+			"E":         eventTime(e.WSEvent),
+			"listenKey": e.ListenKey,
+		}
+	}
+	panic("binancetest: unknown user data event")
+}
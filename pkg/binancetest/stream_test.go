@@ -0,0 +1,148 @@
+package binancetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, ch interface{}) interface{} {
+	t.Helper()
+	switch ch := ch.(type) {
+	case chan *pkg.DepthEvent:
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(5 * time.Second):
+		}
+	case chan *pkg.AggTradeEvent:
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(5 * time.Second):
+		}
+	case chan *pkg.KlineEvent:
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(5 * time.Second):
+		}
+	case chan pkg.UserDataEvent:
+		select {
+		case e := <-ch:
+			return e
+		case <-time.After(5 * time.Second):
+		}
+	}
+	t.Fatal("event not received")
+	return nil
+}
+
+func TestMarketStreams(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.002, Quantity: 1}}, nil)
+
+	diffs, _, err := service.DepthWebsocket(pkg.DepthWebsocketRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	books, _, err := service.DepthWebsocket(pkg.DepthWebsocketRequest{Symbol: "BNBBTC", Level: 5, UpdateSpeed: 100 * time.Millisecond})
+	require.NoError(t, err)
+	trades, _, err := service.TradeWebsocket(pkg.TradeWebsocketRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	klines, _, err := service.KlineWebsocket(pkg.KlineWebsocketRequest{Symbol: "BNBBTC", Interval: pkg.Minute})
+	require.NoError(t, err)
+
+	srv.PushDepth("BNBBTC", []*pkg.Order{{Price: 0.0021, Quantity: 2}}, []*pkg.Order{{Price: 0.0022, Quantity: 3}})
+	diff := receive(t, diffs).(*pkg.DepthEvent)
+	assert.Equal(t, "depthUpdate", diff.Type)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0021, Quantity: 2}}, diff.Bids)
+	assert.Equal(t, diff.FirstUpdateID, diff.FinalUpdateID)
+	book := receive(t, books).(*pkg.DepthEvent)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0021, Quantity: 2}, {Price: 0.002, Quantity: 1}}, book.Bids)
+	assert.Equal(t, []*pkg.Order{{Price: 0.0022, Quantity: 3}}, book.Asks)
+
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.0021, Quantity: 5, Timestamp: time.Unix(1600000000, 0)})
+	trade := receive(t, trades).(*pkg.AggTradeEvent)
+	assert.Equal(t, "BNBBTC", trade.Symbol)
+	assert.Equal(t, 5.0, trade.Quantity)
+	assert.Equal(t, time.Unix(1600000000, 0), trade.Timestamp)
+
+	srv.PushKline("BNBBTC", pkg.Minute, &pkg.Kline{OpenTime: time.Unix(1600000000, 0), Close: 0.0021}, true)
+	kline := receive(t, klines).(*pkg.KlineEvent)
+	assert.True(t, kline.Final)
+	assert.Equal(t, 0.0021, kline.Close)
+	history, err := service.Klines(pkg.KlinesRequest{Symbol: "BNBBTC", Interval: pkg.Minute})
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+func TestUserDataStream(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetBalance("BNB", 1)
+
+	s, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	require.NoError(t, service.KeepAliveUserDataStream(s))
+	events, done, err := service.UserDataWebsocket(pkg.UserDataWebsocketRequest{ListenKey: s.ListenKey})
+	require.NoError(t, err)
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideSell,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    1,
+		Price:       0.003,
+		Timestamp:   time.Now(),
+	})
+	require.NoError(t, err)
+	er := receive(t, events).(*pkg.ExecutionReportEvent)
+	assert.Equal(t, pkg.ExecutionNew, er.ExecutionType)
+	assert.Equal(t, po.OrderID, er.OrderID)
+	assert.Equal(t, po.ClientOrderID, er.ClientOrderID)
+	assert.Equal(t, 0.003, er.Price)
+	ape := receive(t, events).(*pkg.AccountPositionEvent)
+	assert.Equal(t, []*pkg.Balance{{Asset: "BNB", Locked: 1}}, ape.Balances)
+
+	srv.PushUserData(&pkg.BalanceUpdateEvent{Asset: "BTC", Delta: 0.5})
+	bu := receive(t, events).(*pkg.BalanceUpdateEvent)
+	assert.Equal(t, 0.5, bu.Delta)
+
+	assert.True(t, srv.ExpireListenKey())
+	assert.IsType(t, &pkg.ListenKeyExpiredEvent{}, receive(t, events))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not closed")
+	}
+	assert.Equal(t, &pkg.Error{Code: -1125, Message: "This listenKey does not exist."}, service.KeepAliveUserDataStream(s))
+}
+
+func TestSlowStreamDoesNotBlockRequests(t *testing.T) {
+	srv, service := newTestService(t)
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.002, Quantity: 1}}, nil)
+
+	// Stand-in for write to stream connection blocked by slow client.
+	srv.publishMu.Lock()
+	pushed := make(chan struct{})
+	go func() {
+		srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.0021, Quantity: 1, Timestamp: time.Now()})
+		close(pushed)
+	}()
+	requested := make(chan error, 1)
+	go func() {
+		_, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+		requested <- err
+	}()
+	select {
+	case err := <-requested:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("request blocked by stream write")
+	}
+	srv.publishMu.Unlock()
+	<-pushed
+}
@@ -0,0 +1,137 @@
+// Package cassette records REST and websocket traffic of pkg.Service into
+// cassette files and replays it, so that tests can run against real exchange
+// responses without network access.
+//
+// Recorder wraps HTTP transport and stream dialer of the service:
+//
+//	rec := cassette.NewRecorder()
+//	service := pkg.NewAPIService(url, apiKey, signer, logger, ctx,
+//		pkg.WithHTTPClient(rec.Client()),
+//		pkg.WithStreamDialer(rec.Dial))
+//	// ... exercise service ...
+//	err := rec.Cassette().Save("testdata/orders.json")
+//
+// Replayer serves the recorded traffic back:
+//
+//	c, err := cassette.Load("testdata/orders.json")
+//	rp := cassette.NewReplayer(c, cassette.WithMode(cassette.Lenient))
+//	service := pkg.NewAPIService(url, apiKey, signer, logger, ctx,
+//		pkg.WithHTTPClient(rp.Client()),
+//		pkg.WithStreamDialer(rp.Dial))
+//
+// Signatures and listen keys are scrubbed from recorded requests, responses
+// and streams, API keys sent in headers are never recorded.
+package cassette
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Redacted replaces secret values in cassettes.
+const Redacted = "<redacted>"
+
+// Cassette holds recorded REST interactions and websocket streams.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+	Streams      []*Stream      `json:"streams"`
+}
+
+// Interaction is recorded REST request and its response.
+type Interaction struct {
+	Method string `json:"method"`
+	// Path is URL path of the request, e.g. "/api/v3/order".
+	Path string `json:"path"`
+	// Params are query and body params of the request.
+	Params map[string]string `json:"params,omitempty"`
+	// Offset is time since recording started when the request was sent.
+	Offset   time.Duration `json:"offset"`
+	Latency  time.Duration `json:"latency"`
+	Status   int           `json:"status"`
+	Header   http.Header   `json:"header,omitempty"`
+	Response string        `json:"response"`
+}
+
+// Stream is recorded websocket stream.
+type Stream struct {
+	// Path is URL path of the stream, e.g. "/ws/bnbbtc@aggTrade".
+	Path string `json:"path"`
+	// Offset is time since recording started when the stream was dialed.
+	Offset   time.Duration `json:"offset"`
+	Messages []*Message    `json:"messages"`
+	// Err is error which ended the stream, empty if it was closed by the
+	// client.
+	Err string `json:"err,omitempty"`
+}
+
+// Message is message received by websocket stream.
+type Message struct {
+	// Offset is time since the stream was dialed.
+	Offset time.Duration `json:"offset"`
+	Data   string        `json:"data"`
+}
+
+// Load reads cassette from JSON file at path.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read cassette")
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, errors.Wrap(err, "unable to parse cassette")
+	}
+	return c, nil
+}
+
+// Save writes cassette to JSON file at path.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode cassette")
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return errors.Wrap(err, "unable to write cassette")
+	}
+	return nil
+}
+
+// requestParams returns params of request sent by pkg.Service, i.e. its
+// query string merged with its form body, with secrets redacted.
+func requestParams(query, body string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, raw := range []string{query, body} {
+		values, err := url.ParseQuery(raw)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse request params")
+		}
+		for key := range values {
+			params[key] = values.Get(key)
+		}
+	}
+	if len(params) == 0 {
+		return nil, nil
+	}
+	return pkg.RedactParams(params), nil
+}
+
+// streamPath returns path of stream URL with listen key of user data stream
+// redacted.
+func streamPath(rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+	i := strings.LastIndex(path, "/")
+	if name := path[i+1:]; name != "" && !strings.Contains(name, "@") {
+		path = path[:i+1] + Redacted
+	}
+	return path
+}
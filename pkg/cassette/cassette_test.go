@@ -0,0 +1,179 @@
+package cassette
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAPIKey = "test-key"
+	testSecret = "test-secret"
+)
+
+type session struct {
+	book   *pkg.OrderBook
+	order  *pkg.ProcessedOrder
+	report *pkg.ExecutionReportEvent
+}
+
+// run exercises service, calling fill once the order is placed.
+func run(t *testing.T, service pkg.Service, fill func()) session {
+	t.Helper()
+	var s session
+	var err error
+	s.book, err = service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	stream, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	events, _, err := service.UserDataWebsocket(pkg.UserDataWebsocketRequest{ListenKey: stream.ListenKey})
+	require.NoError(t, err)
+
+	s.order, err = service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideSell,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    1,
+		Price:       0.003,
+		Timestamp:   time.Now(),
+	})
+	require.NoError(t, err)
+	fill()
+	for s.report == nil || s.report.ExecutionType != pkg.ExecutionTrade {
+		select {
+		case e := <-events:
+			if er, ok := e.(*pkg.ExecutionReportEvent); ok {
+				s.report = er
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("trade not received")
+		}
+	}
+	return s
+}
+
+func newService(ctx context.Context, env pkg.Environment, client *http.Client, dial pkg.StreamDialer) pkg.Service {
+	return pkg.NewAPIService("", testAPIKey, &pkg.HmacSigner{Key: []byte(testSecret)}, nil, ctx,
+		pkg.WithEnvironment(env),
+		pkg.WithHTTPClient(client),
+		pkg.WithStreamDialer(dial))
+}
+
+func record(t *testing.T) (string, session) {
+	srv := binancetest.NewServer(binancetest.WithHMACKey(testAPIKey, []byte(testSecret)))
+	defer srv.Close()
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC", []*pkg.Order{{Price: 0.002, Quantity: 1}}, nil)
+	srv.SetBalance("BNB", 1)
+
+	rec := NewRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	service := newService(ctx, srv.Environment(), rec.Client(), rec.Dial)
+	s := run(t, service, func() {
+		srv.PlaceExternalOrder("BNBBTC", pkg.SideBuy, 0.003, 1)
+	})
+	cancel()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, rec.Cassette().Save(path))
+	return path, s
+}
+
+func TestRecordReplay(t *testing.T) {
+	path, recorded := record(t)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), testAPIKey)
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, c.Interactions, 3)
+	assert.Equal(t, Redacted, c.Interactions[2].Params["signature"])
+	assert.JSONEq(t, `{"listenKey":"<redacted>"}`, c.Interactions[1].Response)
+	require.Len(t, c.Streams, 1)
+	assert.Equal(t, "/ws/"+Redacted, c.Streams[0].Path)
+	assert.Empty(t, c.Streams[0].Err)
+
+	// Nothing listens at the environment, so any request not served by
+	// replayer fails.
+	env := pkg.CustomEnvironment("http://127.0.0.1:1")
+	rp := NewReplayer(c)
+	replayed := run(t, newService(context.Background(), env, rp.Client(), rp.Dial), func() {})
+	assert.Equal(t, recorded, replayed)
+	assert.Zero(t, rp.Remaining())
+}
+
+func TestMatching(t *testing.T) {
+	path, _ := record(t)
+	c, err := Load(path)
+	require.NoError(t, err)
+	env := pkg.CustomEnvironment("http://127.0.0.1:1")
+
+	rp := NewReplayer(c)
+	service := newService(context.Background(), env, rp.Client(), rp.Dial)
+	_, err = service.StartUserDataStream()
+	assert.Error(t, err)
+	_, err = service.OrderBook(pkg.OrderBookRequest{Symbol: "ETHBTC"})
+	assert.Error(t, err)
+
+	rp = NewReplayer(c, WithMode(Lenient))
+	service = newService(context.Background(), env, rp.Client(), rp.Dial)
+	_, err = service.StartUserDataStream()
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		ob, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+		require.NoError(t, err)
+		assert.Equal(t, []*pkg.Order{{Price: 0.002, Quantity: 1}}, ob.Bids)
+	}
+	_, err = service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC", Limit: 5})
+	assert.NoError(t, err)
+	_, err = service.Account(pkg.AccountRequest{Timestamp: time.Now()})
+	assert.Error(t, err)
+	assert.Equal(t, 2, rp.Remaining())
+}
+
+func TestTiming(t *testing.T) {
+	c := &Cassette{
+		Interactions: []*Interaction{{
+			Method:   "GET",
+			Path:     "/api/v3/ping",
+			Latency:  100 * time.Millisecond,
+			Status:   200,
+			Response: "{}",
+		}},
+		Streams: []*Stream{{
+			Path: "/ws/bnbbtc@aggTrade",
+			Messages: []*Message{
+				{Offset: 100 * time.Millisecond, Data: `{"e":"aggTrade","E":1600000000000,"s":"BNBBTC","a":1,"p":"0.002","q":"1","f":1,"l":1,"T":1600000000000,"m":false,"M":true}`},
+			},
+			Err: "connection reset",
+		}},
+	}
+	rp := NewReplayer(c, WithSpeed(2))
+	service := newService(context.Background(), pkg.CustomEnvironment("http://127.0.0.1:1"), rp.Client(), rp.Dial)
+
+	start := time.Now()
+	require.NoError(t, service.Ping())
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	var trades []*pkg.AggTradeEvent
+	start = time.Now()
+	sub, err := service.SubscribeTrade(pkg.TradeWebsocketRequest{Symbol: "BNBBTC"}, pkg.StreamHandler{
+		OnTrade: func(e *pkg.AggTradeEvent) { trades = append(trades, e) },
+	})
+	require.NoError(t, err)
+	<-sub.Done()
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	require.Len(t, trades, 1)
+	assert.Equal(t, 0.002, trades[0].Price)
+	assert.EqualError(t, sub.Err(), "connection reset")
+}
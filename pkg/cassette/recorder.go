@@ -0,0 +1,202 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Recorder records REST traffic passing through its transport and messages
+// of streams connected by its Dial into Cassette.
+type Recorder struct {
+	transport http.RoundTripper
+	dial      pkg.StreamDialer
+	start     time.Time
+
+	mu       sync.Mutex
+	cassette Cassette
+	// listenKeys are listen keys seen in responses, scrubbed from
+	// everything recorded afterwards.
+	listenKeys []string
+}
+
+// RecorderOption configures Recorder.
+type RecorderOption func(*Recorder)
+
+// WithTransport makes Recorder send requests with rt instead of
+// http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) RecorderOption {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithDialer makes Recorder connect streams with d instead of
+// websocket.DefaultDialer.
+func WithDialer(d pkg.StreamDialer) RecorderOption {
+	return func(r *Recorder) {
+		r.dial = d
+	}
+}
+
+// NewRecorder creates Recorder. Offsets of recorded requests and streams
+// are measured from its creation.
+func NewRecorder(opts ...RecorderOption) *Recorder {
+	r := &Recorder{
+		transport: http.DefaultTransport,
+		dial: func(url string) (pkg.StreamConn, error) {
+			c, _, err := websocket.DefaultDialer.Dial(url, nil)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		},
+		start: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Client returns HTTP client recording its requests, to be used with
+// pkg.WithHTTPClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper. Requests failing without response
+// are not recorded.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, errors.Wrap(err, "unable to read request body")
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	params, err := requestParams(req.URL.RawQuery, string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	sent := time.Now()
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read response body")
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lk := struct {
+		ListenKey string `json:"listenKey"`
+	}{}
+	if json.Unmarshal(data, &lk) == nil && lk.ListenKey != "" {
+		r.listenKeys = append(r.listenKeys, lk.ListenKey)
+	}
+	for key, val := range params {
+		params[key] = r.scrub(val)
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Params:   params,
+		Offset:   sent.Sub(r.start),
+		Latency:  time.Since(sent),
+		Status:   resp.StatusCode,
+		Header:   resp.Header.Clone(),
+		Response: r.scrub(string(data)),
+	})
+	return resp, nil
+}
+
+// scrub replaces known listen keys in s.
+func (r *Recorder) scrub(s string) string {
+	for _, key := range r.listenKeys {
+		s = strings.Replace(s, key, Redacted, -1)
+	}
+	return s
+}
+
+// Dial connects stream at url recording its messages. It implements
+// pkg.StreamDialer.
+func (r *Recorder) Dial(url string) (pkg.StreamConn, error) {
+	c, err := r.dial(url)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := &Stream{
+		Path:   streamPath(url),
+		Offset: time.Since(r.start),
+	}
+	r.cassette.Streams = append(r.cassette.Streams, s)
+	return &recordingConn{StreamConn: c, r: r, stream: s, dialed: time.Now()}, nil
+}
+
+type recordingConn struct {
+	pkg.StreamConn
+	r      *Recorder
+	stream *Stream
+	dialed time.Time
+	// closed is set, under Recorder mutex, when client closes the
+	// connection, so that the resulting read error isn't recorded.
+	closed bool
+}
+
+func (c *recordingConn) ReadMessage() (int, []byte, error) {
+	mt, data, err := c.StreamConn.ReadMessage()
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	if err != nil {
+		if !c.closed {
+			c.stream.Err = err.Error()
+		}
+		return mt, data, err
+	}
+	c.stream.Messages = append(c.stream.Messages, &Message{
+		Offset: time.Since(c.dialed),
+		Data:   c.r.scrub(string(data)),
+	})
+	return mt, data, nil
+}
+
+func (c *recordingConn) Close() error {
+	c.r.mu.Lock()
+	c.closed = true
+	c.r.mu.Unlock()
+	return c.StreamConn.Close()
+}
+
+// Cassette returns copy of traffic recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &Cassette{
+		Interactions: append([]*Interaction(nil), r.cassette.Interactions...),
+	}
+	for _, s := range r.cassette.Streams {
+		sc := *s
+		sc.Messages = append([]*Message(nil), s.Messages...)
+		c.Streams = append(c.Streams, &sc)
+	}
+	return c
+}
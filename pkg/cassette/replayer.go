@@ -0,0 +1,293 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Mode is how Replayer matches requests and streams to recordings.
+type Mode int
+
+const (
+	// Strict serves recordings in recorded order. Request must match the
+	// next interaction by method, path and params, ignoring timestamp;
+	// stream must match the next stream by path.
+	Strict Mode = iota
+	// Lenient serves any unused recording matching the request, preferring
+	// one with equal params over one with equal method and path only.
+	// Interactions can be served repeatedly, e.g. to polling requests, once
+	// there are no unused ones.
+	Lenient
+)
+
+// ignoredParams are params which differ between recording and replay and
+// are ignored by matching.
+var ignoredParams = map[string]bool{
+	"timestamp": true,
+}
+
+// Replayer serves traffic recorded in Cassette.
+type Replayer struct {
+	mode  Mode
+	speed float64
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	streams      []*Stream
+	streamUsed   []bool
+}
+
+// ReplayerOption configures Replayer.
+type ReplayerOption func(*Replayer)
+
+// WithMode sets matching mode, Strict by default.
+func WithMode(m Mode) ReplayerOption {
+	return func(rp *Replayer) {
+		rp.mode = m
+	}
+}
+
+// WithSpeed makes Replayer keep recorded timing, i.e. delay responses by
+// recorded latency and stream messages by their recorded offsets, divided by
+// speed. By default recordings are served without delay.
+func WithSpeed(speed float64) ReplayerOption {
+	return func(rp *Replayer) {
+		rp.speed = speed
+	}
+}
+
+// NewReplayer creates Replayer of c.
+func NewReplayer(c *Cassette, opts ...ReplayerOption) *Replayer {
+	rp := &Replayer{
+		interactions: c.Interactions,
+		used:         make([]bool, len(c.Interactions)),
+		streams:      c.Streams,
+		streamUsed:   make([]bool, len(c.Streams)),
+	}
+	for _, opt := range opts {
+		opt(rp)
+	}
+	return rp
+}
+
+// delay scales recorded duration d by speed.
+func (rp *Replayer) delay(d time.Duration) time.Duration {
+	if rp.speed <= 0 {
+		return 0
+	}
+	return time.Duration(float64(d) / rp.speed)
+}
+
+// Client returns HTTP client serving recorded responses, to be used with
+// pkg.WithHTTPClient.
+func (rp *Replayer) Client() *http.Client {
+	return &http.Client{Transport: rp}
+}
+
+// RoundTrip implements http.RoundTripper. Requests without matching
+// recording fail with error.
+func (rp *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, errors.Wrap(err, "unable to read request body")
+		}
+		req.Body.Close()
+	}
+	params, err := requestParams(req.URL.RawQuery, string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := rp.match(req.Method, req.URL.Path, params)
+	if err != nil {
+		return nil, err
+	}
+	if d := rp.delay(in.Latency); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+		StatusCode:    in.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(in.Response))),
+		ContentLength: int64(len(in.Response)),
+		Request:       req,
+	}, nil
+}
+
+func (rp *Replayer) match(method, path string, params map[string]string) (*Interaction, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	sameRequest := func(in *Interaction) bool {
+		return in.Method == method && in.Path == path
+	}
+
+	if rp.mode == Strict {
+		for i, in := range rp.interactions {
+			if rp.used[i] {
+				continue
+			}
+			if !sameRequest(in) || !sameParams(in.Params, params) {
+				return nil, errors.Errorf("cassette: %s %s %v doesn't match recorded %s %s %v",
+					method, path, params, in.Method, in.Path, in.Params)
+			}
+			rp.used[i] = true
+			return in, nil
+		}
+		return nil, errors.Errorf("cassette: no recorded interaction left for %s %s", method, path)
+	}
+
+	best := -1
+	for i, in := range rp.interactions {
+		if rp.used[i] || !sameRequest(in) {
+			continue
+		}
+		if sameParams(in.Params, params) {
+			best = i
+			break
+		}
+		if best == -1 {
+			best = i
+		}
+	}
+	if best != -1 {
+		rp.used[best] = true
+		return rp.interactions[best], nil
+	}
+	// All matching interactions were served, repeat the latest one.
+	var latest *Interaction
+	for i := len(rp.interactions) - 1; i >= 0; i-- {
+		in := rp.interactions[i]
+		if !sameRequest(in) {
+			continue
+		}
+		if sameParams(in.Params, params) {
+			return in, nil
+		}
+		if latest == nil {
+			latest = in
+		}
+	}
+	if latest == nil {
+		return nil, errors.Errorf("cassette: no recorded interaction for %s %s", method, path)
+	}
+	return latest, nil
+}
+
+func sameParams(recorded, actual map[string]string) bool {
+	for key, val := range recorded {
+		if !ignoredParams[key] && actual[key] != val {
+			return false
+		}
+	}
+	for key := range actual {
+		if _, ok := recorded[key]; !ok && !ignoredParams[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Remaining returns number of recorded interactions and streams not served
+// yet. In Strict mode tests usually expect it to be zero at the end.
+func (rp *Replayer) Remaining() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	n := 0
+	for _, used := range append(append([]bool(nil), rp.used...), rp.streamUsed...) {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// Dial connects to recorded stream matching url. It implements
+// pkg.StreamDialer. The connection delivers recorded messages, then fails
+// with recorded error or, if stream was closed by client, waits until it's
+// closed.
+func (rp *Replayer) Dial(url string) (pkg.StreamConn, error) {
+	path := streamPath(url)
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	for i, s := range rp.streams {
+		if rp.streamUsed[i] {
+			continue
+		}
+		if s.Path != path {
+			if rp.mode == Strict {
+				return nil, errors.Errorf("cassette: stream %s doesn't match recorded %s", path, s.Path)
+			}
+			continue
+		}
+		rp.streamUsed[i] = true
+		return &replayConn{
+			stream: s,
+			rp:     rp,
+			dialed: time.Now(),
+			closed: make(chan struct{}),
+		}, nil
+	}
+	return nil, errors.Errorf("cassette: no recorded stream left for %s", path)
+}
+
+var errClosed = errors.New("cassette: use of closed stream")
+
+type replayConn struct {
+	stream    *Stream
+	rp        *Replayer
+	dialed    time.Time
+	next      int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *replayConn) ReadMessage() (int, []byte, error) {
+	select {
+	case <-c.closed:
+		return 0, nil, errClosed
+	default:
+	}
+	if c.next < len(c.stream.Messages) {
+		m := c.stream.Messages[c.next]
+		if d := c.rp.delay(m.Offset) - time.Since(c.dialed); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-c.closed:
+				return 0, nil, errClosed
+			}
+		}
+		c.next++
+		return websocket.TextMessage, []byte(m.Data), nil
+	}
+	if c.stream.Err != "" {
+		return 0, nil, errors.New(c.stream.Err)
+	}
+	<-c.closed
+	return 0, nil, errClosed
+}
+
+func (c *replayConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
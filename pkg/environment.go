@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environment holds base URLs of Binance REST API, websocket streams and
+// WebSocket API.
+type Environment struct {
+	RESTURL   string
+	StreamURL string
+	// WSAPIURL is empty when environment doesn't provide WebSocket API.
+	WSAPIURL string
+}
+
+var (
+	// Production is Binance spot production environment.
+	Production = Environment{
+		RESTURL:   "https://api.binance.com",
+		StreamURL: "wss://stream.binance.com:9443/ws",
+		WSAPIURL:  DefaultWSAPIURL,
+	}
+	// Testnet is Binance spot testnet. It requires separate API keys.
+	Testnet = Environment{
+		RESTURL:   "https://testnet.binance.vision",
+		StreamURL: "wss://stream.testnet.binance.vision/ws",
+		WSAPIURL:  "wss://ws-api.testnet.binance.vision/ws-api/v3",
+	}
+	// MarketData serves public market data only; account and order endpoints
+	// aren't available.
+	MarketData = Environment{
+		RESTURL:   "https://data-api.binance.vision",
+		StreamURL: "wss://data-stream.binance.vision/ws",
+	}
+)
+
+// Cluster returns production environment using alternative REST API cluster
+// api1 to api4, which might perform better than api.binance.com. Other n
+// returns error.
+func Cluster(n int) (Environment, error) {
+	if n < 1 || n > 4 {
+		return Environment{}, errors.Errorf("unknown API cluster %d, only 1 to 4 exist", n)
+	}
+	env := Production
+	env.RESTURL = fmt.Sprintf("https://api%d.binance.com", n)
+	return env, nil
+}
+
+// CustomEnvironment returns environment of server at baseURL, e.g. local fake
+// exchange. Streams are expected at /ws and WebSocket API at /ws-api/v3 of
+// the same host.
+func CustomEnvironment(baseURL string) Environment {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	wsURL := "ws" + strings.TrimPrefix(baseURL, "http")
+	return Environment{
+		RESTURL:   baseURL,
+		StreamURL: wsURL + "/ws",
+		WSAPIURL:  wsURL + "/ws-api/v3",
+	}
+}
+
+// WithEnvironment configures Service to use URLs of env, overriding URL passed
+// to NewAPIService.
+func WithEnvironment(env Environment) APIServiceOption {
+	return func(as *apiService) {
+		as.URL = env.RESTURL
+		as.StreamURL = env.StreamURL
+		as.WSAPIURL = env.WSAPIURL
+	}
+}
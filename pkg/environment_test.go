@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironments(t *testing.T) {
+	cluster, err := Cluster(3)
+	require.NoError(t, err)
+	assert.Equal(t, "https://api3.binance.com", cluster.RESTURL)
+	assert.Equal(t, Production.StreamURL, cluster.StreamURL)
+	for _, n := range []int{1, 4} {
+		_, err = Cluster(n)
+		assert.NoError(t, err, n)
+	}
+	for _, n := range []int{-1, 0, 5, 7} {
+		_, err = Cluster(n)
+		assert.EqualError(t, err, fmt.Sprintf("unknown API cluster %d, only 1 to 4 exist", n))
+	}
+	assert.Equal(t, Environment{
+		RESTURL:   "http://127.0.0.1:8080",
+		StreamURL: "ws://127.0.0.1:8080/ws",
+		WSAPIURL:  "ws://127.0.0.1:8080/ws-api/v3",
+	}, CustomEnvironment("http://127.0.0.1:8080/"))
+
+	as := NewAPIService("", "", nil, nil, nil, WithEnvironment(Testnet)).(*apiService)
+	assert.Equal(t, Testnet.RESTURL, as.URL)
+	assert.Equal(t, Testnet.StreamURL, as.StreamURL)
+	assert.Equal(t, Testnet.WSAPIURL, as.WSAPIURL)
+}
+
+func TestCustomEnvironment(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/time", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"serverTime":1499827319559}`))
+	})
+	mux.HandleFunc("/ws-api/v3", func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			req := wsAPIRequest{}
+			if err := c.ReadJSON(&req); err != nil {
+				return
+			}
+			c.WriteJSON(map[string]interface{}{"id": req.ID, "status": 200, "result": map[string]interface{}{}})
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ws, err := NewWSAPIService("", "", "", nil, nil, context.Background(), WithEnvironment(CustomEnvironment(srv.URL)))
+	require.NoError(t, err)
+	defer ws.Close()
+	assert.NoError(t, ws.Ping())
+	_, err = ws.Service.Time()
+	assert.NoError(t, err)
+
+	_, err = NewWSAPIService("", "", "", nil, nil, context.Background(), WithEnvironment(MarketData))
+	assert.Error(t, err)
+}
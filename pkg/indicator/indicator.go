@@ -0,0 +1,155 @@
+// Package indicator computes technical indicators from klines.
+//
+// Indicators are streaming: Add commits closed kline, Update previews value
+// with kline still forming, which is replaced by the next Update or Add. Kline
+// events can be passed directly, final ones are committed:
+//
+//	rsi := indicator.NewRSI(14)
+//	service.SubscribeKline(pkg.KlineWebsocketRequest{Symbol: "BNBUSDT", Interval: pkg.Hour},
+//		pkg.StreamHandler{OnKline: indicator.Handler(rsi)})
+//
+// Compute runs indicator over historical klines in batch. Values are NaN
+// until indicator has enough klines.
+package indicator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Indicator is technical indicator updated with klines.
+type Indicator interface {
+	// Add commits closed kline.
+	Add(k *pkg.Kline)
+	// Update previews indicator with forming kline, following the last
+	// committed one.
+	Update(k *pkg.Kline)
+	// Value returns the main value, NaN until indicator is ready.
+	Value() float64
+}
+
+// MultiIndicator is Indicator with several outputs, e.g. MACD line, signal
+// and histogram.
+type MultiIndicator interface {
+	Indicator
+	// Values returns all outputs, NaN until they're ready.
+	Values() []float64
+}
+
+// Feed passes kline event to ind, committing final klines.
+func Feed(ind Indicator, ke *pkg.KlineEvent) {
+	if ke.Final {
+		ind.Add(&ke.Kline)
+	} else {
+		ind.Update(&ke.Kline)
+	}
+}
+
+// Handler returns kline handler feeding events to inds, e.g. for
+// pkg.StreamHandler.OnKline.
+func Handler(inds ...Indicator) func(*pkg.KlineEvent) {
+	return func(ke *pkg.KlineEvent) {
+		for _, ind := range inds {
+			Feed(ind, ke)
+		}
+	}
+}
+
+// Ready reports whether ind has value.
+func Ready(ind Indicator) bool {
+	return !math.IsNaN(ind.Value())
+}
+
+// Compute adds klines to ind and returns its value after each of them.
+func Compute(ind Indicator, klines []*pkg.Kline) []float64 {
+	values := make([]float64, len(klines))
+	for i, k := range klines {
+		ind.Add(k)
+		values[i] = ind.Value()
+	}
+	return values
+}
+
+// ComputeAll adds klines to ind and returns series of each of its outputs.
+func ComputeAll(ind MultiIndicator, klines []*pkg.Kline) [][]float64 {
+	var series [][]float64
+	for i, k := range klines {
+		ind.Add(k)
+		for j, v := range ind.Values() {
+			if i == 0 {
+				series = append(series, make([]float64, len(klines)))
+			}
+			series[j][i] = v
+		}
+	}
+	return series
+}
+
+// mustPeriods panics unless periods of indicator name are positive, as
+// windows of them can't be filled.
+func mustPeriods(name string, periods ...int) {
+	for _, n := range periods {
+		if n < 1 {
+			panic(fmt.Sprintf("indicator: %s period must be positive, got %d", name, n))
+		}
+	}
+}
+
+// push returns the last n values of w followed by v, leaving w intact so
+// that committed window can be previewed.
+func push(w []float64, n int, v float64) []float64 {
+	start := 0
+	if len(w) >= n {
+		start = len(w) - n + 1
+	}
+	out := make([]float64, 0, n)
+	out = append(out, w[start:]...)
+	return append(out, v)
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// average is moving average updated with single values.
+type average struct {
+	n int
+	// alpha is smoothing factor of exponential average; zero makes it
+	// simple one.
+	alpha  float64
+	window []float64
+	count  int
+	value  float64
+}
+
+func simpleAverage(n int) average {
+	return average{n: n, value: math.NaN()}
+}
+
+// exponentialAverage is EMA seeded by simple average of the first n values.
+func exponentialAverage(n int, alpha float64) average {
+	return average{n: n, alpha: alpha, value: math.NaN()}
+}
+
+func (a average) next(v float64) average {
+	a.count++
+	switch {
+	case a.alpha == 0 || a.count <= a.n:
+		a.window = push(a.window, a.n, v)
+		if len(a.window) == a.n {
+			a.value = mean(a.window)
+		}
+		if a.alpha != 0 && a.count == a.n {
+			a.window = nil
+		}
+	default:
+		a.value = a.alpha*v + (1-a.alpha)*a.value
+	}
+	return a
+}
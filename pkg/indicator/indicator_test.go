@@ -0,0 +1,180 @@
+package indicator
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const delta = 1e-9
+
+func closes(values ...float64) []*pkg.Kline {
+	var klines []*pkg.Kline
+	for _, v := range values {
+		klines = append(klines, &pkg.Kline{Open: v, High: v, Low: v, Close: v})
+	}
+	return klines
+}
+
+// bars returns klines of high, low, close and volume quadruples.
+func bars(values ...[4]float64) []*pkg.Kline {
+	var klines []*pkg.Kline
+	for _, v := range values {
+		klines = append(klines, &pkg.Kline{High: v[0], Low: v[1], Close: v[2], Volume: v[3]})
+	}
+	return klines
+}
+
+// assertSeries compares values with expected ones rounded to precision,
+// NaN expected values expecting NaN.
+func assertSeries(t *testing.T, expected, actual []float64, precision float64) {
+	t.Helper()
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		if math.IsNaN(expected[i]) {
+			assert.True(t, math.IsNaN(actual[i]), "value %d: %v is not NaN", i, actual[i])
+			continue
+		}
+		assert.InDelta(t, expected[i], actual[i], precision/2, "value %d", i)
+	}
+}
+
+var nan = math.NaN()
+
+// Reference series are taken from StockCharts ChartSchool spreadsheets.
+var referenceCloses = closes(22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+	22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63,
+	23.82, 23.87, 23.65, 23.19, 23.10, 23.33, 22.68, 23.10, 22.40, 22.17)
+
+func TestSMA(t *testing.T) {
+	assertSeries(t, []float64{nan, nan, nan, nan, nan, nan, nan, nan, nan, 22.22,
+		22.21, 22.23, 22.26, 22.30, 22.42, 22.61, 22.77, 22.91, 23.08, 23.21,
+		23.38, 23.52, 23.65, 23.71, 23.68, 23.61, 23.51, 23.43, 23.28, 23.13,
+	}, Compute(NewSMA(10), referenceCloses), 0.01)
+}
+
+func TestEMA(t *testing.T) {
+	assertSeries(t, []float64{nan, nan, nan, nan, nan, nan, nan, nan, nan, 22.22,
+		22.21, 22.24, 22.27, 22.33, 22.52, 22.80, 22.97, 23.13, 23.28, 23.34,
+		23.43, 23.51, 23.53, 23.47, 23.40, 23.39, 23.26, 23.23, 23.08, 22.92,
+	}, Compute(NewEMA(10), referenceCloses), 0.01)
+}
+
+func TestWMA(t *testing.T) {
+	assertSeries(t, []float64{nan, nan, 14.0 / 6, 20.0 / 6, 26.0 / 6}, Compute(NewWMA(3), closes(1, 2, 3, 4, 5)), delta)
+}
+
+func TestRSI(t *testing.T) {
+	klines := closes(44.3389, 44.0902, 44.1497, 43.6124, 44.3278, 44.8264, 45.0955, 45.4245, 45.8433, 46.0826,
+		45.8931, 46.0328, 45.6140, 46.2820, 46.2820, 46.0028, 46.0328, 46.4116, 46.2222, 45.6439,
+		46.2122, 46.2521, 45.7137, 46.4515, 45.7835, 45.3548, 44.0288, 44.1783, 44.2181, 44.5672,
+		43.4205, 42.6628, 43.1314)
+	assertSeries(t, []float64{nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan, nan,
+		70.53, 66.32, 66.55, 69.41, 66.36, 57.97, 62.93, 63.26, 56.06, 62.38,
+		54.71, 50.42, 39.99, 41.46, 41.87, 45.46, 37.30, 33.08, 37.77,
+	}, Compute(NewRSI(14), klines), 0.01)
+
+	assertSeries(t, []float64{nan, nan, 100}, Compute(NewRSI(2), closes(1, 2, 3)), delta)
+	assertSeries(t, []float64{nan, nan, 50}, Compute(NewRSI(2), closes(1, 1, 1)), delta)
+}
+
+func TestMACD(t *testing.T) {
+	series := ComputeAll(NewMACD(2, 3, 2), closes(1, 2, 4, 3, 5))
+	require.Len(t, series, 3)
+	assertSeries(t, []float64{nan, nan, 5.0 / 6, 7.0 / 18, 14.0 / 27}, series[0], delta)
+	assertSeries(t, []float64{nan, nan, nan, 11.0 / 18, 89.0 / 162}, series[1], delta)
+	assertSeries(t, []float64{nan, nan, nan, 7.0/18 - 11.0/18, -5.0 / 162}, series[2], delta)
+}
+
+func TestBollinger(t *testing.T) {
+	series := ComputeAll(NewBollinger(3, 2), closes(1, 2, 3))
+	require.Len(t, series, 3)
+	deviation := math.Sqrt(2.0 / 3)
+	assertSeries(t, []float64{nan, nan, 2}, series[0], delta)
+	assertSeries(t, []float64{nan, nan, 2 + 2*deviation}, series[1], delta)
+	assertSeries(t, []float64{nan, nan, 2 - 2*deviation}, series[2], delta)
+}
+
+var referenceBars = bars(
+	[4]float64{10, 8, 9, 10},
+	[4]float64{11, 9, 10, 20},
+	[4]float64{12, 9, 11, 30},
+	[4]float64{11, 10, 10.5, 40},
+	[4]float64{13, 11, 12, 50},
+)
+
+func TestATR(t *testing.T) {
+	assertSeries(t, []float64{nan, nan, 7.0 / 3, 17.0 / 9, 56.5 / 27}, Compute(NewATR(3), referenceBars), delta)
+}
+
+func TestStochastic(t *testing.T) {
+	series := ComputeAll(NewStochastic(3, 2), referenceBars)
+	require.Len(t, series, 2)
+	assertSeries(t, []float64{nan, nan, 75, 50, 75}, series[0], delta)
+	assertSeries(t, []float64{nan, nan, nan, 62.5, 62.5}, series[1], delta)
+}
+
+func TestOBV(t *testing.T) {
+	assertSeries(t, []float64{0, 20, 50, 10, 60}, Compute(NewOBV(), referenceBars), delta)
+}
+
+func TestVWAP(t *testing.T) {
+	day := time.Date(2020, 9, 13, 22, 0, 0, 0, time.UTC)
+	klines := bars(
+		[4]float64{10, 8, 9, 10},
+		[4]float64{11, 9, 10, 30},
+		[4]float64{12, 9, 12, 10},
+	)
+	for i, k := range klines {
+		k.OpenTime = day.Add(time.Duration(i) * time.Hour)
+	}
+	assertSeries(t, []float64{9, (90 + 300) / 40.0, 11}, Compute(NewVWAP(24*time.Hour), klines), delta)
+	assertSeries(t, []float64{9, (90 + 300) / 40.0, (90 + 300 + 110) / 50.0}, Compute(NewVWAP(0), klines), delta)
+}
+
+func TestStreaming(t *testing.T) {
+	sma := NewSMA(2)
+	macd := NewMACD(2, 3, 2)
+	handle := Handler(sma, macd)
+	event := func(close float64, final bool) *pkg.KlineEvent {
+		return &pkg.KlineEvent{Final: final, Kline: pkg.Kline{Close: close}}
+	}
+
+	handle(event(1, true))
+	assert.False(t, Ready(sma))
+	handle(event(3, false))
+	assert.Equal(t, 2.0, sma.Value())
+	handle(event(5, false))
+	assert.Equal(t, 3.0, sma.Value())
+	// Forming kline closed at different price.
+	handle(event(2, true))
+	assert.Equal(t, 1.5, sma.Value())
+	handle(event(4, false))
+	assert.Equal(t, 3.0, sma.Value())
+	handle(event(4, true))
+	handle(event(3, true))
+	assert.Equal(t, 3.5, sma.Value())
+
+	// Previews don't leak into committed state of MACD either.
+	batch := ComputeAll(NewMACD(2, 3, 2), closes(1, 2, 4, 3))
+	for i, v := range macd.Values() {
+		assert.InDelta(t, batch[i][3], v, delta)
+	}
+}
+
+func TestInvalidPeriods(t *testing.T) {
+	assert.PanicsWithValue(t, "indicator: SMA period must be positive, got 0", func() { NewSMA(0) })
+	assert.Panics(t, func() { NewEMA(-1) })
+	assert.Panics(t, func() { NewWMA(0) })
+	assert.Panics(t, func() { NewRSI(0) })
+	assert.Panics(t, func() { NewMACD(12, 0, 9) })
+	assert.Panics(t, func() { NewStochastic(14, 0) })
+	assert.Panics(t, func() { NewATR(0) })
+	assert.Panics(t, func() { NewBollinger(0, 2) })
+	assert.PanicsWithValue(t, "indicator: Bollinger width must be positive, got -2", func() { NewBollinger(20, -2) })
+	assert.Panics(t, func() { NewBollinger(20, math.NaN()) })
+}
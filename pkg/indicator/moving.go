@@ -0,0 +1,102 @@
+package indicator
+
+import (
+	"math"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// SMA is simple moving average of close prices.
+type SMA struct {
+	committed, current average
+}
+
+// NewSMA creates SMA of n periods. It panics if n isn't positive.
+func NewSMA(n int) *SMA {
+	mustPeriods("SMA", n)
+	a := simpleAverage(n)
+	return &SMA{committed: a, current: a}
+}
+
+// Add commits closed kline.
+func (s *SMA) Add(k *pkg.Kline) {
+	s.committed = s.committed.next(k.Close)
+	s.current = s.committed
+}
+
+// Update previews SMA with forming kline.
+func (s *SMA) Update(k *pkg.Kline) {
+	s.current = s.committed.next(k.Close)
+}
+
+// Value returns the average.
+func (s *SMA) Value() float64 {
+	return s.current.value
+}
+
+// EMA is exponential moving average of close prices, with smoothing factor
+// 2/(n+1), seeded by simple average of the first n closes.
+type EMA struct {
+	committed, current average
+}
+
+// NewEMA creates EMA of n periods. It panics if n isn't positive.
+func NewEMA(n int) *EMA {
+	mustPeriods("EMA", n)
+	a := exponentialAverage(n, 2/float64(n+1))
+	return &EMA{committed: a, current: a}
+}
+
+// Add commits closed kline.
+func (e *EMA) Add(k *pkg.Kline) {
+	e.committed = e.committed.next(k.Close)
+	e.current = e.committed
+}
+
+// Update previews EMA with forming kline.
+func (e *EMA) Update(k *pkg.Kline) {
+	e.current = e.committed.next(k.Close)
+}
+
+// Value returns the average.
+func (e *EMA) Value() float64 {
+	return e.current.value
+}
+
+// WMA is linearly weighted moving average of close prices, the latest close
+// having weight n and the oldest one weight 1.
+type WMA struct {
+	n                  int
+	committed, current []float64
+}
+
+// NewWMA creates WMA of n periods. It panics if n isn't positive.
+func NewWMA(n int) *WMA {
+	mustPeriods("WMA", n)
+	return &WMA{n: n}
+}
+
+// Add commits closed kline.
+func (w *WMA) Add(k *pkg.Kline) {
+	w.committed = push(w.committed, w.n, k.Close)
+	w.current = w.committed
+}
+
+// Update previews WMA with forming kline.
+func (w *WMA) Update(k *pkg.Kline) {
+	w.current = push(w.committed, w.n, k.Close)
+}
+
+// Value returns the average.
+func (w *WMA) Value() float64 {
+	if len(w.current) < w.n {
+		return math.NaN()
+	}
+	sum, weights := 0.0, 0.0
+	for i, v := range w.current {
+		weight := float64(i + 1)
+		sum += weight * v
+		weights += weight
+	}
+	return sum / weights
+}
@@ -0,0 +1,200 @@
+package indicator
+
+import (
+	"math"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+type rsiState struct {
+	prev       float64
+	hasPrev    bool
+	gain, loss average
+}
+
+func (s rsiState) next(close float64) rsiState {
+	if s.hasPrev {
+		change := close - s.prev
+		s.gain = s.gain.next(math.Max(change, 0))
+		s.loss = s.loss.next(math.Max(-change, 0))
+	}
+	s.prev, s.hasPrev = close, true
+	return s
+}
+
+func (s rsiState) value() float64 {
+	switch {
+	case math.IsNaN(s.gain.value):
+		return math.NaN()
+	case s.loss.value == 0 && s.gain.value == 0:
+		return 50
+	case s.loss.value == 0:
+		return 100
+	}
+	return 100 - 100/(1+s.gain.value/s.loss.value)
+}
+
+// RSI is relative strength index of close prices with Wilder's smoothing,
+// ranging from 0 to 100. It's ready after n+1 klines.
+type RSI struct {
+	committed, current rsiState
+}
+
+// NewRSI creates RSI of n periods. It panics if n isn't positive.
+func NewRSI(n int) *RSI {
+	mustPeriods("RSI", n)
+	s := rsiState{
+		gain: exponentialAverage(n, 1/float64(n)),
+		loss: exponentialAverage(n, 1/float64(n)),
+	}
+	return &RSI{committed: s, current: s}
+}
+
+// Add commits closed kline.
+func (r *RSI) Add(k *pkg.Kline) {
+	r.committed = r.committed.next(k.Close)
+	r.current = r.committed
+}
+
+// Update previews RSI with forming kline.
+func (r *RSI) Update(k *pkg.Kline) {
+	r.current = r.committed.next(k.Close)
+}
+
+// Value returns the index.
+func (r *RSI) Value() float64 {
+	return r.current.value()
+}
+
+type macdState struct {
+	fast, slow, signal average
+	macd               float64
+}
+
+func (s macdState) next(close float64) macdState {
+	s.fast = s.fast.next(close)
+	s.slow = s.slow.next(close)
+	s.macd = s.fast.value - s.slow.value
+	if !math.IsNaN(s.macd) {
+		s.signal = s.signal.next(s.macd)
+	}
+	return s
+}
+
+// MACD is moving average convergence divergence of close prices: difference
+// of fast and slow EMA, its EMA called signal and their difference called
+// histogram.
+type MACD struct {
+	committed, current macdState
+}
+
+// NewMACD creates MACD with given periods of averages, usually 12, 26 and 9.
+// It panics if any period isn't positive.
+func NewMACD(fast, slow, signal int) *MACD {
+	mustPeriods("MACD", fast, slow, signal)
+	s := macdState{
+		fast:   exponentialAverage(fast, 2/float64(fast+1)),
+		slow:   exponentialAverage(slow, 2/float64(slow+1)),
+		signal: exponentialAverage(signal, 2/float64(signal+1)),
+		macd:   math.NaN(),
+	}
+	return &MACD{committed: s, current: s}
+}
+
+// Add commits closed kline.
+func (m *MACD) Add(k *pkg.Kline) {
+	m.committed = m.committed.next(k.Close)
+	m.current = m.committed
+}
+
+// Update previews MACD with forming kline.
+func (m *MACD) Update(k *pkg.Kline) {
+	m.current = m.committed.next(k.Close)
+}
+
+// Value returns MACD line.
+func (m *MACD) Value() float64 {
+	return m.current.macd
+}
+
+// Signal returns signal line.
+func (m *MACD) Signal() float64 {
+	return m.current.signal.value
+}
+
+// Histogram returns difference of MACD and signal line.
+func (m *MACD) Histogram() float64 {
+	return m.current.macd - m.current.signal.value
+}
+
+// Values returns MACD line, signal line and histogram.
+func (m *MACD) Values() []float64 {
+	return []float64{m.Value(), m.Signal(), m.Histogram()}
+}
+
+type stochasticState struct {
+	n           int
+	highs, lows []float64
+	k           float64
+	d           average
+}
+
+func (s stochasticState) next(k *pkg.Kline) stochasticState {
+	s.highs = push(s.highs, s.n, k.High)
+	s.lows = push(s.lows, s.n, k.Low)
+	if len(s.highs) < s.n {
+		return s
+	}
+	high, low := s.highs[0], s.lows[0]
+	for i := range s.highs {
+		high = math.Max(high, s.highs[i])
+		low = math.Min(low, s.lows[i])
+	}
+	s.k = 50
+	if high > low {
+		s.k = 100 * (k.Close - low) / (high - low)
+	}
+	s.d = s.d.next(s.k)
+	return s
+}
+
+// Stochastic is stochastic oscillator: %K is position of close within range
+// of the last n klines, from 0 at the lowest low to 100 at the highest high
+// (50 if the range is empty), %D is its simple average.
+type Stochastic struct {
+	committed, current stochasticState
+}
+
+// NewStochastic creates Stochastic with %K over n klines and %D over d
+// values of %K, usually 14 and 3. It panics if n or d isn't positive.
+func NewStochastic(n, d int) *Stochastic {
+	mustPeriods("Stochastic", n, d)
+	s := stochasticState{n: n, k: math.NaN(), d: simpleAverage(d)}
+	return &Stochastic{committed: s, current: s}
+}
+
+// Add commits closed kline.
+func (s *Stochastic) Add(k *pkg.Kline) {
+	s.committed = s.committed.next(k)
+	s.current = s.committed
+}
+
+// Update previews Stochastic with forming kline.
+func (s *Stochastic) Update(k *pkg.Kline) {
+	s.current = s.committed.next(k)
+}
+
+// Value returns %K.
+func (s *Stochastic) Value() float64 {
+	return s.current.k
+}
+
+// D returns %D.
+func (s *Stochastic) D() float64 {
+	return s.current.d.value
+}
+
+// Values returns %K and %D.
+func (s *Stochastic) Values() []float64 {
+	return []float64{s.Value(), s.D()}
+}
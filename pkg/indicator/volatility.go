@@ -0,0 +1,115 @@
+package indicator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Bollinger is Bollinger bands of close prices: simple moving average with
+// bands width times population standard deviation above and below it.
+type Bollinger struct {
+	n                  int
+	width              float64
+	committed, current []float64
+}
+
+// NewBollinger creates Bollinger bands over n klines, usually 20 and 2. It
+// panics if n or width isn't positive.
+func NewBollinger(n int, width float64) *Bollinger {
+	mustPeriods("Bollinger", n)
+	if !(width > 0) || math.IsInf(width, 0) {
+		panic(fmt.Sprintf("indicator: Bollinger width must be positive, got %v", width))
+	}
+	return &Bollinger{n: n, width: width}
+}
+
+// Add commits closed kline.
+func (b *Bollinger) Add(k *pkg.Kline) {
+	b.committed = push(b.committed, b.n, k.Close)
+	b.current = b.committed
+}
+
+// Update previews bands with forming kline.
+func (b *Bollinger) Update(k *pkg.Kline) {
+	b.current = push(b.committed, b.n, k.Close)
+}
+
+// Value returns the middle band.
+func (b *Bollinger) Value() float64 {
+	if len(b.current) < b.n {
+		return math.NaN()
+	}
+	return mean(b.current)
+}
+
+func (b *Bollinger) deviation() float64 {
+	m := b.Value()
+	variance := 0.0
+	for _, v := range b.current {
+		variance += (v - m) * (v - m)
+	}
+	return math.Sqrt(variance / float64(len(b.current)))
+}
+
+// Upper returns the upper band.
+func (b *Bollinger) Upper() float64 {
+	return b.Value() + b.width*b.deviation()
+}
+
+// Lower returns the lower band.
+func (b *Bollinger) Lower() float64 {
+	return b.Value() - b.width*b.deviation()
+}
+
+// Values returns the middle, upper and lower band.
+func (b *Bollinger) Values() []float64 {
+	return []float64{b.Value(), b.Upper(), b.Lower()}
+}
+
+type atrState struct {
+	prevClose float64
+	hasPrev   bool
+	average   average
+}
+
+func (s atrState) next(k *pkg.Kline) atrState {
+	tr := k.High - k.Low
+	if s.hasPrev {
+		tr = math.Max(tr, math.Max(math.Abs(k.High-s.prevClose), math.Abs(k.Low-s.prevClose)))
+	}
+	s.average = s.average.next(tr)
+	s.prevClose, s.hasPrev = k.Close, true
+	return s
+}
+
+// ATR is average true range with Wilder's smoothing, seeded by simple
+// average of the first n true ranges. True range of the first kline is its
+// high-low range.
+type ATR struct {
+	committed, current atrState
+}
+
+// NewATR creates ATR of n periods. It panics if n isn't positive.
+func NewATR(n int) *ATR {
+	mustPeriods("ATR", n)
+	s := atrState{average: exponentialAverage(n, 1/float64(n))}
+	return &ATR{committed: s, current: s}
+}
+
+// Add commits closed kline.
+func (a *ATR) Add(k *pkg.Kline) {
+	a.committed = a.committed.next(k)
+	a.current = a.committed
+}
+
+// Update previews ATR with forming kline.
+func (a *ATR) Update(k *pkg.Kline) {
+	a.current = a.committed.next(k)
+}
+
+// Value returns the average true range.
+func (a *ATR) Value() float64 {
+	return a.current.average.value
+}
@@ -0,0 +1,107 @@
+package indicator
+
+import (
+	"math"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+)
+
+type obvState struct {
+	prevClose float64
+	hasPrev   bool
+	value     float64
+}
+
+func (s obvState) next(k *pkg.Kline) obvState {
+	switch {
+	case !s.hasPrev:
+	case k.Close > s.prevClose:
+		s.value += k.Volume
+	case k.Close < s.prevClose:
+		s.value -= k.Volume
+	}
+	s.prevClose, s.hasPrev = k.Close, true
+	return s
+}
+
+// OBV is on-balance volume: volume of klines closing higher than previous
+// one added, of those closing lower subtracted, starting from zero.
+type OBV struct {
+	committed, current obvState
+}
+
+// NewOBV creates OBV.
+func NewOBV() *OBV {
+	return &OBV{}
+}
+
+// Add commits closed kline.
+func (o *OBV) Add(k *pkg.Kline) {
+	o.committed = o.committed.next(k)
+	o.current = o.committed
+}
+
+// Update previews OBV with forming kline.
+func (o *OBV) Update(k *pkg.Kline) {
+	o.current = o.committed.next(k)
+}
+
+// Value returns cumulative volume, NaN before the first kline.
+func (o *OBV) Value() float64 {
+	if !o.current.hasPrev {
+		return math.NaN()
+	}
+	return o.current.value
+}
+
+type vwapState struct {
+	session     time.Time
+	priceVolume float64
+	volume      float64
+}
+
+// VWAP is volume weighted average price of klines, priced at their typical
+// price (high+low+close)/3. It restarts with every session.
+type VWAP struct {
+	session            time.Duration
+	committed, current vwapState
+}
+
+// NewVWAP creates VWAP restarting when open time of kline crosses multiple
+// of session, e.g. every UTC day with 24h. Zero session never restarts.
+func NewVWAP(session time.Duration) *VWAP {
+	return &VWAP{session: session}
+}
+
+func (v *VWAP) next(k *pkg.Kline) vwapState {
+	s := v.committed
+	if v.session > 0 {
+		session := k.OpenTime.Truncate(v.session)
+		if !session.Equal(s.session) {
+			s = vwapState{session: session}
+		}
+	}
+	s.priceVolume += (k.High + k.Low + k.Close) / 3 * k.Volume
+	s.volume += k.Volume
+	return s
+}
+
+// Add commits closed kline.
+func (v *VWAP) Add(k *pkg.Kline) {
+	v.committed = v.next(k)
+	v.current = v.committed
+}
+
+// Update previews VWAP with forming kline.
+func (v *VWAP) Update(k *pkg.Kline) {
+	v.current = v.next(k)
+}
+
+// Value returns the average price, NaN until there's volume.
+func (v *VWAP) Value() float64 {
+	if v.current.volume == 0 {
+		return math.NaN()
+	}
+	return v.current.priceVolume / v.current.volume
+}
@@ -1,5 +1,7 @@
 package pkg
 
+import "time"
+
 // Interval represents interval enum.
 type Interval string
 
@@ -21,10 +23,36 @@ var (
 	Month          = Interval("1M")
 )
 
+// intervalDurations are lengths of kline intervals, months approximated.
+var intervalDurations = map[Interval]time.Duration{
+	Minute:         time.Minute,
+	ThreeMinutes:   3 * time.Minute,
+	FiveMinutes:    5 * time.Minute,
+	FifteenMinutes: 15 * time.Minute,
+	ThirtyMinutes:  30 * time.Minute,
+	Hour:           time.Hour,
+	TwoHours:       2 * time.Hour,
+	FourHours:      4 * time.Hour,
+	SixHours:       6 * time.Hour,
+	EightHours:     8 * time.Hour,
+	TwelveHours:    12 * time.Hour,
+	Day:            24 * time.Hour,
+	ThreeDays:      72 * time.Hour,
+	Week:           7 * 24 * time.Hour,
+	Month:          30 * 24 * time.Hour,
+}
+
+// Duration returns length of kline interval, with month approximated as 30
+// days. Unknown intervals have zero duration.
+func (i Interval) Duration() time.Duration {
+	return intervalDurations[i]
+}
+
 // TimeInForce represents timeInForce enum.
 type TimeInForce string
 
 var (
 	GTC = TimeInForce("GTC")
 	IOC = TimeInForce("IOC")
+	FOK = TimeInForce("FOK")
 )
@@ -0,0 +1,128 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+const (
+	// tradesWindow is the longest time range of single MyTrades call.
+	tradesWindow = 24 * time.Hour
+	// historyWindow is the longest time range of single deposit or
+	// withdraw history call.
+	historyWindow = 90 * 24 * time.Hour
+
+	// tradesWeight and historyWeight are request weights of MyTrades and
+	// deposit or withdraw history calls.
+	tradesWeight  = 20
+	historyWeight = 1
+)
+
+// pace waits until call of weight fits weight per minute of e.
+func (e *Exporter) pace(weight int) {
+	if e.weightPerMinute <= 0 {
+		return
+	}
+	now := time.Now()
+	if e.next.After(now) {
+		time.Sleep(e.next.Sub(now))
+	} else {
+		e.next = now
+	}
+	e.next = e.next.Add(time.Duration(weight) * time.Minute / time.Duration(e.weightPerMinute))
+}
+
+// windows calls f with consecutive time ranges from time from until time
+// to, each at most d long. End of range is exclusive.
+func windows(from, to time.Time, d time.Duration, f func(start, end time.Time) error) error {
+	for start := from; start.Before(to); start = start.Add(d) {
+		end := start.Add(d)
+		if end.After(to) {
+			end = to
+		}
+		if err := f(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trades returns trades of symbol from time from until time to. Windows
+// with more trades than fit on a page are continued by trade ID.
+func (e *Exporter) trades(symbol string, from, to time.Time) ([]*pkg.Trade, error) {
+	var trades []*pkg.Trade
+	err := windows(from, to, tradesWindow, func(start, end time.Time) error {
+		req := pkg.MyTradesRequest{
+			Symbol:    symbol,
+			StartTime: start,
+			EndTime:   end.Add(-time.Millisecond),
+			Limit:     e.tradesLimit,
+		}
+		for {
+			e.pace(tradesWeight)
+			req.Timestamp = time.Now()
+			page, err := e.service.MyTrades(req)
+			if err != nil {
+				return errors.Wrapf(err, "unable to get %s trades from %s", symbol, start.UTC().Format(time.RFC3339))
+			}
+			for _, t := range page {
+				if t.Time.Before(end) {
+					trades = append(trades, t)
+				}
+			}
+			if len(page) < e.tradesLimit || !page[len(page)-1].Time.Before(end) {
+				return nil
+			}
+			req = pkg.MyTradesRequest{
+				Symbol: symbol,
+				FromID: page[len(page)-1].ID + 1,
+				Limit:  e.tradesLimit,
+			}
+		}
+	})
+	return trades, err
+}
+
+// deposits returns credited deposits from time from until time to.
+func (e *Exporter) deposits(from, to time.Time) ([]*pkg.Deposit, error) {
+	var deposits []*pkg.Deposit
+	status := depositSuccess
+	err := windows(from, to, historyWindow, func(start, end time.Time) error {
+		e.pace(historyWeight)
+		page, err := e.service.DepositHistory(pkg.HistoryRequest{
+			Status:    &status,
+			StartTime: start,
+			EndTime:   end.Add(-time.Millisecond),
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to get deposits from %s", start.UTC().Format(time.RFC3339))
+		}
+		deposits = append(deposits, page...)
+		return nil
+	})
+	return deposits, err
+}
+
+// withdrawals returns completed withdrawals from time from until time to.
+func (e *Exporter) withdrawals(from, to time.Time) ([]*pkg.Withdrawal, error) {
+	var withdrawals []*pkg.Withdrawal
+	status := withdrawalCompleted
+	err := windows(from, to, historyWindow, func(start, end time.Time) error {
+		e.pace(historyWeight)
+		page, err := e.service.WithdrawHistory(pkg.HistoryRequest{
+			Status:    &status,
+			StartTime: start,
+			EndTime:   end.Add(-time.Millisecond),
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to get withdrawals from %s", start.UTC().Format(time.RFC3339))
+		}
+		withdrawals = append(withdrawals, page...)
+		return nil
+	})
+	return withdrawals, err
+}
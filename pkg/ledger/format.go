@@ -0,0 +1,59 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// csvHeader are columns of CSV written by WriteCSV.
+var csvHeader = []string{"Time", "Kind", "Asset", "Amount", "Fiat Price", "Fiat Value", "Fiat", "Symbol", "Reference"}
+
+// WriteCSV writes rows as CSV with header. Time is in RFC 3339 format in
+// UTC, fiat price and value of unpriced rows are empty.
+func WriteCSV(w io.Writer, rows []*Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return errors.Wrap(err, "unable to write CSV header")
+	}
+	for _, r := range rows {
+		fiatPrice, fiatValue := "", ""
+		if r.Priced() {
+			fiatPrice, fiatValue = formatFloat(r.FiatPrice), formatFloat(r.FiatValue)
+		}
+		err := cw.Write([]string{
+			r.Time.UTC().Format(time.RFC3339),
+			string(r.Kind),
+			r.Asset,
+			formatFloat(r.Amount),
+			fiatPrice,
+			fiatValue,
+			r.Fiat,
+			r.Symbol,
+			r.Reference,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to write CSV row")
+		}
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "unable to write CSV")
+}
+
+// WriteJSON writes rows as indented JSON array.
+func WriteJSON(w io.Writer, rows []*Row) error {
+	if rows == nil {
+		rows = []*Row{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(rows), "unable to write JSON")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,280 @@
+// Package ledger exports trades, deposits and withdrawals of account as
+// normalized ledger rows for tax and accounting tools.
+//
+// Every movement of an asset is a row: trade produces rows of both traded
+// assets and a fee row of commission, withdrawal a row of withdrawn amount
+// and a fee row of transaction fee. Rows are valued in fiat by historical
+// klines at time of the transaction:
+//
+//	e := ledger.New(service,
+//		ledger.WithSymbols("BNBUSDT", "BNBBTC"),
+//		ledger.WithFiat("EUR"))
+//	rows, err := e.Export(from, to)
+//	if err != nil {
+//		panic(err)
+//	}
+//	err = ledger.WriteCSV(os.Stdout, rows)
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/internal"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/pnl"
+	"github.com/retirero/go-binance/pkg/portfolio"
+)
+
+// DefaultFiat is asset rows are valued in by default. Binance lists no USD
+// symbols, so USDT stands for it.
+const DefaultFiat = "USDT"
+
+// DefaultWeightPerMinute is request weight Exporter uses per minute by
+// default, leaving most of the IP limit of 6000 to other clients. Trades of
+// a day of single symbol take one MyTrades call of weight 20.
+const DefaultWeightPerMinute = 1200
+
+const (
+	// depositSuccess is status of credited deposit.
+	depositSuccess = 1
+	// withdrawalCompleted is status of completed withdrawal.
+	withdrawalCompleted = 6
+)
+
+// Kind is kind of ledger row.
+type Kind string
+
+const (
+	// Trade is asset bought or sold by trade.
+	Trade Kind = "trade"
+	// Fee is commission of trade or transaction fee of withdrawal.
+	Fee Kind = "fee"
+	// Deposit is asset deposited to account.
+	Deposit Kind = "deposit"
+	// Withdrawal is asset withdrawn from account.
+	Withdrawal Kind = "withdrawal"
+)
+
+// Row is single movement of asset.
+type Row struct {
+	Time  time.Time `json:"time"`
+	Kind  Kind      `json:"kind"`
+	Asset string    `json:"asset"`
+	// Amount is positive for received asset and negative for sent or paid
+	// asset.
+	Amount float64 `json:"amount"`
+	// FiatPrice is price of one unit of Asset in Fiat at Time, zero if it's
+	// unknown.
+	FiatPrice float64 `json:"fiatPrice,omitempty"`
+	// FiatValue is Amount valued at FiatPrice.
+	FiatValue float64 `json:"fiatValue,omitempty"`
+	Fiat      string  `json:"fiat"`
+	// Symbol is set in rows of trades.
+	Symbol string `json:"symbol,omitempty"`
+	// Reference is shared by rows of the same transaction, symbol and trade
+	// ID for trades and transaction ID for deposits and withdrawals.
+	Reference string `json:"reference"`
+}
+
+// Priced returns whether row is valued in fiat.
+func (r *Row) Priced() bool {
+	return r.FiatPrice != 0
+}
+
+// Exporter fetches history of account and converts it to rows.
+type Exporter struct {
+	service pkg.Service
+	market  *portfolio.Market
+	symbols []string
+	fiat    string
+	prices  pnl.Prices
+	logger  log.Logger
+
+	// tradesLimit is number of trades requested per MyTrades call.
+	tradesLimit int
+	// weightPerMinute is request weight calls are paced to, next is time
+	// of the next call.
+	weightPerMinute int
+	next            time.Time
+}
+
+// Option configures Exporter.
+type Option func(*Exporter)
+
+// WithSymbols adds symbols trades are exported of. MyTrades can't list
+// trades of all symbols, so trades are exported only for added symbols.
+func WithSymbols(symbols ...string) Option {
+	return func(e *Exporter) {
+		e.symbols = append(e.symbols, symbols...)
+	}
+}
+
+// WithSymbol adds symbol like WithSymbols and sets assets its trades are
+// booked in. Export fails for added symbols whose assets can't be told from
+// the name.
+func WithSymbol(symbol, base, quote string) Option {
+	return func(e *Exporter) {
+		e.market.SetSymbol(symbol, base, quote)
+		e.symbols = append(e.symbols, symbol)
+	}
+}
+
+// WithFiat sets asset rows are valued in, DefaultFiat by default. Fiat like
+// EUR needs path through listed symbols, e.g. BTCEUR.
+func WithFiat(asset string) Option {
+	return func(e *Exporter) {
+		e.fiat = asset
+	}
+}
+
+// WithPrices sets source of historical prices, portfolio.HistoricalPrices of
+// minute klines of service by default.
+func WithPrices(p pnl.Prices) Option {
+	return func(e *Exporter) {
+		e.prices = p
+	}
+}
+
+// WithWeightPerMinute limits request weight of calls of Exporter per minute,
+// DefaultWeightPerMinute by default. Calls are spaced out evenly, zero weight
+// doesn't pace them.
+func WithWeightPerMinute(weight int) Option {
+	return func(e *Exporter) {
+		e.weightPerMinute = weight
+	}
+}
+
+// WithLogger sets logger of rows failed to be valued.
+func WithLogger(logger log.Logger) Option {
+	return func(e *Exporter) {
+		e.logger = logger
+	}
+}
+
+// New creates Exporter of account of service.
+func New(service pkg.Service, opts ...Option) *Exporter {
+	e := &Exporter{
+		service:     service,
+		market:      portfolio.NewMarket(),
+		fiat:        DefaultFiat,
+		logger:      log.NewNopLogger(),
+		tradesLimit: internal.TradesLimit,
+
+		weightPerMinute: DefaultWeightPerMinute,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.prices == nil {
+		// Minute interval is always supported.
+		e.prices, _ = portfolio.NewHistoricalPrices(service, pkg.Minute)
+	}
+	return e
+}
+
+// Export returns rows of trades of added symbols, credited deposits and
+// completed withdrawals from time from until time to, ordered by time. Rows
+// whose price isn't available are logged and left unpriced.
+func (e *Exporter) Export(from, to time.Time) ([]*Row, error) {
+	var rows []*Row
+	for _, symbol := range e.symbols {
+		base, quote, ok := e.market.Assets(symbol)
+		if !ok {
+			return nil, errors.Errorf("unknown assets of symbol %s", symbol)
+		}
+		trades, err := e.trades(symbol, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range trades {
+			rows = append(rows, tradeRows(t, base, quote)...)
+		}
+	}
+	deposits, err := e.deposits(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deposits {
+		rows = append(rows, &Row{
+			Time:      d.InsertTime.UTC(),
+			Kind:      Deposit,
+			Asset:     d.Asset,
+			Amount:    d.Amount,
+			Reference: d.TxID,
+		})
+	}
+	withdrawals, err := e.withdrawals(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range withdrawals {
+		rows = append(rows, &Row{
+			Time:      w.ApplyTime.UTC(),
+			Kind:      Withdrawal,
+			Asset:     w.Asset,
+			Amount:    -w.Amount,
+			Reference: w.TxID,
+		})
+		if w.TransactionFee != 0 {
+			rows = append(rows, &Row{
+				Time:      w.ApplyTime.UTC(),
+				Kind:      Fee,
+				Asset:     w.Asset,
+				Amount:    -w.TransactionFee,
+				Reference: w.TxID,
+			})
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Time.Before(rows[j].Time)
+	})
+	for _, r := range rows {
+		e.value(r)
+	}
+	return rows, nil
+}
+
+func tradeRows(t *pkg.Trade, base, quote string) []*Row {
+	quoteQty := t.QuoteQty
+	if quoteQty == 0 {
+		quoteQty = t.Price * t.Qty
+	}
+	sign := 1.0
+	if !t.IsBuyer {
+		sign = -1
+	}
+	row := Row{
+		Time:      t.Time.UTC(),
+		Kind:      Trade,
+		Symbol:    t.Symbol,
+		Reference: fmt.Sprintf("%s-%d", t.Symbol, t.ID),
+	}
+	baseRow, quoteRow := row, row
+	baseRow.Asset, baseRow.Amount = base, sign*t.Qty
+	quoteRow.Asset, quoteRow.Amount = quote, -sign*quoteQty
+	rows := []*Row{&baseRow, &quoteRow}
+	if t.Commission != 0 {
+		feeRow := row
+		feeRow.Kind, feeRow.Asset, feeRow.Amount = Fee, t.CommissionAsset, -t.Commission
+		rows = append(rows, &feeRow)
+	}
+	return rows
+}
+
+func (e *Exporter) value(r *Row) {
+	r.Fiat = e.fiat
+	price, err := e.prices.Price(r.Asset, e.fiat, r.Time)
+	if err != nil {
+		level.Warn(e.logger).Log("msg", "unable to value row", "asset", r.Asset,
+			"time", r.Time, "reference", r.Reference, "err", err)
+		return
+	}
+	r.FiatPrice = price
+	r.FiatValue = r.Amount * price
+}
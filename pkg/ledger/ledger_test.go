@@ -0,0 +1,205 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeService serves account history from slices, like Binance does.
+type fakeService struct {
+	pkg.Service
+	trades      []*pkg.Trade
+	deposits    []*pkg.Deposit
+	withdrawals []*pkg.Withdrawal
+
+	tradeRequests   []pkg.MyTradesRequest
+	historyRequests []pkg.HistoryRequest
+}
+
+func (s *fakeService) MyTrades(mtr pkg.MyTradesRequest) ([]*pkg.Trade, error) {
+	s.tradeRequests = append(s.tradeRequests, mtr)
+	if mtr.Symbol != "BNBUSDT" {
+		return nil, errors.New("invalid symbol")
+	}
+	var trades []*pkg.Trade
+	for _, t := range s.trades {
+		if t.ID < mtr.FromID || (!mtr.StartTime.IsZero() && t.Time.Before(mtr.StartTime)) ||
+			(!mtr.EndTime.IsZero() && t.Time.After(mtr.EndTime)) {
+			continue
+		}
+		if len(trades) == mtr.Limit {
+			break
+		}
+		trades = append(trades, t)
+	}
+	return trades, nil
+}
+
+func inRange(t time.Time, hr pkg.HistoryRequest) bool {
+	return !t.Before(hr.StartTime) && !t.After(hr.EndTime)
+}
+
+func (s *fakeService) DepositHistory(hr pkg.HistoryRequest) ([]*pkg.Deposit, error) {
+	s.historyRequests = append(s.historyRequests, hr)
+	var deposits []*pkg.Deposit
+	for _, d := range s.deposits {
+		if inRange(d.InsertTime, hr) && d.Status == *hr.Status {
+			deposits = append(deposits, d)
+		}
+	}
+	return deposits, nil
+}
+
+func (s *fakeService) WithdrawHistory(hr pkg.HistoryRequest) ([]*pkg.Withdrawal, error) {
+	s.historyRequests = append(s.historyRequests, hr)
+	var withdrawals []*pkg.Withdrawal
+	for _, w := range s.withdrawals {
+		if inRange(w.ApplyTime, hr) && w.Status == *hr.Status {
+			withdrawals = append(withdrawals, w)
+		}
+	}
+	return withdrawals, nil
+}
+
+// fixedPrices returns prices by asset and quote asset regardless of time.
+type fixedPrices map[string]float64
+
+func (p fixedPrices) Price(asset, quote string, t time.Time) (float64, error) {
+	if asset == quote {
+		return 1, nil
+	}
+	price, ok := p[asset+quote]
+	if !ok {
+		return 0, errors.Errorf("no %s%s price", asset, quote)
+	}
+	return price, nil
+}
+
+var from = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestService() *fakeService {
+	day := 24 * time.Hour
+	return &fakeService{
+		trades: []*pkg.Trade{
+			{Symbol: "BNBUSDT", ID: 1, Price: 40, Qty: 2, QuoteQty: 80, Commission: 0.25, CommissionAsset: "USDT",
+				Time: from.Add(time.Hour), IsBuyer: true},
+			{Symbol: "BNBUSDT", ID: 2, Price: 40, Qty: 1, QuoteQty: 40, Time: from.Add(2 * time.Hour)},
+			{Symbol: "BNBUSDT", ID: 3, Price: 40, Qty: 1, QuoteQty: 40, Time: from.Add(3 * time.Hour)},
+			{Symbol: "BNBUSDT", ID: 4, Price: 50, Qty: 1, QuoteQty: 50, Commission: 0.5, CommissionAsset: "BNB",
+				Time: from.Add(day + time.Hour), IsBuyer: true},
+			// After exported range.
+			{Symbol: "BNBUSDT", ID: 5, Price: 50, Qty: 1, QuoteQty: 50, Time: from.Add(200 * day)},
+		},
+		deposits: []*pkg.Deposit{
+			{InsertTime: from, Amount: 100, Asset: "USDT", TxID: "d1", Status: depositSuccess},
+			{InsertTime: from.Add(100 * day), Amount: 1, Asset: "BTC", TxID: "d2", Status: depositSuccess},
+			{InsertTime: from.Add(100 * day), Amount: 1, Asset: "BTC", TxID: "d3", Status: 0},
+		},
+		withdrawals: []*pkg.Withdrawal{
+			{ApplyTime: from.Add(2 * day), Amount: 1, TransactionFee: 0.25, Asset: "BNB", TxID: "w1",
+				Status: withdrawalCompleted},
+			{ApplyTime: from.Add(2 * day), Amount: 1, Asset: "BNB", TxID: "w2", Status: 1},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	service := newTestService()
+	e := New(service, WithSymbols("BNBUSDT"), WithPrices(fixedPrices{"BNBUSDT": 40}), WithWeightPerMinute(0))
+	e.tradesLimit = 2
+	rows, err := e.Export(from, from.Add(150*24*time.Hour))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*Row{
+		{Time: from, Kind: Deposit, Asset: "USDT", Amount: 100, FiatPrice: 1, FiatValue: 100, Fiat: "USDT",
+			Reference: "d1"},
+		{Time: from.Add(time.Hour), Kind: Trade, Asset: "BNB", Amount: 2, FiatPrice: 40, FiatValue: 80, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-1"},
+		{Time: from.Add(time.Hour), Kind: Trade, Asset: "USDT", Amount: -80, FiatPrice: 1, FiatValue: -80, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-1"},
+		{Time: from.Add(time.Hour), Kind: Fee, Asset: "USDT", Amount: -0.25, FiatPrice: 1, FiatValue: -0.25, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-1"},
+		{Time: from.Add(2 * time.Hour), Kind: Trade, Asset: "BNB", Amount: -1, FiatPrice: 40, FiatValue: -40, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-2"},
+		{Time: from.Add(2 * time.Hour), Kind: Trade, Asset: "USDT", Amount: 40, FiatPrice: 1, FiatValue: 40, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-2"},
+		{Time: from.Add(3 * time.Hour), Kind: Trade, Asset: "BNB", Amount: -1, FiatPrice: 40, FiatValue: -40, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-3"},
+		{Time: from.Add(3 * time.Hour), Kind: Trade, Asset: "USDT", Amount: 40, FiatPrice: 1, FiatValue: 40, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-3"},
+		{Time: from.Add(25 * time.Hour), Kind: Trade, Asset: "BNB", Amount: 1, FiatPrice: 40, FiatValue: 40, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-4"},
+		{Time: from.Add(25 * time.Hour), Kind: Trade, Asset: "USDT", Amount: -50, FiatPrice: 1, FiatValue: -50, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-4"},
+		{Time: from.Add(25 * time.Hour), Kind: Fee, Asset: "BNB", Amount: -0.5, FiatPrice: 40, FiatValue: -20, Fiat: "USDT",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-4"},
+		{Time: from.Add(48 * time.Hour), Kind: Withdrawal, Asset: "BNB", Amount: -1, FiatPrice: 40, FiatValue: -40,
+			Fiat: "USDT", Reference: "w1"},
+		{Time: from.Add(48 * time.Hour), Kind: Fee, Asset: "BNB", Amount: -0.25, FiatPrice: 40, FiatValue: -10,
+			Fiat: "USDT", Reference: "w1"},
+		// No BTC price.
+		{Time: from.Add(100 * 24 * time.Hour), Kind: Deposit, Asset: "BTC", Amount: 1, Fiat: "USDT", Reference: "d2"},
+	}, rows)
+
+	// 150 daily windows, the first one continued by trade ID.
+	require.Len(t, service.tradeRequests, 151)
+	assert.Equal(t, from, service.tradeRequests[0].StartTime)
+	assert.Equal(t, from.Add(24*time.Hour-time.Millisecond), service.tradeRequests[0].EndTime)
+	assert.Equal(t, int64(3), service.tradeRequests[1].FromID)
+	assert.True(t, service.tradeRequests[1].StartTime.IsZero())
+	assert.Equal(t, from.Add(24*time.Hour), service.tradeRequests[2].StartTime)
+	// 90 and 60 days long windows of deposits and withdrawals.
+	require.Len(t, service.historyRequests, 4)
+	assert.Equal(t, from.Add(90*24*time.Hour), service.historyRequests[1].StartTime)
+	assert.Equal(t, from.Add(150*24*time.Hour-time.Millisecond), service.historyRequests[1].EndTime)
+}
+
+func TestExportPacing(t *testing.T) {
+	// MyTrades calls of weight 20 are 10ms apart.
+	e := New(newTestService(), WithSymbols("BNBUSDT"), WithPrices(fixedPrices{"BNBUSDT": 40}),
+		WithWeightPerMinute(20*6000))
+	start := time.Now()
+	_, err := e.Export(from.Add(10*24*time.Hour), from.Add(15*24*time.Hour))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(40*time.Millisecond))
+}
+
+func TestExportErrors(t *testing.T) {
+	_, err := New(newTestService(), WithSymbols("XYZ")).Export(from, from.Add(time.Hour))
+	assert.EqualError(t, err, "unknown assets of symbol XYZ")
+	_, err = New(newTestService(), WithSymbol("XYZ", "X", "YZ")).Export(from, from.Add(time.Hour))
+	assert.EqualError(t, err, "unable to get XYZ trades from 2021-01-01T00:00:00Z: invalid symbol")
+}
+
+func TestWrite(t *testing.T) {
+	rows := []*Row{
+		{Time: from, Kind: Trade, Asset: "BNB", Amount: 1.5, FiatPrice: 40, FiatValue: 60, Fiat: "EUR",
+			Symbol: "BNBUSDT", Reference: "BNBUSDT-1"},
+		{Time: from.Add(time.Second), Kind: Deposit, Asset: "XYZ", Amount: -0.00000001, Fiat: "EUR", Reference: "d, 1"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, rows))
+	assert.Equal(t, "Time,Kind,Asset,Amount,Fiat Price,Fiat Value,Fiat,Symbol,Reference\n"+
+		"2021-01-01T00:00:00Z,trade,BNB,1.5,40,60,EUR,BNBUSDT,BNBUSDT-1\n"+
+		"2021-01-01T00:00:01Z,deposit,XYZ,-0.00000001,,,EUR,,\"d, 1\"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteJSON(&buf, rows))
+	var decoded []*Row
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, rows, decoded)
+	assert.Contains(t, buf.String(), `"kind": "deposit"`)
+	assert.NotContains(t, buf.String(), "fiatPrice\": 0")
+
+	buf.Reset()
+	require.NoError(t, WriteJSON(&buf, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
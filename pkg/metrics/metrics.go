@@ -0,0 +1,193 @@
+// Package metrics exports Prometheus metrics of REST and websocket activity.
+//
+// Metrics are registered on user supplied registry and collected through
+// pkg hooks:
+//
+//	m, err := metrics.New(prometheus.DefaultRegisterer, "binance")
+//	service := pkg.NewAPIService(url, apiKey, signer, logger, ctx,
+//		pkg.WithMiddleware(m.Middleware()),
+//		pkg.WithStreamObserver(m))
+//
+// Metrics also implements pkg.MethodObserver for pkg.WithMetrics decorator.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// usedWeightHeaders and orderCountHeaders map response headers to interval
+// label of respective gauges.
+var (
+	usedWeightHeaders = map[string]string{
+		"X-Mbx-Used-Weight":    "",
+		"X-Mbx-Used-Weight-1m": "1m",
+	}
+	orderCountHeaders = map[string]string{
+		"X-Mbx-Order-Count-10s": "10s",
+		"X-Mbx-Order-Count-1d":  "1d",
+	}
+)
+
+// Metrics collects Binance client metrics.
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	usedWeight      *prometheus.GaugeVec
+	orderCount      *prometheus.GaugeVec
+	messages        *prometheus.CounterVec
+	parseErrors     *prometheus.CounterVec
+	dropped         *prometheus.CounterVec
+	reconnects      *prometheus.CounterVec
+	eventLatency    *prometheus.HistogramVec
+	methodCalls     *prometheus.CounterVec
+	methodDuration  *prometheus.HistogramVec
+}
+
+// New creates Metrics and registers them on reg with given namespace.
+func New(reg prometheus.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rest_requests_total",
+			Help:      "REST requests by endpoint, method and response status.",
+		}, []string{"endpoint", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rest_request_duration_seconds",
+			Help:      "REST request latency by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "method"}),
+		usedWeight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rest_used_weight",
+			Help:      "Request weight used in current interval as reported by X-MBX-USED-WEIGHT headers.",
+		}, []string{"interval"}),
+		orderCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rest_order_count",
+			Help:      "Orders placed in current interval as reported by X-MBX-ORDER-COUNT headers.",
+		}, []string{"interval"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_messages_total",
+			Help:      "Websocket messages received by stream.",
+		}, []string{"stream"}),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_parse_errors_total",
+			Help:      "Websocket messages which couldn't be parsed by stream.",
+		}, []string{"stream"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_dropped_events_total",
+			Help:      "Websocket events dropped because of full buffer by stream.",
+		}, []string{"stream"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ws_reconnects_total",
+			Help:      "Websocket reconnects by stream.",
+		}, []string{"stream"}),
+		eventLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "ws_event_latency_seconds",
+			Help:      "Time from event time to receiving the event by stream.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"stream"}),
+		methodCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "service_calls_total",
+			Help:      "Service method calls by method and result.",
+		}, []string{"method", "result"}),
+		methodDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "service_call_duration_seconds",
+			Help:      "Service method call latency by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.requests, m.requestDuration, m.usedWeight, m.orderCount,
+		m.messages, m.parseErrors, m.dropped, m.reconnects, m.eventLatency,
+		m.methodCalls, m.methodDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, errors.Wrap(err, "unable to register metric")
+		}
+	}
+	return m, nil
+}
+
+// Middleware returns pkg.Middleware recording REST requests.
+func (m *Metrics) Middleware() pkg.Middleware {
+	return func(next pkg.RoundTripper) pkg.RoundTripper {
+		return func(req *pkg.APIRequest) (*pkg.APIResponse, error) {
+			res, err := next(req)
+			if err != nil {
+				m.requests.WithLabelValues(req.Endpoint, req.Method, "error").Inc()
+				return res, err
+			}
+			m.requests.WithLabelValues(req.Endpoint, req.Method, strconv.Itoa(res.StatusCode)).Inc()
+			m.requestDuration.WithLabelValues(req.Endpoint, req.Method).Observe(res.Latency.Seconds())
+			m.observeHeaders(res)
+			return res, err
+		}
+	}
+}
+
+func (m *Metrics) observeHeaders(res *pkg.APIResponse) {
+	for key, values := range res.Header {
+		if interval, ok := usedWeightHeaders[key]; ok {
+			setGauge(m.usedWeight, interval, values)
+		} else if interval, ok := orderCountHeaders[key]; ok {
+			setGauge(m.orderCount, interval, values)
+		}
+	}
+}
+
+func setGauge(g *prometheus.GaugeVec, interval string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	if v, err := strconv.ParseFloat(values[0], 64); err == nil {
+		g.WithLabelValues(interval).Set(v)
+	}
+}
+
+// MessageReceived implements pkg.StreamObserver.
+func (m *Metrics) MessageReceived(stream string, eventTime time.Time) {
+	m.messages.WithLabelValues(stream).Inc()
+	if !eventTime.IsZero() {
+		m.eventLatency.WithLabelValues(stream).Observe(time.Since(eventTime).Seconds())
+	}
+}
+
+// ParseError implements pkg.StreamObserver.
+func (m *Metrics) ParseError(stream string) {
+	m.parseErrors.WithLabelValues(stream).Inc()
+}
+
+// EventDropped implements pkg.StreamObserver.
+func (m *Metrics) EventDropped(stream string) {
+	m.dropped.WithLabelValues(stream).Inc()
+}
+
+// Reconnected implements pkg.StreamObserver.
+func (m *Metrics) Reconnected(stream string) {
+	m.reconnects.WithLabelValues(stream).Inc()
+}
+
+// ObserveMethod implements pkg.MethodObserver.
+func (m *Metrics) ObserveMethod(method string, latency time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.methodCalls.WithLabelValues(method, result).Inc()
+	m.methodDuration.WithLabelValues(method).Observe(latency.Seconds())
+}
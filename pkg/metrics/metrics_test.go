@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "21")
+		w.Header().Set("X-MBX-ORDER-COUNT-10S", "3")
+		if r.URL.Path == "/api/v3/order" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"code":-2010,"msg":"Account has insufficient balance for requested action."}`))
+			return
+		}
+		w.Write([]byte(`{"serverTime":1499827319559}`))
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	m, err := New(reg, "binance")
+	require.NoError(t, err)
+	service := pkg.NewAPIService(srv.URL, "", &pkg.HmacSigner{}, nil, context.Background(),
+		pkg.WithMiddleware(m.Middleware()))
+
+	_, err = service.Time()
+	require.NoError(t, err)
+	_, err = service.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC"})
+	require.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("api/v3/time", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues("api/v3/order", "POST", "400")))
+	assert.Equal(t, 21.0, testutil.ToFloat64(m.usedWeight.WithLabelValues("1m")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.orderCount.WithLabelValues("10s")))
+}
+
+func TestStreamMetrics(t *testing.T) {
+	eventTime := time.Now().Add(-time.Second).UnixNano() / int64(time.Millisecond)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"e":"aggTrade","E":%d,"s":"BNBBTC","a":1,"p":"1","q":"1","T":%d}`, eventTime, eventTime)))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"e":"aggTrade","p":false}`))
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	m, err := New(reg, "binance")
+	require.NoError(t, err)
+	service := pkg.NewAPIService(srv.URL, "", nil, nil, context.Background(),
+		pkg.WithStreamObserver(m), pkg.WithStreamURL("ws"+strings.TrimPrefix(srv.URL, "http")))
+
+	errch := make(chan error, 1)
+	sub, err := service.SubscribeTrade(pkg.TradeWebsocketRequest{Symbol: "BNBBTC"}, pkg.StreamHandler{
+		OnTrade: func(*pkg.AggTradeEvent) {},
+		OnError: func(err error) { errch <- err },
+	})
+	require.NoError(t, err)
+	<-errch
+	sub.Close()
+	<-sub.Done()
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.messages.WithLabelValues("bnbbtc@aggTrade")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.parseErrors.WithLabelValues("bnbbtc@aggTrade")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.eventLatency))
+}
+
+func TestDroppedAndReconnects(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg, "binance")
+	require.NoError(t, err)
+
+	m.EventDropped(pkg.UserDataStreamLabel)
+	m.Reconnected(pkg.UserDataStreamLabel)
+	m.ObserveMethod("NewOrder", time.Millisecond, nil)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.dropped.WithLabelValues("userData")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.reconnects.WithLabelValues("userData")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.methodCalls.WithLabelValues("NewOrder", "ok")))
+
+	_, err = New(reg, "binance")
+	assert.Error(t, err)
+}
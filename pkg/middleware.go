@@ -0,0 +1,253 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// APIRequest describes REST request passing through Middleware chain.
+type APIRequest struct {
+	// Ctx is context of the call, see WithContext.
+	Ctx      context.Context
+	Method   string
+	Endpoint string
+	// Params are request parameters. Signature is added after the chain, so
+	// it's never present.
+	Params map[string]string
+	// Weight is request weight counted by Binance against IP limits.
+	Weight int
+	APIKey bool
+	Signed bool
+}
+
+// APIResponse describes REST response passing through Middleware chain.
+type APIResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Latency    time.Duration
+}
+
+// RoundTripper sends APIRequest and returns APIResponse. Non-200 responses
+// are returned without error, network failures as error.
+type RoundTripper func(req *APIRequest) (*APIResponse, error)
+
+// Middleware wraps RoundTripper, e.g. to log or measure requests, serve them
+// from cache or inject faults.
+type Middleware func(next RoundTripper) RoundTripper
+
+// WithMiddleware adds middlewares around REST requests. The first middleware
+// is the outermost one.
+func WithMiddleware(mws ...Middleware) APIServiceOption {
+	return func(as *apiService) {
+		as.Middlewares = append(as.Middlewares, mws...)
+	}
+}
+
+// chain wraps rt with middlewares.
+func chain(rt RoundTripper, mws []Middleware) RoundTripper {
+	for i := len(mws) - 1; i >= 0; i-- {
+		rt = mws[i](rt)
+	}
+	return rt
+}
+
+// redactedParams lists params whose values are hidden by RedactParams.
+var redactedParams = map[string]bool{
+	"signature": true,
+	"listenKey": true,
+}
+
+// RedactParams returns copy of params with secret values replaced, suitable
+// for logs and dumps.
+func RedactParams(params map[string]string) map[string]string {
+	redacted := make(map[string]string, len(params))
+	for key, val := range params {
+		if redactedParams[key] {
+			val = "<redacted>"
+		}
+		redacted[key] = val
+	}
+	return redacted
+}
+
+// RedactBody returns JSON body with values of secret fields at any depth
+// replaced, e.g. listenKey of userDataStream response. Bodies without
+// secrets and non-JSON bodies are returned unchanged.
+func RedactBody(body []byte) []byte {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil || !redactValue(v) {
+		return body
+	}
+	var redacted bytes.Buffer
+	e := json.NewEncoder(&redacted)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(redacted.Bytes(), []byte("\n"))
+}
+
+// redactValue replaces secret fields of decoded JSON value in place and
+// reports whether there were any.
+func redactValue(v interface{}) bool {
+	redacted := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if redactedParams[key] {
+				v[key] = "<redacted>"
+				redacted = true
+			} else if redactValue(val) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, val := range v {
+			if redactValue(val) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// endpointWeights are request weights of endpoints with constant weight.
+var endpointWeights = map[string]int{
+	"GET api/v3/ping":                      1,
+	"GET api/v3/time":                      1,
+	"GET api/v3/aggTrades":                 2,
+	"GET api/v3/klines":                    2,
+	"GET api/v3/ticker/price":              4,
+	"GET api/v3/ticker/bookTicker":         4,
+	"POST api/v3/order":                    1,
+	"POST api/v3/order/test":               1,
+	"GET api/v3/order":                     4,
+	"DELETE api/v3/order":                  1,
+	"GET api/v3/allOrders":                 20,
+	"GET api/v3/account":                   20,
+	"GET api/v3/myTrades":                  20,
+	"POST api/v3/userDataStream":           2,
+	"PUT api/v3/userDataStream":            2,
+	"DELETE api/v3/userDataStream":         2,
+	"POST wapi/v1/withdraw.html":           1,
+	"GET sapi/v1/capital/deposit/hisrec":   1,
+	"GET sapi/v1/capital/withdraw/history": 1,
+}
+
+// endpointWeight returns request weight of endpoint called with params.
+func endpointWeight(method, endpoint string, params map[string]string) int {
+	switch method + " " + endpoint {
+	case "GET api/v3/depth":
+		limit, _ := strconv.Atoi(params["limit"])
+		switch {
+		case limit > 1000:
+			return 250
+		case limit > 500:
+			return 50
+		case limit > 100:
+			return 25
+		default:
+			return 5
+		}
+	case "GET api/v3/ticker/24hr":
+		if params["symbol"] == "" {
+			return 80
+		}
+		return 2
+	case "GET api/v3/openOrders":
+		if params["symbol"] == "" {
+			return 80
+		}
+		return 6
+	}
+	if w, ok := endpointWeights[method+" "+endpoint]; ok {
+		return w
+	}
+	return 1
+}
+
+// LoggingMiddleware logs every request with its redacted params, weight,
+// response status, used weight and latency. Failed requests are logged on
+// error level.
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			res, err := next(req)
+			keyvals := []interface{}{
+				"method", req.Method,
+				"endpoint", req.Endpoint,
+				"params", fmt.Sprint(RedactParams(req.Params)),
+				"weight", req.Weight,
+			}
+			if err != nil {
+				level.Error(logger).Log(append(keyvals, "err", err)...)
+				return res, err
+			}
+			keyvals = append(keyvals,
+				"status", res.StatusCode,
+				"usedWeight", res.Header.Get("X-MBX-USED-WEIGHT-1M"),
+				"latency", res.Latency,
+			)
+			if res.StatusCode != 200 {
+				level.Warn(logger).Log(append(keyvals, "body", string(RedactBody(res.Body)))...)
+			} else {
+				level.Debug(logger).Log(keyvals...)
+			}
+			return res, err
+		}
+	}
+}
+
+// DumpMiddleware writes every request and response to w for debugging.
+// Secret params and fields of JSON bodies are redacted. Writes are serialized, so w can
+// be shared by concurrent requests, e.g. a file.
+func DumpMiddleware(w io.Writer) Middleware {
+	var mu sync.Mutex
+	return func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			res, err := next(req)
+
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintf(w, "> %s %s\n", req.Method, req.Endpoint)
+			params := RedactParams(req.Params)
+			keys := make([]string, 0, len(params))
+			for key := range params {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(w, "> %s=%s\n", key, params[key])
+			}
+			if err != nil {
+				fmt.Fprintf(w, "< error: %s\n\n", err)
+				return res, err
+			}
+			fmt.Fprintf(w, "< %d (%s)\n", res.StatusCode, res.Latency)
+			headers := make([]string, 0, len(res.Header))
+			for key := range res.Header {
+				headers = append(headers, key)
+			}
+			sort.Strings(headers)
+			for _, key := range headers {
+				fmt.Fprintf(w, "< %s: %s\n", key, res.Header.Get(key))
+			}
+			fmt.Fprintf(w, "<\n%s\n\n", RedactBody(res.Body))
+			return res, err
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "7")
+		w.Write([]byte(`{"serverTime":1499827319559}`))
+	}))
+	defer srv.Close()
+
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next RoundTripper) RoundTripper {
+			return func(req *APIRequest) (*APIResponse, error) {
+				calls = append(calls, name+">")
+				res, err := next(req)
+				calls = append(calls, "<"+name)
+				return res, err
+			}
+		}
+	}
+	var seen *APIResponse
+	inspect := func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			assert.Equal(t, "api/v3/time", req.Endpoint)
+			assert.Equal(t, 1, req.Weight)
+			res, err := next(req)
+			seen = res
+			return res, err
+		}
+	}
+
+	service := NewAPIService(srv.URL, "", nil, nil, context.Background(),
+		WithMiddleware(record("a"), record("b"), inspect))
+	_, err := service.Time()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a>", "b>", "<b", "<a"}, calls)
+	require.NotNil(t, seen)
+	assert.Equal(t, 200, seen.StatusCode)
+	assert.Equal(t, "7", seen.Header.Get("X-MBX-USED-WEIGHT-1M"))
+	assert.True(t, seen.Latency > 0)
+}
+
+func TestMiddlewareFaultInjection(t *testing.T) {
+	fault := func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			return &APIResponse{StatusCode: 429, Body: []byte(`{"code":-1003,"msg":"Too many requests."}`)}, nil
+		}
+	}
+	service := NewAPIService("http://127.0.0.1:0", "", nil, nil, context.Background(), WithMiddleware(fault))
+	err := service.Ping()
+	apiErr, ok := err.(*Error)
+	require.True(t, ok, "invalid type of error returned: %T", err)
+	assert.Equal(t, -1003, apiErr.Code)
+}
+
+func TestLoggingAndDumpMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "3")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var logs, dump bytes.Buffer
+	service := NewAPIService(srv.URL, "api-key", nil, nil, context.Background(),
+		WithMiddleware(LoggingMiddleware(log.NewLogfmtLogger(&logs)), DumpMiddleware(&dump)))
+	require.NoError(t, service.KeepAliveUserDataStream(&Stream{ListenKey: "secret-key"}))
+
+	assert.Contains(t, logs.String(), "endpoint=api/v3/userDataStream")
+	assert.Contains(t, logs.String(), "weight=2")
+	assert.Contains(t, logs.String(), "status=200")
+	assert.Contains(t, logs.String(), "usedWeight=3")
+	assert.True(t, strings.HasPrefix(dump.String(), "> PUT api/v3/userDataStream\n> listenKey=<redacted>\n< 200"), dump.String())
+	assert.Contains(t, dump.String(), "< X-Mbx-Used-Weight-1m: 3\n")
+	assert.NotContains(t, logs.String()+dump.String(), "secret-key")
+}
+
+func TestDumpMiddlewareRedactsBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"listenKey":"secret-key"}`))
+	}))
+	defer srv.Close()
+
+	var dump bytes.Buffer
+	service := NewAPIService(srv.URL, "api-key", nil, nil, context.Background(), WithMiddleware(DumpMiddleware(&dump)))
+	s, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	assert.Equal(t, "secret-key", s.ListenKey)
+	assert.Contains(t, dump.String(), "<\n{\"listenKey\":\"<redacted>\"}\n")
+	assert.NotContains(t, dump.String(), "secret-key")
+}
+
+func TestRedactBody(t *testing.T) {
+	assert.Equal(t, `[{"listenKey":"<redacted>","n":12345678901234567890}]`,
+		string(RedactBody([]byte(`[{"listenKey":"k","n":12345678901234567890}]`))))
+	body := []byte(`{"orderId": 1}`)
+	assert.Equal(t, body, RedactBody(body))
+	assert.Equal(t, []byte("not json"), RedactBody([]byte("not json")))
+}
+
+func TestEndpointWeight(t *testing.T) {
+	assert.Equal(t, 5, endpointWeight("GET", "api/v3/depth", map[string]string{"limit": "100"}))
+	assert.Equal(t, 50, endpointWeight("GET", "api/v3/depth", map[string]string{"limit": "1000"}))
+	assert.Equal(t, 80, endpointWeight("GET", "api/v3/ticker/24hr", nil))
+	assert.Equal(t, 2, endpointWeight("GET", "api/v3/ticker/24hr", map[string]string{"symbol": "BNBBTC"}))
+	assert.Equal(t, 20, endpointWeight("GET", "api/v3/account", nil))
+}
+
+func TestEndpointWeightsMatchCalls(t *testing.T) {
+	var endpoints []string
+	record := func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			endpoints = append(endpoints, req.Method+" "+req.Endpoint)
+			return &APIResponse{StatusCode: 200, Body: []byte(`{"success":true}`)}, nil
+		}
+	}
+	service := NewAPIService("", "", &HmacSigner{}, nil, context.Background(), WithMiddleware(record))
+	service.Withdraw(WithdrawRequest{Asset: "BNB", Address: "address", Amount: 1})
+	service.DepositHistory(HistoryRequest{})
+	service.WithdrawHistory(HistoryRequest{})
+
+	require.Len(t, endpoints, 3)
+	for _, endpoint := range endpoints {
+		assert.Contains(t, endpointWeights, endpoint)
+	}
+}
+
+type ctxKey struct{}
+
+func TestWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var seen interface{}
+	inspect := func(next RoundTripper) RoundTripper {
+		return func(req *APIRequest) (*APIResponse, error) {
+			seen = req.Ctx.Value(ctxKey{})
+			return next(req)
+		}
+	}
+	service := WithLogging(NewAPIService(srv.URL, "", nil, nil, context.Background(), WithMiddleware(inspect)), log.NewNopLogger())
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "decision")
+	require.NoError(t, WithContext(service, ctx).Ping())
+	assert.Equal(t, "decision", seen)
+
+	require.NoError(t, service.Ping())
+	assert.Nil(t, seen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, WithContext(service, ctx).Ping())
+}
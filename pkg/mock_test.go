@@ -175,7 +175,7 @@ func (m *ServiceMock) DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEven
 	if !ok {
 		dech = nil
 	}
-	sch, ok := args.Get(0).(chan struct{})
+	sch, ok := args.Get(1).(chan struct{})
 	if !ok {
 		sch = nil
 	}
@@ -187,7 +187,7 @@ func (m *ServiceMock) KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEven
 	if !ok {
 		kech = nil
 	}
-	sch, ok := args.Get(0).(chan struct{})
+	sch, ok := args.Get(1).(chan struct{})
 	if !ok {
 		sch = nil
 	}
@@ -199,21 +199,53 @@ func (m *ServiceMock) TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeE
 	if !ok {
 		atech = nil
 	}
-	sch, ok := args.Get(0).(chan struct{})
+	sch, ok := args.Get(1).(chan struct{})
 	if !ok {
 		sch = nil
 	}
 	return atech, sch, args.Error(2)
 }
-func (m *ServiceMock) UserDataWebsocket(udwr UserDataWebsocketRequest) (chan *AccountEvent, chan struct{}, error) {
+func (m *ServiceMock) UserDataWebsocket(udwr UserDataWebsocketRequest) (chan UserDataEvent, chan struct{}, error) {
 	args := m.Called(udwr)
-	aech, ok := args.Get(0).(chan *AccountEvent)
+	udech, ok := args.Get(0).(chan UserDataEvent)
 	if !ok {
-		aech = nil
+		udech = nil
 	}
-	sch, ok := args.Get(0).(chan struct{})
+	sch, ok := args.Get(1).(chan struct{})
 	if !ok {
 		sch = nil
 	}
-	return aech, sch, args.Error(2)
+	return udech, sch, args.Error(2)
+}
+func (m *ServiceMock) SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	args := m.Called(dwr, h)
+	sub, ok := args.Get(0).(*Subscription)
+	if !ok {
+		sub = nil
+	}
+	return sub, args.Error(1)
+}
+func (m *ServiceMock) SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	args := m.Called(kwr, h)
+	sub, ok := args.Get(0).(*Subscription)
+	if !ok {
+		sub = nil
+	}
+	return sub, args.Error(1)
+}
+func (m *ServiceMock) SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	args := m.Called(twr, h)
+	sub, ok := args.Get(0).(*Subscription)
+	if !ok {
+		sub = nil
+	}
+	return sub, args.Error(1)
+}
+func (m *ServiceMock) SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	args := m.Called(udwr, h)
+	sub, ok := args.Get(0).(*Subscription)
+	if !ok {
+		sub = nil
+	}
+	return sub, args.Error(1)
 }
@@ -9,6 +9,18 @@ type OrderType string
 // OrderSide represents order side enum.
 type OrderSide string
 
+// ExecutionType represents execution type enum.
+type ExecutionType string
+
+// ContingencyType represents order list contingency type enum.
+type ContingencyType string
+
+// ListStatusType represents order list status type enum.
+type ListStatusType string
+
+// ListOrderStatus represents order list order status enum.
+type ListOrderStatus string
+
 var (
 	StatusNew             = OrderStatus("NEW")
 	StatusPartiallyFilled = OrderStatus("PARTIALLY_FILLED")
@@ -18,9 +30,32 @@ var (
 	StatusRejected        = OrderStatus("REJECTED")
 	StatusExpired         = OrderStatus("EXPIRED")
 
-	TypeLimit  = OrderType("LIMIT")
-	TypeMarket = OrderType("MARKET")
+	TypeLimit           = OrderType("LIMIT")
+	TypeMarket          = OrderType("MARKET")
+	TypeLimitMaker      = OrderType("LIMIT_MAKER")
+	TypeStopLoss        = OrderType("STOP_LOSS")
+	TypeStopLossLimit   = OrderType("STOP_LOSS_LIMIT")
+	TypeTakeProfit      = OrderType("TAKE_PROFIT")
+	TypeTakeProfitLimit = OrderType("TAKE_PROFIT_LIMIT")
 
 	SideBuy  = OrderSide("BUY")
 	SideSell = OrderSide("SELL")
+
+	ExecutionNew             = ExecutionType("NEW")
+	ExecutionCanceled        = ExecutionType("CANCELED")
+	ExecutionReplaced        = ExecutionType("REPLACED")
+	ExecutionRejected        = ExecutionType("REJECTED")
+	ExecutionTrade           = ExecutionType("TRADE")
+	ExecutionExpired         = ExecutionType("EXPIRED")
+	ExecutionTradePrevention = ExecutionType("TRADE_PREVENTION")
+
+	ContingencyOCO = ContingencyType("OCO")
+
+	ListStatusResponse    = ListStatusType("RESPONSE")
+	ListStatusExecStarted = ListStatusType("EXEC_STARTED")
+	ListStatusAllDone     = ListStatusType("ALL_DONE")
+
+	ListOrderStatusExecuting = ListOrderStatus("EXECUTING")
+	ListOrderStatusAllDone   = ListOrderStatus("ALL_DONE")
+	ListOrderStatusReject    = ListOrderStatus("REJECT")
 )
@@ -0,0 +1,406 @@
+// Package paper implements pkg.Service trading with simulated funds against
+// live market data.
+//
+// Market data calls and streams are passed to the live Service, while orders
+// and account calls are served locally. Orders fill against book tickers and
+// trades of the live market and their executions are published to user data
+// streams of the paper Service:
+//
+//	live := pkg.NewAPIService(url, apiKey, signer, logger, ctx)
+//	service := paper.New(ctx, live,
+//		paper.WithBalance("USDT", 1000),
+//		paper.WithFees(0.001, 0.001),
+//		paper.WithLatency(50*time.Millisecond))
+//	defer service.Close()
+//	b := pkg.NewBinance(service)
+//
+// Limit orders taking liquidity fill at the best price of the opposite side,
+// resting ones at their price once the book or a trade moves through it. With
+// WithPartialFills fills are limited by quantity quoted and traded at the best
+// price.
+package paper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/internal/sim"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// ListenKey is listen key of the only user data stream of Service.
+const ListenKey = "paper"
+
+// bookLevel is depth of book streams watched for book tickers.
+const bookLevel = 5
+
+// Service is pkg.Service trading with simulated funds.
+type Service struct {
+	// Service is live Service serving market data.
+	pkg.Service
+
+	cfg      sim.Config
+	balances map[string]float64
+	logger   log.Logger
+	ex       *sim.Exchange
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	watched map[string][]*pkg.Subscription
+
+	feedMu  sync.Mutex
+	feeds   map[*pkg.StreamFeed]bool
+	pending []pkg.UserDataEvent
+	signal  chan struct{}
+}
+
+// Option configures Service.
+type Option func(*Service)
+
+// WithBalance sets initial free amount of asset.
+func WithBalance(asset string, free float64) Option {
+	return func(s *Service) {
+		s.balances[asset] = free
+	}
+}
+
+// WithFees sets maker and taker commission rates, e.g. 0.001 for 0.1%.
+// Commission is charged in the received asset. There are no fees by default.
+func WithFees(maker, taker float64) Option {
+	return func(s *Service) {
+		s.cfg.MakerFee = maker
+		s.cfg.TakerFee = taker
+	}
+}
+
+// WithLatency delays matching of new orders by d, modelling time the order
+// takes to reach the exchange.
+func WithLatency(d time.Duration) Option {
+	return func(s *Service) {
+		s.cfg.Latency = d
+	}
+}
+
+// WithPartialFills limits fills by quantity quoted at the best price and by
+// traded quantity, so orders larger than the market fill in parts. Resting
+// order is credited with queueShare of quantity traded exactly at its price,
+// modelling orders ahead of it in the queue.
+func WithPartialFills(queueShare float64) Option {
+	return func(s *Service) {
+		s.cfg.PartialFills = true
+		s.cfg.QueueShare = queueShare
+	}
+}
+
+// WithSymbol sets base and quote asset of symbol, telling balances its fills
+// move. Orders of symbols whose assets can't be told from the name are
+// rejected as invalid symbol.
+func WithSymbol(symbol, base, quote string) Option {
+	return func(s *Service) {
+		s.cfg.Symbols[symbol] = [2]string{base, quote}
+	}
+}
+
+// WithLogger sets logger of market data stream failures.
+func WithLogger(logger log.Logger) Option {
+	return func(s *Service) {
+		s.logger = logger
+	}
+}
+
+// New creates paper Service using live for market data. It runs until ctx is
+// done or Close is called.
+func New(ctx context.Context, live pkg.Service, opts ...Option) *Service {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Service{
+		Service:  live,
+		cfg:      sim.Config{Symbols: make(map[string][2]string)},
+		balances: make(map[string]float64),
+		logger:   log.NewNopLogger(),
+		ctx:      ctx,
+		cancel:   cancel,
+		watched:  make(map[string][]*pkg.Subscription),
+		feeds:    make(map[*pkg.StreamFeed]bool),
+		signal:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.cfg.Publish = s.publish
+	s.ex = sim.New(s.cfg)
+	for asset, free := range s.balances {
+		s.ex.SetBalance(asset, free)
+	}
+	go s.dispatch()
+	return s
+}
+
+// Close stops market data streams and user data streams of the Service.
+func (s *Service) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for symbol, subs := range s.watched {
+		for _, sub := range subs {
+			sub.Close()
+		}
+		delete(s.watched, symbol)
+	}
+	return nil
+}
+
+// Watch starts following book ticker and trades of symbol. Symbols of orders
+// are watched automatically, but watching symbol beforehand avoids the delay
+// of the first order.
+func (s *Service) Watch(symbol string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watched[symbol]; ok {
+		return nil
+	}
+	if s.ctx.Err() != nil {
+		return errors.New("paper service closed")
+	}
+	ob, err := s.Service.OrderBook(pkg.OrderBookRequest{Symbol: symbol, Limit: bookLevel})
+	if err != nil {
+		return errors.Wrapf(err, "unable to get %s order book", symbol)
+	}
+	s.updateBook(symbol, ob)
+
+	onError := func(err error) {
+		level.Error(s.logger).Log("paper", "stream", "symbol", symbol, "err", err)
+	}
+	depth, err := s.Service.SubscribeDepth(pkg.DepthWebsocketRequest{
+		Symbol:      symbol,
+		Level:       bookLevel,
+		UpdateSpeed: 100 * time.Millisecond,
+	}, pkg.StreamHandler{
+		OnDepth: func(de *pkg.DepthEvent) {
+			s.updateBook(symbol, &de.OrderBook)
+		},
+		OnError: onError,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to subscribe %s depth", symbol)
+	}
+	trades, err := s.Service.SubscribeTrade(pkg.TradeWebsocketRequest{Symbol: symbol}, pkg.StreamHandler{
+		OnTrade: func(ate *pkg.AggTradeEvent) {
+			s.ex.UpdateTrade(symbol, ate.Price, ate.Quantity)
+		},
+		OnError: onError,
+	})
+	if err != nil {
+		depth.Close()
+		return errors.Wrapf(err, "unable to subscribe %s trades", symbol)
+	}
+	subs := []*pkg.Subscription{depth, trades}
+	s.watched[symbol] = subs
+	for _, sub := range subs {
+		go s.unwatch(symbol, subs, sub)
+	}
+	return nil
+}
+
+// unwatch forgets symbol once sub of its streams stops, so that it's watched
+// again by the next order.
+func (s *Service) unwatch(symbol string, subs []*pkg.Subscription, sub *pkg.Subscription) {
+	select {
+	case <-sub.Done():
+	case <-s.ctx.Done():
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.watched[symbol]; !ok || current[0] != subs[0] {
+		return
+	}
+	level.Error(s.logger).Log("paper", "stream stopped", "symbol", symbol, "err", sub.Err())
+	delete(s.watched, symbol)
+	for _, other := range subs {
+		if other != sub {
+			go other.Close()
+		}
+	}
+}
+
+func (s *Service) updateBook(symbol string, ob *pkg.OrderBook) {
+	var bid, bidQty, ask, askQty float64
+	if len(ob.Bids) > 0 {
+		bid, bidQty = ob.Bids[0].Price, ob.Bids[0].Quantity
+	}
+	if len(ob.Asks) > 0 {
+		ask, askQty = ob.Asks[0].Price, ob.Asks[0].Quantity
+	}
+	s.ex.UpdateBook(symbol, bid, bidQty, ask, askQty)
+}
+
+// NewOrder places simulated order.
+func (s *Service) NewOrder(or pkg.NewOrderRequest) (*pkg.ProcessedOrder, error) {
+	if err := s.Watch(or.Symbol); err != nil {
+		return nil, err
+	}
+	po, err := s.ex.NewOrder(or)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.Latency > 0 {
+		time.AfterFunc(s.cfg.Latency, func() {
+			s.ex.Match(or.Symbol)
+		})
+	}
+	return po, nil
+}
+
+// NewOrderTest validates order request like NewOrder without placing it.
+func (s *Service) NewOrderTest(or pkg.NewOrderRequest) error {
+	if err := s.Watch(or.Symbol); err != nil {
+		return err
+	}
+	return s.ex.NewOrderTest(or)
+}
+
+// QueryOrder returns simulated order.
+func (s *Service) QueryOrder(qor pkg.QueryOrderRequest) (*pkg.ExecutedOrder, error) {
+	return s.ex.QueryOrder(qor)
+}
+
+// CancelOrder cancels simulated order.
+func (s *Service) CancelOrder(cor pkg.CancelOrderRequest) (*pkg.CanceledOrder, error) {
+	return s.ex.CancelOrder(cor)
+}
+
+// OpenOrders returns active simulated orders.
+func (s *Service) OpenOrders(oor pkg.OpenOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	return s.ex.OpenOrders(oor)
+}
+
+// AllOrders returns simulated orders of symbol.
+func (s *Service) AllOrders(aor pkg.AllOrdersRequest) ([]*pkg.ExecutedOrder, error) {
+	return s.ex.AllOrders(aor)
+}
+
+// Account returns simulated balances.
+func (s *Service) Account(ar pkg.AccountRequest) (*pkg.Account, error) {
+	return s.ex.Account(ar)
+}
+
+// MyTrades returns fills of simulated orders.
+func (s *Service) MyTrades(mtr pkg.MyTradesRequest) ([]*pkg.Trade, error) {
+	return s.ex.MyTrades(mtr)
+}
+
+// Withdraw fails, simulated funds can't be withdrawn.
+func (s *Service) Withdraw(wr pkg.WithdrawRequest) (*pkg.WithdrawResult, error) {
+	return nil, errors.New("withdrawals are not supported by paper service")
+}
+
+// DepositHistory returns no deposits.
+func (s *Service) DepositHistory(hr pkg.HistoryRequest) ([]*pkg.Deposit, error) {
+	return []*pkg.Deposit{}, nil
+}
+
+// WithdrawHistory returns no withdrawals.
+func (s *Service) WithdrawHistory(hr pkg.HistoryRequest) ([]*pkg.Withdrawal, error) {
+	return []*pkg.Withdrawal{}, nil
+}
+
+// StartUserDataStream returns stream with ListenKey.
+func (s *Service) StartUserDataStream() (*pkg.Stream, error) {
+	return &pkg.Stream{ListenKey: ListenKey}, nil
+}
+
+// KeepAliveUserDataStream does nothing, simulated stream doesn't expire.
+func (s *Service) KeepAliveUserDataStream(st *pkg.Stream) error {
+	return nil
+}
+
+// CloseUserDataStream does nothing, simulated stream is closed with its
+// subscriptions.
+func (s *Service) CloseUserDataStream(st *pkg.Stream) error {
+	return nil
+}
+
+// UserDataWebsocket streams simulated user data events.
+func (s *Service) UserDataWebsocket(udwr pkg.UserDataWebsocketRequest) (chan pkg.UserDataEvent, chan struct{}, error) {
+	udech := make(chan pkg.UserDataEvent)
+	sub, err := s.SubscribeUserData(udwr, pkg.StreamHandler{
+		OnUserData: func(ude pkg.UserDataEvent) {
+			select {
+			case udech <- ude:
+			case <-s.ctx.Done():
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		<-sub.Done()
+		close(done)
+	}()
+	return udech, done, nil
+}
+
+// SubscribeUserData calls h.OnUserData with simulated user data events.
+func (s *Service) SubscribeUserData(udwr pkg.UserDataWebsocketRequest, h pkg.StreamHandler) (*pkg.Subscription, error) {
+	if udwr.ListenKey != ListenKey {
+		return nil, errors.Errorf("unknown listen key %q", udwr.ListenKey)
+	}
+	feed, sub := pkg.NewStreamFeed(s.ctx, udwr.StreamOptions, func(event interface{}) {
+		if h.OnUserData != nil {
+			h.OnUserData(event.(pkg.UserDataEvent))
+		}
+	})
+	s.feedMu.Lock()
+	s.feeds[feed] = true
+	s.feedMu.Unlock()
+	go func() {
+		<-sub.Done()
+		s.feedMu.Lock()
+		delete(s.feeds, feed)
+		s.feedMu.Unlock()
+	}()
+	return sub, nil
+}
+
+// publish queues event of the exchange. It's called with the exchange
+// locked, so events are delivered to feeds by dispatch.
+func (s *Service) publish(ude pkg.UserDataEvent) {
+	s.feedMu.Lock()
+	s.pending = append(s.pending, ude)
+	s.feedMu.Unlock()
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch delivers queued events to user data feeds in order.
+func (s *Service) dispatch() {
+	for {
+		select {
+		case <-s.signal:
+		case <-s.ctx.Done():
+			return
+		}
+		s.feedMu.Lock()
+		events := s.pending
+		s.pending = nil
+		var feeds []*pkg.StreamFeed
+		for feed := range s.feeds {
+			feeds = append(feeds, feed)
+		}
+		s.feedMu.Unlock()
+		for _, ude := range events {
+			for _, feed := range feeds {
+				feed.Push("", ude)
+			}
+		}
+	}
+}
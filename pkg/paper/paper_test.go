@@ -0,0 +1,209 @@
+package paper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, opts ...Option) (*binancetest.Server, *Service, chan pkg.UserDataEvent) {
+	srv := binancetest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddSymbol("BNBBTC", "BNB", "BTC")
+	srv.SetOrderBook("BNBBTC",
+		[]*pkg.Order{{Price: 0.002, Quantity: 1}},
+		[]*pkg.Order{{Price: 0.0021, Quantity: 1}})
+	live := pkg.NewAPIService("", "", nil, nil, context.Background(), pkg.WithEnvironment(srv.Environment()))
+	service := New(context.Background(), live, opts...)
+	t.Cleanup(func() { service.Close() })
+
+	stream, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	events, _, err := service.UserDataWebsocket(pkg.UserDataWebsocketRequest{ListenKey: stream.ListenKey})
+	require.NoError(t, err)
+	return srv, service, events
+}
+
+// nextTrade returns the next execution report of trade.
+func nextTrade(t *testing.T, events chan pkg.UserDataEvent) *pkg.ExecutionReportEvent {
+	t.Helper()
+	for {
+		select {
+		case e := <-events:
+			if er, ok := e.(*pkg.ExecutionReportEvent); ok && er.ExecutionType == pkg.ExecutionTrade {
+				return er
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("trade not received")
+		}
+	}
+}
+
+func balances(t *testing.T, service pkg.Service) map[string]pkg.Balance {
+	t.Helper()
+	account, err := service.Account(pkg.AccountRequest{})
+	require.NoError(t, err)
+	m := make(map[string]pkg.Balance)
+	for _, b := range account.Balances {
+		m[b.Asset] = *b
+	}
+	return m
+}
+
+func TestPaperTrading(t *testing.T) {
+	srv, service, events := newTestService(t, WithBalance("BTC", 1), WithFees(0.001, 0.002))
+
+	ob, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Equal(t, []*pkg.Order{{Price: 0.002, Quantity: 1}}, ob.Bids)
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideBuy,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    2,
+		Price:       0.0022,
+	})
+	require.NoError(t, err)
+	er := nextTrade(t, events)
+	assert.Equal(t, po.OrderID, er.OrderID)
+	assert.Equal(t, 0.0021, er.LastExecutedPrice)
+	assert.Equal(t, 2.0, er.LastExecutedQty)
+	assert.InDelta(t, 0.004, er.Commission, 1e-12)
+	assert.Equal(t, "BNB", er.CommissionAsset)
+	assert.False(t, er.IsMaker)
+	assert.Equal(t, pkg.StatusFilled, er.Status)
+	b := balances(t, service)
+	assert.InDelta(t, 1.996, b["BNB"].Free, 1e-12)
+	assert.InDelta(t, 1-0.0042, b["BTC"].Free, 1e-12)
+	assert.Zero(t, b["BTC"].Locked)
+
+	po, err = service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideSell,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    1,
+		Price:       0.0023,
+	})
+	require.NoError(t, err)
+	open, err := service.OpenOrders(pkg.OpenOrdersRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, int(po.OrderID), open[0].OrderID)
+	assert.Equal(t, 1.0, balances(t, service)["BNB"].Locked)
+
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.0024, Quantity: 5, Timestamp: time.Now()})
+	er = nextTrade(t, events)
+	assert.Equal(t, 0.0023, er.LastExecutedPrice)
+	assert.True(t, er.IsMaker)
+	assert.InDelta(t, 0.0000023, er.Commission, 1e-12)
+	assert.Equal(t, "BTC", er.CommissionAsset)
+
+	trades, err := service.MyTrades(pkg.MyTradesRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	require.Len(t, trades, 2)
+	assert.Equal(t, "BNBBTC", trades[0].Symbol)
+	assert.InDelta(t, 2*0.0021, trades[0].QuoteQty, 1e-12)
+	assert.True(t, trades[0].IsBuyer)
+	assert.Equal(t, po.OrderID, trades[1].OrderID)
+	assert.True(t, trades[1].IsMaker)
+	orders, err := service.AllOrders(pkg.AllOrdersRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+	account, err := service.Account(pkg.AccountRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), account.MakerCommision)
+	assert.Equal(t, int64(20), account.TakerCommision)
+
+	// Nothing reached the live exchange.
+	assert.Empty(t, srv.Orders())
+	assert.Empty(t, srv.Balances())
+}
+
+func TestPartialFills(t *testing.T) {
+	srv, service, events := newTestService(t, WithBalance("BTC", 1), WithPartialFills(0.5))
+
+	_, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:   "BNBBTC",
+		Side:     pkg.SideBuy,
+		Type:     pkg.TypeMarket,
+		Quantity: 3,
+	})
+	require.NoError(t, err)
+	er := nextTrade(t, events)
+	assert.Equal(t, 1.0, er.LastExecutedQty)
+	assert.Equal(t, pkg.StatusPartiallyFilled, er.Status)
+
+	srv.PushDepth("BNBBTC", nil, []*pkg.Order{{Price: 0.0021, Quantity: 5}})
+	er = nextTrade(t, events)
+	assert.Equal(t, 2.0, er.LastExecutedQty)
+	assert.Equal(t, pkg.StatusFilled, er.Status)
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideBuy,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    2,
+		Price:       0.002,
+	})
+	require.NoError(t, err)
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.002, Quantity: 2, Timestamp: time.Now()})
+	er = nextTrade(t, events)
+	assert.Equal(t, 1.0, er.LastExecutedQty)
+	srv.PushAggTrade("BNBBTC", &pkg.AggTrade{Price: 0.0019, Quantity: 3, Timestamp: time.Now()})
+	er = nextTrade(t, events)
+	assert.Equal(t, 1.0, er.LastExecutedQty)
+	eo, err := service.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrderID: po.OrderID})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.StatusFilled, eo.Status)
+	assert.Equal(t, 2.0, eo.ExecutedQty)
+}
+
+func TestLatency(t *testing.T) {
+	_, service, events := newTestService(t, WithBalance("BNB", 1), WithLatency(100*time.Millisecond))
+
+	po, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:   "BNBBTC",
+		Side:     pkg.SideSell,
+		Type:     pkg.TypeMarket,
+		Quantity: 1,
+	})
+	require.NoError(t, err)
+	eo, err := service.QueryOrder(pkg.QueryOrderRequest{Symbol: "BNBBTC", OrderID: po.OrderID})
+	require.NoError(t, err)
+	assert.Equal(t, pkg.StatusNew, eo.Status)
+
+	er := nextTrade(t, events)
+	assert.True(t, er.TransactionTime.Sub(po.TransactTime) >= 100*time.Millisecond)
+	assert.Equal(t, 0.002, er.LastExecutedPrice)
+}
+
+func TestErrors(t *testing.T) {
+	_, service, _ := newTestService(t, WithBalance("BTC", 0.001))
+
+	_, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        pkg.SideBuy,
+		Type:        pkg.TypeLimit,
+		TimeInForce: pkg.GTC,
+		Quantity:    1,
+		Price:       0.002,
+	})
+	assert.Equal(t, &pkg.Error{Code: -2010, Message: "Account has insufficient balance for requested action."}, err)
+	_, err = service.NewOrder(pkg.NewOrderRequest{Symbol: "ETHBTC", Side: pkg.SideBuy, Type: pkg.TypeMarket, Quantity: 1})
+	assert.Error(t, err)
+	_, err = service.CancelOrder(pkg.CancelOrderRequest{Symbol: "BNBBTC", OrderID: 1})
+	assert.Equal(t, &pkg.Error{Code: -2011, Message: "Unknown order sent."}, err)
+	_, err = service.Withdraw(pkg.WithdrawRequest{Asset: "BTC", Amount: 0.001})
+	assert.Error(t, err)
+	_, err = service.SubscribeUserData(pkg.UserDataWebsocketRequest{ListenKey: "live"}, pkg.StreamHandler{})
+	assert.Error(t, err)
+}
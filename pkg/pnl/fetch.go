@@ -0,0 +1,39 @@
+package pnl
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/internal"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// FetchTrades returns all trades of symbol with ID fromID or greater,
+// fetching them page by page. Zero fromID fetches the whole history.
+func FetchTrades(service pkg.Service, symbol string, fromID int64) ([]*pkg.Trade, error) {
+	return fetchTrades(service, symbol, fromID, internal.TradesLimit)
+}
+
+// fetchTrades is FetchTrades with pages of limit trades.
+func fetchTrades(service pkg.Service, symbol string, fromID int64, limit int) ([]*pkg.Trade, error) {
+	if fromID < 1 {
+		fromID = 1
+	}
+	var trades []*pkg.Trade
+	for {
+		page, err := service.MyTrades(pkg.MyTradesRequest{
+			Symbol:    symbol,
+			FromID:    fromID,
+			Limit:     limit,
+			Timestamp: time.Now(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get %s trades from %d", symbol, fromID)
+		}
+		trades = append(trades, page...)
+		if len(page) < limit {
+			return trades, nil
+		}
+		fromID = page[len(page)-1].ID + 1
+	}
+}
@@ -0,0 +1,290 @@
+// Package pnl computes realized and unrealized profit and loss of trades.
+//
+// Book keeps cost basis of positions of every symbol in its quote asset and
+// realizes profit or loss when they are sold, matching sold quantity with
+// bought lots by Method:
+//
+//	trades, err := pnl.FetchTrades(service, "BNBUSDT", 0)
+//	prices, err := portfolio.NewHistoricalPrices(service, pkg.Minute)
+//	book := pnl.New(pnl.FIFO, pnl.WithPrices(prices))
+//	if err := book.Add(trades...); err != nil {
+//		panic(err)
+//	}
+//	summaries := book.BySymbol(market)
+//
+// Commission paid in the quote asset is added to cost of bought lots and
+// subtracted from proceeds of sales. Commission paid in the base asset of
+// purchase reduces bought quantity. Commission in other assets, like BNB, is
+// converted to the quote asset by Prices at time of the trade.
+package pnl
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/portfolio"
+)
+
+// Method is method of matching sold quantity with bought lots.
+type Method int
+
+const (
+	// FIFO sells the earliest bought lots first.
+	FIFO Method = iota
+	// LIFO sells the latest bought lots first.
+	LIFO
+	// AverageCost sells at average cost of all held quantity.
+	AverageCost
+)
+
+// String returns name of the method.
+func (m Method) String() string {
+	switch m {
+	case FIFO:
+		return "FIFO"
+	case LIFO:
+		return "LIFO"
+	case AverageCost:
+		return "AverageCost"
+	}
+	return "Unknown"
+}
+
+// Prices returns price of one unit of asset in quote asset at time t.
+// *portfolio.HistoricalPrices implements it.
+type Prices interface {
+	Price(asset, quote string, t time.Time) (float64, error)
+}
+
+// Entry is trade added to Book with its effect.
+type Entry struct {
+	Time       time.Time
+	Symbol     string
+	TradeID    int64
+	OrderID    int64
+	Asset      string
+	QuoteAsset string
+	IsBuyer    bool
+	// Qty is traded quantity of asset.
+	Qty float64
+	// QuoteQty is traded quantity of quote asset.
+	QuoteQty float64
+	// Fee is commission converted to quote asset.
+	Fee float64
+	// Cost is cost basis of sold quantity, zero for purchases.
+	Cost float64
+	// Realized is proceeds of sale less fee and cost basis, zero for
+	// purchases.
+	Realized float64
+	// Unmatched is sold quantity not matched with any bought lot, e.g.
+	// bought before the first trade of the Book. It's not included in
+	// Cost and Realized.
+	Unmatched float64
+}
+
+type lot struct {
+	qty  float64
+	cost float64
+}
+
+type position struct {
+	symbol     string
+	asset      string
+	quoteAsset string
+	lots       []lot
+	lastID     int64
+	realized   float64
+	fees       float64
+	trades     int
+}
+
+func (p *position) qty() float64 {
+	qty := 0.0
+	for _, l := range p.lots {
+		qty += l.qty
+	}
+	return qty
+}
+
+func (p *position) cost() float64 {
+	cost := 0.0
+	for _, l := range p.lots {
+		cost += l.cost
+	}
+	return cost
+}
+
+// Book tracks positions and profit and loss of trades.
+type Book struct {
+	method    Method
+	prices    Prices
+	market    *portfolio.Market
+	positions map[string]*position
+	entries   []*Entry
+}
+
+// Option configures Book.
+type Option func(*Book)
+
+// WithPrices sets source of prices converting commission paid in assets
+// other than base and quote asset of the trade.
+func WithPrices(p Prices) Option {
+	return func(b *Book) {
+		b.prices = p
+	}
+}
+
+// WithSymbol sets base and quote asset of symbol, i.e. asset its positions
+// hold and asset their PnL is in. Add fails for trades of symbols whose
+// assets can't be told from the name.
+func WithSymbol(symbol, base, quote string) Option {
+	return func(b *Book) {
+		b.market.SetSymbol(symbol, base, quote)
+	}
+}
+
+// New creates empty Book matching lots by method.
+func New(method Method, opts ...Option) *Book {
+	b := &Book{
+		method:    method,
+		market:    portfolio.NewMarket(),
+		positions: make(map[string]*position),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Add adds trades in order of their time. Trades of symbol with ID not
+// greater than ID of the last added trade of the symbol are skipped, so
+// overlapping trade histories can be added.
+func (b *Book) Add(trades ...*pkg.Trade) error {
+	sorted := append([]*pkg.Trade{}, trades...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	for _, t := range sorted {
+		if err := b.add(t); err != nil {
+			return errors.Wrapf(err, "unable to add %s trade %d", t.Symbol, t.ID)
+		}
+	}
+	return nil
+}
+
+func (b *Book) add(t *pkg.Trade) error {
+	p, ok := b.positions[t.Symbol]
+	if !ok {
+		asset, quote, ok := b.market.Assets(t.Symbol)
+		if !ok {
+			return errors.New("unknown assets of symbol")
+		}
+		p = &position{symbol: t.Symbol, asset: asset, quoteAsset: quote}
+		b.positions[t.Symbol] = p
+	}
+	if p.trades > 0 && t.ID <= p.lastID {
+		return nil
+	}
+
+	quoteQty := t.QuoteQty
+	if quoteQty == 0 {
+		quoteQty = t.Price * t.Qty
+	}
+	e := &Entry{
+		Time:       t.Time,
+		Symbol:     t.Symbol,
+		TradeID:    t.ID,
+		OrderID:    t.OrderID,
+		Asset:      p.asset,
+		QuoteAsset: p.quoteAsset,
+		IsBuyer:    t.IsBuyer,
+		Qty:        t.Qty,
+		QuoteQty:   quoteQty,
+	}
+	qty := t.Qty
+	switch {
+	case t.Commission == 0:
+	case t.CommissionAsset == p.quoteAsset:
+		e.Fee = t.Commission
+	case t.CommissionAsset == p.asset:
+		e.Fee = t.Commission * t.Price
+		if t.IsBuyer {
+			qty -= t.Commission
+		}
+	default:
+		if b.prices == nil {
+			return errors.Errorf("no prices converting commission in %s", t.CommissionAsset)
+		}
+		price, err := b.prices.Price(t.CommissionAsset, p.quoteAsset, t.Time)
+		if err != nil {
+			return errors.Wrap(err, "unable to convert commission")
+		}
+		e.Fee = t.Commission * price
+	}
+
+	if t.IsBuyer {
+		cost := quoteQty
+		if t.CommissionAsset != p.asset {
+			cost += e.Fee
+		}
+		b.buy(p, qty, cost)
+	} else {
+		matched, cost := b.sell(p, t.Qty)
+		e.Unmatched = t.Qty - matched
+		if t.Qty > 0 {
+			e.Cost = cost
+			e.Realized = (quoteQty-e.Fee)*matched/t.Qty - cost
+		}
+	}
+	p.lastID = t.ID
+	p.realized += e.Realized
+	p.fees += e.Fee
+	p.trades++
+	b.entries = append(b.entries, e)
+	return nil
+}
+
+func (b *Book) buy(p *position, qty, cost float64) {
+	if b.method == AverageCost && len(p.lots) > 0 {
+		p.lots[0].qty += qty
+		p.lots[0].cost += cost
+		return
+	}
+	p.lots = append(p.lots, lot{qty: qty, cost: cost})
+}
+
+// sell removes qty from lots of p and returns matched quantity and its cost.
+func (b *Book) sell(p *position, qty float64) (float64, float64) {
+	matched, cost := 0.0, 0.0
+	for qty > 0 && len(p.lots) > 0 {
+		i := 0
+		if b.method == LIFO {
+			i = len(p.lots) - 1
+		}
+		l := &p.lots[i]
+		if l.qty <= qty {
+			matched += l.qty
+			cost += l.cost
+			qty -= l.qty
+			p.lots = append(p.lots[:i], p.lots[i+1:]...)
+			continue
+		}
+		part := l.cost * qty / l.qty
+		matched += qty
+		cost += part
+		l.qty -= qty
+		l.cost -= part
+		qty = 0
+	}
+	return matched, cost
+}
+
+// Entries returns added trades in order they were added.
+func (b *Book) Entries() []*Entry {
+	return append([]*Entry{}, b.entries...)
+}
@@ -0,0 +1,212 @@
+package pnl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/retirero/go-binance/pkg/portfolio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const delta = 1e-9
+
+// fixedPrices returns prices by asset and quote asset regardless of time.
+type fixedPrices map[string]float64
+
+func (p fixedPrices) Price(asset, quote string, t time.Time) (float64, error) {
+	price, ok := p[asset+quote]
+	if !ok {
+		return 0, errors.Errorf("no %s%s price", asset, quote)
+	}
+	return price, nil
+}
+
+var start = time.Date(2021, 1, 30, 12, 0, 0, 0, time.UTC)
+
+func testTrades() []*pkg.Trade {
+	return []*pkg.Trade{
+		// Sell is listed first, trades are added by time.
+		{Symbol: "BNBUSDT", ID: 3, Price: 30, Qty: 15, QuoteQty: 450, Commission: 0.45, CommissionAsset: "USDT",
+			Time: start.Add(72 * time.Hour)},
+		{Symbol: "BNBUSDT", ID: 1, Price: 10, Qty: 10, QuoteQty: 100, Commission: 0.1, CommissionAsset: "USDT",
+			Time: start, IsBuyer: true},
+		{Symbol: "BNBUSDT", ID: 2, Price: 20, Qty: 10, Commission: 0.01, CommissionAsset: "BNB",
+			Time: start.Add(time.Hour), IsBuyer: true},
+	}
+}
+
+func TestMethods(t *testing.T) {
+	for _, tc := range []struct {
+		method        Method
+		realizedCost  float64
+		remainingCost float64
+	}{
+		// Whole first lot and 5 of 9.99 bought net of commission.
+		{FIFO, 100.1 + 200*5/9.99, 200 * 4.99 / 9.99},
+		// Whole second lot and 5.01 of the first one.
+		{LIFO, 200 + 100.1*5.01/10, 100.1 * 4.99 / 10},
+		{AverageCost, 300.1 * 15 / 19.99, 300.1 * 4.99 / 19.99},
+	} {
+		t.Run(tc.method.String(), func(t *testing.T) {
+			book := New(tc.method)
+			require.NoError(t, book.Add(testTrades()...))
+
+			entries := book.Entries()
+			require.Len(t, entries, 3)
+			assert.Equal(t, int64(1), entries[0].TradeID)
+			assert.Equal(t, 200.0, entries[1].QuoteQty)
+			assert.InDelta(t, 0.2, entries[1].Fee, delta)
+			sell := entries[2]
+			assert.Equal(t, "BNB", sell.Asset)
+			assert.Equal(t, "USDT", sell.QuoteAsset)
+			assert.InDelta(t, tc.realizedCost, sell.Cost, delta)
+			assert.InDelta(t, 449.55-tc.realizedCost, sell.Realized, delta)
+			assert.Zero(t, sell.Unmatched)
+
+			market := portfolio.NewMarket()
+			market.Update("BNBUSDT", 40)
+			summaries := book.BySymbol(market)
+			require.Len(t, summaries, 1)
+			s := summaries[0]
+			assert.Equal(t, "BNBUSDT", s.Symbol)
+			assert.InDelta(t, 4.99, s.Qty, delta)
+			assert.InDelta(t, tc.remainingCost, s.Cost, delta)
+			assert.InDelta(t, 4.99*40, s.Value, delta)
+			assert.InDelta(t, 4.99*40-tc.remainingCost, s.Unrealized, delta)
+			assert.InDelta(t, 449.55-tc.realizedCost, s.Realized, delta)
+			assert.InDelta(t, 0.1+0.2+0.45, s.Fees, delta)
+			assert.Equal(t, 3, s.Trades)
+			assert.InDelta(t, s.Realized+s.Unrealized, s.Total(), delta)
+
+			// Without prices only realized PnL is known.
+			s = book.BySymbol(nil)[0]
+			assert.Zero(t, s.Value)
+			assert.Zero(t, s.Unrealized)
+		})
+	}
+}
+
+func TestCommission(t *testing.T) {
+	trades := []*pkg.Trade{
+		{Symbol: "ETHUSDT", ID: 1, Price: 100, Qty: 1, Commission: 0.002, CommissionAsset: "BNB",
+			Time: start, IsBuyer: true},
+		{Symbol: "ETHUSDT", ID: 2, Price: 110, Qty: 1, Commission: 0.003, CommissionAsset: "BNB",
+			Time: start.Add(time.Hour)},
+	}
+	err := New(FIFO).Add(trades...)
+	assert.EqualError(t, err, "unable to add ETHUSDT trade 1: no prices converting commission in BNB")
+	err = New(FIFO, WithPrices(fixedPrices{})).Add(trades...)
+	assert.EqualError(t, err, "unable to add ETHUSDT trade 1: unable to convert commission: no BNBUSDT price")
+
+	book := New(FIFO, WithPrices(fixedPrices{"BNBUSDT": 50}))
+	require.NoError(t, book.Add(trades...))
+	entries := book.Entries()
+	assert.InDelta(t, 0.1, entries[0].Fee, delta)
+	assert.InDelta(t, 0.15, entries[1].Fee, delta)
+	assert.InDelta(t, 100.1, entries[1].Cost, delta)
+	assert.InDelta(t, 110-0.15-100.1, entries[1].Realized, delta)
+}
+
+func TestUnmatchedAndDuplicates(t *testing.T) {
+	book := New(FIFO, WithSymbol("XYZ-ABC", "XYZ", "ABC"))
+	require.NoError(t, book.Add(
+		&pkg.Trade{Symbol: "XYZ-ABC", ID: 1, Price: 2, Qty: 1, Time: start, IsBuyer: true},
+		&pkg.Trade{Symbol: "XYZ-ABC", ID: 2, Price: 3, Qty: 4, Time: start.Add(time.Hour)},
+	))
+	// Overlapping history.
+	require.NoError(t, book.Add(
+		&pkg.Trade{Symbol: "XYZ-ABC", ID: 2, Price: 3, Qty: 4, Time: start.Add(time.Hour)},
+		&pkg.Trade{Symbol: "XYZ-ABC", ID: 3, Price: 4, Qty: 1, Time: start.Add(2 * time.Hour), IsBuyer: true},
+	))
+	entries := book.Entries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, 3.0, entries[1].Unmatched)
+	assert.Equal(t, 2.0, entries[1].Cost)
+	assert.Equal(t, 1.0, entries[1].Realized)
+	s := book.BySymbol(nil)[0]
+	assert.Equal(t, "XYZ", s.Asset)
+	assert.Equal(t, 1.0, s.Qty)
+	assert.Equal(t, 4.0, s.Cost)
+
+	err := book.Add(&pkg.Trade{Symbol: "UNKNOWN", ID: 1})
+	assert.EqualError(t, err, "unable to add UNKNOWN trade 1: unknown assets of symbol")
+}
+
+func TestPeriods(t *testing.T) {
+	book := New(FIFO)
+	require.NoError(t, book.Add(testTrades()...))
+	require.NoError(t, book.Add(
+		&pkg.Trade{Symbol: "BNBBTC", ID: 1, Price: 0.01, Qty: 2, Commission: 0.0001, CommissionAsset: "BTC",
+			Time: start, IsBuyer: true},
+		&pkg.Trade{Symbol: "BNBBTC", ID: 2, Price: 0.02, Qty: 1, Time: start.Add(time.Hour)},
+	))
+	sell := book.Entries()[2]
+	require.Equal(t, int64(3), sell.TradeID)
+
+	months := book.ByPeriod(Month)
+	require.Len(t, months, 3)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), months[0].Period)
+	assert.Equal(t, "BTC", months[0].QuoteAsset)
+	assert.InDelta(t, 0.02-0.01-0.00005, months[0].Realized, delta)
+	assert.Equal(t, 2, months[0].Trades)
+	assert.Equal(t, "USDT", months[1].QuoteAsset)
+	assert.Zero(t, months[1].Realized)
+	assert.InDelta(t, 0.3, months[1].Fees, delta)
+	assert.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), months[2].Period)
+	assert.InDelta(t, sell.Realized, months[2].Realized, delta)
+	assert.Equal(t, 1, months[2].Trades)
+
+	assert.Len(t, book.ByPeriod(Day), 3)
+	assert.Len(t, book.ByPeriod(Year), 2)
+
+	assets := book.ByAsset(nil)
+	require.Len(t, assets, 2)
+	assert.Equal(t, "BNB", assets[0].Asset)
+	assert.Equal(t, "BTC", assets[0].QuoteAsset)
+	assert.Equal(t, 1.0, assets[0].Qty)
+	assert.Equal(t, "USDT", assets[1].QuoteAsset)
+}
+
+func TestPeriodStart(t *testing.T) {
+	// Saturday.
+	at := time.Date(2021, 1, 30, 23, 30, 0, 0, time.FixedZone("", -2*60*60))
+	assert.Equal(t, time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), Day.Start(at))
+	assert.Equal(t, time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC), Week.Start(at))
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Month.Start(at))
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Year.Start(at))
+	assert.Equal(t, time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC), Week.Start(time.Date(2021, 1, 25, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestFetchTrades(t *testing.T) {
+	srv := binancetest.NewServer(binancetest.WithHMACKey("test-key", []byte("test-secret")))
+	defer srv.Close()
+	srv.AddSymbol("BNBUSDT", "BNB", "USDT")
+	srv.SetOrderBook("BNBUSDT", nil, []*pkg.Order{{Price: 10, Quantity: 1}, {Price: 11, Quantity: 1}, {Price: 12, Quantity: 1}})
+	srv.SetBalance("USDT", 100)
+	service := pkg.NewAPIService("", "test-key", &pkg.HmacSigner{Key: []byte("test-secret")}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	_, err := service.NewOrder(pkg.NewOrderRequest{
+		Symbol:    "BNBUSDT",
+		Side:      pkg.SideBuy,
+		Type:      pkg.TypeMarket,
+		Quantity:  3,
+		Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+
+	trades, err := fetchTrades(service, "BNBUSDT", 0, 2)
+	require.NoError(t, err)
+	require.Len(t, trades, 3)
+	assert.Equal(t, []float64{10, 11, 12}, []float64{trades[0].Price, trades[1].Price, trades[2].Price})
+	trades, err = fetchTrades(service, "BNBUSDT", trades[1].ID, 2)
+	require.NoError(t, err)
+	assert.Len(t, trades, 2)
+
+	_, err = FetchTrades(service, "UNKNOWN", 0)
+	assert.Error(t, err)
+}
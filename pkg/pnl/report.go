@@ -0,0 +1,152 @@
+package pnl
+
+import (
+	"sort"
+	"time"
+
+	"github.com/retirero/go-binance/pkg/portfolio"
+)
+
+// Summary is profit and loss of symbol, asset or period in QuoteAsset.
+type Summary struct {
+	// Symbol is set in summaries of symbols.
+	Symbol string
+	// Asset is set in summaries of symbols and assets.
+	Asset      string
+	QuoteAsset string
+	// Period is start of period in summaries of periods.
+	Period time.Time
+	// Qty is held quantity of asset.
+	Qty float64
+	// Cost is cost basis of held quantity.
+	Cost float64
+	// Value is value of held quantity at current price, zero without price.
+	Value    float64
+	Realized float64
+	// Unrealized is Value less Cost, zero without price.
+	Unrealized float64
+	Fees       float64
+	Trades     int
+}
+
+// Total returns realized and unrealized profit and loss.
+func (s *Summary) Total() float64 {
+	return s.Realized + s.Unrealized
+}
+
+// Period is length of periods of ByPeriod.
+type Period int
+
+const (
+	Day Period = iota
+	// Week starts on Monday.
+	Week
+	Month
+	Year
+)
+
+// Start returns start of period containing t, in UTC.
+func (p Period) Start(t time.Time) time.Time {
+	t = t.UTC()
+	y, m, d := t.Date()
+	switch p {
+	case Week:
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-weekday, 0, 0, 0, 0, time.UTC)
+	case Month:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	case Year:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// BySymbol returns summaries of symbols ordered by symbol. Held quantities
+// are valued at prices of market, which can be nil to skip valuation.
+func (b *Book) BySymbol(market *portfolio.Market) []*Summary {
+	var summaries []*Summary
+	for _, p := range b.positions {
+		s := &Summary{
+			Symbol:     p.symbol,
+			Asset:      p.asset,
+			QuoteAsset: p.quoteAsset,
+			Qty:        p.qty(),
+			Cost:       p.cost(),
+			Realized:   p.realized,
+			Fees:       p.fees,
+			Trades:     p.trades,
+		}
+		if market != nil {
+			if value, _, ok := market.Convert(s.Qty, s.Asset, s.QuoteAsset); ok {
+				s.Value = value
+				s.Unrealized = value - s.Cost
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Symbol < summaries[j].Symbol
+	})
+	return summaries
+}
+
+// ByAsset returns summaries of symbols summed by asset and quote asset,
+// ordered by them.
+func (b *Book) ByAsset(market *portfolio.Market) []*Summary {
+	byAsset := make(map[[2]string]*Summary)
+	var summaries []*Summary
+	for _, s := range b.BySymbol(market) {
+		key := [2]string{s.Asset, s.QuoteAsset}
+		sum, ok := byAsset[key]
+		if !ok {
+			sum = &Summary{Asset: s.Asset, QuoteAsset: s.QuoteAsset}
+			byAsset[key] = sum
+			summaries = append(summaries, sum)
+		}
+		sum.Qty += s.Qty
+		sum.Cost += s.Cost
+		sum.Value += s.Value
+		sum.Realized += s.Realized
+		sum.Unrealized += s.Unrealized
+		sum.Fees += s.Fees
+		sum.Trades += s.Trades
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Asset != summaries[j].Asset {
+			return summaries[i].Asset < summaries[j].Asset
+		}
+		return summaries[i].QuoteAsset < summaries[j].QuoteAsset
+	})
+	return summaries
+}
+
+// ByPeriod returns realized profit and loss and fees of trades of every
+// period and quote asset, ordered by period and quote asset. Periods
+// without trades are omitted.
+func (b *Book) ByPeriod(period Period) []*Summary {
+	type key struct {
+		period time.Time
+		quote  string
+	}
+	byPeriod := make(map[key]*Summary)
+	var summaries []*Summary
+	for _, e := range b.entries {
+		k := key{period: period.Start(e.Time), quote: e.QuoteAsset}
+		sum, ok := byPeriod[k]
+		if !ok {
+			sum = &Summary{Period: k.period, QuoteAsset: k.quote}
+			byPeriod[k] = sum
+			summaries = append(summaries, sum)
+		}
+		sum.Realized += e.Realized
+		sum.Fees += e.Fee
+		sum.Trades++
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].Period.Equal(summaries[j].Period) {
+			return summaries[i].Period.Before(summaries[j].Period)
+		}
+		return summaries[i].QuoteAsset < summaries[j].QuoteAsset
+	})
+	return summaries
+}
@@ -0,0 +1,108 @@
+package portfolio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+type klineKey struct {
+	symbol string
+	open   time.Time
+}
+
+// HistoricalPrices converts assets at past times by close prices of klines
+// containing the time, along the shortest path through symbols currently
+// listed. Prices are cached, so HistoricalPrices is meant to be reused.
+type HistoricalPrices struct {
+	service  pkg.Service
+	interval pkg.Interval
+	duration time.Duration
+
+	mu     sync.Mutex
+	market *Market
+	listed bool
+	cache  map[klineKey]float64
+}
+
+// NewHistoricalPrices creates HistoricalPrices using klines of interval of
+// service, e.g. pkg.Minute for precise or pkg.Day for daily close prices.
+// Intervals longer than a day aren't supported.
+func NewHistoricalPrices(service pkg.Service, interval pkg.Interval) (*HistoricalPrices, error) {
+	d := interval.Duration()
+	if d == 0 || d > 24*time.Hour {
+		return nil, errors.Errorf("unsupported interval %s", interval)
+	}
+	return &HistoricalPrices{
+		service:  service,
+		interval: interval,
+		duration: d,
+		market:   NewMarket(),
+		cache:    make(map[klineKey]float64),
+	}, nil
+}
+
+// SetSymbol sets base and quote asset of symbol, see Market.SetSymbol.
+func (h *HistoricalPrices) SetSymbol(symbol, base, quote string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.market.SetSymbol(symbol, base, quote)
+}
+
+// Price returns price of one unit of asset in quote asset at t.
+func (h *HistoricalPrices) Price(asset, quote string, t time.Time) (float64, error) {
+	if asset == quote {
+		return 1, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.listed {
+		tickers, err := h.service.TickerAllPrices()
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to list symbols")
+		}
+		h.market.UpdateAll(tickers)
+		h.listed = true
+	}
+	path, ok := h.market.Path(asset, quote)
+	if !ok {
+		return 0, errors.Errorf("no market converting %s to %s", asset, quote)
+	}
+	rate := 1.0
+	for _, hop := range path {
+		price, err := h.close(hop.Symbol, t)
+		if err != nil {
+			return 0, err
+		}
+		if hop.Inverse {
+			rate /= price
+		} else {
+			rate *= price
+		}
+	}
+	return rate, nil
+}
+
+// close returns close price of kline of symbol containing t.
+func (h *HistoricalPrices) close(symbol string, t time.Time) (float64, error) {
+	key := klineKey{symbol: symbol, open: t.Truncate(h.duration)}
+	if price, ok := h.cache[key]; ok {
+		return price, nil
+	}
+	klines, err := h.service.Klines(pkg.KlinesRequest{
+		Symbol:    symbol,
+		Interval:  h.interval,
+		StartTime: key.open.UnixNano() / int64(time.Millisecond),
+		Limit:     1,
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to get %s klines", symbol)
+	}
+	if len(klines) == 0 || !klines[0].OpenTime.Equal(key.open) || klines[0].Close <= 0 {
+		return 0, errors.Errorf("no %s price at %s", symbol, t.UTC().Format(time.RFC3339))
+	}
+	h.cache[key] = klines[0].Close
+	return klines[0].Close, nil
+}
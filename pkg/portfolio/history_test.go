@@ -0,0 +1,60 @@
+package portfolio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoricalPrices(t *testing.T) {
+	srv := binancetest.NewServer()
+	defer srv.Close()
+	open := time.Date(2021, 1, 30, 12, 0, 0, 0, time.UTC)
+	for symbol, closes := range map[string][]float64{
+		"BNBUSDT": {40, 42},
+		"XYZBNB":  {0.5, 0.25},
+	} {
+		srv.AddAggTrades(symbol, &pkg.AggTrade{Price: closes[len(closes)-1], Quantity: 1, Timestamp: open})
+		for i, c := range closes {
+			at := open.Add(time.Duration(i) * time.Hour)
+			srv.AddKlines(symbol, pkg.Hour, &pkg.Kline{
+				OpenTime:  at,
+				Close:     c,
+				CloseTime: at.Add(time.Hour - time.Millisecond),
+			})
+		}
+	}
+	service := pkg.NewAPIService("", "", nil, nil, context.Background(), pkg.WithEnvironment(srv.Environment()))
+
+	_, err := NewHistoricalPrices(service, pkg.Week)
+	assert.EqualError(t, err, "unsupported interval 1w")
+	prices, err := NewHistoricalPrices(service, pkg.Hour)
+	require.NoError(t, err)
+
+	price, err := prices.Price("XYZ", "USDT", open.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, price)
+	price, err = prices.Price("USDT", "BNB", open.Add(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1/42.0, price)
+	price, err = prices.Price("BNB", "BNB", open)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, price)
+
+	// Cached klines aren't requested again.
+	requests := len(srv.Requests())
+	price, err = prices.Price("XYZ", "USDT", open.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, price)
+	assert.Len(t, srv.Requests(), requests)
+
+	_, err = prices.Price("BNB", "USDT", open.Add(3*time.Hour))
+	assert.EqualError(t, err, "no BNBUSDT price at 2021-01-30T15:00:00Z")
+	_, err = prices.Price("ETH", "USDT", open)
+	assert.EqualError(t, err, "no market converting ETH to USDT")
+}
@@ -0,0 +1,180 @@
+package portfolio
+
+import (
+	"sort"
+
+	"github.com/retirero/go-binance/internal"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// maxHops is maximal number of symbols asset is converted through.
+const maxHops = 3
+
+// bridgeAssets are assets preferred as intermediate steps of conversions
+// with the same number of hops, most liquid first.
+var bridgeAssets = []string{"USDT", "BTC", "BNB", "ETH", "FDUSD", "USDC", "BUSD"}
+
+// Hop is single conversion step through Symbol, from its base to quote asset
+// at its price or, if Inverse, from its quote to base asset.
+type Hop struct {
+	Symbol  string
+	Inverse bool
+}
+
+// Market holds last prices of symbols and converts amounts between assets
+// by the shortest path through symbols with known price.
+//
+// Assets of symbols are derived from symbols quoted in well known assets
+// like USDT, BTC or BNB, others have to be set by SetSymbol.
+type Market struct {
+	assets map[string][2]string
+	prices map[string]float64
+	// pairs maps asset to its counter asset to symbol trading them.
+	pairs map[string]map[string]string
+}
+
+// NewMarket creates Market without prices.
+func NewMarket() *Market {
+	return &Market{
+		assets: make(map[string][2]string),
+		prices: make(map[string]float64),
+		pairs:  make(map[string]map[string]string),
+	}
+}
+
+// SetSymbol sets base and quote asset of symbol.
+func (m *Market) SetSymbol(symbol, base, quote string) {
+	m.assets[symbol] = [2]string{base, quote}
+}
+
+// Assets returns base and quote asset of symbol.
+func (m *Market) Assets(symbol string) (string, string, bool) {
+	if a, ok := m.assets[symbol]; ok {
+		return a[0], a[1], true
+	}
+	return internal.SplitSymbol(symbol)
+}
+
+// Update sets last price of symbol. Symbols of unknown assets are ignored.
+func (m *Market) Update(symbol string, price float64) {
+	base, quote, ok := m.Assets(symbol)
+	if !ok {
+		return
+	}
+	if price <= 0 {
+		delete(m.prices, symbol)
+		return
+	}
+	m.prices[symbol] = price
+	m.pair(base, quote, symbol)
+	m.pair(quote, base, symbol)
+}
+
+func (m *Market) pair(asset, counter, symbol string) {
+	if m.pairs[asset] == nil {
+		m.pairs[asset] = make(map[string]string)
+	}
+	m.pairs[asset][counter] = symbol
+}
+
+// UpdateAll sets last prices of tickers.
+func (m *Market) UpdateAll(tickers []*pkg.PriceTicker) {
+	for _, t := range tickers {
+		m.Update(t.Symbol, t.Price)
+	}
+}
+
+// Price returns last price of symbol.
+func (m *Market) Price(symbol string) (float64, bool) {
+	price, ok := m.prices[symbol]
+	return price, ok
+}
+
+// Path returns the shortest conversion path from asset to asset, empty if
+// they're the same. Paths of equal length go preferably through bridge
+// assets like BTC and BNB.
+func (m *Market) Path(from, to string) ([]Hop, bool) {
+	if from == to {
+		return []Hop{}, true
+	}
+	prev := map[string]string{from: ""}
+	level := []string{from}
+	for hops := 0; hops < maxHops && len(level) > 0; hops++ {
+		var next []string
+		for _, asset := range level {
+			for _, counter := range m.counters(asset) {
+				if _, seen := prev[counter]; seen {
+					continue
+				}
+				prev[counter] = asset
+				if counter == to {
+					return m.hops(prev, to), true
+				}
+				next = append(next, counter)
+			}
+		}
+		level = next
+	}
+	return nil, false
+}
+
+// counters returns assets asset converts to directly, bridge assets first.
+func (m *Market) counters(asset string) []string {
+	var counters []string
+	for counter := range m.pairs[asset] {
+		if _, ok := m.prices[m.pairs[asset][counter]]; ok {
+			counters = append(counters, counter)
+		}
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		ri, rj := bridgeRank(counters[i]), bridgeRank(counters[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return counters[i] < counters[j]
+	})
+	return counters
+}
+
+func bridgeRank(asset string) int {
+	for i, bridge := range bridgeAssets {
+		if asset == bridge {
+			return i
+		}
+	}
+	return len(bridgeAssets)
+}
+
+func (m *Market) hops(prev map[string]string, to string) []Hop {
+	var path []Hop
+	for asset := to; prev[asset] != ""; asset = prev[asset] {
+		from := prev[asset]
+		symbol := m.pairs[from][asset]
+		base, _, _ := m.Assets(symbol)
+		path = append([]Hop{{Symbol: symbol, Inverse: base != from}}, path...)
+	}
+	return path
+}
+
+// Rate returns price of one unit of asset in asset to, converted along path.
+func (m *Market) Rate(path []Hop) float64 {
+	rate := 1.0
+	for _, h := range path {
+		if h.Inverse {
+			rate /= m.prices[h.Symbol]
+		} else {
+			rate *= m.prices[h.Symbol]
+		}
+	}
+	return rate
+}
+
+// Convert returns amount of asset from in asset to and path it was
+// converted along. It returns false if there's no path.
+func (m *Market) Convert(amount float64, from, to string) (float64, []Hop, bool) {
+	path, ok := m.Path(from, to)
+	if !ok {
+		return 0, nil, false
+	}
+	return amount * m.Rate(path), path, true
+}
@@ -0,0 +1,91 @@
+package portfolio
+
+import (
+	"testing"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMarket() *Market {
+	m := NewMarket()
+	m.UpdateAll([]*pkg.PriceTicker{
+		{Symbol: "BTCUSDT", Price: 20000},
+		{Symbol: "BNBUSDT", Price: 300},
+		{Symbol: "BNBBTC", Price: 0.015},
+		{Symbol: "ETHBTC", Price: 0.07},
+		{Symbol: "XYZBNB", Price: 0.5},
+	})
+	return m
+}
+
+func TestPath(t *testing.T) {
+	m := newTestMarket()
+
+	path, ok := m.Path("BTC", "USDT")
+	assert.True(t, ok)
+	assert.Equal(t, []Hop{{Symbol: "BTCUSDT"}}, path)
+	assert.Equal(t, 20000.0, m.Rate(path))
+
+	path, ok = m.Path("USDT", "BTC")
+	assert.True(t, ok)
+	assert.Equal(t, []Hop{{Symbol: "BTCUSDT", Inverse: true}}, path)
+
+	value, path, ok := m.Convert(10, "XYZ", "USDT")
+	assert.True(t, ok)
+	assert.Equal(t, []Hop{{Symbol: "XYZBNB"}, {Symbol: "BNBUSDT"}}, path)
+	assert.Equal(t, 1500.0, value)
+
+	value, path, ok = m.Convert(2, "ETH", "BNB")
+	assert.True(t, ok)
+	assert.Equal(t, []Hop{{Symbol: "ETHBTC"}, {Symbol: "BNBBTC", Inverse: true}}, path)
+	assert.InDelta(t, 2*0.07/0.015, value, 1e-9)
+
+	path, ok = m.Path("USDT", "USDT")
+	assert.True(t, ok)
+	assert.Empty(t, path)
+	assert.Equal(t, 1.0, m.Rate(path))
+
+	_, _, ok = m.Convert(1, "FOO", "USDT")
+	assert.False(t, ok)
+}
+
+func TestPathPreference(t *testing.T) {
+	m := newTestMarket()
+	// Both XYZ→BTC→USDT and XYZ→BNB→USDT take two hops, BTC is preferred.
+	m.Update("XYZBTC", 0.0075)
+	path, _ := m.Path("XYZ", "USDT")
+	assert.Equal(t, []Hop{{Symbol: "XYZBTC"}, {Symbol: "BTCUSDT"}}, path)
+
+	// Direct market is the shortest path.
+	m.Update("XYZUSDT", 151)
+	path, _ = m.Path("XYZ", "USDT")
+	assert.Equal(t, []Hop{{Symbol: "XYZUSDT"}}, path)
+
+	// Markets without price aren't used.
+	m.Update("XYZUSDT", 0)
+	m.Update("XYZBTC", 0)
+	path, _ = m.Path("XYZ", "USDT")
+	assert.Equal(t, []Hop{{Symbol: "XYZBNB"}, {Symbol: "BNBUSDT"}}, path)
+}
+
+func TestPathLength(t *testing.T) {
+	m := newTestMarket()
+	m.SetSymbol("AAA-BBB", "AAA", "BBB")
+	m.SetSymbol("BBB-CCC", "BBB", "CCC")
+	m.SetSymbol("CCC-DDD", "CCC", "DDD")
+	m.Update("AAA-BBB", 2)
+	m.Update("BBB-CCC", 3)
+	m.Update("CCC-DDD", 4)
+	m.Update("DDDUSDT", 5)
+	// Unknown assets of symbol.
+	m.Update("AAAXXX", 1)
+
+	value, _, ok := m.Convert(1, "BBB", "USDT")
+	assert.True(t, ok)
+	assert.Equal(t, 60.0, value)
+	_, ok = m.Path("AAA", "USDT")
+	assert.False(t, ok)
+	_, ok = m.Price("AAAXXX")
+	assert.False(t, ok)
+}
@@ -0,0 +1,384 @@
+// Package portfolio values account balances in a chosen quote asset.
+//
+// Assets are converted by the shortest path through symbols with known
+// prices, directly like BTC→USDT or through other assets like XYZ→BNB→USDT.
+// Assets without any path are reported as unpriced:
+//
+//	p := portfolio.New(service, portfolio.WithQuoteAsset("USDT"))
+//	if err := p.Refresh(); err != nil {
+//		panic(err)
+//	}
+//	v := p.Valuation()
+//	fmt.Println(v.Total, v.Unpriced())
+//
+// Started Portfolio keeps valuation current, following balances on user data
+// stream and prices on trade streams of symbols along conversion paths.
+package portfolio
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// DefaultQuoteAsset is asset portfolio is valued in by default.
+const DefaultQuoteAsset = "USDT"
+
+// Valuation is value of balances in QuoteAsset.
+type Valuation struct {
+	QuoteAsset string
+	Total      float64
+	// Assets are values of assets with non-zero balance ordered by asset.
+	Assets []*AssetValue
+	Time   time.Time
+}
+
+// AssetValue is value of balance of single asset.
+type AssetValue struct {
+	Asset  string
+	Free   float64
+	Locked float64
+	// Price is price of one unit of asset in quote asset, zero if asset has
+	// no path to quote asset.
+	Price float64
+	Value float64
+	// Path is conversion path to quote asset, nil if asset has no path.
+	Path []Hop
+}
+
+// Priced returns whether asset has path to quote asset.
+func (av *AssetValue) Priced() bool {
+	return av.Path != nil
+}
+
+// Unpriced returns assets without path to quote asset.
+func (v *Valuation) Unpriced() []string {
+	var assets []string
+	for _, av := range v.Assets {
+		if !av.Priced() {
+			assets = append(assets, av.Asset)
+		}
+	}
+	return assets
+}
+
+// Value values balances with prices of market in quote asset.
+func Value(balances []*pkg.Balance, market *Market, quote string) *Valuation {
+	v := &Valuation{QuoteAsset: quote, Assets: []*AssetValue{}}
+	for _, b := range balances {
+		if b.Free == 0 && b.Locked == 0 {
+			continue
+		}
+		av := &AssetValue{Asset: b.Asset, Free: b.Free, Locked: b.Locked}
+		if path, ok := market.Path(b.Asset, quote); ok {
+			av.Path = path
+			av.Price = market.Rate(path)
+			av.Value = (b.Free + b.Locked) * av.Price
+			v.Total += av.Value
+		}
+		v.Assets = append(v.Assets, av)
+	}
+	sort.Slice(v.Assets, func(i, j int) bool {
+		return v.Assets[i].Asset < v.Assets[j].Asset
+	})
+	return v
+}
+
+// Portfolio values balances of account.
+type Portfolio struct {
+	service  pkg.Service
+	quote    string
+	logger   log.Logger
+	onUpdate func(*Valuation)
+	refresh  time.Duration
+
+	// notifyMu serializes updates, so that handler sees them in order.
+	notifyMu sync.Mutex
+	mu       sync.Mutex
+	market   *Market
+	balances map[string]*pkg.Balance
+	updated  time.Time
+	watched  map[string]*pkg.Subscription
+	manager  *pkg.UserDataStreamManager
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Option configures Portfolio.
+type Option func(*Portfolio)
+
+// WithQuoteAsset sets asset balances are valued in, DefaultQuoteAsset by
+// default.
+func WithQuoteAsset(asset string) Option {
+	return func(p *Portfolio) {
+		p.quote = asset
+	}
+}
+
+// WithSymbol sets base and quote asset of symbol, so that balances can be
+// converted through it. Prices of symbols whose assets can't be told from the
+// name are ignored.
+func WithSymbol(symbol, base, quote string) Option {
+	return func(p *Portfolio) {
+		p.market.SetSymbol(symbol, base, quote)
+	}
+}
+
+// WithHandler sets function called with valuation of started Portfolio
+// whenever balances or prices change. It's called one call at a time.
+func WithHandler(f func(*Valuation)) Option {
+	return func(p *Portfolio) {
+		p.onUpdate = f
+	}
+}
+
+// WithRefreshInterval makes started Portfolio refresh balances and all
+// prices every d, picking up paths through symbols not watched yet. There's
+// no periodic refresh by default.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(p *Portfolio) {
+		p.refresh = d
+	}
+}
+
+// WithLogger sets logger of stream failures.
+func WithLogger(logger log.Logger) Option {
+	return func(p *Portfolio) {
+		p.logger = logger
+	}
+}
+
+// New creates Portfolio of account of service.
+func New(service pkg.Service, opts ...Option) *Portfolio {
+	p := &Portfolio{
+		service:  service,
+		quote:    DefaultQuoteAsset,
+		logger:   log.NewNopLogger(),
+		market:   NewMarket(),
+		balances: make(map[string]*pkg.Balance),
+		watched:  make(map[string]*pkg.Subscription),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Refresh fetches balances and prices of all symbols.
+func (p *Portfolio) Refresh() error {
+	account, err := p.service.Account(pkg.AccountRequest{Timestamp: time.Now()})
+	if err != nil {
+		return errors.Wrap(err, "unable to get account")
+	}
+	tickers, err := p.service.TickerAllPrices()
+	if err != nil {
+		return errors.Wrap(err, "unable to get prices")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balances = make(map[string]*pkg.Balance)
+	for _, b := range account.Balances {
+		p.setBalance(b)
+	}
+	p.market.UpdateAll(tickers)
+	p.updated = time.Now()
+	return nil
+}
+
+func (p *Portfolio) setBalance(b *pkg.Balance) {
+	if b.Free == 0 && b.Locked == 0 {
+		delete(p.balances, b.Asset)
+		return
+	}
+	c := *b
+	p.balances[b.Asset] = &c
+}
+
+// Valuation returns valuation of the last known balances and prices.
+func (p *Portfolio) Valuation() *Valuation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.valuation()
+}
+
+func (p *Portfolio) valuation() *Valuation {
+	var balances []*pkg.Balance
+	for _, b := range p.balances {
+		balances = append(balances, b)
+	}
+	v := Value(balances, p.market, p.quote)
+	v.Time = p.updated
+	return v
+}
+
+// Start refreshes the Portfolio and keeps it current until ctx is done or
+// Close is called.
+func (p *Portfolio) Start(ctx context.Context) error {
+	p.mu.Lock()
+	started := p.done != nil
+	p.mu.Unlock()
+	if started {
+		return errors.New("portfolio already started")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	manager := pkg.NewUserDataStreamManager(p.service, p.logger)
+	if err := manager.Start(ctx); err != nil {
+		cancel()
+		return errors.Wrap(err, "unable to start user data stream")
+	}
+	if err := p.Refresh(); err != nil {
+		cancel()
+		manager.Close()
+		return err
+	}
+	p.update(func() {
+		p.manager = manager
+		p.cancel = cancel
+		p.done = make(chan struct{})
+		p.watch()
+	})
+	go p.run(ctx, manager)
+	return nil
+}
+
+// Close stops streams of started Portfolio.
+func (p *Portfolio) Close() error {
+	p.mu.Lock()
+	if p.done == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	p.cancel()
+	manager, done := p.manager, p.done
+	var subs []*pkg.Subscription
+	for symbol, sub := range p.watched {
+		subs = append(subs, sub)
+		delete(p.watched, symbol)
+	}
+	p.mu.Unlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+	<-done
+	return manager.Close()
+}
+
+func (p *Portfolio) run(ctx context.Context, manager *pkg.UserDataStreamManager) {
+	defer close(p.done)
+	var tick <-chan time.Time
+	if p.refresh > 0 {
+		ticker := time.NewTicker(p.refresh)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case ude, ok := <-manager.Events():
+			if !ok {
+				return
+			}
+			switch e := ude.(type) {
+			case *pkg.AccountPositionEvent:
+				p.update(func() {
+					for _, b := range e.Balances {
+						p.setBalance(b)
+					}
+					p.updated = e.LastUpdateTime
+					p.watch()
+				})
+			case *pkg.ListenKeyExpiredEvent:
+				// Balance updates might have been missed.
+				p.resync()
+			}
+		case <-tick:
+			p.resync()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Portfolio) resync() {
+	if err := p.Refresh(); err != nil {
+		level.Error(p.logger).Log("portfolio", "refresh", "err", err)
+		return
+	}
+	p.update(p.watch)
+}
+
+// watch subscribes trades of symbols along conversion paths of balances and
+// closes streams of symbols no longer needed.
+func (p *Portfolio) watch() {
+	needed := make(map[string]bool)
+	for asset := range p.balances {
+		path, _ := p.market.Path(asset, p.quote)
+		for _, h := range path {
+			needed[h.Symbol] = true
+		}
+	}
+	for symbol, sub := range p.watched {
+		if !needed[symbol] {
+			delete(p.watched, symbol)
+			go sub.Close()
+		}
+	}
+	for symbol := range needed {
+		if _, ok := p.watched[symbol]; ok {
+			continue
+		}
+		symbol := symbol
+		sub, err := p.service.SubscribeTrade(pkg.TradeWebsocketRequest{
+			Symbol:        symbol,
+			StreamOptions: pkg.StreamOptions{Overflow: pkg.OverflowDropOldest},
+		}, pkg.StreamHandler{
+			OnTrade: func(ate *pkg.AggTradeEvent) {
+				p.update(func() {
+					p.market.Update(symbol, ate.Price)
+					p.updated = ate.Timestamp
+				})
+			},
+			OnError: func(err error) {
+				level.Error(p.logger).Log("portfolio", "stream", "symbol", symbol, "err", err)
+			},
+		})
+		if err != nil {
+			level.Error(p.logger).Log("portfolio", "subscribe", "symbol", symbol, "err", err)
+			continue
+		}
+		p.watched[symbol] = sub
+		go p.unwatch(symbol, sub)
+	}
+}
+
+// unwatch forgets symbol once its stream stops, so that it's watched again
+// on the next update of balances.
+func (p *Portfolio) unwatch(symbol string, sub *pkg.Subscription) {
+	<-sub.Done()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watched[symbol] != sub {
+		return
+	}
+	level.Error(p.logger).Log("portfolio", "stream stopped", "symbol", symbol, "err", sub.Err())
+	delete(p.watched, symbol)
+}
+
+// update changes state of the Portfolio by f and passes the new valuation
+// to handler.
+func (p *Portfolio) update(f func()) {
+	p.notifyMu.Lock()
+	defer p.notifyMu.Unlock()
+	p.mu.Lock()
+	f()
+	v := p.valuation()
+	p.mu.Unlock()
+	if p.onUpdate != nil {
+		p.onUpdate(v)
+	}
+}
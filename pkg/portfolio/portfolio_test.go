@@ -0,0 +1,124 @@
+package portfolio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/retirero/go-binance/pkg/binancetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAPIKey = "test-key"
+	testSecret = "test-secret"
+)
+
+func newTestServer(t *testing.T) (*binancetest.Server, pkg.Service) {
+	srv := binancetest.NewServer(binancetest.WithHMACKey(testAPIKey, []byte(testSecret)))
+	t.Cleanup(srv.Close)
+	for symbol, price := range map[string]float64{
+		"BTCUSDT": 20000,
+		"BNBUSDT": 300,
+		"XYZBNB":  0.5,
+		"ETHBTC":  0.07,
+	} {
+		base, quote := symbol[:3], symbol[3:]
+		srv.AddSymbol(symbol, base, quote)
+		srv.AddAggTrades(symbol, &pkg.AggTrade{Price: price, Quantity: 1, Timestamp: time.Now()})
+	}
+	srv.SetBalance("USDT", 100)
+	srv.SetBalance("BTC", 0.5)
+	srv.SetBalance("XYZ", 10)
+	srv.SetBalance("FOO", 3)
+	service := pkg.NewAPIService("", testAPIKey, &pkg.HmacSigner{Key: []byte(testSecret)}, nil, context.Background(),
+		pkg.WithEnvironment(srv.Environment()))
+	return srv, service
+}
+
+func assetValues(v *Valuation) map[string]*AssetValue {
+	m := make(map[string]*AssetValue)
+	for _, av := range v.Assets {
+		m[av.Asset] = av
+	}
+	return m
+}
+
+func TestRefresh(t *testing.T) {
+	_, service := newTestServer(t)
+	p := New(service)
+	require.NoError(t, p.Refresh())
+
+	v := p.Valuation()
+	assert.Equal(t, "USDT", v.QuoteAsset)
+	assert.Equal(t, 100+10000+1500.0, v.Total)
+	assert.Equal(t, []string{"FOO"}, v.Unpriced())
+	values := assetValues(v)
+	require.Len(t, values, 4)
+	assert.Equal(t, &AssetValue{Asset: "USDT", Free: 100, Price: 1, Value: 100, Path: []Hop{}}, values["USDT"])
+	assert.Equal(t, 150.0, values["XYZ"].Price)
+	assert.Equal(t, []Hop{{Symbol: "XYZBNB"}, {Symbol: "BNBUSDT"}}, values["XYZ"].Path)
+	assert.Equal(t, &AssetValue{Asset: "FOO", Free: 3}, values["FOO"])
+
+	p = New(service, WithQuoteAsset("BTC"))
+	require.NoError(t, p.Refresh())
+	assert.InDelta(t, 0.005+0.5+0.075, p.Valuation().Total, 1e-12)
+}
+
+func TestStart(t *testing.T) {
+	srv, service := newTestServer(t)
+	valuations := make(chan *Valuation, 100)
+	p := New(service, WithHandler(func(v *Valuation) {
+		valuations <- v
+	}))
+	require.NoError(t, p.Start(context.Background()))
+	defer p.Close()
+	assert.Error(t, p.Start(context.Background()))
+
+	// waitFor waits for valuation satisfying cond, calling push until then.
+	waitFor := func(push func(), cond func(v *Valuation) bool) *Valuation {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			push()
+			select {
+			case v := <-valuations:
+				if cond(v) {
+					return v
+				}
+			case <-time.After(100 * time.Millisecond):
+			case <-timeout:
+				t.Fatal("valuation not received")
+			}
+		}
+	}
+	v := waitFor(func() {}, func(v *Valuation) bool { return true })
+	assert.Equal(t, 11600.0, v.Total)
+
+	// User data stream connects in background.
+	v = waitFor(func() {
+		srv.PushUserData(&pkg.AccountPositionEvent{Balances: []*pkg.Balance{
+			{Asset: "BTC", Free: 0.5, Locked: 0.5},
+			{Asset: "ETH", Free: 10},
+			{Asset: "USDT", Free: 0},
+		}})
+	}, func(v *Valuation) bool { return assetValues(v)["ETH"] != nil })
+	values := assetValues(v)
+	assert.Nil(t, values["USDT"])
+	assert.Equal(t, 20000.0, values["BTC"].Value)
+	assert.Equal(t, []Hop{{Symbol: "ETHBTC"}, {Symbol: "BTCUSDT"}}, values["ETH"].Path)
+	assert.Equal(t, 20000+1500+14000.0, v.Total)
+
+	// Prices of symbols along paths are followed.
+	srv.PushAggTrade("BTCUSDT", &pkg.AggTrade{Price: 21000, Quantity: 1, Timestamp: time.Now()})
+	v = waitFor(func() {}, func(v *Valuation) bool { return assetValues(v)["BTC"].Value == 21000 })
+	srv.PushAggTrade("ETHBTC", &pkg.AggTrade{Price: 0.08, Quantity: 1, Timestamp: time.Now()})
+	v = waitFor(func() {}, func(v *Valuation) bool { return assetValues(v)["ETH"].Price == 0.08*21000 })
+	assert.Equal(t, 21000+1500+16800.0, v.Total)
+	assert.Equal(t, v.Total, p.Valuation().Total)
+
+	require.NoError(t, p.Close())
+	require.NoError(t, p.Close())
+}
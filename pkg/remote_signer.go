@@ -0,0 +1,141 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// SignRequest describes payload to be signed by ContextSigner.
+type SignRequest struct {
+	// Method is HTTP method of REST request, empty for WebSocket API requests.
+	Method string `json:"method,omitempty"`
+	// Endpoint is REST endpoint (e.g. "api/v3/order") or WebSocket API method
+	// (e.g. "order.place").
+	Endpoint string `json:"endpoint"`
+	// Payload is exact string to be signed.
+	Payload string `json:"payload"`
+}
+
+// SignResponse is reply of remote signers to SignRequest.
+type SignResponse struct {
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ContextSigner signs requests with keys that might be held outside of the
+// process. Unlike Signer, signing can be cancelled and can fail.
+type ContextSigner interface {
+	// SignContext returns encoded signature of sr.Payload.
+	SignContext(ctx context.Context, sr SignRequest) (string, error)
+}
+
+// LocalSigner adapts Signer to ContextSigner.
+type LocalSigner struct {
+	Signer Signer
+}
+
+// SignContext signs payload with wrapped Signer. Signers implementing
+// ContextSigner themselves, like RSASigner, report signing errors this way.
+func (ls *LocalSigner) SignContext(ctx context.Context, sr SignRequest) (string, error) {
+	if cs, ok := ls.Signer.(ContextSigner); ok {
+		return cs.SignContext(ctx, sr)
+	}
+	return ls.Signer.Sign([]byte(sr.Payload)), nil
+}
+
+// HTTPSigner requests signatures from signing sidecar over HTTP. SignRequest
+// is POSTed as JSON to URL and SignResponse is expected in reply.
+type HTTPSigner struct {
+	URL    string
+	Client *http.Client
+}
+
+// SignContext requests signature of sr from signing sidecar.
+func (hs *HTTPSigner) SignContext(ctx context.Context, sr SignRequest) (string, error) {
+	body, err := json.Marshal(sr)
+	if err != nil {
+		return "", errors.Wrap(err, "sign request marshal failed")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", hs.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to create sign request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := hs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "sign request failed")
+	}
+	defer res.Body.Close()
+	textRes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read sign response")
+	}
+	return signatureFromJSON(textRes)
+}
+
+// NewUnixSocketSigner creates signer talking to signing daemon listening on
+// Unix socket at path. The daemon speaks the same protocol as HTTPSigner.
+func NewUnixSocketSigner(path string) *HTTPSigner {
+	dialer := &net.Dialer{}
+	return &HTTPSigner{
+		URL: "http://unix/sign",
+		Client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// CommandSigner runs command for every signature. SignRequest is written as
+// JSON to its standard input and SignResponse is read from standard output.
+type CommandSigner struct {
+	Path string
+	Args []string
+}
+
+// SignContext runs signing command for sr. The command is killed when ctx is
+// done.
+func (cs *CommandSigner) SignContext(ctx context.Context, sr SignRequest) (string, error) {
+	body, err := json.Marshal(sr)
+	if err != nil {
+		return "", errors.Wrap(err, "sign request marshal failed")
+	}
+	cmd := exec.CommandContext(ctx, cs.Path, cs.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return "", errors.Wrapf(err, "signing command failed: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+	return signatureFromJSON(out)
+}
+
+func signatureFromJSON(textRes []byte) (string, error) {
+	sr := &SignResponse{}
+	if err := json.Unmarshal(textRes, sr); err != nil {
+		return "", errors.Wrap(err, "sign response unmarshal failed")
+	}
+	if sr.Error != "" {
+		return "", errors.Errorf("signer refused: %s", sr.Error)
+	}
+	if sr.Signature == "" {
+		return "", errors.New("signer returned empty signature")
+	}
+	return sr.Signature, nil
+}
@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ResponseMeta holds metadata of REST response.
+type ResponseMeta struct {
+	StatusCode int
+	Header     http.Header
+	// UsedWeight is request weight used in current minute
+	// (X-MBX-USED-WEIGHT-1M header).
+	UsedWeight int
+	// OrderCount10s and OrderCount1d are numbers of orders placed in
+	// current intervals (X-MBX-ORDER-COUNT-10S and X-MBX-ORDER-COUNT-1D
+	// headers). They are sent only in responses to order requests.
+	OrderCount10s int
+	OrderCount1d  int
+	// Date is server time of the response (Date header).
+	Date time.Time
+	// Latency is time from sending request to receiving whole response.
+	Latency time.Duration
+}
+
+type responseMetaKey struct{}
+
+// ContextWithResponseMeta returns ctx making REST calls of Service bound to it
+// (see WithContext) store metadata of their response into meta. Metadata is
+// stored for error responses too. Meta is overwritten by every call, so use
+// separate one for concurrent calls.
+//
+//	var meta ResponseMeta
+//	acc, err := WithContext(service, ContextWithResponseMeta(ctx, &meta)).Account(ar)
+//	if meta.UsedWeight > 1000 { ... }
+func ContextWithResponseMeta(ctx context.Context, meta *ResponseMeta) context.Context {
+	return context.WithValue(ctx, responseMetaKey{}, meta)
+}
+
+// storeResponseMeta fills ResponseMeta requested in ctx, if any.
+func storeResponseMeta(ctx context.Context, res *APIResponse) {
+	if ctx == nil {
+		return
+	}
+	meta, ok := ctx.Value(responseMetaKey{}).(*ResponseMeta)
+	if !ok || meta == nil {
+		return
+	}
+	*meta = ResponseMeta{
+		StatusCode:    res.StatusCode,
+		Header:        res.Header,
+		UsedWeight:    intHeader(res.Header, "X-MBX-USED-WEIGHT-1M"),
+		OrderCount10s: intHeader(res.Header, "X-MBX-ORDER-COUNT-10S"),
+		OrderCount1d:  intHeader(res.Header, "X-MBX-ORDER-COUNT-1D"),
+		Latency:       res.Latency,
+	}
+	if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		meta.Date = date
+	}
+}
+
+func intHeader(h http.Header, key string) int {
+	i, _ := strconv.Atoi(h.Get(key))
+	return i
+}
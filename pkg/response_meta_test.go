@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-MBX-USED-WEIGHT-1M", "42")
+		w.Header().Set("X-MBX-ORDER-COUNT-10S", "2")
+		w.Header().Set("X-MBX-ORDER-COUNT-1D", "17")
+		w.Header().Set("Date", "Wed, 12 Jul 2017 03:21:59 GMT")
+		if r.Method == "DELETE" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"code":-2011,"msg":"Unknown order sent."}`))
+			return
+		}
+		w.Write([]byte(`{"symbol":"BNBBTC","orderId":1,"clientOrderId":"a","transactTime":1499827319559}`))
+	}))
+	defer srv.Close()
+	service := NewAPIService(srv.URL, "", &HmacSigner{}, nil, context.Background())
+
+	var meta ResponseMeta
+	ctx := ContextWithResponseMeta(context.Background(), &meta)
+	_, err := WithContext(service, ctx).NewOrder(NewOrderRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	assert.Equal(t, 200, meta.StatusCode)
+	assert.Equal(t, 42, meta.UsedWeight)
+	assert.Equal(t, 2, meta.OrderCount10s)
+	assert.Equal(t, 17, meta.OrderCount1d)
+	assert.Equal(t, time.Date(2017, 7, 12, 3, 21, 59, 0, time.UTC), meta.Date)
+	assert.True(t, meta.Latency > 0)
+
+	var errMeta ResponseMeta
+	_, err = WithContext(service, ContextWithResponseMeta(context.Background(), &errMeta)).
+		CancelOrder(CancelOrderRequest{Symbol: "BNBBTC", OrderID: 1})
+	require.Error(t, err)
+	assert.Equal(t, 400, errMeta.StatusCode)
+	assert.Equal(t, 42, errMeta.UsedWeight)
+}
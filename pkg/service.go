@@ -36,5 +36,10 @@ type Service interface {
 	DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEvent, chan struct{}, error)
 	KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, chan struct{}, error)
 	TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeEvent, chan struct{}, error)
-	UserDataWebsocket(udwr UserDataWebsocketRequest) (chan *AccountEvent, chan struct{}, error)
+	UserDataWebsocket(udwr UserDataWebsocketRequest) (chan UserDataEvent, chan struct{}, error)
+
+	SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (*Subscription, error)
+	SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (*Subscription, error)
+	SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (*Subscription, error)
+	SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (*Subscription, error)
 }
\ No newline at end of file
@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/retirero/go-binance/internal"
-	"io/ioutil"
 	"strconv"
+	"time"
 )
 
 type rawExecutedOrder struct {
@@ -25,6 +25,14 @@ type rawExecutedOrder struct {
 }
 
 func (as *apiService) NewOrder(or NewOrderRequest) (*ProcessedOrder, error) {
+	textRes, err := as.call("POST", "api/v3/order", newOrderParams(or), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return processedOrderFromJSON(textRes)
+}
+
+func newOrderParams(or NewOrderRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = or.Symbol
 	params["side"] = string(or.Side)
@@ -42,21 +50,10 @@ func (as *apiService) NewOrder(or NewOrderRequest) (*ProcessedOrder, error) {
 	if or.IcebergQty != 0 {
 		params["icebergQty"] = strconv.FormatFloat(or.IcebergQty, 'f', -1, 64)
 	}
+	return params
+}
 
-	res, err := as.request("POST", "api/v3/order", params, true, true)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Ticker/24hr")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
-
+func processedOrderFromJSON(textRes []byte) (*ProcessedOrder, error) {
 	rawOrder := struct {
 		Symbol        string  `json:"symbol"`
 		OrderID       int64   `json:"orderId"`
@@ -81,41 +78,19 @@ func (as *apiService) NewOrder(or NewOrderRequest) (*ProcessedOrder, error) {
 }
 
 func (as *apiService) NewOrderTest(or NewOrderRequest) error {
-	params := make(map[string]string)
-	params["symbol"] = or.Symbol
-	params["side"] = string(or.Side)
-	params["type"] = string(or.Type)
-	params["timeInForce"] = string(or.TimeInForce)
-	params["quantity"] = strconv.FormatFloat(or.Quantity, 'f', -1, 64)
-	params["price"] = strconv.FormatFloat(or.Price, 'f', -1, 64)
-	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(or.Timestamp), 10)
-	if or.NewClientOrderID != "" {
-		params["newClientOrderId"] = or.NewClientOrderID
-	}
-	if or.StopPrice != 0 {
-		params["stopPrice"] = strconv.FormatFloat(or.StopPrice, 'f', -1, 64)
-	}
-	if or.IcebergQty != 0 {
-		params["icebergQty"] = strconv.FormatFloat(or.IcebergQty, 'f', -1, 64)
-	}
+	_, err := as.call("POST", "api/v3/order/test", newOrderParams(or), true, true)
+	return err
+}
 
-	res, err := as.request("POST", "api/v3/order/test", params, true, true)
-	if err != nil {
-		return err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
+func (as *apiService) QueryOrder(qor QueryOrderRequest) (*ExecutedOrder, error) {
+	textRes, err := as.call("GET", "api/v3/order", queryOrderParams(qor), true, true)
 	if err != nil {
-		return errors.Wrap(err, "unable to read response from Ticker/24hr")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return as.handleError(textRes)
+		return nil, err
 	}
-	return nil
+	return executedOrderFromJSON(textRes)
 }
 
-func (as *apiService) QueryOrder(qor QueryOrderRequest) (*ExecutedOrder, error) {
+func queryOrderParams(qor QueryOrderRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = qor.Symbol
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(qor.Timestamp), 10)
@@ -126,36 +101,28 @@ func (as *apiService) QueryOrder(qor QueryOrderRequest) (*ExecutedOrder, error)
 		params["origClientOrderId"] = qor.OrigClientOrderID
 	}
 	if qor.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(qor.RecvWindow), 10)
-	}
-
-	res, err := as.request("GET", "api/v3/order", params, true, true)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from order.get")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(qor.RecvWindow), 10)
 	}
+	return params
+}
 
+func executedOrderFromJSON(textRes []byte) (*ExecutedOrder, error) {
 	rawOrder := &rawExecutedOrder{}
 	if err := json.Unmarshal(textRes, rawOrder); err != nil {
 		return nil, errors.Wrap(err, "rawOrder unmarshal failed")
 	}
+	return executedOrderFromRaw(rawOrder)
+}
 
-	eo, err := executedOrderFromRaw(rawOrder)
+func (as *apiService) CancelOrder(cor CancelOrderRequest) (*CanceledOrder, error) {
+	textRes, err := as.call("DELETE", "api/v3/order", cancelOrderParams(cor), true, true)
 	if err != nil {
 		return nil, err
 	}
-	return eo, nil
+	return canceledOrderFromJSON(textRes)
 }
 
-func (as *apiService) CancelOrder(cor CancelOrderRequest) (*CanceledOrder, error) {
+func cancelOrderParams(cor CancelOrderRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = cor.Symbol
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(cor.Timestamp), 10)
@@ -169,23 +136,12 @@ func (as *apiService) CancelOrder(cor CancelOrderRequest) (*CanceledOrder, error
 		params["newClientOrderId"] = cor.NewClientOrderID
 	}
 	if cor.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(cor.RecvWindow), 10)
-	}
-
-	res, err := as.request("DELETE", "api/v3/order", params, true, true)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from order.delete")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(cor.RecvWindow), 10)
 	}
+	return params
+}
 
+func canceledOrderFromJSON(textRes []byte) (*CanceledOrder, error) {
 	rawCanceledOrder := struct {
 		Symbol            string `json:"symbol"`
 		OrigClientOrderID string `json:"origClientOrderId"`
@@ -205,30 +161,27 @@ func (as *apiService) CancelOrder(cor CancelOrderRequest) (*CanceledOrder, error
 }
 
 func (as *apiService) OpenOrders(oor OpenOrdersRequest) ([]*ExecutedOrder, error) {
-	params := make(map[string]string)
-	params["symbol"] = oor.Symbol
-	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(oor.Timestamp), 10)
-	if oor.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(oor.RecvWindow), 10)
-	}
-
-	res, err := as.request("GET", "api/v3/openOrders", params, true, true)
+	textRes, err := as.call("GET", "api/v3/openOrders", openOrdersParams(oor), true, true)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from openOrders.get")
-	}
-	defer res.Body.Close()
+	return executedOrdersFromJSON(textRes)
+}
 
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
+func openOrdersParams(oor OpenOrdersRequest) map[string]string {
+	params := make(map[string]string)
+	params["symbol"] = oor.Symbol
+	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(oor.Timestamp), 10)
+	if oor.RecvWindow != 0 {
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(oor.RecvWindow), 10)
 	}
+	return params
+}
 
+func executedOrdersFromJSON(textRes []byte) ([]*ExecutedOrder, error) {
 	rawOrders := []*rawExecutedOrder{}
 	if err := json.Unmarshal(textRes, &rawOrders); err != nil {
-		return nil, errors.Wrap(err, "openOrders unmarshal failed")
+		return nil, errors.Wrap(err, "rawOrders unmarshal failed")
 	}
 
 	var eoc []*ExecutedOrder
@@ -244,6 +197,14 @@ func (as *apiService) OpenOrders(oor OpenOrdersRequest) ([]*ExecutedOrder, error
 }
 
 func (as *apiService) AllOrders(aor AllOrdersRequest) ([]*ExecutedOrder, error) {
+	textRes, err := as.call("GET", "api/v3/allOrders", allOrdersParams(aor), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return executedOrdersFromJSON(textRes)
+}
+
+func allOrdersParams(aor AllOrdersRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = aor.Symbol
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(aor.Timestamp), 10)
@@ -254,61 +215,29 @@ func (as *apiService) AllOrders(aor AllOrdersRequest) ([]*ExecutedOrder, error)
 		params["limit"] = strconv.Itoa(aor.Limit)
 	}
 	if aor.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(aor.RecvWindow), 10)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(aor.RecvWindow), 10)
 	}
+	return params
+}
 
-	res, err := as.request("GET", "api/v3/allOrders", params, true, true)
+func (as *apiService) Account(ar AccountRequest) (*Account, error) {
+	textRes, err := as.call("GET", "api/v3/account", accountParams(ar), true, true)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from allOrders.get")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
-
-	rawOrders := []*rawExecutedOrder{}
-	if err := json.Unmarshal(textRes, &rawOrders); err != nil {
-		return nil, errors.Wrap(err, "allOrders unmarshal failed")
-	}
-
-	var eoc []*ExecutedOrder
-	for _, rawOrder := range rawOrders {
-		eo, err := executedOrderFromRaw(rawOrder)
-		if err != nil {
-			return nil, err
-		}
-		eoc = append(eoc, eo)
-	}
-
-	return eoc, nil
+	return accountFromJSON(textRes)
 }
 
-func (as *apiService) Account(ar AccountRequest) (*Account, error) {
+func accountParams(ar AccountRequest) map[string]string {
 	params := make(map[string]string)
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(ar.Timestamp), 10)
 	if ar.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(ar.RecvWindow), 10)
-	}
-
-	res, err := as.request("GET", "api/v3/account", params, true, true)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from account.get")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(ar.RecvWindow), 10)
 	}
+	return params
+}
 
+func accountFromJSON(textRes []byte) (*Account, error) {
 	rawAccount := struct {
 		MakerCommision   int64 `json:"makerCommision"`
 		TakerCommission  int64 `json:"takerCommission"`
@@ -356,37 +285,44 @@ func (as *apiService) Account(ar AccountRequest) (*Account, error) {
 }
 
 func (as *apiService) MyTrades(mtr MyTradesRequest) ([]*Trade, error) {
+	textRes, err := as.call("GET", "api/v3/myTrades", myTradesParams(mtr), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return tradesFromJSON(textRes)
+}
+
+func myTradesParams(mtr MyTradesRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = mtr.Symbol
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(mtr.Timestamp), 10)
 	if mtr.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(mtr.RecvWindow), 10)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(mtr.RecvWindow), 10)
 	}
 	if mtr.FromID != 0 {
-		params["orderId"] = strconv.FormatInt(mtr.FromID, 10)
+		params["fromId"] = strconv.FormatInt(mtr.FromID, 10)
 	}
-	if mtr.Limit != 0 {
-		params["limit"] = strconv.Itoa(mtr.Limit)
+	if !mtr.StartTime.IsZero() {
+		params["startTime"] = strconv.FormatInt(internal.UnixMillis(mtr.StartTime), 10)
 	}
-
-	res, err := as.request("GET", "api/v3/myTrades", params, true, true)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from myTrades.get")
+	if !mtr.EndTime.IsZero() {
+		params["endTime"] = strconv.FormatInt(internal.UnixMillis(mtr.EndTime), 10)
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
+	if mtr.Limit != 0 {
+		params["limit"] = strconv.Itoa(mtr.Limit)
 	}
+	return params
+}
 
+func tradesFromJSON(textRes []byte) ([]*Trade, error) {
 	rawTrades := []struct {
+		Symbol          string  `json:"symbol"`
 		ID              int64   `json:"id"`
+		OrderID         int64   `json:"orderId"`
+		OrderListID     int64   `json:"orderListId"`
 		Price           string  `json:"price"`
 		Qty             string  `json:"qty"`
+		QuoteQty        string  `json:"quoteQty"`
 		Commission      string  `json:"commission"`
 		CommissionAsset string  `json:"commissionAsset"`
 		Time            float64 `json:"time"`
@@ -408,6 +344,13 @@ func (as *apiService) MyTrades(mtr MyTradesRequest) ([]*Trade, error) {
 		if err != nil {
 			return nil, err
 		}
+		// quoteQty is missing in some responses, e.g. of older trades.
+		var quoteQty float64
+		if rt.QuoteQty != "" {
+			if quoteQty, err = internal.FloatFromString(rt.QuoteQty); err != nil {
+				return nil, err
+			}
+		}
 		commission, err := internal.FloatFromString(rt.Commission)
 		if err != nil {
 			return nil, err
@@ -417,9 +360,13 @@ func (as *apiService) MyTrades(mtr MyTradesRequest) ([]*Trade, error) {
 			return nil, err
 		}
 		tc = append(tc, &Trade{
+			Symbol:          rt.Symbol,
 			ID:              rt.ID,
+			OrderID:         rt.OrderID,
+			OrderListID:     rt.OrderListID,
 			Price:           price,
 			Qty:             qty,
+			QuoteQty:        quoteQty,
 			Commission:      commission,
 			CommissionAsset: rt.CommissionAsset,
 			Time:            t,
@@ -438,32 +385,23 @@ func (as *apiService) Withdraw(wr WithdrawRequest) (*WithdrawResult, error) {
 	params["amount"] = strconv.FormatFloat(wr.Amount, 'f', 10, 64)
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(wr.Timestamp), 10)
 	if wr.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(wr.RecvWindow), 10)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(wr.RecvWindow), 10)
 	}
 	if wr.Name != "" {
 		params["name"] = wr.Name
 	}
 
-	res, err := as.request("POST", "wapi/v1/withdraw.html", params, true, true)
+	textRes, err := as.call("POST", "wapi/v1/withdraw.html", params, true, true)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from withdraw.post")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
 
 	rawResult := struct {
 		Msg     string `json:"msg"`
 		Success bool   `json:"success"`
 	}{}
 	if err := json.Unmarshal(textRes, &rawResult); err != nil {
-		return nil, errors.Wrap(err, "rawTrades unmarshal failed")
+		return nil, errors.Wrap(err, "rawResult unmarshal failed")
 	}
 
 	return &WithdrawResult{
@@ -471,11 +409,12 @@ func (as *apiService) Withdraw(wr WithdrawRequest) (*WithdrawResult, error) {
 		Success: rawResult.Success,
 	}, nil
 }
-func (as *apiService) DepositHistory(hr HistoryRequest) ([]*Deposit, error) {
+
+func historyParams(hr HistoryRequest) map[string]string {
 	params := make(map[string]string)
 	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(hr.Timestamp), 10)
 	if hr.Asset != "" {
-		params["asset"] = hr.Asset
+		params["coin"] = hr.Asset
 	}
 	if hr.Status != nil {
 		params["status"] = strconv.Itoa(*hr.Status)
@@ -484,116 +423,105 @@ func (as *apiService) DepositHistory(hr HistoryRequest) ([]*Deposit, error) {
 		params["startTime"] = strconv.FormatInt(internal.UnixMillis(hr.StartTime), 10)
 	}
 	if !hr.EndTime.IsZero() {
-		params["startTime"] = strconv.FormatInt(internal.UnixMillis(hr.EndTime), 10)
+		params["endTime"] = strconv.FormatInt(internal.UnixMillis(hr.EndTime), 10)
 	}
 	if hr.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(hr.RecvWindow), 10)
+		params["recvWindow"] = strconv.FormatInt(internal.RecvWindow(hr.RecvWindow), 10)
 	}
+	return params
+}
 
-	res, err := as.request("POST", "wapi/v1/getDepositHistory.html", params, true, true)
+func (as *apiService) DepositHistory(hr HistoryRequest) ([]*Deposit, error) {
+	textRes, err := as.call("GET", "sapi/v1/capital/deposit/hisrec", historyParams(hr), true, true)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from depositHistory.post")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
+	return depositsFromJSON(textRes)
+}
 
-	rawDepositHistory := struct {
-		DepositList []struct {
-			InsertTime float64 `json:"insertTime"`
-			Amount     float64 `json:"amount"`
-			Asset      string  `json:"asset"`
-			Status     int     `json:"status"`
-		}
-		Success bool `json:"success"`
+func depositsFromJSON(textRes []byte) ([]*Deposit, error) {
+	rawDeposits := []struct {
+		InsertTime float64 `json:"insertTime"`
+		Amount     string  `json:"amount"`
+		Coin       string  `json:"coin"`
+		Address    string  `json:"address"`
+		TxID       string  `json:"txId"`
+		Status     int     `json:"status"`
 	}{}
-	if err := json.Unmarshal(textRes, &rawDepositHistory); err != nil {
-		return nil, errors.Wrap(err, "rawDepositHistory unmarshal failed")
+	if err := json.Unmarshal(textRes, &rawDeposits); err != nil {
+		return nil, errors.Wrap(err, "rawDeposits unmarshal failed")
 	}
 
 	var dc []*Deposit
-	for _, d := range rawDepositHistory.DepositList {
+	for _, d := range rawDeposits {
 		t, err := internal.TimeFromUnixTimestampFloat(d.InsertTime)
 		if err != nil {
 			return nil, err
 		}
+		amount, err := internal.FloatFromString(d.Amount)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse Deposit.Amount")
+		}
 		dc = append(dc, &Deposit{
 			InsertTime: t,
-			Amount:     d.Amount,
-			Asset:      d.Asset,
+			Amount:     amount,
+			Asset:      d.Coin,
+			Address:    d.Address,
+			TxID:       d.TxID,
 			Status:     d.Status,
 		})
 	}
 
 	return dc, nil
 }
-func (as *apiService) WithdrawHistory(hr HistoryRequest) ([]*Withdrawal, error) {
-	params := make(map[string]string)
-	params["timestamp"] = strconv.FormatInt(internal.UnixMillis(hr.Timestamp), 10)
-	if hr.Asset != "" {
-		params["asset"] = hr.Asset
-	}
-	if hr.Status != nil {
-		params["status"] = strconv.Itoa(*hr.Status)
-	}
-	if !hr.StartTime.IsZero() {
-		params["startTime"] = strconv.FormatInt(internal.UnixMillis(hr.StartTime), 10)
-	}
-	if !hr.EndTime.IsZero() {
-		params["startTime"] = strconv.FormatInt(internal.UnixMillis(hr.EndTime), 10)
-	}
-	if hr.RecvWindow != 0 {
-		params["internal.RecvWindow"] = strconv.FormatInt(internal.RecvWindow(hr.RecvWindow), 10)
-	}
 
-	res, err := as.request("POST", "wapi/v1/getWithdrawHistory.html", params, true, true)
+func (as *apiService) WithdrawHistory(hr HistoryRequest) ([]*Withdrawal, error) {
+	textRes, err := as.call("GET", "sapi/v1/capital/withdraw/history", historyParams(hr), true, true)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from withdrawHistory.post")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
+	return withdrawalsFromJSON(textRes)
+}
 
-	rawWithdrawHistory := struct {
-		WithdrawList []struct {
-			Amount    float64 `json:"amount"`
-			Address   string  `json:"address"`
-			TxID      string  `json:"txId"`
-			Asset     string  `json:"asset"`
-			ApplyTime float64 `json:"insertTime"`
-			Status    int     `json:"status"`
-		}
-		Success bool `json:"success"`
+// withdrawApplyTimeLayout is layout of UTC apply time of withdrawal.
+const withdrawApplyTimeLayout = "2006-01-02 15:04:05"
+
+func withdrawalsFromJSON(textRes []byte) ([]*Withdrawal, error) {
+	rawWithdrawals := []struct {
+		Amount         string `json:"amount"`
+		TransactionFee string `json:"transactionFee"`
+		Address        string `json:"address"`
+		TxID           string `json:"txId"`
+		Coin           string `json:"coin"`
+		ApplyTime      string `json:"applyTime"`
+		Status         int    `json:"status"`
 	}{}
-	if err := json.Unmarshal(textRes, &rawWithdrawHistory); err != nil {
-		return nil, errors.Wrap(err, "rawWithdrawHistory unmarshal failed")
+	if err := json.Unmarshal(textRes, &rawWithdrawals); err != nil {
+		return nil, errors.Wrap(err, "rawWithdrawals unmarshal failed")
 	}
 
 	var wc []*Withdrawal
-	for _, w := range rawWithdrawHistory.WithdrawList {
-		t, err := internal.TimeFromUnixTimestampFloat(w.ApplyTime)
+	for _, w := range rawWithdrawals {
+		t, err := time.Parse(withdrawApplyTimeLayout, w.ApplyTime)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrap(err, "cannot parse Withdrawal.ApplyTime")
+		}
+		amount, err := internal.FloatFromString(w.Amount)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse Withdrawal.Amount")
+		}
+		fee, err := internal.FloatFromString(w.TransactionFee)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse Withdrawal.TransactionFee")
 		}
 		wc = append(wc, &Withdrawal{
-			Amount:    w.Amount,
-			Address:   w.Address,
-			TxID:      w.TxID,
-			Asset:     w.Asset,
-			ApplyTime: t,
-			Status:    w.Status,
+			Amount:         amount,
+			TransactionFee: fee,
+			Address:        w.Address,
+			TxID:           w.TxID,
+			Asset:          w.Coin,
+			ApplyTime:      t,
+			Status:         w.Status,
 		})
 	}
 
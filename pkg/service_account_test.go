@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewOrder(t *testing.T) {
@@ -174,6 +175,51 @@ func TestMyTrades(t *testing.T) {
 	assert.Equal(t, tc, tc_r)
 }
 
+func TestTradesFromJSON(t *testing.T) {
+	tc, err := tradesFromJSON([]byte(`[
+		{"symbol":"BNBETH","id":1,"orderId":2,"price":"0.5","qty":"2","quoteQty":"1","commission":"0.001","commissionAsset":"BNB","time":1499865549590},
+		{"symbol":"BNBETH","id":2,"orderId":2,"price":"0.5","qty":"4","commission":"0.002","commissionAsset":"BNB","time":1499865549590}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, tc, 2)
+	assert.Equal(t, 1.0, tc[0].QuoteQty)
+	assert.Equal(t, 0.0, tc[1].QuoteQty)
+	assert.Equal(t, 4.0, tc[1].Qty)
+}
+
+func TestDepositsFromJSON(t *testing.T) {
+	dc, err := depositsFromJSON([]byte(`[
+		{"id":"1","amount":"0.00999800","coin":"PAXG","network":"ETH","status":1,"address":"0x788c","addressTag":"",
+			"txId":"0xaad4","insertTime":1599621997000,"transferType":0,"confirmTimes":"12/12"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []*Deposit{{
+		InsertTime: time.Unix(1599621997, 0),
+		Amount:     0.009998,
+		Asset:      "PAXG",
+		Address:    "0x788c",
+		TxID:       "0xaad4",
+		Status:     1,
+	}}, dc)
+}
+
+func TestWithdrawalsFromJSON(t *testing.T) {
+	wc, err := withdrawalsFromJSON([]byte(`[
+		{"id":"b6ae","amount":"8.91000000","transactionFee":"0.004","coin":"USDT","status":6,"address":"0x94df",
+			"txId":"0xb5ef","applyTime":"2019-10-12 11:12:02","network":"ETH","transferType":0}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []*Withdrawal{{
+		Amount:         8.91,
+		TransactionFee: 0.004,
+		Address:        "0x94df",
+		TxID:           "0xb5ef",
+		Asset:          "USDT",
+		ApplyTime:      time.Date(2019, 10, 12, 11, 12, 2, 0, time.UTC),
+		Status:         6,
+	}}, wc)
+}
+
 func TestWithdraw(t *testing.T) {
 	binanceService := &ServiceMock{}
 	b := NewBinance(binanceService)
@@ -0,0 +1,498 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned by Service wrapped with WithBreaker while the
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// WithLogging wraps svc to log every method call with its request, latency
+// and error. Successful calls are logged on debug level, failed on error level.
+func WithLogging(svc Service, logger log.Logger) Service {
+	return &serviceDecorator{
+		next: svc,
+		around: func(method string, args []interface{}, call func() error) error {
+			start := time.Now()
+			err := call()
+			keyvals := []interface{}{"method", method, "took", time.Since(start)}
+			for _, arg := range args {
+				keyvals = append(keyvals, "request", fmt.Sprintf("%+v", redactRequest(arg)))
+			}
+			if err != nil {
+				level.Error(logger).Log(append(keyvals, "err", err)...)
+			} else {
+				level.Debug(logger).Log(keyvals...)
+			}
+			return err
+		},
+	}
+}
+
+// redactRequest returns copy of request struct, or pointer to it, with
+// secret fields replaced the way RedactParams replaces params of the same
+// name. Other values are returned as they are.
+func redactRequest(arg interface{}) interface{} {
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		redacted := reflect.New(v.Elem().Type())
+		redacted.Elem().Set(v.Elem())
+		redactFields(redacted.Elem())
+		return redacted.Interface()
+	}
+	if v.Kind() == reflect.Struct {
+		redacted := reflect.New(v.Type()).Elem()
+		redacted.Set(v)
+		redactFields(redacted)
+		return redacted.Interface()
+	}
+	return arg
+}
+
+func redactFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, field := t.Field(i), v.Field(i)
+		switch {
+		case f.Anonymous && field.Kind() == reflect.Struct:
+			redactFields(field)
+		case field.Kind() == reflect.String && field.CanSet():
+			name := strings.ToLower(f.Name[:1]) + f.Name[1:]
+			if redactedParams[name] {
+				field.SetString("<redacted>")
+			}
+		}
+	}
+}
+
+// MethodObserver receives outcome of every Service method call.
+type MethodObserver interface {
+	ObserveMethod(method string, latency time.Duration, err error)
+}
+
+// WithMetrics wraps svc to report latency and error of every method call to
+// observer.
+func WithMetrics(svc Service, observer MethodObserver) Service {
+	return &serviceDecorator{
+		next: svc,
+		around: func(method string, args []interface{}, call func() error) error {
+			start := time.Now()
+			err := call()
+			observer.ObserveMethod(method, time.Since(start), err)
+			return err
+		},
+	}
+}
+
+// MethodStat holds call statistics of single Service method.
+type MethodStat struct {
+	Calls        int
+	Errors       int
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+}
+
+// MethodStats is in-memory MethodObserver collecting MethodStat per method.
+type MethodStats struct {
+	mu    sync.Mutex
+	stats map[string]MethodStat
+}
+
+// ObserveMethod records single method call.
+func (ms *MethodStats) ObserveMethod(method string, latency time.Duration, err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.stats == nil {
+		ms.stats = make(map[string]MethodStat)
+	}
+	s := ms.stats[method]
+	s.Calls++
+	if err != nil {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	ms.stats[method] = s
+}
+
+// Snapshot returns copy of collected statistics keyed by method name.
+func (ms *MethodStats) Snapshot() map[string]MethodStat {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	snapshot := make(map[string]MethodStat, len(ms.stats))
+	for method, s := range ms.stats {
+		snapshot[method] = s
+	}
+	return snapshot
+}
+
+// BreakerConfig configures circuit breaker of WithBreaker.
+type BreakerConfig struct {
+	// Threshold is number of consecutive failures opening the circuit, 5 by default.
+	Threshold int
+	// CoolDown is time the circuit stays open before a trial call is let
+	// through, 30 seconds by default.
+	CoolDown time.Duration
+	// Methods guarded by the breaker, order endpoints by default.
+	Methods []string
+	// IsFailure decides whether error counts as failure. By default network
+	// errors and Binance errors of server or network issues count, while
+	// rejections like insufficient balance don't, see IsServerFailure.
+	IsFailure func(err error) bool
+	// Now returns current time, time.Now by default.
+	Now func() time.Time
+}
+
+// DefaultBreakerMethods are order methods guarded by breaker by default.
+var DefaultBreakerMethods = []string{
+	"NewOrder", "NewOrderTest", "QueryOrder", "CancelOrder", "OpenOrders", "AllOrders",
+}
+
+// serverFailureCodes are codes of Binance errors caused by server or network
+// issues rather than by the request.
+var serverFailureCodes = map[int]bool{
+	-1000: true, // unknown error
+	-1001: true, // internal error, disconnected
+	-1003: true, // too many requests
+	-1006: true, // unexpected response from message bus
+	-1007: true, // timeout waiting for response from backend
+	-1008: true, // server busy
+}
+
+// IsServerFailure reports whether err is network failure or Binance error of
+// server or network issue, like timeout or too many requests. Errors of
+// invalid requests, e.g. -1013 filter failure or -1021 timestamp outside of
+// recvWindow, aren't server failures.
+func IsServerFailure(err error) bool {
+	if apiErr, ok := errors.Cause(err).(*Error); ok {
+		return serverFailureCodes[apiErr.Code]
+	}
+	return err != nil
+}
+
+// WithBreaker wraps svc with circuit breaker. After Threshold consecutive
+// failures of guarded methods, their calls fail fast with ErrCircuitOpen until
+// CoolDown passes. Then single trial call is let through, closing the circuit
+// on success and opening it again on failure.
+func WithBreaker(svc Service, cfg BreakerConfig) Service {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 5
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+	if cfg.Methods == nil {
+		cfg.Methods = DefaultBreakerMethods
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = IsServerFailure
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	b := &breaker{cfg: cfg, methods: make(map[string]bool)}
+	for _, m := range cfg.Methods {
+		b.methods[m] = true
+	}
+	return &serviceDecorator{
+		next:   svc,
+		around: b.around,
+	}
+}
+
+type breaker struct {
+	cfg     BreakerConfig
+	methods map[string]bool
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) around(method string, args []interface{}, call func() error) error {
+	if !b.methods[method] {
+		return call()
+	}
+
+	b.mu.Lock()
+	if b.failures >= b.cfg.Threshold {
+		if b.trial || b.cfg.Now().Before(b.openUntil) {
+			b.mu.Unlock()
+			return ErrCircuitOpen
+		}
+		b.trial = true
+	}
+	b.mu.Unlock()
+
+	err := call()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err != nil && b.cfg.IsFailure(err) {
+		b.failures++
+		if b.failures >= b.cfg.Threshold {
+			b.openUntil = b.cfg.Now().Add(b.cfg.CoolDown)
+		}
+	} else {
+		b.failures = 0
+	}
+	return err
+}
+
+// serviceDecorator passes every Service method call through around.
+type serviceDecorator struct {
+	next   Service
+	around func(method string, args []interface{}, call func() error) error
+}
+
+func (d *serviceDecorator) withContext(ctx context.Context) Service {
+	c := *d
+	c.next = WithContext(d.next, ctx)
+	return &c
+}
+
+func (d *serviceDecorator) Ping() error {
+	return d.around("Ping", nil, func() error {
+		return d.next.Ping()
+	})
+}
+
+func (d *serviceDecorator) Time() (r time.Time, err error) {
+	err = d.around("Time", nil, func() error {
+		r, err = d.next.Time()
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) OrderBook(obr OrderBookRequest) (r *OrderBook, err error) {
+	err = d.around("OrderBook", []interface{}{obr}, func() error {
+		r, err = d.next.OrderBook(obr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) AggTrades(atr AggTradesRequest) (r []*AggTrade, err error) {
+	err = d.around("AggTrades", []interface{}{atr}, func() error {
+		r, err = d.next.AggTrades(atr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) Klines(kr KlinesRequest) (r []*Kline, err error) {
+	err = d.around("Klines", []interface{}{kr}, func() error {
+		r, err = d.next.Klines(kr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) Ticker24(tr TickerRequest) (r *Ticker24, err error) {
+	err = d.around("Ticker24", []interface{}{tr}, func() error {
+		r, err = d.next.Ticker24(tr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) TickerAllPrices() (r []*PriceTicker, err error) {
+	err = d.around("TickerAllPrices", nil, func() error {
+		r, err = d.next.TickerAllPrices()
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) TickerAllBooks() (r []*BookTicker, err error) {
+	err = d.around("TickerAllBooks", nil, func() error {
+		r, err = d.next.TickerAllBooks()
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) NewOrder(or NewOrderRequest) (r *ProcessedOrder, err error) {
+	err = d.around("NewOrder", []interface{}{or}, func() error {
+		r, err = d.next.NewOrder(or)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) NewOrderTest(or NewOrderRequest) error {
+	return d.around("NewOrderTest", []interface{}{or}, func() error {
+		return d.next.NewOrderTest(or)
+	})
+}
+
+func (d *serviceDecorator) QueryOrder(qor QueryOrderRequest) (r *ExecutedOrder, err error) {
+	err = d.around("QueryOrder", []interface{}{qor}, func() error {
+		r, err = d.next.QueryOrder(qor)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) CancelOrder(cor CancelOrderRequest) (r *CanceledOrder, err error) {
+	err = d.around("CancelOrder", []interface{}{cor}, func() error {
+		r, err = d.next.CancelOrder(cor)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) OpenOrders(oor OpenOrdersRequest) (r []*ExecutedOrder, err error) {
+	err = d.around("OpenOrders", []interface{}{oor}, func() error {
+		r, err = d.next.OpenOrders(oor)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) AllOrders(aor AllOrdersRequest) (r []*ExecutedOrder, err error) {
+	err = d.around("AllOrders", []interface{}{aor}, func() error {
+		r, err = d.next.AllOrders(aor)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) Account(ar AccountRequest) (r *Account, err error) {
+	err = d.around("Account", []interface{}{ar}, func() error {
+		r, err = d.next.Account(ar)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) MyTrades(mtr MyTradesRequest) (r []*Trade, err error) {
+	err = d.around("MyTrades", []interface{}{mtr}, func() error {
+		r, err = d.next.MyTrades(mtr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) Withdraw(wr WithdrawRequest) (r *WithdrawResult, err error) {
+	err = d.around("Withdraw", []interface{}{wr}, func() error {
+		r, err = d.next.Withdraw(wr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) DepositHistory(hr HistoryRequest) (r []*Deposit, err error) {
+	err = d.around("DepositHistory", []interface{}{hr}, func() error {
+		r, err = d.next.DepositHistory(hr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) WithdrawHistory(hr HistoryRequest) (r []*Withdrawal, err error) {
+	err = d.around("WithdrawHistory", []interface{}{hr}, func() error {
+		r, err = d.next.WithdrawHistory(hr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) StartUserDataStream() (r *Stream, err error) {
+	err = d.around("StartUserDataStream", nil, func() error {
+		r, err = d.next.StartUserDataStream()
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) KeepAliveUserDataStream(s *Stream) error {
+	return d.around("KeepAliveUserDataStream", []interface{}{s}, func() error {
+		return d.next.KeepAliveUserDataStream(s)
+	})
+}
+
+func (d *serviceDecorator) CloseUserDataStream(s *Stream) error {
+	return d.around("CloseUserDataStream", []interface{}{s}, func() error {
+		return d.next.CloseUserDataStream(s)
+	})
+}
+
+func (d *serviceDecorator) DepthWebsocket(dwr DepthWebsocketRequest) (r0 chan *DepthEvent, r1 chan struct{}, err error) {
+	err = d.around("DepthWebsocket", []interface{}{dwr}, func() error {
+		r0, r1, err = d.next.DepthWebsocket(dwr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) KlineWebsocket(kwr KlineWebsocketRequest) (r0 chan *KlineEvent, r1 chan struct{}, err error) {
+	err = d.around("KlineWebsocket", []interface{}{kwr}, func() error {
+		r0, r1, err = d.next.KlineWebsocket(kwr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) TradeWebsocket(twr TradeWebsocketRequest) (r0 chan *AggTradeEvent, r1 chan struct{}, err error) {
+	err = d.around("TradeWebsocket", []interface{}{twr}, func() error {
+		r0, r1, err = d.next.TradeWebsocket(twr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) UserDataWebsocket(udwr UserDataWebsocketRequest) (r0 chan UserDataEvent, r1 chan struct{}, err error) {
+	err = d.around("UserDataWebsocket", []interface{}{udwr}, func() error {
+		r0, r1, err = d.next.UserDataWebsocket(udwr)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (r *Subscription, err error) {
+	err = d.around("SubscribeDepth", []interface{}{dwr}, func() error {
+		r, err = d.next.SubscribeDepth(dwr, h)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (r *Subscription, err error) {
+	err = d.around("SubscribeKline", []interface{}{kwr}, func() error {
+		r, err = d.next.SubscribeKline(kwr, h)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (r *Subscription, err error) {
+	err = d.around("SubscribeTrade", []interface{}{twr}, func() error {
+		r, err = d.next.SubscribeTrade(twr, h)
+		return err
+	})
+	return
+}
+
+func (d *serviceDecorator) SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (r *Subscription, err error) {
+	err = d.around("SubscribeUserData", []interface{}{udwr}, func() error {
+		r, err = d.next.SubscribeUserData(udwr, h)
+		return err
+	})
+	return
+}
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLogging(t *testing.T) {
+	binanceService := &ServiceMock{}
+	binanceService.On("CancelOrder", CancelOrderRequest{Symbol: "BNBBTC", OrderID: 1}).
+		Return(nil, &Error{Code: -2011, Message: "Unknown order sent."})
+
+	var logs bytes.Buffer
+	b := NewBinance(WithLogging(binanceService, log.NewLogfmtLogger(&logs)))
+	_, err := b.CancelOrder(CancelOrderRequest{Symbol: "BNBBTC", OrderID: 1})
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "method=CancelOrder")
+	assert.Contains(t, logs.String(), "Symbol:BNBBTC")
+	assert.Contains(t, logs.String(), `err="-2011: Unknown order sent."`)
+
+	binanceService.On("KeepAliveUserDataStream", &Stream{ListenKey: "secret-key"}).Return(nil)
+	binanceService.On("UserDataWebsocket", UserDataWebsocketRequest{ListenKey: "secret-key"}).
+		Return(nil, nil, errors.New("connection refused"))
+	assert.NoError(t, b.KeepAliveUserDataStream(&Stream{ListenKey: "secret-key"}))
+	_, _, err = b.UserDataWebsocket(UserDataWebsocketRequest{ListenKey: "secret-key"})
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "ListenKey:<redacted>")
+	assert.NotContains(t, logs.String(), "secret-key")
+}
+
+func TestIsServerFailure(t *testing.T) {
+	assert.True(t, IsServerFailure(errors.New("i/o timeout")))
+	assert.True(t, IsServerFailure(&Error{Code: -1001, Message: "Internal error; unable to process your request. Please try again."}))
+	assert.True(t, IsServerFailure(errors.Wrap(&Error{Code: -1003, Message: "Too many requests."}, "unable to place order")))
+	assert.False(t, IsServerFailure(&Error{Code: -1013, Message: "Filter failure: LOT_SIZE"}))
+	assert.False(t, IsServerFailure(&Error{Code: -1021, Message: "Timestamp for this request is outside of the recvWindow."}))
+	assert.False(t, IsServerFailure(&Error{Code: -1022, Message: "Signature for this request is not valid."}))
+	assert.False(t, IsServerFailure(nil))
+}
+
+func TestWithMetrics(t *testing.T) {
+	binanceService := &ServiceMock{}
+	binanceService.On("Ping").Return(nil).Once()
+	binanceService.On("Ping").Return(errors.New("connection reset")).Once()
+
+	stats := &MethodStats{}
+	svc := WithMetrics(binanceService, stats)
+	assert.NoError(t, svc.Ping())
+	assert.Error(t, svc.Ping())
+
+	s := stats.Snapshot()["Ping"]
+	assert.Equal(t, 2, s.Calls)
+	assert.Equal(t, 1, s.Errors)
+}
+
+func TestWithBreaker(t *testing.T) {
+	now := time.Unix(1499827319, 0)
+	nor := NewOrderRequest{Symbol: "BNBBTC"}
+	binanceService := &ServiceMock{}
+	binanceService.On("NewOrder", nor).Return(nil, errors.New("i/o timeout")).Times(3)
+	binanceService.On("Ping").Return(errors.New("i/o timeout"))
+
+	stats := &MethodStats{}
+	svc := WithMetrics(WithBreaker(binanceService, BreakerConfig{
+		Threshold: 2,
+		CoolDown:  time.Minute,
+		Now:       func() time.Time { return now },
+	}), stats)
+
+	// unguarded methods don't affect the circuit
+	assert.Error(t, svc.Ping())
+	assert.Error(t, svc.Ping())
+
+	_, err := svc.NewOrder(nor)
+	assert.EqualError(t, err, "i/o timeout")
+	_, err = svc.NewOrder(nor)
+	assert.EqualError(t, err, "i/o timeout")
+	_, err = svc.NewOrder(nor)
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// trial call after cool-down fails and opens the circuit again
+	now = now.Add(time.Minute)
+	_, err = svc.NewOrder(nor)
+	assert.EqualError(t, err, "i/o timeout")
+	_, err = svc.NewOrder(nor)
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	// successful trial closes the circuit
+	now = now.Add(time.Minute)
+	po := &ProcessedOrder{Symbol: "BNBBTC", OrderID: 1}
+	binanceService.On("NewOrder", nor).Return(po, nil)
+	po_r, err := svc.NewOrder(nor)
+	assert.NoError(t, err)
+	assert.Equal(t, po, po_r)
+	_, err = svc.NewOrder(nor)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 7, stats.Snapshot()["NewOrder"].Calls)
+	binanceService.AssertNumberOfCalls(t, "NewOrder", 5)
+}
+
+func TestWithBreakerIgnoresRejections(t *testing.T) {
+	nor := NewOrderRequest{Symbol: "BNBBTC"}
+	binanceService := &ServiceMock{}
+	binanceService.On("NewOrder", nor).Return(nil, &Error{Code: -2010, Message: "Account has insufficient balance for requested action."})
+
+	svc := WithBreaker(binanceService, BreakerConfig{Threshold: 1})
+	for i := 0; i < 3; i++ {
+		_, err := svc.NewOrder(nor)
+		assert.IsType(t, &Error{}, err)
+	}
+}
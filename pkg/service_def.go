@@ -7,74 +7,251 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
+type apiService struct {
+	URL           string
+	StreamURL     string
+	WSAPIURL      string
+	APIKey        string
+	Signer        Signer
+	ContextSigner ContextSigner
+	Logger        log.Logger
+	Ctx           context.Context
+	HTTPClient    *http.Client
+	Middlewares   []Middleware
+	// StreamObserver, if set, is notified about websocket stream activity.
+	StreamObserver StreamObserver
+	StreamDialer   StreamDialer
+
+	roundTrip RoundTripper
+}
 
+// APIServiceOption configures optional behaviour of Service created by NewAPIService.
+type APIServiceOption func(*apiService)
 
-type apiService struct {
-	URL    string
-	APIKey string
-	Signer Signer
-	Logger log.Logger
-	Ctx    context.Context
+// WithContextSigner makes Service sign requests with cs instead of Signer,
+// e.g. when the secret is held by external signing daemon.
+func WithContextSigner(cs ContextSigner) APIServiceOption {
+	return func(as *apiService) {
+		as.ContextSigner = cs
+	}
+}
+
+// WithStreamURL makes Service connect websocket streams to url instead of
+// Binance production streams.
+func WithStreamURL(url string) APIServiceOption {
+	return func(as *apiService) {
+		as.StreamURL = url
+	}
+}
+
+// WithHTTPClient makes Service send REST requests with client.
+func WithHTTPClient(client *http.Client) APIServiceOption {
+	return func(as *apiService) {
+		as.HTTPClient = client
+	}
 }
 
 // NewAPIService creates instance of Service.
 //
 // If logger or ctx are not provided, NopLogger and Background context are used as default.
 // You can use context for one-time request cancel (e.g. when shutting down the app).
-func NewAPIService(url, apiKey string, signer Signer, logger log.Logger, ctx context.Context) Service {
+func NewAPIService(url, apiKey string, signer Signer, logger log.Logger, ctx context.Context, opts ...APIServiceOption) Service {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	return &apiService{
-		URL:    url,
-		APIKey: apiKey,
-		Signer: signer,
-		Logger: logger,
-		Ctx:    ctx,
+	as := &apiService{
+		URL:       url,
+		StreamURL: Production.StreamURL,
+		WSAPIURL:  Production.WSAPIURL,
+		APIKey:    apiKey,
+		Signer:    signer,
+		Logger:    logger,
+		Ctx:       ctx,
+	}
+	for _, opt := range opts {
+		opt(as)
+	}
+	if as.HTTPClient == nil {
+		as.HTTPClient = &http.Client{}
+	}
+	if as.StreamDialer == nil {
+		as.StreamDialer = dialStream
 	}
+	as.roundTrip = chain(as.send, as.Middlewares)
+	return as
 }
 
-func (as *apiService) request(method string, endpoint string, params map[string]string,
+// contextBinder is implemented by services supporting WithContext.
+type contextBinder interface {
+	withContext(ctx context.Context) Service
+}
+
+// WithContext returns svc bound to ctx. REST requests are cancelled with ctx
+// and pass its values (e.g. trace span) to middlewares, streams are closed
+// when ctx is done. Services other than those created by NewAPIService and
+// decorators wrapping them are returned unchanged.
+func WithContext(svc Service, ctx context.Context) Service {
+	if cb, ok := svc.(contextBinder); ok {
+		return cb.withContext(ctx)
+	}
+	return svc
+}
+
+func (as *apiService) withContext(ctx context.Context) Service {
+	c := *as
+	c.Ctx = ctx
+	return &c
+}
+
+// request sends params in query string of GET requests and as
+// application/x-www-form-urlencoded body otherwise, so that they don't end up
+// in access logs. Signature is computed over totalParams, i.e. query string
+// concatenated with body, and appended to the part carrying params.
+func (as *apiService) request(ctx context.Context, method string, endpoint string, params map[string]string,
 	apiKey bool, sign bool) (*http.Response, error) {
-	transport := &http.Transport{}
-	client := &http.Client{
-		Transport: transport,
+	var query, body string
+	if method == "GET" {
+		query = encodeParams(params)
+	} else {
+		body = encodeParams(params)
+	}
+	if sign {
+		// Base64 encoded signatures of Ed25519 and RSA keys need escaping.
+		signature, err := as.sign(ctx, method, endpoint, query+body)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to sign request")
+		}
+		level.Debug(as.Logger).Log("totalParams", query+body, "signature", signature)
+		if method == "GET" {
+			query = joinParams(query, "signature="+url.QueryEscape(signature))
+		} else {
+			body = joinParams(body, "signature="+url.QueryEscape(signature))
+		}
 	}
 
-	url := fmt.Sprintf("%s/%s", as.URL, endpoint)
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", as.URL, endpoint), strings.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create request")
 	}
-	req.WithContext(as.Ctx)
-
-	q := req.URL.Query()
-	for key, val := range params {
-		q.Add(key, val)
+	req.URL.RawQuery = query
+	if body != "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
 	if apiKey {
 		req.Header.Add("X-MBX-APIKEY", as.APIKey)
 	}
-	if sign {
-		level.Debug(as.Logger).Log("queryString", q.Encode())
-		q.Add("signature", as.Signer.Sign([]byte(q.Encode())))
-		level.Debug(as.Logger).Log("signature", as.Signer.Sign([]byte(q.Encode())))
-	}
-	req.URL.RawQuery = q.Encode()
 
-	resp, err := client.Do(req)
+	resp, err := as.HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
+// encodeParams URL encodes params ordered by name, so that the same params
+// always produce the same string.
+func encodeParams(params map[string]string) string {
+	q := url.Values{}
+	for key, val := range params {
+		q.Set(key, val)
+	}
+	return q.Encode()
+}
+
+// listParams are array parameters of newer endpoints. Their values are
+// encoded by listParam.
+var listParams = map[string]bool{
+	"permissions": true,
+	"symbols":     true,
+}
+
+// listParam is value of array parameter, e.g. symbols=["BNBBTC","ETHBTC"].
+// REST requests carry it as JSON list string, WebSocket API requests as JSON
+// array.
+type listParam []string
+
+// String encodes l as JSON list.
+func (l listParam) String() string {
+	if l == nil {
+		l = listParam{}
+	}
+	b, _ := json.Marshal([]string(l))
+	return string(b)
+}
+
+func joinParams(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "&" + b
+}
+
+// sign returns signature of payload using ContextSigner if configured.
+func (as *apiService) sign(ctx context.Context, method, endpoint, payload string) (string, error) {
+	var cs ContextSigner = &LocalSigner{Signer: as.Signer}
+	if as.ContextSigner != nil {
+		cs = as.ContextSigner
+	}
+	return cs.SignContext(ctx, SignRequest{
+		Method:   method,
+		Endpoint: endpoint,
+		Payload:  payload,
+	})
+}
+
+// call passes request through middlewares and returns body of successful
+// response. Error responses are returned as *Error.
+func (as *apiService) call(method string, endpoint string, params map[string]string,
+	apiKey bool, sign bool) ([]byte, error) {
+	res, err := as.roundTrip(&APIRequest{
+		Ctx:      as.Ctx,
+		Method:   method,
+		Endpoint: endpoint,
+		Params:   params,
+		Weight:   endpointWeight(method, endpoint, params),
+		APIKey:   apiKey,
+		Signed:   sign,
+	})
+	if err != nil {
+		return nil, err
+	}
+	storeResponseMeta(as.Ctx, res)
+	if res.StatusCode != 200 {
+		return nil, as.handleError(res.Body)
+	}
+	return res.Body, nil
+}
+
+// send is the innermost RoundTripper executing request.
+func (as *apiService) send(req *APIRequest) (*APIResponse, error) {
+	start := time.Now()
+	res, err := as.request(req.Ctx, req.Method, req.Endpoint, req.Params, req.APIKey, req.Signed)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	textRes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read response from %s %s", req.Method, req.Endpoint)
+	}
+	return &APIResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       textRes,
+		Latency:    time.Since(start),
+	}, nil
+}
+
 func (as *apiService) handleError(textRes []byte) error {
 	err := &Error{}
 	level.Info(as.Logger).Log("errorResponse", textRes)
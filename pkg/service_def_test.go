@@ -3,6 +3,16 @@ package pkg
 import (
 	"testing"
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestErrorHandler(t *testing.T) {
@@ -19,3 +29,148 @@ func TestErrorHandler(t *testing.T) {
 		t.Errorf("invalid error message extracted")
 	}
 }
+
+func TestSignedRequestEd25519(t *testing.T) {
+	signer, err := NewEd25519SignerFromPEM([]byte(ed25519TestKey))
+	require.NoError(t, err)
+	pub := signer.Key.Public().(ed25519.PublicKey)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := strings.LastIndex(r.URL.RawQuery, "&signature=")
+		require.True(t, i > 0, "missing signature: %s", r.URL.RawQuery)
+		sig, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("signature"))
+		require.NoError(t, err)
+		assert.True(t, ed25519.Verify(pub, []byte(r.URL.RawQuery[:i]), sig))
+		assert.Equal(t, "api-key", r.Header.Get("X-MBX-APIKEY"))
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	as := NewAPIService(srv.URL, "api-key", signer, nil, context.Background()).(*apiService)
+	_, err = as.call("GET", "api/v3/account", map[string]string{"timestamp": "1499827319559"}, true, true)
+	assert.NoError(t, err)
+}
+
+func TestSignedPostBody(t *testing.T) {
+	signer := &HmacSigner{
+		Key: []byte("NhqPtmdSJYdKjVHjA7PZj4Mge3R5YNiP1e3UZjInClVN65XAbvqqM6A7H5fATj0j"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		assert.Empty(t, r.URL.RawQuery)
+		assert.Equal(t, "price=0.1&quantity=1&recvWindow=5000&side=BUY&symbol=LTCBTC&timeInForce=GTC&timestamp=1499827319559&type=LIMIT"+
+			"&signature=70fd30433bc3a2e3b5ff17d075e50538dde3734841da6dc28d79113dd37fa9c7", string(body))
+		w.Write([]byte(`{"symbol":"LTCBTC","orderId":1,"clientOrderId":"a","transactTime":1499827319559}`))
+	}))
+	defer srv.Close()
+
+	as := NewAPIService(srv.URL, "api-key", signer, nil, context.Background()).(*apiService)
+	_, err := as.call("POST", "api/v3/order", map[string]string{
+		"symbol":      "LTCBTC",
+		"side":        "BUY",
+		"type":        "LIMIT",
+		"timeInForce": "GTC",
+		"quantity":    "1",
+		"price":       "0.1",
+		"recvWindow":  "5000",
+		"timestamp":   "1499827319559",
+	}, true, true)
+	assert.NoError(t, err)
+}
+
+func TestEncodeParams(t *testing.T) {
+	assert.Equal(t, "a=1&b=2&symbols=%5B%22BNBBTC%22%2C%22ETHBTC%22%5D", encodeParams(map[string]string{
+		"symbols": listParam{"BNBBTC", "ETHBTC"}.String(),
+		"b":       "2",
+		"a":       "1",
+	}))
+	assert.Equal(t, "a=1&b=2&newClientOrderId=%5Bid%5D", encodeParams(map[string]string{
+		"newClientOrderId": "[id]",
+		"b":                "2",
+		"a":                "1",
+	}))
+	assert.Equal(t, "[]", listParam(nil).String())
+}
+
+func TestSignedListParam(t *testing.T) {
+	signer := &HmacSigner{Key: []byte("secret")}
+	payload := "symbols=%5B%22BNBBTC%22%2C%22ETHBTC%22%5D&timestamp=1499827319559"
+	for _, method := range []string{"GET", "POST"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			params := r.URL.RawQuery
+			if method == "POST" {
+				params = string(body)
+			}
+			assert.Equal(t, payload+"&signature="+signer.Sign([]byte(payload)), params)
+			values, err := url.ParseQuery(params)
+			require.NoError(t, err)
+			assert.Equal(t, `["BNBBTC","ETHBTC"]`, values.Get("symbols"))
+			w.Write([]byte(`{}`))
+		}))
+		as := NewAPIService(srv.URL, "api-key", signer, nil, context.Background()).(*apiService)
+		_, err := as.call(method, "api/v3/test", map[string]string{
+			"symbols":   listParam{"BNBBTC", "ETHBTC"}.String(),
+			"timestamp": "1499827319559",
+		}, true, true)
+		assert.NoError(t, err)
+		srv.Close()
+	}
+}
+
+func TestEndpointVersions(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v3/time":
+			w.Write([]byte(`{"serverTime":1499827319559}`))
+		case "/api/v3/depth":
+			w.Write([]byte(`{"lastUpdateId":1,"bids":[],"asks":[]}`))
+		case "/api/v3/userDataStream":
+			w.Write([]byte(`{"listenKey":"key"}`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+
+	service := NewAPIService(srv.URL, "", nil, nil, context.Background())
+	require.NoError(t, service.Ping())
+	_, err := service.Time()
+	require.NoError(t, err)
+	_, err = service.OrderBook(OrderBookRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	_, err = service.AggTrades(AggTradesRequest{Symbol: "BNBBTC"})
+	require.NoError(t, err)
+	_, err = service.Klines(KlinesRequest{Symbol: "BNBBTC", Interval: Hour})
+	require.NoError(t, err)
+	// Only path matters, empty ticker isn't parsed.
+	service.Ticker24(TickerRequest{Symbol: "BNBBTC"})
+	_, err = service.TickerAllPrices()
+	require.NoError(t, err)
+	_, err = service.TickerAllBooks()
+	require.NoError(t, err)
+	s, err := service.StartUserDataStream()
+	require.NoError(t, err)
+	require.NoError(t, service.KeepAliveUserDataStream(s))
+	require.NoError(t, service.CloseUserDataStream(s))
+
+	assert.Equal(t, []string{
+		"GET /api/v3/ping",
+		"GET /api/v3/time",
+		"GET /api/v3/depth",
+		"GET /api/v3/aggTrades",
+		"GET /api/v3/klines",
+		"GET /api/v3/ticker/24hr",
+		"GET /api/v3/ticker/price",
+		"GET /api/v3/ticker/bookTicker",
+		"POST /api/v3/userDataStream",
+		"PUT /api/v3/userDataStream",
+		"DELETE /api/v3/userDataStream",
+	}, paths)
+}
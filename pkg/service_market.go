@@ -2,9 +2,7 @@ package pkg
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/retirero/go-binance/internal"
-	"io/ioutil"
 	"strconv"
 	"time"
 
@@ -13,103 +11,101 @@ import (
 
 func (as *apiService) Ping() error {
 	params := make(map[string]string)
-	response, err := as.request("GET", "api/v1/ping", params, false, false)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("%#v\n", response.StatusCode)
-	return nil
+	_, err := as.call("GET", "api/v3/ping", params, false, false)
+	return err
 }
 
 func (as *apiService) Time() (time.Time, error) {
 	params := make(map[string]string)
-	res, err := as.request("GET", "api/v1/time", params, false, false)
+	textRes, err := as.call("GET", "api/v3/time", params, false, false)
 	if err != nil {
 		return time.Time{}, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return time.Time{}, errors.Wrap(err, "unable to read response from Time")
-	}
-	defer res.Body.Close()
+	return timeFromJSON(textRes)
+}
+
+func timeFromJSON(textRes []byte) (time.Time, error) {
 	var rawTime struct {
-		ServerTime string `json:"serverTime"`
+		ServerTime float64 `json:"serverTime"`
 	}
 	if err := json.Unmarshal(textRes, &rawTime); err != nil {
 		return time.Time{}, errors.Wrap(err, "timeResponse unmarshal failed")
 	}
-	t, err := internal.TimeFromUnixTimestampFloat(rawTime)
+	return internal.TimeFromUnixTimestampFloat(rawTime.ServerTime)
+}
+
+func (as *apiService) OrderBook(obr OrderBookRequest) (*OrderBook, error) {
+	textRes, err := as.call("GET", "api/v3/depth", orderBookParams(obr), false, false)
 	if err != nil {
-		return time.Time{}, err
+		return nil, err
 	}
-	return t, nil
+	return orderBookFromJSON(textRes)
 }
 
-func (as *apiService) OrderBook(obr OrderBookRequest) (*OrderBook, error) {
+func orderBookParams(obr OrderBookRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = obr.Symbol
 	if obr.Limit != 0 {
 		params["limit"] = strconv.Itoa(obr.Limit)
 	}
-	res, err := as.request("GET", "api/v1/depth", params, false, false)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Time")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		as.handleError(textRes)
-	}
+	return params
+}
 
+func orderBookFromJSON(textRes []byte) (*OrderBook, error) {
 	rawBook := &struct {
 		LastUpdateID int        `json:"lastUpdateId"`
 		Bids         [][]string `json:"bids"`
 		Asks         [][]string `json:"asks"`
 	}{}
 	if err := json.Unmarshal(textRes, rawBook); err != nil {
-		return nil, errors.Wrap(err, "timeResponse unmarshal failed")
+		return nil, errors.Wrap(err, "rawBook unmarshal failed")
 	}
 
 	ob := &OrderBook{
 		LastUpdateID: rawBook.LastUpdateID,
 	}
-	extractOrder := func(rawPrice, rawQuantity string) (*Order, error) {
-		price, err := internal.FloatFromString(rawPrice)
+	var err error
+	if ob.Bids, err = ordersFromRaw(rawBook.Bids); err != nil {
+		return nil, err
+	}
+	if ob.Asks, err = ordersFromRaw(rawBook.Asks); err != nil {
+		return nil, err
+	}
+
+	return ob, nil
+}
+
+func ordersFromRaw(rawOrders [][]string) ([]*Order, error) {
+	var orders []*Order
+	for _, ro := range rawOrders {
+		if len(ro) < 2 {
+			return nil, errors.New("invalid price level")
+		}
+		price, err := internal.FloatFromString(ro[0])
 		if err != nil {
 			return nil, err
 		}
-		quantity, err := internal.FloatFromString(rawQuantity)
+		quantity, err := internal.FloatFromString(ro[1])
 		if err != nil {
 			return nil, err
 		}
-		return &Order{
+		orders = append(orders, &Order{
 			Price:    price,
 			Quantity: quantity,
-		}, nil
-	}
-	for _, bid := range rawBook.Bids {
-		order, err := extractOrder(bid[0], bid[1])
-		if err != nil {
-			return nil, err
-		}
-		ob.Bids = append(ob.Bids, order)
-	}
-	for _, ask := range rawBook.Asks {
-		order, err := extractOrder(ask[0], ask[1])
-		if err != nil {
-			return nil, err
-		}
-		ob.Asks = append(ob.Asks, order)
+		})
 	}
-
-	return ob, nil
+	return orders, nil
 }
 
 func (as *apiService) AggTrades(atr AggTradesRequest) ([]*AggTrade, error) {
+	textRes, err := as.call("GET", "api/v3/aggTrades", aggTradesParams(atr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return aggTradesFromJSON(textRes)
+}
+
+func aggTradesParams(atr AggTradesRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = atr.Symbol
 	if atr.FromID != 0 {
@@ -124,21 +120,10 @@ func (as *apiService) AggTrades(atr AggTradesRequest) ([]*AggTrade, error) {
 	if atr.Limit != 0 {
 		params["limit"] = strconv.Itoa(atr.Limit)
 	}
+	return params
+}
 
-	res, err := as.request("GET", "api/v1/aggTrades", params, false, false)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from AggTrades")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		as.handleError(textRes)
-	}
-
+func aggTradesFromJSON(textRes []byte) ([]*AggTrade, error) {
 	rawAggTrades := []struct {
 		ID             int    `json:"a"`
 		Price          string `json:"p"`
@@ -179,6 +164,14 @@ func (as *apiService) AggTrades(atr AggTradesRequest) ([]*AggTrade, error) {
 }
 
 func (as *apiService) Klines(kr KlinesRequest) ([]*Kline, error) {
+	textRes, err := as.call("GET", "api/v3/klines", klinesParams(kr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return klinesFromJSON(textRes)
+}
+
+func klinesParams(kr KlinesRequest) map[string]string {
 	params := make(map[string]string)
 	params["symbol"] = kr.Symbol
 	params["interval"] = string(kr.Interval)
@@ -191,27 +184,19 @@ func (as *apiService) Klines(kr KlinesRequest) ([]*Kline, error) {
 	if kr.EndTime != 0 {
 		params["endTime"] = strconv.FormatInt(kr.EndTime, 10)
 	}
+	return params
+}
 
-	res, err := as.request("GET", "api/v1/klines", params, false, false)
-	if err != nil {
-		return nil, err
-	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Klines")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		as.handleError(textRes)
-	}
-
+func klinesFromJSON(textRes []byte) ([]*Kline, error) {
 	rawKlines := [][]interface{}{}
 	if err := json.Unmarshal(textRes, &rawKlines); err != nil {
 		return nil, errors.Wrap(err, "rawKlines unmarshal failed")
 	}
 	klines := []*Kline{}
 	for _, k := range rawKlines {
+		if len(k) < 11 {
+			return nil, errors.New("cannot parse Kline, too few values")
+		}
 		ot, err := internal.TimeFromUnixTimestampFloat(k[0])
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot parse Kline.OpenTime")
@@ -246,7 +231,7 @@ func (as *apiService) Klines(kr KlinesRequest) ([]*Kline, error) {
 		}
 		not, ok := k[8].(float64)
 		if !ok {
-			return nil, errors.Wrap(err, "cannot parse Kline.NumberOfTrades")
+			return nil, errors.New("cannot parse Kline.NumberOfTrades")
 		}
 		tbbav, err := internal.FloatFromString(k[9].(string))
 		if err != nil {
@@ -274,23 +259,20 @@ func (as *apiService) Klines(kr KlinesRequest) ([]*Kline, error) {
 }
 
 func (as *apiService) Ticker24(tr TickerRequest) (*Ticker24, error) {
-	params := make(map[string]string)
-	params["symbol"] = tr.Symbol
-
-	res, err := as.request("GET", "api/v1/ticker/24hr", params, false, false)
+	textRes, err := as.call("GET", "api/v3/ticker/24hr", tickerParams(tr), false, false)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Ticker/24hr")
-	}
-	defer res.Body.Close()
+	return ticker24FromJSON(textRes)
+}
 
-	if res.StatusCode != 200 {
-		as.handleError(textRes)
-	}
+func tickerParams(tr TickerRequest) map[string]string {
+	params := make(map[string]string)
+	params["symbol"] = tr.Symbol
+	return params
+}
 
+func ticker24FromJSON(textRes []byte) (*Ticker24, error) {
 	rawTicker24 := struct {
 		PriceChange        string  `json:"priceChange"`
 		PriceChangePercent string  `json:"priceChangePercent"`
@@ -388,21 +370,14 @@ func (as *apiService) Ticker24(tr TickerRequest) (*Ticker24, error) {
 
 func (as *apiService) TickerAllPrices() ([]*PriceTicker, error) {
 	params := make(map[string]string)
-
-	res, err := as.request("GET", "api/v1/ticker/allPrices", params, false, false)
+	textRes, err := as.call("GET", "api/v3/ticker/price", params, false, false)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Ticker/24hr")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		as.handleError(textRes)
-	}
+	return priceTickersFromJSON(textRes)
+}
 
+func priceTickersFromJSON(textRes []byte) ([]*PriceTicker, error) {
 	rawTickerAllPrices := []struct {
 		Symbol string `json:"symbol"`
 		Price  string `json:"price"`
@@ -427,21 +402,14 @@ func (as *apiService) TickerAllPrices() ([]*PriceTicker, error) {
 
 func (as *apiService) TickerAllBooks() ([]*BookTicker, error) {
 	params := make(map[string]string)
-
-	res, err := as.request("GET", "api/v1/ticker/allBookTickers", params, false, false)
+	textRes, err := as.call("GET", "api/v3/ticker/bookTicker", params, false, false)
 	if err != nil {
 		return nil, err
 	}
-	textRes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response from Ticker/allBookTickers")
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, as.handleError(textRes)
-	}
+	return bookTickersFromJSON(textRes)
+}
 
+func bookTickersFromJSON(textRes []byte) ([]*BookTicker, error) {
 	rawBookTickers := []struct {
 		Symbol   string `json:"symbol"`
 		BidPrice string `json:"bidPrice"`
@@ -1,418 +1,705 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/retirero/go-binance/internal"
-	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log/level"
-	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
 )
 
 func (as *apiService) DepthWebsocket(dwr DepthWebsocketRequest) (chan *DepthEvent, chan struct{}, error) {
-	url := fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@depth", strings.ToLower(dwr.Symbol))
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	dech := make(chan *DepthEvent)
+	gate := newSubscriptionGate()
+	sub, err := as.SubscribeDepth(dwr, StreamHandler{
+		OnDepth: func(de *DepthEvent) {
+			select {
+			case dech <- de:
+			case <-gate.closing():
+			}
+		},
+	})
 	if err != nil {
-		log.Fatal("dial:", err)
+		return nil, nil, err
 	}
+	gate.open(sub)
+	return dech, sub.done, nil
+}
 
-	done := make(chan struct{})
-	dech := make(chan *DepthEvent)
-
-	go func() {
-		defer c.Close()
-		defer close(done)
-		for {
-			select {
-			case <-as.Ctx.Done():
-				level.Info(as.Logger).Log("closing reader")
-				return
-			default:
-				_, message, err := c.ReadMessage()
-				if err != nil {
-					level.Error(as.Logger).Log("wsRead", err)
-					return
-				}
-				rawDepth := struct {
-					Type          string     `json:"e"`
-					Time          float64    `json:"E"`
-					Symbol        string     `json:"s"`
-					UpdateID      int        `json:"u"`
-					BidDepthDelta [][]string `json:"b"`
-					AskDepthDelta [][]string `json:"a"`
-				}{}
-				if err := json.Unmarshal(message, &rawDepth); err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-					return
-				}
-				t, err := internal.TimeFromUnixTimestampFloat(rawDepth.Time)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-					return
-				}
-				de := &DepthEvent{
-					WSEvent: WSEvent{
-						Type:   rawDepth.Type,
-						Time:   t,
-						Symbol: rawDepth.Symbol,
-					},
-					UpdateID: rawDepth.UpdateID,
-				}
-				for _, b := range rawDepth.BidDepthDelta {
-					p, err := internal.FloatFromString(b[0])
-					if err != nil {
-						level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-						return
-					}
-					q, err := internal.FloatFromString(b[1])
-					if err != nil {
-						level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-						return
-					}
-					de.Bids = append(de.Bids, &Order{
-						Price:    p,
-						Quantity: q,
-					})
-				}
-				dech <- de
+func (as *apiService) SubscribeDepth(dwr DepthWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	if dwr.Level == 0 && dwr.Overflow == OverflowCoalesce {
+		return nil, errors.New("diff depth updates can't be coalesced")
+	}
+	name, err := depthStreamName(dwr)
+	if err != nil {
+		return nil, err
+	}
+	return as.subscribe(name, name, dwr.StreamOptions, h,
+		func(message []byte) (string, interface{}, error) {
+			de, err := depthEventFromMessage(dwr, message)
+			if err != nil {
+				return "", nil, err
 			}
-		}
-	}()
+			if dwr.Level == 0 {
+				return "", de, nil
+			}
+			return de.Symbol, de, nil
+		},
+		func(event interface{}) {
+			if h.OnDepth != nil {
+				h.OnDepth(event.(*DepthEvent))
+			}
+		})
+}
 
-	go as.exitHandler(c, done)
-	return dech, done, nil
+func depthStreamName(dwr DepthWebsocketRequest) (string, error) {
+	name := fmt.Sprintf("%s@depth", strings.ToLower(dwr.Symbol))
+	switch dwr.Level {
+	case 0:
+	case 5, 10, 20:
+		name += strconv.Itoa(dwr.Level)
+	default:
+		return "", errors.Errorf("unsupported depth level %d", dwr.Level)
+	}
+	switch dwr.UpdateSpeed {
+	case 0, time.Second:
+	case 100 * time.Millisecond:
+		name += "@100ms"
+	default:
+		return "", errors.Errorf("unsupported depth update speed %s", dwr.UpdateSpeed)
+	}
+	return name, nil
 }
 
-func (as *apiService) KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, chan struct{}, error) {
-	url := fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@kline_%s", strings.ToLower(kwr.Symbol), string(kwr.Interval))
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+func depthEventFromMessage(dwr DepthWebsocketRequest, message []byte) (*DepthEvent, error) {
+	if dwr.Level != 0 {
+		rawBook := struct {
+			LastUpdateID int        `json:"lastUpdateId"`
+			Bids         [][]string `json:"bids"`
+			Asks         [][]string `json:"asks"`
+		}{}
+		if err := json.Unmarshal(message, &rawBook); err != nil {
+			return nil, errors.Wrap(err, "rawBook unmarshal failed")
+		}
+		de := &DepthEvent{
+			WSEvent: WSEvent{
+				Type:   "depth",
+				Symbol: strings.ToUpper(dwr.Symbol),
+			},
+			FirstUpdateID: rawBook.LastUpdateID,
+			FinalUpdateID: rawBook.LastUpdateID,
+			OrderBook: OrderBook{
+				LastUpdateID: rawBook.LastUpdateID,
+			},
+		}
+		var err error
+		if de.Bids, err = ordersFromRaw(rawBook.Bids); err != nil {
+			return nil, err
+		}
+		if de.Asks, err = ordersFromRaw(rawBook.Asks); err != nil {
+			return nil, err
+		}
+		return de, nil
+	}
+
+	rawDepth := struct {
+		Type          string     `json:"e"`
+		Time          float64    `json:"E"`
+		Symbol        string     `json:"s"`
+		FirstUpdateID int        `json:"U"`
+		FinalUpdateID int        `json:"u"`
+		BidDepthDelta [][]string `json:"b"`
+		AskDepthDelta [][]string `json:"a"`
+	}{}
+	if err := json.Unmarshal(message, &rawDepth); err != nil {
+		return nil, errors.Wrap(err, "rawDepth unmarshal failed")
+	}
+	t, err := internal.TimeFromUnixTimestampFloat(rawDepth.Time)
 	if err != nil {
-		log.Fatal("dial:", err)
+		return nil, err
 	}
+	de := &DepthEvent{
+		WSEvent: WSEvent{
+			Type:   rawDepth.Type,
+			Time:   t,
+			Symbol: rawDepth.Symbol,
+		},
+		FirstUpdateID: rawDepth.FirstUpdateID,
+		FinalUpdateID: rawDepth.FinalUpdateID,
+		OrderBook: OrderBook{
+			LastUpdateID: rawDepth.FinalUpdateID,
+		},
+	}
+	if de.Bids, err = ordersFromRaw(rawDepth.BidDepthDelta); err != nil {
+		return nil, err
+	}
+	if de.Asks, err = ordersFromRaw(rawDepth.AskDepthDelta); err != nil {
+		return nil, err
+	}
+	return de, nil
+}
 
-	done := make(chan struct{})
+func (as *apiService) KlineWebsocket(kwr KlineWebsocketRequest) (chan *KlineEvent, chan struct{}, error) {
 	kech := make(chan *KlineEvent)
-
-	go func() {
-		defer c.Close()
-		defer close(done)
-		for {
+	gate := newSubscriptionGate()
+	sub, err := as.SubscribeKline(kwr, StreamHandler{
+		OnKline: func(ke *KlineEvent) {
 			select {
-			case <-as.Ctx.Done():
-				level.Info(as.Logger).Log("closing reader")
-				return
-			default:
-				_, message, err := c.ReadMessage()
-				if err != nil {
-					level.Error(as.Logger).Log("wsRead", err)
-					return
-				}
-				rawKline := struct {
-					Type     string  `json:"e"`
-					Time     float64 `json:"E"`
-					Symbol   string  `json:"S"`
-					OpenTime float64 `json:"t"`
-					Kline    struct {
-						Interval                 string  `json:"i"`
-						FirstTradeID             int64   `json:"f"`
-						LastTradeID              int64   `json:"L"`
-						Final                    bool    `json:"x"`
-						OpenTime                 float64 `json:"t"`
-						CloseTime                float64 `json:"T"`
-						Open                     string  `json:"o"`
-						High                     string  `json:"h"`
-						Low                      string  `json:"l"`
-						Close                    string  `json:"c"`
-						Volume                   string  `json:"v"`
-						NumberOfTrades           int     `json:"n"`
-						QuoteAssetVolume         string  `json:"q"`
-						TakerBuyBaseAssetVolume  string  `json:"V"`
-						TakerBuyQuoteAssetVolume string  `json:"Q"`
-					} `json:"k"`
-				}{}
-				if err := json.Unmarshal(message, &rawKline); err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-					return
-				}
-				t, err := internal.TimeFromUnixTimestampFloat(rawKline.Time)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Time)
-					return
-				}
-				ot, err := internal.TimeFromUnixTimestampFloat(rawKline.Kline.OpenTime)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.OpenTime)
-					return
-				}
-				ct, err := internal.TimeFromUnixTimestampFloat(rawKline.Kline.CloseTime)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.CloseTime)
-					return
-				}
-				open, err := internal.FloatFromString(rawKline.Kline.Open)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.Open)
-					return
-				}
-				cls, err := internal.FloatFromString(rawKline.Kline.Close)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.Close)
-					return
-				}
-				high, err := internal.FloatFromString(rawKline.Kline.High)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.High)
-					return
-				}
-				low, err := internal.FloatFromString(rawKline.Kline.Low)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.Low)
-					return
-				}
-				vol, err := internal.FloatFromString(rawKline.Kline.Volume)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.Volume)
-					return
-				}
-				qav, err := internal.FloatFromString(rawKline.Kline.QuoteAssetVolume)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", (rawKline.Kline.QuoteAssetVolume))
-					return
-				}
-				tbbav, err := internal.FloatFromString(rawKline.Kline.TakerBuyBaseAssetVolume)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.TakerBuyBaseAssetVolume)
-					return
-				}
-				tbqav, err := internal.FloatFromString(rawKline.Kline.TakerBuyQuoteAssetVolume)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawKline.Kline.TakerBuyQuoteAssetVolume)
-					return
-				}
+			case kech <- ke:
+			case <-gate.closing():
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	gate.open(sub)
+	return kech, sub.done, nil
+}
 
-				ke := &KlineEvent{
-					WSEvent: WSEvent{
-						Type:   rawKline.Type,
-						Time:   t,
-						Symbol: rawKline.Symbol,
-					},
-					Interval:     Interval(rawKline.Kline.Interval),
-					FirstTradeID: rawKline.Kline.FirstTradeID,
-					LastTradeID:  rawKline.Kline.LastTradeID,
-					Final:        rawKline.Kline.Final,
-					Kline: Kline{
-						OpenTime:                 ot,
-						CloseTime:                ct,
-						Open:                     open,
-						Close:                    cls,
-						High:                     high,
-						Low:                      low,
-						Volume:                   vol,
-						NumberOfTrades:           rawKline.Kline.NumberOfTrades,
-						QuoteAssetVolume:         qav,
-						TakerBuyBaseAssetVolume:  tbbav,
-						TakerBuyQuoteAssetVolume: tbqav,
-					},
-				}
-				kech <- ke
+func (as *apiService) SubscribeKline(kwr KlineWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	name := fmt.Sprintf("%s@kline_%s", strings.ToLower(kwr.Symbol), string(kwr.Interval))
+	return as.subscribe(name, name, kwr.StreamOptions, h,
+		func(message []byte) (string, interface{}, error) {
+			ke, err := klineEventFromMessage(message)
+			if err != nil {
+				return "", nil, err
 			}
-		}
-	}()
+			return fmt.Sprintf("%s@%d", ke.Symbol, internal.UnixMillis(ke.OpenTime)), ke, nil
+		},
+		func(event interface{}) {
+			if h.OnKline != nil {
+				h.OnKline(event.(*KlineEvent))
+			}
+		})
+}
+
+func klineEventFromMessage(message []byte) (*KlineEvent, error) {
+	rawKline := struct {
+		Type   string  `json:"e"`
+		Time   float64 `json:"E"`
+		Symbol string  `json:"s"`
+		Kline  struct {
+			Interval                 string  `json:"i"`
+			FirstTradeID             int64   `json:"f"`
+			LastTradeID              int64   `json:"L"`
+			Final                    bool    `json:"x"`
+			OpenTime                 float64 `json:"t"`
+			CloseTime                float64 `json:"T"`
+			Open                     string  `json:"o"`
+			High                     string  `json:"h"`
+			Low                      string  `json:"l"`
+			Close                    string  `json:"c"`
+			Volume                   string  `json:"v"`
+			NumberOfTrades           int     `json:"n"`
+			QuoteAssetVolume         string  `json:"q"`
+			TakerBuyBaseAssetVolume  string  `json:"V"`
+			TakerBuyQuoteAssetVolume string  `json:"Q"`
+		} `json:"k"`
+	}{}
+	if err := json.Unmarshal(message, &rawKline); err != nil {
+		return nil, errors.Wrap(err, "rawKline unmarshal failed")
+	}
+
+	ke := &KlineEvent{
+		WSEvent: WSEvent{
+			Type:   rawKline.Type,
+			Symbol: rawKline.Symbol,
+		},
+		Interval:     Interval(rawKline.Kline.Interval),
+		FirstTradeID: rawKline.Kline.FirstTradeID,
+		LastTradeID:  rawKline.Kline.LastTradeID,
+		Final:        rawKline.Kline.Final,
+		Kline: Kline{
+			NumberOfTrades: rawKline.Kline.NumberOfTrades,
+		},
+	}
 
-	go as.exitHandler(c, done)
-	return kech, done, nil
+	var err error
+	for _, f := range []struct {
+		dst *time.Time
+		raw float64
+	}{
+		{&ke.Time, rawKline.Time},
+		{&ke.OpenTime, rawKline.Kline.OpenTime},
+		{&ke.CloseTime, rawKline.Kline.CloseTime},
+	} {
+		if *f.dst, err = internal.TimeFromUnixTimestampFloat(f.raw); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range []struct {
+		dst *float64
+		raw string
+	}{
+		{&ke.Open, rawKline.Kline.Open},
+		{&ke.High, rawKline.Kline.High},
+		{&ke.Low, rawKline.Kline.Low},
+		{&ke.Close, rawKline.Kline.Close},
+		{&ke.Volume, rawKline.Kline.Volume},
+		{&ke.QuoteAssetVolume, rawKline.Kline.QuoteAssetVolume},
+		{&ke.TakerBuyBaseAssetVolume, rawKline.Kline.TakerBuyBaseAssetVolume},
+		{&ke.TakerBuyQuoteAssetVolume, rawKline.Kline.TakerBuyQuoteAssetVolume},
+	} {
+		if *f.dst, err = internal.FloatFromString(f.raw); err != nil {
+			return nil, err
+		}
+	}
+	return ke, nil
 }
 
 func (as *apiService) TradeWebsocket(twr TradeWebsocketRequest) (chan *AggTradeEvent, chan struct{}, error) {
-	url := fmt.Sprintf("wss://stream.binance.com:9443/ws/%s@aggTrade", strings.ToLower(twr.Symbol))
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	aggtech := make(chan *AggTradeEvent)
+	gate := newSubscriptionGate()
+	sub, err := as.SubscribeTrade(twr, StreamHandler{
+		OnTrade: func(ate *AggTradeEvent) {
+			select {
+			case aggtech <- ate:
+			case <-gate.closing():
+			}
+		},
+	})
 	if err != nil {
-		log.Fatal("dial:", err)
+		return nil, nil, err
 	}
+	gate.open(sub)
+	return aggtech, sub.done, nil
+}
 
-	done := make(chan struct{})
-	aggtech := make(chan *AggTradeEvent)
+func (as *apiService) SubscribeTrade(twr TradeWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	if twr.Overflow == OverflowCoalesce {
+		return nil, errors.New("trades can't be coalesced")
+	}
+	name := fmt.Sprintf("%s@aggTrade", strings.ToLower(twr.Symbol))
+	return as.subscribe(name, name, twr.StreamOptions, h,
+		func(message []byte) (string, interface{}, error) {
+			ate, err := aggTradeEventFromMessage(message)
+			if err != nil {
+				return "", nil, err
+			}
+			return "", ate, nil
+		},
+		func(event interface{}) {
+			if h.OnTrade != nil {
+				h.OnTrade(event.(*AggTradeEvent))
+			}
+		})
+}
 
-	go func() {
-		defer c.Close()
-		defer close(done)
-		for {
+func aggTradeEventFromMessage(message []byte) (*AggTradeEvent, error) {
+	rawAggTrade := struct {
+		EventType       string  `json:"e"`
+		EventTime       float64 `json:"E"`
+		Symbol          string  `json:"s"`
+		AggregateTimeID int     `json:"a"`
+		Price           string  `json:"p"`
+		Quantity        string  `json:"q"`
+		FirstTradeID    int     `json:"f"`
+		LastTradeID     int     `json:"l"`
+		TradeTime       float64 `json:"T"`
+		IsMaker         bool    `json:"m"`
+		Ignore          bool    `json:"M"`
+	}{}
+	if err := json.Unmarshal(message, &rawAggTrade); err != nil {
+		return nil, errors.Wrap(err, "rawAggTrade unmarshal failed")
+	}
+
+	ate := &AggTradeEvent{
+		WSEvent: WSEvent{
+			Type:   rawAggTrade.EventType,
+			Symbol: rawAggTrade.Symbol,
+		},
+		AggTrade: AggTrade{
+			ID:           rawAggTrade.AggregateTimeID,
+			FirstTradeID: rawAggTrade.FirstTradeID,
+			LastTradeID:  rawAggTrade.LastTradeID,
+			BuyerMaker:   rawAggTrade.IsMaker,
+		},
+	}
+	var err error
+	if ate.Time, err = internal.TimeFromUnixTimestampFloat(rawAggTrade.EventTime); err != nil {
+		return nil, err
+	}
+	if ate.Timestamp, err = internal.TimeFromUnixTimestampFloat(rawAggTrade.TradeTime); err != nil {
+		return nil, err
+	}
+	if ate.Price, err = internal.FloatFromString(rawAggTrade.Price); err != nil {
+		return nil, err
+	}
+	if ate.Quantity, err = internal.FloatFromString(rawAggTrade.Quantity); err != nil {
+		return nil, err
+	}
+	return ate, nil
+}
+
+func (as *apiService) UserDataWebsocket(udwr UserDataWebsocketRequest) (chan UserDataEvent, chan struct{}, error) {
+	udech := make(chan UserDataEvent)
+	gate := newSubscriptionGate()
+	sub, err := as.SubscribeUserData(udwr, StreamHandler{
+		OnUserData: func(ude UserDataEvent) {
 			select {
-			case <-as.Ctx.Done():
-				level.Info(as.Logger).Log("closing reader")
-				return
-			default:
-				_, message, err := c.ReadMessage()
-				if err != nil {
-					level.Error(as.Logger).Log("wsRead", err)
-					return
-				}
-				rawAggTrade := struct {
-					EventType       string  `json:"e"`
-					EventTime       float64 `json:"E"`
-					Symbol          string  `json:"s"`
-					AggregateTimeID int     `json:"a"`
-					Price           string  `json:"p"`
-					Quantity        string  `json:"q"`
-					FirstTradeID    int     `json:"f"`
-					LastTradeID     int     `json:"l"`
-					TradeTime       float64 `json:"T"`
-					IsMaker         bool    `json:"m"`
-				}{}
-				if err := json.Unmarshal(message, &rawAggTrade); err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
-					continue
-				}
-				wsEvent := WSEvent{
-					Type:   rawAggTrade.EventType,
-					Symbol: rawAggTrade.Symbol,
-				}
-				if wsEvent.Time, err = internal.TimeFromUnixTimestampFloat(rawAggTrade.TradeTime); err != nil {
-					continue
-				}
-				aggTrade := AggTrade{
-					ID:           rawAggTrade.AggregateTimeID,
-					FirstTradeID: rawAggTrade.FirstTradeID,
-					LastTradeID:  rawAggTrade.LastTradeID,
-					BuyerMaker:   rawAggTrade.IsMaker,
-				}
+			case udech <- ude:
+			case <-gate.closing():
+			}
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	gate.open(sub)
+	return udech, sub.done, nil
+}
 
-				if aggTrade.Price, err = internal.FloatFromString(rawAggTrade.Price); err != nil {
-					continue
-				}
-				if aggTrade.Quantity, err = internal.FloatFromString(rawAggTrade.Quantity); err != nil {
-					continue
-				}
-				if aggTrade.Timestamp, err = internal.TimeFromUnixTimestampFloat(rawAggTrade.TradeTime); err != nil {
-					continue
-				}
-				aggtech <- &AggTradeEvent{
-					WSEvent:  wsEvent,
-					AggTrade: aggTrade,
-				}
+func (as *apiService) SubscribeUserData(udwr UserDataWebsocketRequest, h StreamHandler) (*Subscription, error) {
+	return as.subscribe(udwr.ListenKey, UserDataStreamLabel, udwr.StreamOptions, h,
+		func(message []byte) (string, interface{}, error) {
+			ude, err := userDataEventFromMessage(message)
+			return "", ude, err
+		},
+		func(event interface{}) {
+			if h.OnUserData != nil {
+				h.OnUserData(event.(UserDataEvent))
 			}
+		})
+}
+
+func userDataEventFromMessage(message []byte) (UserDataEvent, error) {
+	rawEvent := struct {
+		Type string  `json:"e"`
+		Time float64 `json:"E"`
+	}{}
+	if err := json.Unmarshal(message, &rawEvent); err != nil {
+		return nil, errors.Wrap(err, "rawEvent unmarshal failed")
+	}
+	t, err := internal.TimeFromUnixTimestampFloat(rawEvent.Time)
+	if err != nil {
+		return nil, err
+	}
+	wsEvent := WSEvent{
+		Type: rawEvent.Type,
+		Time: t,
+	}
+
+	switch rawEvent.Type {
+	case "outboundAccountPosition":
+		return accountPositionEventFromMessage(wsEvent, message)
+	case "balanceUpdate":
+		return balanceUpdateEventFromMessage(wsEvent, message)
+	case "executionReport":
+		return executionReportEventFromMessage(wsEvent, message)
+	case "listStatus":
+		return listStatusEventFromMessage(wsEvent, message)
+	case "listenKeyExpired":
+		rawExpired := struct {
+			ListenKey string `json:"listenKey"`
+		}{}
+		if err := json.Unmarshal(message, &rawExpired); err != nil {
+			return nil, errors.Wrap(err, "rawExpired unmarshal failed")
 		}
-	}()
+		return &ListenKeyExpiredEvent{
+			WSEvent:   wsEvent,
+			ListenKey: rawExpired.ListenKey,
+		}, nil
+	}
+	return nil, errors.Errorf("unknown user data event type: %s", rawEvent.Type)
+}
+
+func accountPositionEventFromMessage(wsEvent WSEvent, message []byte) (*AccountPositionEvent, error) {
+	rawAccount := struct {
+		LastUpdateTime float64 `json:"u"`
+		Balances       []struct {
+			Asset  string `json:"a"`
+			Free   string `json:"f"`
+			Locked string `json:"l"`
+		} `json:"B"`
+	}{}
+	if err := json.Unmarshal(message, &rawAccount); err != nil {
+		return nil, errors.Wrap(err, "rawAccount unmarshal failed")
+	}
+	ut, err := internal.TimeFromUnixTimestampFloat(rawAccount.LastUpdateTime)
+	if err != nil {
+		return nil, err
+	}
 
-	go as.exitHandler(c, done)
-	return aggtech, done, nil
+	ape := &AccountPositionEvent{
+		WSEvent:        wsEvent,
+		LastUpdateTime: ut,
+	}
+	for _, b := range rawAccount.Balances {
+		free, err := internal.FloatFromString(b.Free)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := internal.FloatFromString(b.Locked)
+		if err != nil {
+			return nil, err
+		}
+		ape.Balances = append(ape.Balances, &Balance{
+			Asset:  b.Asset,
+			Free:   free,
+			Locked: locked,
+		})
+	}
+	return ape, nil
 }
 
-func (as *apiService) UserDataWebsocket(urwr UserDataWebsocketRequest) (chan *AccountEvent, chan struct{}, error) {
-	url := fmt.Sprintf("wss://stream.binance.com:9443/ws/%s", urwr.ListenKey)
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+func balanceUpdateEventFromMessage(wsEvent WSEvent, message []byte) (*BalanceUpdateEvent, error) {
+	rawBalance := struct {
+		Asset     string  `json:"a"`
+		Delta     string  `json:"d"`
+		ClearTime float64 `json:"T"`
+	}{}
+	if err := json.Unmarshal(message, &rawBalance); err != nil {
+		return nil, errors.Wrap(err, "rawBalance unmarshal failed")
+	}
+	delta, err := internal.FloatFromString(rawBalance.Delta)
 	if err != nil {
-		log.Fatal("dial:", err)
+		return nil, err
+	}
+	ct, err := internal.TimeFromUnixTimestampFloat(rawBalance.ClearTime)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceUpdateEvent{
+		WSEvent:   wsEvent,
+		Asset:     rawBalance.Asset,
+		Delta:     delta,
+		ClearTime: ct,
+	}, nil
+}
+
+func executionReportEventFromMessage(wsEvent WSEvent, message []byte) (*ExecutionReportEvent, error) {
+	// Every key sent by Binance needs its own field here, otherwise
+	// json would match it case-insensitively with its counterpart (e.g. "I"
+	// would overwrite "i").
+	rawReport := struct {
+		Symbol                  string  `json:"s"`
+		ClientOrderID           string  `json:"c"`
+		Side                    string  `json:"S"`
+		Type                    string  `json:"o"`
+		TimeInForce             string  `json:"f"`
+		Quantity                string  `json:"q"`
+		Price                   string  `json:"p"`
+		StopPrice               string  `json:"P"`
+		IcebergQty              string  `json:"F"`
+		OrderListID             int64   `json:"g"`
+		OrigClientOrderID       string  `json:"C"`
+		ExecutionType           string  `json:"x"`
+		Status                  string  `json:"X"`
+		RejectReason            string  `json:"r"`
+		OrderID                 int64   `json:"i"`
+		LastExecutedQty         string  `json:"l"`
+		CumulativeFilledQty     string  `json:"z"`
+		LastExecutedPrice       string  `json:"L"`
+		Commission              string  `json:"n"`
+		CommissionAsset         *string `json:"N"`
+		TransactionTime         float64 `json:"T"`
+		TradeID                 int64   `json:"t"`
+		PreventedMatchID        int64   `json:"v"`
+		Ignore                  int64   `json:"I"`
+		IsWorking               bool    `json:"w"`
+		IsMaker                 bool    `json:"m"`
+		IgnoreMaker             bool    `json:"M"`
+		OrderCreationTime       float64 `json:"O"`
+		CumulativeQuoteQty      string  `json:"Z"`
+		LastQuoteQty            string  `json:"Y"`
+		QuoteOrderQty           string  `json:"Q"`
+		WorkingTime             float64 `json:"W"`
+		SelfTradePreventionMode string  `json:"V"`
+	}{}
+	if err := json.Unmarshal(message, &rawReport); err != nil {
+		return nil, errors.Wrap(err, "rawReport unmarshal failed")
+	}
+
+	wsEvent.Symbol = rawReport.Symbol
+	ere := &ExecutionReportEvent{
+		WSEvent:                 wsEvent,
+		ClientOrderID:           rawReport.ClientOrderID,
+		Side:                    OrderSide(rawReport.Side),
+		OrderType:               OrderType(rawReport.Type),
+		TimeInForce:             TimeInForce(rawReport.TimeInForce),
+		OrderListID:             rawReport.OrderListID,
+		OrigClientOrderID:       rawReport.OrigClientOrderID,
+		ExecutionType:           ExecutionType(rawReport.ExecutionType),
+		Status:                  OrderStatus(rawReport.Status),
+		RejectReason:            rawReport.RejectReason,
+		OrderID:                 rawReport.OrderID,
+		TradeID:                 rawReport.TradeID,
+		IsWorking:               rawReport.IsWorking,
+		IsMaker:                 rawReport.IsMaker,
+		SelfTradePreventionMode: rawReport.SelfTradePreventionMode,
+		PreventedMatchID:        rawReport.PreventedMatchID,
+	}
+	if rawReport.CommissionAsset != nil {
+		ere.CommissionAsset = *rawReport.CommissionAsset
+	}
+
+	var err error
+	for _, f := range []struct {
+		dst *float64
+		raw string
+	}{
+		{&ere.Quantity, rawReport.Quantity},
+		{&ere.Price, rawReport.Price},
+		{&ere.StopPrice, rawReport.StopPrice},
+		{&ere.IcebergQty, rawReport.IcebergQty},
+		{&ere.LastExecutedQty, rawReport.LastExecutedQty},
+		{&ere.CumulativeFilledQty, rawReport.CumulativeFilledQty},
+		{&ere.LastExecutedPrice, rawReport.LastExecutedPrice},
+		{&ere.Commission, rawReport.Commission},
+		{&ere.CumulativeQuoteQty, rawReport.CumulativeQuoteQty},
+		{&ere.LastQuoteQty, rawReport.LastQuoteQty},
+		{&ere.QuoteOrderQty, rawReport.QuoteOrderQty},
+	} {
+		if f.raw == "" {
+			continue
+		}
+		if *f.dst, err = internal.FloatFromString(f.raw); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range []struct {
+		dst *time.Time
+		raw float64
+	}{
+		{&ere.TransactionTime, rawReport.TransactionTime},
+		{&ere.OrderCreationTime, rawReport.OrderCreationTime},
+		{&ere.WorkingTime, rawReport.WorkingTime},
+	} {
+		if *f.dst, err = internal.TimeFromUnixTimestampFloat(f.raw); err != nil {
+			return nil, err
+		}
+	}
+	return ere, nil
+}
+
+func listStatusEventFromMessage(wsEvent WSEvent, message []byte) (*ListStatusEvent, error) {
+	rawList := struct {
+		Symbol            string  `json:"s"`
+		OrderListID       int64   `json:"g"`
+		ContingencyType   string  `json:"c"`
+		ListStatusType    string  `json:"l"`
+		ListOrderStatus   string  `json:"L"`
+		ListRejectReason  string  `json:"r"`
+		ListClientOrderID string  `json:"C"`
+		TransactionTime   float64 `json:"T"`
+		Orders            []struct {
+			Symbol        string `json:"s"`
+			OrderID       int64  `json:"i"`
+			ClientOrderID string `json:"c"`
+		} `json:"O"`
+	}{}
+	if err := json.Unmarshal(message, &rawList); err != nil {
+		return nil, errors.Wrap(err, "rawList unmarshal failed")
+	}
+	tt, err := internal.TimeFromUnixTimestampFloat(rawList.TransactionTime)
+	if err != nil {
+		return nil, err
 	}
 
-	done := make(chan struct{})
-	aech := make(chan *AccountEvent)
+	wsEvent.Symbol = rawList.Symbol
+	lse := &ListStatusEvent{
+		WSEvent:           wsEvent,
+		OrderListID:       rawList.OrderListID,
+		ContingencyType:   ContingencyType(rawList.ContingencyType),
+		ListStatusType:    ListStatusType(rawList.ListStatusType),
+		ListOrderStatus:   ListOrderStatus(rawList.ListOrderStatus),
+		ListRejectReason:  rawList.ListRejectReason,
+		ListClientOrderID: rawList.ListClientOrderID,
+		TransactionTime:   tt,
+	}
+	for _, o := range rawList.Orders {
+		lse.Orders = append(lse.Orders, &ListStatusOrder{
+			Symbol:        o.Symbol,
+			OrderID:       o.OrderID,
+			ClientOrderID: o.ClientOrderID,
+		})
+	}
+	return lse, nil
+}
+
+// subscribe connects to Binance stream and delivers its events through
+// eventQueue configured by opts. parse returns event with its coalescing key
+// and handle passes the event to subscriber. Stream is reported to
+// StreamObserver as label.
+func (as *apiService) subscribe(name, label string, opts StreamOptions, h StreamHandler,
+	parse func(message []byte) (string, interface{}, error),
+	handle func(event interface{})) (*Subscription, error) {
+	url := fmt.Sprintf("%s/%s", as.StreamURL, name)
+	c, err := as.StreamDialer(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to dial stream")
+	}
 
+	ctx, cancel := context.WithCancel(as.Ctx)
+	sub := newSubscription(ctx, cancel)
+	q := newEventQueue(opts)
+	observer := as.StreamObserver
+	if observer != nil {
+		q.onDrop = func() {
+			observer.EventDropped(label)
+		}
+	}
+	onError := func(err error) {
+		if h.OnError != nil {
+			h.OnError(err)
+		}
+	}
+
+	readerDone := make(chan struct{})
 	go func() {
-		defer c.Close()
-		defer close(done)
+		defer close(readerDone)
+		defer q.close()
 		for {
-			select {
-			case <-as.Ctx.Done():
-				level.Info(as.Logger).Log("closing reader")
-				return
-			default:
-				_, message, err := c.ReadMessage()
-				if err != nil {
-					level.Error(as.Logger).Log("wsRead", err)
-					return
-				}
-				rawAccount := struct {
-					Type            string  `json:"e"`
-					Time            float64 `json:"E"`
-					OpenTime        float64 `json:"t"`
-					MakerCommision  int64   `json:"m"`
-					TakerCommision  int64   `json:"t"`
-					BuyerCommision  int64   `json:"b"`
-					SellerCommision int64   `json:"s"`
-					CanTrade        bool    `json:"T"`
-					CanWithdraw     bool    `json:"W"`
-					CanDeposit      bool    `json:"D"`
-					Balances        []struct {
-						Asset            string `json:"a"`
-						AvailableBalance string `json:"f"`
-						Locked           string `json:"l"`
-					} `json:"B"`
-				}{}
-				if err := json.Unmarshal(message, &rawAccount); err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				if ctx.Err() != nil {
+					level.Info(as.Logger).Log("closing reader")
 					return
 				}
-				t, err := internal.TimeFromUnixTimestampFloat(rawAccount.Time)
-				if err != nil {
-					level.Error(as.Logger).Log("wsUnmarshal", err, "body", rawAccount.Time)
-					return
-				}
-
-				ae := &AccountEvent{
-					WSEvent: WSEvent{
-						Type: rawAccount.Type,
-						Time: t,
-					},
-					Account: Account{
-						MakerCommision:  rawAccount.MakerCommision,
-						TakerCommision:  rawAccount.TakerCommision,
-						BuyerCommision:  rawAccount.BuyerCommision,
-						SellerCommision: rawAccount.SellerCommision,
-						CanTrade:        rawAccount.CanTrade,
-						CanWithdraw:     rawAccount.CanWithdraw,
-						CanDeposit:      rawAccount.CanDeposit,
-					},
-				}
-				for _, b := range rawAccount.Balances {
-					free, err := internal.FloatFromString(b.AvailableBalance)
-					if err != nil {
-						level.Error(as.Logger).Log("wsUnmarshal", err, "body", b.AvailableBalance)
-						return
-					}
-					locked, err := internal.FloatFromString(b.Locked)
-					if err != nil {
-						level.Error(as.Logger).Log("wsUnmarshal", err, "body", b.Locked)
-						return
-					}
-					ae.Balances = append(ae.Balances, &Balance{
-						Asset:  b.Asset,
-						Free:   free,
-						Locked: locked,
-					})
+				level.Error(as.Logger).Log("wsRead", err)
+				sub.setErr(err)
+				onError(err)
+				return
+			}
+			key, event, err := parse(message)
+			if err != nil {
+				level.Error(as.Logger).Log("wsUnmarshal", err, "body", string(message))
+				if observer != nil {
+					observer.ParseError(label)
+				}
+				onError(err)
+				continue
+			}
+			if observer != nil {
+				var eventTime time.Time
+				if te, ok := event.(timedEvent); ok {
+					eventTime = te.eventTime()
 				}
-				aech <- ae
+				observer.MessageReceived(label, eventTime)
 			}
+			q.push(key, event)
 		}
 	}()
 
-	go as.exitHandler(c, done)
-	return aech, done, nil
+	go func() {
+		defer close(sub.done)
+		defer cancel()
+		sub.deliver(q, handle)
+		<-readerDone
+	}()
+
+	go as.exitHandler(ctx, c)
+	return sub, nil
 }
 
-func (as *apiService) exitHandler(c *websocket.Conn, done chan struct{}) {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-	defer c.Close()
-
-	for {
-		select {
-		//case t := <-ticker.C:
-			//err := c.WriteMessage(websocket.TextMessage, []byte(t.String()))
-			//if err != nil {
-			//	level.Error(as.Logger).Log("wsWrite", err)
-			//	return
-			//}
-		case <-as.Ctx.Done():
-			select {
-			case <-done:
-			case <-time.After(time.Second):
-			}
-			level.Info(as.Logger).Log("closing connection")
-			return
-		}
-	}
+func (as *apiService) exitHandler(ctx context.Context, c StreamConn) {
+	<-ctx.Done()
+	level.Info(as.Logger).Log("closing connection")
+	c.Close()
 }
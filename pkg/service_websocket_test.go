@@ -0,0 +1,329 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newStreamServer returns apiService connected to local websocket server,
+// which writes messages to every connection and closes it if closeConn is set.
+func newStreamServer(t *testing.T, messages []string, closeConn bool) (*apiService, *httptest.Server) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %s", err)
+			return
+		}
+		defer c.Close()
+		for _, m := range messages {
+			if err := c.WriteMessage(websocket.TextMessage, []byte(m)); err != nil {
+				return
+			}
+		}
+		if closeConn {
+			return
+		}
+		for {
+			if _, _, err := c.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	as := NewAPIService(srv.URL, "", nil, nil, context.Background()).(*apiService)
+	as.StreamURL = "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	return as, srv
+}
+
+func TestDepthStreamName(t *testing.T) {
+	for _, tc := range []struct {
+		level int
+		speed time.Duration
+		name  string
+	}{
+		{0, 0, "bnbbtc@depth"},
+		{0, 100 * time.Millisecond, "bnbbtc@depth@100ms"},
+		{10, time.Second, "bnbbtc@depth10"},
+		{5, 100 * time.Millisecond, "bnbbtc@depth5@100ms"},
+		{20, 0, "bnbbtc@depth20"},
+	} {
+		name, err := depthStreamName(DepthWebsocketRequest{Symbol: "BNBBTC", Level: tc.level, UpdateSpeed: tc.speed})
+		assert.Nil(t, err)
+		assert.Equal(t, tc.name, name)
+	}
+
+	_, err := depthStreamName(DepthWebsocketRequest{Symbol: "BNBBTC", Level: 15})
+	assert.EqualError(t, err, "unsupported depth level 15")
+	_, err = depthStreamName(DepthWebsocketRequest{Symbol: "BNBBTC", UpdateSpeed: 250 * time.Millisecond})
+	assert.EqualError(t, err, "unsupported depth update speed 250ms")
+
+	as := &apiService{}
+	_, err = as.SubscribeDepth(DepthWebsocketRequest{Symbol: "BNBBTC", Level: 1}, StreamHandler{})
+	assert.EqualError(t, err, "unsupported depth level 1")
+	_, _, err = as.DepthWebsocket(DepthWebsocketRequest{Symbol: "BNBBTC", UpdateSpeed: 500 * time.Millisecond})
+	assert.EqualError(t, err, "unsupported depth update speed 500ms")
+}
+
+func TestDepthEventFromDiffMessage(t *testing.T) {
+	message := []byte(`{"e":"depthUpdate","E":123456789,"s":"BNBBTC","U":157,"u":160,` +
+		`"b":[["0.0024","10"]],"a":[["0.0026","100"],["0.0027","0"]]}`)
+
+	de, err := depthEventFromMessage(DepthWebsocketRequest{Symbol: "BNBBTC"}, message)
+	assert.Nil(t, err)
+	assert.Equal(t, "depthUpdate", de.Type)
+	assert.Equal(t, "BNBBTC", de.Symbol)
+	assert.Equal(t, 157, de.FirstUpdateID)
+	assert.Equal(t, 160, de.FinalUpdateID)
+	assert.Equal(t, []*Order{{Price: 0.0024, Quantity: 10}}, de.Bids)
+	assert.Equal(t, []*Order{{Price: 0.0026, Quantity: 100}, {Price: 0.0027, Quantity: 0}}, de.Asks)
+}
+
+func TestDepthEventFromPartialMessage(t *testing.T) {
+	message := []byte(`{"lastUpdateId":160,"bids":[["0.0024","10"]],"asks":[["0.0026","100"]]}`)
+
+	de, err := depthEventFromMessage(DepthWebsocketRequest{Symbol: "bnbbtc", Level: 5}, message)
+	assert.Nil(t, err)
+	assert.Equal(t, "BNBBTC", de.Symbol)
+	assert.Equal(t, 160, de.LastUpdateID)
+	assert.Equal(t, 160, de.FirstUpdateID)
+	assert.Equal(t, 160, de.FinalUpdateID)
+	assert.Equal(t, []*Order{{Price: 0.0024, Quantity: 10}}, de.Bids)
+	assert.Equal(t, []*Order{{Price: 0.0026, Quantity: 100}}, de.Asks)
+}
+
+func TestUserDataEventFromExecutionReport(t *testing.T) {
+	message := []byte(`{"e":"executionReport","E":1499405658658,"s":"ETHBTC","c":"mUvoqJxFIILMdfAW5iGSOW",` +
+		`"S":"BUY","o":"LIMIT","f":"GTC","q":"1.00000000","p":"0.10264410","P":"0.00000000","F":"0.00000000",` +
+		`"g":-1,"C":"","x":"TRADE","X":"PARTIALLY_FILLED","r":"NONE","i":4293153,"l":"0.50000000",` +
+		`"z":"0.50000000","L":"0.10264400","n":"0.00050000","N":"BNB","T":1499405658657,"t":42,"I":8641984,` +
+		`"w":false,"m":true,"M":false,"O":1499405658600,"Z":"0.05132200","Y":"0.05132200","Q":"0.00000000",` +
+		`"W":1499405658600,"V":"NONE"}`)
+
+	ude, err := userDataEventFromMessage(message)
+	assert.Nil(t, err)
+	ere, ok := ude.(*ExecutionReportEvent)
+	if !ok {
+		t.Fatalf("invalid type of event returned: %T", ude)
+	}
+	assert.Equal(t, "executionReport", ere.Type)
+	assert.Equal(t, "ETHBTC", ere.Symbol)
+	assert.Equal(t, "mUvoqJxFIILMdfAW5iGSOW", ere.ClientOrderID)
+	assert.Equal(t, SideBuy, ere.Side)
+	assert.Equal(t, TypeLimit, ere.OrderType)
+	assert.Equal(t, ExecutionTrade, ere.ExecutionType)
+	assert.Equal(t, StatusPartiallyFilled, ere.Status)
+	assert.Equal(t, "NONE", ere.RejectReason)
+	assert.Equal(t, int64(4293153), ere.OrderID)
+	assert.Equal(t, int64(-1), ere.OrderListID)
+	assert.Equal(t, 0.5, ere.LastExecutedQty)
+	assert.Equal(t, 0.102644, ere.LastExecutedPrice)
+	assert.Equal(t, 0.0005, ere.Commission)
+	assert.Equal(t, "BNB", ere.CommissionAsset)
+	assert.Equal(t, int64(42), ere.TradeID)
+	assert.True(t, ere.IsMaker)
+	assert.Equal(t, int64(1499405658657), ere.TransactionTime.UnixNano()/int64(time.Millisecond))
+}
+
+func TestUserDataEventFromAccountPosition(t *testing.T) {
+	message := []byte(`{"e":"outboundAccountPosition","E":1564034571105,"u":1564034571073,` +
+		`"B":[{"a":"ETH","f":"10000.000000","l":"0.000000"}]}`)
+
+	ude, err := userDataEventFromMessage(message)
+	assert.Nil(t, err)
+	ape, ok := ude.(*AccountPositionEvent)
+	if !ok {
+		t.Fatalf("invalid type of event returned: %T", ude)
+	}
+	assert.Equal(t, []*Balance{{Asset: "ETH", Free: 10000}}, ape.Balances)
+}
+
+func TestUserDataEventFromBalanceUpdate(t *testing.T) {
+	message := []byte(`{"e":"balanceUpdate","E":1573200697110,"a":"BTC","d":"100.00000000","T":1573200697068}`)
+
+	ude, err := userDataEventFromMessage(message)
+	assert.Nil(t, err)
+	bue, ok := ude.(*BalanceUpdateEvent)
+	if !ok {
+		t.Fatalf("invalid type of event returned: %T", ude)
+	}
+	assert.Equal(t, "BTC", bue.Asset)
+	assert.Equal(t, 100.0, bue.Delta)
+}
+
+func TestUserDataEventFromListStatus(t *testing.T) {
+	message := []byte(`{"e":"listStatus","E":1564035303637,"s":"ETHBTC","g":2,"c":"OCO","l":"EXEC_STARTED",` +
+		`"L":"EXECUTING","r":"NONE","C":"F4QN4G8DlFATFlIUQ0cjdD","T":1564035303625,` +
+		`"O":[{"s":"ETHBTC","i":17,"c":"AJYsMjErWJesZvqlJCTUgL"},{"s":"ETHBTC","i":18,"c":"bfYPSQdLoqAJeNrOr9adzq"}]}`)
+
+	ude, err := userDataEventFromMessage(message)
+	assert.Nil(t, err)
+	lse, ok := ude.(*ListStatusEvent)
+	if !ok {
+		t.Fatalf("invalid type of event returned: %T", ude)
+	}
+	assert.Equal(t, int64(2), lse.OrderListID)
+	assert.Equal(t, ContingencyOCO, lse.ContingencyType)
+	assert.Equal(t, ListStatusExecStarted, lse.ListStatusType)
+	assert.Equal(t, ListOrderStatusExecuting, lse.ListOrderStatus)
+	assert.Equal(t, "F4QN4G8DlFATFlIUQ0cjdD", lse.ListClientOrderID)
+	assert.Len(t, lse.Orders, 2)
+	assert.Equal(t, int64(18), lse.Orders[1].OrderID)
+}
+
+func TestUserDataEventFromListenKeyExpired(t *testing.T) {
+	message := []byte(`{"e":"listenKeyExpired","E":1576653824250,"listenKey":"OfYGbUzi3PraNagEkdKuFwUHn48brFsItTdsuiIXrucEvD0rhRXZ7I6URWfE8YE8"}`)
+
+	ude, err := userDataEventFromMessage(message)
+	assert.Nil(t, err)
+	lke, ok := ude.(*ListenKeyExpiredEvent)
+	if !ok {
+		t.Fatalf("invalid type of event returned: %T", ude)
+	}
+	assert.Equal(t, "OfYGbUzi3PraNagEkdKuFwUHn48brFsItTdsuiIXrucEvD0rhRXZ7I6URWfE8YE8", lke.ListenKey)
+
+	_, err = userDataEventFromMessage([]byte(`{"e":"unknownEvent","E":1576653824250}`))
+	assert.NotNil(t, err)
+}
+
+func TestKlineEventFromMessage(t *testing.T) {
+	message := []byte(`{"e":"kline","E":123456789,"s":"BNBBTC","k":{"t":123400000,"T":123460000,"s":"BNBBTC",` +
+		`"i":"1m","f":100,"L":200,"o":"0.0010","c":"0.0020","h":"0.0025","l":"0.0015","v":"1000","n":100,` +
+		`"x":false,"q":"1.0000","V":"500","Q":"0.500","B":"123456"}}`)
+
+	ke, err := klineEventFromMessage(message)
+	assert.Nil(t, err)
+	assert.Equal(t, "BNBBTC", ke.Symbol)
+	assert.Equal(t, Minute, ke.Interval)
+	assert.Equal(t, int64(100), ke.FirstTradeID)
+	assert.Equal(t, int64(200), ke.LastTradeID)
+	assert.False(t, ke.Final)
+	assert.Equal(t, 0.001, ke.Open)
+	assert.Equal(t, 0.002, ke.Close)
+	assert.Equal(t, 0.0025, ke.High)
+	assert.Equal(t, 0.0015, ke.Low)
+	assert.Equal(t, 1000.0, ke.Volume)
+	assert.Equal(t, 100, ke.NumberOfTrades)
+	assert.Equal(t, 500.0, ke.TakerBuyBaseAssetVolume)
+}
+
+func TestAggTradeEventFromMessage(t *testing.T) {
+	message := []byte(`{"e":"aggTrade","E":123456789,"s":"BNBBTC","a":12345,"p":"0.001","q":"100",` +
+		`"f":100,"l":105,"T":123456785,"m":true,"M":true}`)
+
+	ate, err := aggTradeEventFromMessage(message)
+	assert.Nil(t, err)
+	assert.Equal(t, "BNBBTC", ate.Symbol)
+	assert.Equal(t, 12345, ate.ID)
+	assert.Equal(t, 0.001, ate.Price)
+	assert.Equal(t, 100.0, ate.Quantity)
+	assert.True(t, ate.BuyerMaker)
+	assert.Equal(t, int64(123456789), ate.Time.UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, int64(123456785), ate.Timestamp.UnixNano()/int64(time.Millisecond))
+}
+
+func TestSubscribeKline(t *testing.T) {
+	as, srv := newStreamServer(t, []string{
+		`{"e":"kline","E":1,"s":"BNBBTC","k":{"t":0,"T":60000,"i":"1m","o":"1","c":"2","h":"3","l":"0.5",` +
+			`"v":"10","q":"20","V":"5","Q":"10","x":true}}`,
+		`{"e":"kline","E":2,"s":"BNBBTC","k":{"o":"invalid"}}`,
+	}, false)
+	defer srv.Close()
+
+	kech := make(chan *KlineEvent, 1)
+	errch := make(chan error, 1)
+	sub, err := as.SubscribeKline(KlineWebsocketRequest{Symbol: "BNBBTC", Interval: Minute}, StreamHandler{
+		OnKline: func(ke *KlineEvent) { kech <- ke },
+		OnError: func(err error) { errch <- err },
+	})
+	assert.Nil(t, err)
+
+	ke := <-kech
+	assert.Equal(t, 2.0, ke.Close)
+	assert.True(t, ke.Final)
+	assert.NotNil(t, <-errch)
+
+	assert.Nil(t, sub.Close())
+	<-sub.Done()
+	assert.Nil(t, sub.Err())
+}
+
+func TestSubscribeRejectsCoalescedUpdates(t *testing.T) {
+	as, srv := newStreamServer(t, nil, false)
+	defer srv.Close()
+
+	_, err := as.SubscribeTrade(TradeWebsocketRequest{
+		Symbol:        "BNBBTC",
+		StreamOptions: StreamOptions{Overflow: OverflowCoalesce},
+	}, StreamHandler{})
+	assert.NotNil(t, err)
+	_, err = as.SubscribeDepth(DepthWebsocketRequest{
+		Symbol:        "BNBBTC",
+		StreamOptions: StreamOptions{Overflow: OverflowCoalesce},
+	}, StreamHandler{})
+	assert.NotNil(t, err)
+}
+
+func TestSubscribeReportsConnectionError(t *testing.T) {
+	as, srv := newStreamServer(t, nil, true)
+	defer srv.Close()
+
+	errch := make(chan error, 1)
+	sub, err := as.SubscribeTrade(TradeWebsocketRequest{Symbol: "BNBBTC"}, StreamHandler{
+		OnError: func(err error) { errch <- err },
+	})
+	assert.Nil(t, err)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription not stopped after connection was closed")
+	}
+	assert.NotNil(t, sub.Err())
+	assert.Equal(t, sub.Err(), <-errch)
+}
+
+func TestTradeWebsocketOnSubscription(t *testing.T) {
+	as, srv := newStreamServer(t, []string{
+		`{"e":"aggTrade","E":1,"s":"BNBBTC","a":1,"p":"0.001","q":"100","T":1}`,
+	}, true)
+	defer srv.Close()
+
+	aggtech, done, err := as.TradeWebsocket(TradeWebsocketRequest{Symbol: "BNBBTC"})
+	assert.Nil(t, err)
+	ate := <-aggtech
+	assert.Equal(t, 0.001, ate.Price)
+	<-done
+}
+
+func TestChannelStreamClose(t *testing.T) {
+	as, srv := newStreamServer(t, []string{
+		`{"e":"aggTrade","E":1,"s":"BNBBTC","a":1,"p":"0.001","q":"100","T":1}`,
+	}, false)
+	defer srv.Close()
+
+	gate := newSubscriptionGate()
+	returned := make(chan struct{})
+	sub, err := as.SubscribeTrade(TradeWebsocketRequest{Symbol: "BNBBTC"}, StreamHandler{
+		OnTrade: func(ate *AggTradeEvent) {
+			// Nobody receives, handler returns once subscription is closed.
+			select {
+			case make(chan *AggTradeEvent) <- ate:
+			case <-gate.closing():
+			}
+			close(returned)
+		},
+	})
+	assert.Nil(t, err)
+	gate.open(sub)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, sub.Close())
+	<-returned
+}
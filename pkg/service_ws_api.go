@@ -0,0 +1,443 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/internal"
+)
+
+// DefaultWSAPIURL is URL of Binance WebSocket API.
+const DefaultWSAPIURL = "wss://ws-api.binance.com:443/ws-api/v3"
+
+// DefaultWSAPITimeout is maximum time WSAPIService waits for a response.
+const DefaultWSAPITimeout = 10 * time.Second
+
+// ErrWSAPIClosed is returned for requests sent after WSAPIService connection
+// was closed.
+var ErrWSAPIClosed = errors.New("websocket API connection closed")
+
+// wsAPIIntParams are parameters sent as JSON numbers instead of strings.
+var wsAPIIntParams = map[string]bool{
+	"endTime":    true,
+	"fromId":     true,
+	"limit":      true,
+	"orderId":    true,
+	"recvWindow": true,
+	"startTime":  true,
+	"timestamp":  true,
+}
+
+// WSAPIService implements Service on top of Binance WebSocket API.
+//
+// Requests are sent over single persistent connection and responses are
+// correlated by request id, which saves the HTTPS round trip on every call.
+// Operations not available in WebSocket API (withdrawals, deposit and
+// withdraw history) and market streams are delegated to embedded REST Service.
+type WSAPIService struct {
+	Service
+
+	APIKey  string
+	Logger  log.Logger
+	Timeout time.Duration
+
+	rest    *apiService
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  map[int64]chan *wsAPIResponse
+	lastID   int64
+	loggedOn bool
+	err      error
+	done     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+type wsAPIRequest struct {
+	ID     int64                  `json:"id"`
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+type wsAPIResponse struct {
+	ID     int64           `json:"id"`
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// NewWSAPIService connects to WebSocket API at wsAPIURL and returns Service
+// using it. REST API at url serves the operations WebSocket API lacks.
+//
+// If logger or ctx are not provided, NopLogger and Background context are used as default.
+// Cancelling ctx closes the connection. Options apply to both transports;
+// with WithEnvironment, url and wsAPIURL can be left empty.
+func NewWSAPIService(url, wsAPIURL, apiKey string, signer Signer, logger log.Logger, ctx context.Context,
+	opts ...APIServiceOption) (*WSAPIService, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	rest := NewAPIService(url, apiKey, signer, logger, ctx, opts...).(*apiService)
+	if wsAPIURL == "" {
+		wsAPIURL = rest.WSAPIURL
+	}
+	if wsAPIURL == "" {
+		cancel()
+		return nil, errors.New("environment doesn't provide websocket API")
+	}
+	c, _, err := websocket.DefaultDialer.Dial(wsAPIURL, nil)
+	if err != nil {
+		cancel()
+		return nil, errors.Wrap(err, "unable to dial websocket API")
+	}
+
+	ws := &WSAPIService{
+		Service: rest,
+		APIKey:  apiKey,
+		Logger:  logger,
+		Timeout: DefaultWSAPITimeout,
+		rest:    rest,
+		conn:    c,
+		pending: make(map[int64]chan *wsAPIResponse),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go ws.read()
+	go func() {
+		<-ctx.Done()
+		level.Info(logger).Log("closing connection")
+		c.Close()
+	}()
+	return ws, nil
+}
+
+// Logon authenticates the connection with session.logon. Signed requests of
+// logged on session don't carry API key and signature. Binance supports
+// session authentication for Ed25519 keys only.
+func (ws *WSAPIService) Logon() error {
+	params := map[string]string{
+		"timestamp": strconv.FormatInt(internal.UnixMillis(time.Now()), 10),
+	}
+	if _, err := ws.call("session.logon", params, true, true); err != nil {
+		return err
+	}
+	ws.mu.Lock()
+	ws.loggedOn = true
+	ws.mu.Unlock()
+	return nil
+}
+
+// Close closes the connection and fails requests waiting for response.
+func (ws *WSAPIService) Close() error {
+	ws.cancel()
+	<-ws.done
+	return nil
+}
+
+// Done returns channel closed when the connection is closed.
+func (ws *WSAPIService) Done() <-chan struct{} {
+	return ws.done
+}
+
+func (ws *WSAPIService) Ping() error {
+	_, err := ws.call("ping", nil, false, false)
+	return err
+}
+
+func (ws *WSAPIService) Time() (time.Time, error) {
+	textRes, err := ws.call("time", nil, false, false)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return timeFromJSON(textRes)
+}
+
+func (ws *WSAPIService) OrderBook(obr OrderBookRequest) (*OrderBook, error) {
+	textRes, err := ws.call("depth", orderBookParams(obr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return orderBookFromJSON(textRes)
+}
+
+func (ws *WSAPIService) AggTrades(atr AggTradesRequest) ([]*AggTrade, error) {
+	textRes, err := ws.call("trades.aggregate", aggTradesParams(atr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return aggTradesFromJSON(textRes)
+}
+
+func (ws *WSAPIService) Klines(kr KlinesRequest) ([]*Kline, error) {
+	textRes, err := ws.call("klines", klinesParams(kr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return klinesFromJSON(textRes)
+}
+
+func (ws *WSAPIService) Ticker24(tr TickerRequest) (*Ticker24, error) {
+	textRes, err := ws.call("ticker.24hr", tickerParams(tr), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return ticker24FromJSON(textRes)
+}
+
+func (ws *WSAPIService) TickerAllPrices() ([]*PriceTicker, error) {
+	textRes, err := ws.call("ticker.price", nil, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return priceTickersFromJSON(textRes)
+}
+
+func (ws *WSAPIService) TickerAllBooks() ([]*BookTicker, error) {
+	textRes, err := ws.call("ticker.book", nil, false, false)
+	if err != nil {
+		return nil, err
+	}
+	return bookTickersFromJSON(textRes)
+}
+
+func (ws *WSAPIService) NewOrder(or NewOrderRequest) (*ProcessedOrder, error) {
+	textRes, err := ws.call("order.place", newOrderParams(or), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return processedOrderFromJSON(textRes)
+}
+
+func (ws *WSAPIService) NewOrderTest(or NewOrderRequest) error {
+	_, err := ws.call("order.test", newOrderParams(or), true, true)
+	return err
+}
+
+func (ws *WSAPIService) QueryOrder(qor QueryOrderRequest) (*ExecutedOrder, error) {
+	textRes, err := ws.call("order.status", queryOrderParams(qor), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return executedOrderFromJSON(textRes)
+}
+
+func (ws *WSAPIService) CancelOrder(cor CancelOrderRequest) (*CanceledOrder, error) {
+	textRes, err := ws.call("order.cancel", cancelOrderParams(cor), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return canceledOrderFromJSON(textRes)
+}
+
+func (ws *WSAPIService) OpenOrders(oor OpenOrdersRequest) ([]*ExecutedOrder, error) {
+	textRes, err := ws.call("openOrders.status", openOrdersParams(oor), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return executedOrdersFromJSON(textRes)
+}
+
+func (ws *WSAPIService) AllOrders(aor AllOrdersRequest) ([]*ExecutedOrder, error) {
+	textRes, err := ws.call("allOrders", allOrdersParams(aor), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return executedOrdersFromJSON(textRes)
+}
+
+func (ws *WSAPIService) Account(ar AccountRequest) (*Account, error) {
+	textRes, err := ws.call("account.status", accountParams(ar), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return accountFromJSON(textRes)
+}
+
+func (ws *WSAPIService) MyTrades(mtr MyTradesRequest) ([]*Trade, error) {
+	textRes, err := ws.call("myTrades", myTradesParams(mtr), true, true)
+	if err != nil {
+		return nil, err
+	}
+	return tradesFromJSON(textRes)
+}
+
+func (ws *WSAPIService) StartUserDataStream() (*Stream, error) {
+	textRes, err := ws.call("userDataStream.start", nil, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return streamFromJSON(textRes)
+}
+
+func (ws *WSAPIService) KeepAliveUserDataStream(s *Stream) error {
+	_, err := ws.call("userDataStream.ping", streamParams(s), true, false)
+	return err
+}
+
+func (ws *WSAPIService) CloseUserDataStream(s *Stream) error {
+	_, err := ws.call("userDataStream.stop", streamParams(s), true, false)
+	return err
+}
+
+// call sends request and waits for its response. Result of successful
+// response is returned, error responses are returned as *Error.
+func (ws *WSAPIService) call(method string, params map[string]string, apiKey bool, sign bool) ([]byte, error) {
+	ws.mu.Lock()
+	if ws.err != nil {
+		err := ws.err
+		ws.mu.Unlock()
+		return nil, err
+	}
+	ws.lastID++
+	id := ws.lastID
+	resc := make(chan *wsAPIResponse, 1)
+	ws.pending[id] = resc
+	loggedOn := ws.loggedOn
+	ws.mu.Unlock()
+	defer func() {
+		ws.mu.Lock()
+		delete(ws.pending, id)
+		ws.mu.Unlock()
+	}()
+
+	rp, err := ws.requestParams(method, params, apiKey && !(loggedOn && sign), sign && !loggedOn)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := json.Marshal(wsAPIRequest{ID: id, Method: method, Params: rp})
+	if err != nil {
+		return nil, errors.Wrap(err, "request marshal failed")
+	}
+	level.Debug(ws.Logger).Log("wsAPIRequest", string(msg))
+
+	ws.writeMu.Lock()
+	err = ws.conn.WriteMessage(websocket.TextMessage, msg)
+	ws.writeMu.Unlock()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to send %s request", method)
+	}
+
+	timer := time.NewTimer(ws.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-resc:
+		if res.Error != nil {
+			level.Info(ws.Logger).Log("errorResponse", res.Error)
+			return nil, res.Error
+		}
+		return res.Result, nil
+	case <-ws.done:
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		return nil, ws.err
+	case <-timer.C:
+		return nil, errors.Errorf("%s request timed out after %s", method, ws.Timeout)
+	}
+}
+
+// requestParams converts params to JSON request parameters. Signature is
+// computed over parameters sorted by name, as required by WebSocket API.
+func (ws *WSAPIService) requestParams(method string, params map[string]string, apiKey bool, sign bool) (map[string]interface{}, error) {
+	if len(params) == 0 && !apiKey && !sign {
+		return nil, nil
+	}
+	all := make(map[string]string, len(params)+2)
+	for key, val := range params {
+		all[key] = val
+	}
+	if apiKey {
+		all["apiKey"] = ws.APIKey
+	}
+	if sign {
+		signature, err := ws.rest.sign(ws.ctx, "", method, wsAPIPayload(all))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to sign request")
+		}
+		all["signature"] = signature
+	}
+
+	rp := make(map[string]interface{}, len(all))
+	for key, val := range all {
+		if listParams[key] {
+			var values []string
+			if err := json.Unmarshal([]byte(val), &values); err != nil {
+				return nil, errors.Errorf("invalid list parameter %s: %s", key, val)
+			}
+			rp[key] = values
+			continue
+		}
+		if wsAPIIntParams[key] {
+			if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+				rp[key] = i
+				continue
+			}
+		}
+		rp[key] = val
+	}
+	return rp, nil
+}
+
+// wsAPIPayload returns signature payload of params.
+func wsAPIPayload(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + params[key]
+	}
+	return strings.Join(pairs, "&")
+}
+
+// read dispatches responses to waiting requests until connection fails.
+func (ws *WSAPIService) read() {
+	var err error
+	for {
+		var message []byte
+		_, message, err = ws.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		res := &wsAPIResponse{}
+		if err := json.Unmarshal(message, res); err != nil {
+			level.Error(ws.Logger).Log("wsUnmarshal", err, "body", string(message))
+			continue
+		}
+		ws.mu.Lock()
+		resc, ok := ws.pending[res.ID]
+		ws.mu.Unlock()
+		if !ok {
+			level.Info(ws.Logger).Log("unexpectedResponse", res.ID)
+			continue
+		}
+		resc <- res
+	}
+
+	ws.mu.Lock()
+	ws.err = ErrWSAPIClosed
+	if ws.ctx.Err() == nil {
+		level.Error(ws.Logger).Log("wsRead", err)
+		ws.err = errors.Wrap(err, "websocket API connection failed")
+	}
+	ws.mu.Unlock()
+	ws.cancel()
+	close(ws.done)
+}
@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWSAPIServer starts fake WebSocket API answering requests with handle.
+func newWSAPIServer(t *testing.T, handle func(method string, params map[string]interface{}) (interface{}, *Error)) (*WSAPIService, *httptest.Server) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %s", err)
+			return
+		}
+		defer c.Close()
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			req := struct {
+				ID     int64                  `json:"id"`
+				Method string                 `json:"method"`
+				Params map[string]interface{} `json:"params"`
+			}{}
+			if err := json.Unmarshal(message, &req); err != nil {
+				t.Errorf("invalid request: %s", err)
+				return
+			}
+			result, apiErr := handle(req.Method, req.Params)
+			res := map[string]interface{}{"id": req.ID, "status": 200, "result": result}
+			if apiErr != nil {
+				res = map[string]interface{}{"id": req.ID, "status": 400, "error": apiErr}
+			}
+			if err := c.WriteJSON(res); err != nil {
+				return
+			}
+		}
+	}))
+	ws, err := NewWSAPIService(srv.URL, "ws"+strings.TrimPrefix(srv.URL, "http"), "api-key",
+		&HmacSigner{Key: []byte("secret")}, nil, context.Background())
+	require.NoError(t, err)
+	return ws, srv
+}
+
+// verifySignature checks WebSocket API signature of params.
+func verifySignature(params map[string]interface{}) bool {
+	payload := make(map[string]string)
+	for key, val := range params {
+		if key == "signature" {
+			continue
+		}
+		switch v := val.(type) {
+		case float64:
+			payload[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			payload[key] = v
+		}
+	}
+	signer := &HmacSigner{Key: []byte("secret")}
+	return params["signature"] == signer.Sign([]byte(wsAPIPayload(payload)))
+}
+
+func TestWSAPIPayload(t *testing.T) {
+	assert.Equal(t, "apiKey=k&quantity=1&symbol=BNBBTC&timestamp=1", wsAPIPayload(map[string]string{
+		"timestamp": "1",
+		"symbol":    "BNBBTC",
+		"apiKey":    "k",
+		"quantity":  "1",
+	}))
+}
+
+func TestWSAPINewOrder(t *testing.T) {
+	ws, srv := newWSAPIServer(t, func(method string, params map[string]interface{}) (interface{}, *Error) {
+		assert.Equal(t, "order.place", method)
+		assert.Equal(t, "api-key", params["apiKey"])
+		assert.Equal(t, float64(1499827319559), params["timestamp"])
+		if !verifySignature(params) {
+			return nil, &Error{Code: -1022, Message: "Signature for this request is not valid."}
+		}
+		return map[string]interface{}{
+			"symbol":        params["symbol"],
+			"orderId":       12569099453,
+			"clientOrderId": "4d96324ff9d44481926157ec08158a40",
+			"transactTime":  1660801715639,
+		}, nil
+	})
+	defer srv.Close()
+	defer ws.Close()
+
+	po, err := ws.NewOrder(NewOrderRequest{
+		Symbol:      "BNBBTC",
+		Side:        SideBuy,
+		Type:        TypeLimit,
+		TimeInForce: GTC,
+		Quantity:    1,
+		Price:       0.1,
+		Timestamp:   time.Unix(0, 1499827319559*int64(time.Millisecond)),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "BNBBTC", po.Symbol)
+	assert.Equal(t, int64(12569099453), po.OrderID)
+}
+
+func TestWSAPIErrorResponse(t *testing.T) {
+	ws, srv := newWSAPIServer(t, func(method string, params map[string]interface{}) (interface{}, *Error) {
+		return nil, &Error{Code: -1121, Message: "Invalid symbol."}
+	})
+	defer srv.Close()
+	defer ws.Close()
+
+	_, err := ws.OrderBook(OrderBookRequest{Symbol: "XXX"})
+	apiErr, ok := err.(*Error)
+	require.True(t, ok, "invalid type of error returned: %T", err)
+	assert.Equal(t, -1121, apiErr.Code)
+}
+
+func TestWSAPILogon(t *testing.T) {
+	ws, srv := newWSAPIServer(t, func(method string, params map[string]interface{}) (interface{}, *Error) {
+		switch method {
+		case "session.logon":
+			assert.True(t, verifySignature(params))
+			return map[string]interface{}{"apiKey": params["apiKey"]}, nil
+		case "account.status":
+			assert.NotContains(t, params, "apiKey")
+			assert.NotContains(t, params, "signature")
+			assert.Contains(t, params, "timestamp")
+			return map[string]interface{}{"canTrade": true}, nil
+		}
+		return nil, &Error{Code: -1, Message: "unexpected method " + method}
+	})
+	defer srv.Close()
+	defer ws.Close()
+
+	require.NoError(t, ws.Logon())
+	acc, err := ws.Account(AccountRequest{Timestamp: time.Now()})
+	require.NoError(t, err)
+	assert.True(t, acc.CanTrade)
+}
+
+func TestWSAPIConcurrentRequests(t *testing.T) {
+	ws, srv := newWSAPIServer(t, func(method string, params map[string]interface{}) (interface{}, *Error) {
+		return map[string]interface{}{"serverTime": 1499827319559}, nil
+	})
+	defer srv.Close()
+	defer ws.Close()
+
+	errc := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			_, err := ws.Time()
+			errc <- err
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, <-errc)
+	}
+}
+
+func TestWSAPIClosed(t *testing.T) {
+	ws, srv := newWSAPIServer(t, func(method string, params map[string]interface{}) (interface{}, *Error) {
+		return map[string]interface{}{}, nil
+	})
+	defer srv.Close()
+
+	require.NoError(t, ws.Ping())
+	require.NoError(t, ws.Close())
+	assert.Equal(t, ErrWSAPIClosed, ws.Ping())
+}
+
+func TestWSAPIRequestParams(t *testing.T) {
+	ws := &WSAPIService{}
+	rp, err := ws.requestParams("order.place", map[string]string{
+		"newClientOrderId": `["BNBBTC"]`,
+		"limit":            "10",
+	}, false, false)
+	require.NoError(t, err)
+	b, err := json.Marshal(rp)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"newClientOrderId":"[\"BNBBTC\"]","limit":10}`, string(b))
+}
+
+func TestWSAPIListParams(t *testing.T) {
+	signer := &HmacSigner{Key: []byte("secret")}
+	ws := &WSAPIService{APIKey: "api-key", rest: &apiService{Signer: signer}, ctx: context.Background()}
+	rp, err := ws.requestParams("ticker.price", map[string]string{
+		"symbols":   listParam{"BNBBTC", "ETHBTC"}.String(),
+		"timestamp": "1499827319559",
+	}, true, true)
+	require.NoError(t, err)
+	b, err := json.Marshal(rp)
+	require.NoError(t, err)
+	signature := signer.Sign([]byte(`apiKey=api-key&symbols=["BNBBTC","ETHBTC"]&timestamp=1499827319559`))
+	assert.JSONEq(t, `{"apiKey":"api-key","symbols":["BNBBTC","ETHBTC"],"timestamp":1499827319559,"signature":"`+
+		signature+`"}`, string(b))
+
+	_, err = ws.requestParams("ticker.price", map[string]string{"symbols": "BNBBTC"}, false, false)
+	assert.EqualError(t, err, "invalid list parameter symbols: BNBBTC")
+}
@@ -1,9 +1,19 @@
 package pkg
 
 import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
 )
 
 // Signer signs provided payloads.
@@ -23,3 +33,102 @@ func (hs *HmacSigner) Sign(payload []byte) string {
 	mac.Write(payload)
 	return hex.EncodeToString(mac.Sum(nil))
 }
+
+// Ed25519Signer uses Ed25519 keys for signing payloads.
+type Ed25519Signer struct {
+	Key ed25519.PrivateKey
+}
+
+// NewEd25519SignerFromPEM creates Ed25519Signer from PEM encoded PKCS#8
+// private key.
+func NewEd25519SignerFromPEM(pemKey []byte) (*Ed25519Signer, error) {
+	key, err := parsePKCS8PrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("expected Ed25519 private key, got %T", key)
+	}
+	return &Ed25519Signer{Key: edKey}, nil
+}
+
+// Sign signs provided payload and returns base64 encoded signature.
+func (es *Ed25519Signer) Sign(payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(es.Key, payload))
+}
+
+// RSASigner uses RSA keys for signing payloads with RSASSA-PKCS1-v1_5 and SHA256.
+type RSASigner struct {
+	Key *rsa.PrivateKey
+}
+
+// NewRSASignerFromPEM creates RSASigner from PEM encoded PKCS#8 or PKCS#1
+// private key.
+func NewRSASignerFromPEM(pemKey []byte) (*RSASigner, error) {
+	var rsaKey *rsa.PrivateKey
+	block, _ := pem.Decode(pemKey)
+	if block != nil && block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse PKCS#1 private key")
+		}
+		rsaKey = key
+	} else {
+		key, err := parsePKCS8PrivateKey(pemKey)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if rsaKey, ok = key.(*rsa.PrivateKey); !ok {
+			return nil, errors.Errorf("expected RSA private key, got %T", key)
+		}
+	}
+	rs := &RSASigner{Key: rsaKey}
+	// Keys too short for SHA256 signatures are parsed fine, but can't sign.
+	if _, err := rs.sign(nil); err != nil {
+		return nil, errors.Wrap(err, "unable to sign with RSA key")
+	}
+	return rs, nil
+}
+
+// Sign signs provided payload and returns base64 encoded signature, or empty
+// one if the key can't be used for signing. Service signs with SignContext,
+// which reports the error with the request.
+func (rs *RSASigner) Sign(payload []byte) string {
+	sig, _ := rs.sign(payload)
+	return sig
+}
+
+// SignContext signs sr.Payload and returns base64 encoded signature.
+func (rs *RSASigner) SignContext(ctx context.Context, sr SignRequest) (string, error) {
+	sig, err := rs.sign([]byte(sr.Payload))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to sign with RSA key")
+	}
+	return sig, nil
+}
+
+func (rs *RSASigner) sign(payload []byte) (string, error) {
+	sum := sha256.Sum256(payload)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rs.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func parsePKCS8PrivateKey(pemKey []byte) (interface{}, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, errors.Errorf("unexpected PEM block type %q", block.Type)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse PKCS#8 private key")
+	}
+	return key, nil
+}
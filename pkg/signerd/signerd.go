@@ -0,0 +1,250 @@
+// Package signerd implements reference signing daemon, which keeps API secret
+// outside of trading process and signs only requests allowed by its Policy.
+//
+// Server speaks protocol of pkg.HTTPSigner over HTTP or Unix socket and of
+// pkg.CommandSigner over standard input and output.
+package signerd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/retirero/go-binance/pkg"
+)
+
+// Policy lists requests the daemon signs.
+type Policy struct {
+	// Endpoints are allowed REST endpoints (e.g. "api/v3/order"), optionally
+	// restricted to HTTP method ("DELETE api/v3/order"), and WebSocket API
+	// methods (e.g. "order.place"). No request is signed if empty.
+	Endpoints []string
+	// Symbols are allowed symbols. Requests for any symbol are signed if
+	// empty. If set, requests of endpoints taking symbol must carry one.
+	Symbols []string
+	// Rules are params of endpoints keyed by method and endpoint
+	// ("POST api/v3/order") or WebSocket API method, overriding the
+	// built-in ones. Endpoints without known rule are never signed.
+	Rules map[string]Rule
+}
+
+// Rule lists params of endpoint.
+type Rule struct {
+	// Params are allowed params.
+	Params []string
+	// Required are params payload must carry, so that its signature isn't
+	// valid for other endpoints taking the same params. Alternatives are
+	// separated by "|", e.g. "orderId|origClientOrderId".
+	Required []string
+}
+
+var (
+	newOrderParams = []string{"symbol", "side", "type", "timeInForce", "quantity", "quoteOrderQty", "price",
+		"newClientOrderId", "stopPrice", "icebergQty", "newOrderRespType", "timestamp", "recvWindow"}
+	cancelOrderParams = []string{"symbol", "orderId", "origClientOrderId", "newClientOrderId", "timestamp",
+		"recvWindow"}
+	queryOrderParams = []string{"symbol", "orderId", "origClientOrderId", "timestamp", "recvWindow"}
+	openOrdersParams = []string{"symbol", "timestamp", "recvWindow"}
+	accountParams    = []string{"timestamp", "recvWindow"}
+	myTradesParams   = []string{"symbol", "orderId", "fromId", "startTime", "endTime", "limit", "timestamp", "recvWindow"}
+	allOrdersParams  = []string{"symbol", "orderId", "startTime", "endTime", "limit", "timestamp", "recvWindow"}
+
+	newOrderRule    = Rule{Params: newOrderParams, Required: []string{"symbol", "side", "type", "timestamp"}}
+	cancelOrderRule = Rule{Params: cancelOrderParams, Required: []string{"symbol", "orderId|origClientOrderId", "timestamp"}}
+	queryOrderRule  = Rule{Params: queryOrderParams, Required: []string{"symbol", "orderId|origClientOrderId", "timestamp"}}
+	openOrdersRule  = Rule{Params: openOrdersParams, Required: []string{"timestamp"}}
+	accountRule     = Rule{Params: accountParams, Required: []string{"timestamp"}}
+)
+
+// endpointRules are rules of signed endpoints of trading and account
+// queries. Withdrawals aren't included, so they can't be signed unless
+// Policy.Rules has their rule.
+var endpointRules = map[string]Rule{
+	"POST api/v3/order":      newOrderRule,
+	"POST api/v3/order/test": newOrderRule,
+	"DELETE api/v3/order":    cancelOrderRule,
+	"GET api/v3/order":       queryOrderRule,
+	"GET api/v3/openOrders":  openOrdersRule,
+	"GET api/v3/allOrders":   {Params: allOrdersParams, Required: []string{"symbol", "timestamp"}},
+	"GET api/v3/account":     accountRule,
+	"GET api/v3/myTrades":    {Params: myTradesParams, Required: []string{"symbol", "timestamp"}},
+	"order.place":            wsAPIRule(newOrderRule),
+	"order.test":             wsAPIRule(newOrderRule),
+	"order.cancel":           wsAPIRule(cancelOrderRule),
+	"order.status":           wsAPIRule(queryOrderRule),
+	"openOrders.status":      wsAPIRule(openOrdersRule),
+	"account.status":         wsAPIRule(accountRule),
+	"session.logon":          {Params: []string{"apiKey", "timestamp", "recvWindow"}, Required: []string{"apiKey", "timestamp"}},
+}
+
+// wsAPIRule returns rule of WebSocket API method taking the same params as
+// REST endpoint of r, plus API key.
+func wsAPIRule(r Rule) Rule {
+	return Rule{
+		Params:   append([]string{"apiKey"}, r.Params...),
+		Required: append([]string{"apiKey"}, r.Required...),
+	}
+}
+
+// Check returns error if sr is not allowed by policy. Endpoint of sr is
+// supplied by client and not covered by signature, so payload is checked
+// against rule of the endpoint: a payload with params of any other endpoint,
+// e.g. address of withdrawal, or without params telling the endpoint apart,
+// e.g. side of new order, is refused.
+func (p Policy) Check(sr pkg.SignRequest) error {
+	if !p.allowsEndpoint(sr) {
+		return errors.Errorf("endpoint %s is not allowed", sr.Endpoint)
+	}
+	rule, ok := p.rule(sr)
+	if !ok {
+		return errors.Errorf("params of endpoint %s are not known", sr.Endpoint)
+	}
+	params, err := url.ParseQuery(sr.Payload)
+	if err != nil {
+		return errors.Wrap(err, "invalid payload")
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !contains(rule.Params, name) {
+			return errors.Errorf("param %s is not allowed", name)
+		}
+		if len(params[name]) > 1 {
+			return errors.Errorf("param %s is repeated", name)
+		}
+	}
+	if len(p.Symbols) > 0 && contains(rule.Params, "symbol") {
+		symbol := params.Get("symbol")
+		if symbol == "" {
+			return errors.New("symbol is required")
+		}
+		if !contains(p.Symbols, symbol) {
+			return errors.Errorf("symbol %s is not allowed", symbol)
+		}
+	}
+	for _, required := range rule.Required {
+		if !hasAny(params, strings.Split(required, "|")) {
+			return errors.Errorf("param %s is required", required)
+		}
+	}
+	return nil
+}
+
+func (p Policy) allowsEndpoint(sr pkg.SignRequest) bool {
+	for _, e := range p.Endpoints {
+		if e == sr.Endpoint || (sr.Method != "" && e == sr.Method+" "+sr.Endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// rule returns rule of endpoint of sr.
+func (p Policy) rule(sr pkg.SignRequest) (Rule, bool) {
+	key := sr.Endpoint
+	if sr.Method != "" {
+		key = sr.Method + " " + sr.Endpoint
+	}
+	if rule, ok := p.Rules[key]; ok {
+		return rule, true
+	}
+	rule, ok := endpointRules[key]
+	return rule, ok
+}
+
+// hasAny reports whether params carry non-empty value of any of names.
+func hasAny(params url.Values, names []string) bool {
+	for _, name := range names {
+		if params.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Server signs requests allowed by Policy with Signer.
+type Server struct {
+	Signer pkg.Signer
+	Policy Policy
+	Logger log.Logger
+}
+
+// NewServer creates signing Server. If logger is not provided, NopLogger is used.
+func NewServer(signer pkg.Signer, policy Policy, logger log.Logger) *Server {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Server{
+		Signer: signer,
+		Policy: policy,
+		Logger: logger,
+	}
+}
+
+// Sign signs sr if allowed by policy.
+func (s *Server) Sign(sr pkg.SignRequest) pkg.SignResponse {
+	if err := s.Policy.Check(sr); err != nil {
+		level.Warn(s.Logger).Log("msg", "signing refused", "method", sr.Method, "endpoint", sr.Endpoint, "err", err)
+		return pkg.SignResponse{Error: err.Error()}
+	}
+	signature, err := (&pkg.LocalSigner{Signer: s.Signer}).SignContext(context.Background(), sr)
+	if err != nil {
+		level.Error(s.Logger).Log("msg", "signing failed", "method", sr.Method, "endpoint", sr.Endpoint, "err", err)
+		return pkg.SignResponse{Error: "signing failed"}
+	}
+	level.Info(s.Logger).Log("msg", "signed", "method", sr.Method, "endpoint", sr.Endpoint)
+	return pkg.SignResponse{Signature: signature}
+}
+
+// ServeHTTP handles SignRequest POSTed as JSON.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var sr pkg.SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		writeJSON(w, http.StatusBadRequest, pkg.SignResponse{Error: "invalid sign request"})
+		return
+	}
+	res := s.Sign(sr)
+	status := http.StatusOK
+	if res.Error != "" {
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, res)
+}
+
+// ServeStdio handles single SignRequest read from r and writes response to w.
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	var sr pkg.SignRequest
+	if err := json.NewDecoder(r).Decode(&sr); err != nil {
+		return errors.Wrap(err, "invalid sign request")
+	}
+	return json.NewEncoder(w).Encode(s.Sign(sr))
+}
+
+func writeJSON(w http.ResponseWriter, status int, res pkg.SignResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
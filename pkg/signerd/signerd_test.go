@@ -0,0 +1,188 @@
+package signerd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = Policy{
+	Endpoints: []string{"POST api/v3/order", "order.place"},
+	Symbols:   []string{"BNBBTC"},
+}
+
+var testSigner = &pkg.HmacSigner{Key: []byte("secret")}
+
+func TestPolicy(t *testing.T) {
+	assert.NoError(t, testPolicy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET",
+	}))
+	assert.NoError(t, testPolicy.Check(pkg.SignRequest{
+		Endpoint: "order.place", Payload: "apiKey=k&side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET",
+	}))
+	assert.Error(t, testPolicy.Check(pkg.SignRequest{
+		Method: "DELETE", Endpoint: "api/v3/order", Payload: "symbol=BNBBTC&timestamp=1",
+	}))
+	assert.Error(t, testPolicy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "symbol=ETHBTC&timestamp=1",
+	}))
+	assert.Error(t, Policy{}.Check(pkg.SignRequest{Endpoint: "order.place"}))
+
+	// Symbol can't be omitted to request orders of all symbols.
+	err := testPolicy.Check(pkg.SignRequest{Endpoint: "order.place", Payload: "side=BUY&timestamp=1"})
+	assert.EqualError(t, err, "symbol is required")
+	err = testPolicy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "symbol=BNBBTC&symbol=ETHBTC&timestamp=1",
+	})
+	assert.EqualError(t, err, "param symbol is repeated")
+	err = Policy{Endpoints: []string{"GET api/v3/account"}, Symbols: []string{"BNBBTC"}}.Check(pkg.SignRequest{
+		Method: "GET", Endpoint: "api/v3/account", Payload: "timestamp=1",
+	})
+	assert.NoError(t, err)
+	err = Policy{Endpoints: []string{"api/v3/unknown"}}.Check(pkg.SignRequest{
+		Method: "GET", Endpoint: "api/v3/unknown", Payload: "timestamp=1",
+	})
+	assert.EqualError(t, err, "params of endpoint api/v3/unknown are not known")
+	err = Policy{
+		Endpoints: []string{"POST wapi/v1/withdraw.html"},
+		Rules: map[string]Rule{"POST wapi/v1/withdraw.html": {
+			Params:   []string{"asset", "address", "amount", "timestamp"},
+			Required: []string{"asset", "address", "amount", "timestamp"},
+		}},
+	}.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "wapi/v1/withdraw.html", Payload: "asset=BTC&address=a&amount=1&timestamp=1",
+	})
+	assert.NoError(t, err)
+}
+
+func TestPolicyMislabelledWithdrawal(t *testing.T) {
+	withdrawal := "address=attacker&amount=1&asset=BTC&network=BTC&timestamp=1"
+	for _, sr := range []pkg.SignRequest{
+		{Method: "POST", Endpoint: "api/v3/order", Payload: withdrawal},
+		{Method: "POST", Endpoint: "api/v3/order", Payload: "symbol=BNBBTC&" + withdrawal},
+		{Endpoint: "order.place", Payload: withdrawal},
+	} {
+		assert.Error(t, testPolicy.Check(sr), sr.Payload)
+	}
+	err := Policy{Endpoints: []string{"POST api/v3/order"}}.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: withdrawal,
+	})
+	assert.EqualError(t, err, "param address is not allowed")
+}
+
+func TestPolicyRequiredParams(t *testing.T) {
+	// Payload signed as new order would be valid for cancelling all open
+	// orders of the symbol too.
+	policy := Policy{Endpoints: []string{"POST api/v3/order", "DELETE api/v3/order"}}
+	err := policy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "symbol=BNBBTC&timestamp=1",
+	})
+	assert.EqualError(t, err, "param side is required")
+	err = policy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "side=BUY&symbol=BNBBTC&timestamp=1",
+	})
+	assert.EqualError(t, err, "param type is required")
+	assert.NoError(t, policy.Check(pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET",
+	}))
+
+	err = policy.Check(pkg.SignRequest{
+		Method: "DELETE", Endpoint: "api/v3/order", Payload: "symbol=BNBBTC&timestamp=1",
+	})
+	assert.EqualError(t, err, "param orderId|origClientOrderId is required")
+	assert.NoError(t, policy.Check(pkg.SignRequest{
+		Method: "DELETE", Endpoint: "api/v3/order", Payload: "origClientOrderId=a&symbol=BNBBTC&timestamp=1",
+	}))
+}
+
+func TestHTTPSigner(t *testing.T) {
+	srv := httptest.NewServer(NewServer(testSigner, testPolicy, nil))
+	defer srv.Close()
+	signer := &pkg.HTTPSigner{URL: srv.URL}
+
+	payload := "side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET"
+	s, err := signer.SignContext(context.Background(), pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: payload,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testSigner.Sign([]byte(payload)), s)
+
+	_, err = signer.SignContext(context.Background(), pkg.SignRequest{
+		Method: "POST", Endpoint: "wapi/v1/withdraw.html", Payload: "asset=BTC",
+	})
+	assert.EqualError(t, err, "signer refused: endpoint wapi/v1/withdraw.html is not allowed")
+}
+
+func TestUnixSocketSigner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signerd.sock")
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	srv := &http.Server{Handler: NewServer(testSigner, testPolicy, nil)}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	payload := "apiKey=k&side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET"
+	s, err := pkg.NewUnixSocketSigner(path).SignContext(context.Background(), pkg.SignRequest{
+		Endpoint: "order.place", Payload: payload,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testSigner.Sign([]byte(payload)), s)
+}
+
+// TestHelperProcess is stand-in signing daemon run by TestCommandSigner.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("SIGNERD_HELPER_PROCESS") != "1" {
+		return
+	}
+	if err := NewServer(testSigner, testPolicy, nil).ServeStdio(os.Stdin, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestCommandSigner(t *testing.T) {
+	os.Setenv("SIGNERD_HELPER_PROCESS", "1")
+	defer os.Unsetenv("SIGNERD_HELPER_PROCESS")
+	signer := &pkg.CommandSigner{Path: os.Args[0], Args: []string{"-test.run=TestHelperProcess"}}
+
+	payload := "side=BUY&symbol=BNBBTC&timestamp=1&type=MARKET"
+	s, err := signer.SignContext(context.Background(), pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: payload,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, testSigner.Sign([]byte(payload)), s)
+
+	_, err = signer.SignContext(context.Background(), pkg.SignRequest{
+		Method: "POST", Endpoint: "api/v3/order", Payload: "symbol=ETHBTC&timestamp=1",
+	})
+	assert.EqualError(t, err, "signer refused: symbol ETHBTC is not allowed")
+}
+
+func TestServiceWithContextSigner(t *testing.T) {
+	signerd := httptest.NewServer(NewServer(testSigner, testPolicy, nil))
+	defer signerd.Close()
+
+	var signature string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.PostFormValue("signature")
+		w.Write([]byte(`{"symbol":"BNBBTC","orderId":1,"clientOrderId":"a","transactTime":1499827319559}`))
+	}))
+	defer api.Close()
+
+	service := pkg.NewAPIService(api.URL, "api-key", nil, nil, context.Background(),
+		pkg.WithContextSigner(&pkg.HTTPSigner{URL: signerd.URL}))
+	_, err := service.NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideBuy, Type: pkg.TypeMarket, Quantity: 1})
+	require.NoError(t, err)
+	assert.NotEmpty(t, signature)
+
+	_, err = service.CancelOrder(pkg.CancelOrderRequest{Symbol: "BNBBTC", OrderID: 1})
+	assert.Error(t, err)
+}
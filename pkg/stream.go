@@ -0,0 +1,426 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// OverflowPolicy represents behaviour of websocket stream when consumer
+// doesn't keep up with incoming events and stream buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading from connection until consumer receives
+	// queued event. Binance disconnects streams blocked for too long.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued event.
+	OverflowDropOldest
+	// OverflowDropNewest discards the incoming event.
+	OverflowDropNewest
+	// OverflowCoalesce replaces queued event carrying the same state with the
+	// incoming one, so only the latest state is kept. It's meant for streams
+	// carrying full state: partial book depth is coalesced by symbol, klines
+	// by symbol and open time, so final kline is never replaced by the next
+	// one. Diff depth and trade subscriptions reject it. Ticker and book
+	// ticker streams, the other full state streams of Binance, aren't
+	// provided by Service. When no queued event can be replaced, incoming
+	// event waits as with OverflowBlock.
+	OverflowCoalesce
+)
+
+// StreamOptions configures delivery of websocket stream events.
+type StreamOptions struct {
+	// BufferSize is number of events queued ahead of the consumer. Values
+	// lower than 1 are treated as 1.
+	BufferSize int
+	// Overflow is applied when buffer is full.
+	Overflow OverflowPolicy
+	// Stats, if set, is updated with counters of the stream.
+	Stats *StreamStats
+}
+
+// StreamStats holds counters of websocket stream events.
+//
+// Counters are updated atomically and can be read while stream is running.
+// Single StreamStats can be shared by multiple streams.
+type StreamStats struct {
+	received  uint64
+	dropped   uint64
+	coalesced uint64
+}
+
+// Received returns number of events read from connection.
+func (ss *StreamStats) Received() uint64 {
+	return atomic.LoadUint64(&ss.received)
+}
+
+// Dropped returns number of events discarded because of full buffer.
+func (ss *StreamStats) Dropped() uint64 {
+	return atomic.LoadUint64(&ss.dropped)
+}
+
+// Coalesced returns number of queued events replaced by newer ones.
+func (ss *StreamStats) Coalesced() uint64 {
+	return atomic.LoadUint64(&ss.coalesced)
+}
+
+// UserDataStreamLabel is name under which user data streams are reported to
+// StreamObserver, so that listen keys don't leak into metrics.
+const UserDataStreamLabel = "userData"
+
+// StreamObserver is notified about activity of websocket streams, e.g. to
+// export metrics. Methods are called from stream goroutines and must not block.
+type StreamObserver interface {
+	// MessageReceived is called for every parsed message. eventTime is time
+	// the event was produced by Binance, zero if message doesn't carry it.
+	MessageReceived(stream string, eventTime time.Time)
+	// ParseError is called for every message which couldn't be parsed.
+	ParseError(stream string)
+	// EventDropped is called for every event discarded because of full buffer.
+	EventDropped(stream string)
+	// Reconnected is called when stream is connected again after failure.
+	Reconnected(stream string)
+}
+
+// WithStreamObserver makes Service report websocket stream activity to o.
+func WithStreamObserver(o StreamObserver) APIServiceOption {
+	return func(as *apiService) {
+		as.StreamObserver = o
+	}
+}
+
+// StreamConn is websocket stream connection, as returned by StreamDialer.
+// *websocket.Conn implements it.
+type StreamConn interface {
+	// ReadMessage returns the next message. After Close it returns error.
+	ReadMessage() (messageType int, data []byte, err error)
+	Close() error
+}
+
+// StreamDialer connects websocket stream at url.
+type StreamDialer func(url string) (StreamConn, error)
+
+// WithStreamDialer makes Service connect websocket streams with d instead
+// of websocket.DefaultDialer, e.g. to record or replay streams.
+func WithStreamDialer(d StreamDialer) APIServiceOption {
+	return func(as *apiService) {
+		as.StreamDialer = d
+	}
+}
+
+func dialStream(url string) (StreamConn, error) {
+	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// timedEvent is implemented by events carrying event time.
+type timedEvent interface {
+	eventTime() time.Time
+}
+
+func (e WSEvent) eventTime() time.Time {
+	return e.Time
+}
+
+type queuedEvent struct {
+	key   string
+	event interface{}
+}
+
+// eventQueue buffers events between connection reader and consumer,
+// applying StreamOptions overflow policy.
+type eventQueue struct {
+	opts   StreamOptions
+	size   int
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []queuedEvent
+	closed bool
+	// onDrop, if set, is called for every dropped event.
+	onDrop func()
+}
+
+func newEventQueue(opts StreamOptions) *eventQueue {
+	q := &eventQueue{
+		opts: opts,
+		size: opts.BufferSize,
+	}
+	if q.size < 1 {
+		q.size = 1
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *eventQueue) dropped() {
+	if q.opts.Stats != nil {
+		atomic.AddUint64(&q.opts.Stats.dropped, 1)
+	}
+	if q.onDrop != nil {
+		q.onDrop()
+	}
+}
+
+func (q *eventQueue) push(key string, event interface{}) {
+	stats := q.opts.Stats
+	if stats != nil {
+		atomic.AddUint64(&stats.received, 1)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+
+	if len(q.events) >= q.size {
+		switch q.opts.Overflow {
+		case OverflowCoalesce:
+			if q.coalesce(key, event) {
+				return
+			}
+			q.wait()
+			if q.closed {
+				return
+			}
+		case OverflowDropNewest:
+			q.dropped()
+			return
+		case OverflowDropOldest:
+			q.events = q.events[1:]
+			q.dropped()
+		default:
+			q.wait()
+			if q.closed {
+				return
+			}
+		}
+	}
+
+	q.events = append(q.events, queuedEvent{key: key, event: event})
+	q.cond.Broadcast()
+}
+
+// coalesce replaces the latest queued event of the same key with event and
+// reports whether it did. Events without key are never coalesced.
+func (q *eventQueue) coalesce(key string, event interface{}) bool {
+	if key == "" {
+		return false
+	}
+	for i := len(q.events) - 1; i >= 0; i-- {
+		if q.events[i].key == key {
+			q.events[i].event = event
+			if q.opts.Stats != nil {
+				atomic.AddUint64(&q.opts.Stats.coalesced, 1)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until there is room in the queue or it's closed. It must be
+// called with q.mu held.
+func (q *eventQueue) wait() {
+	for len(q.events) >= q.size && !q.closed {
+		q.cond.Wait()
+	}
+}
+
+// pop returns the oldest queued event, waiting for one if necessary. It
+// returns false when queue is closed and there are no more events.
+func (q *eventQueue) pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.events) == 0 {
+		return nil, false
+	}
+	event := q.events[0].event
+	q.events[0] = queuedEvent{}
+	q.events = q.events[1:]
+	q.cond.Broadcast()
+	return event, true
+}
+
+// close stops accepting new events. Already queued events can still be
+// popped.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// discard drops all queued events and closes the queue.
+func (q *eventQueue) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.events = nil
+	q.cond.Broadcast()
+}
+
+// StreamHandler groups callbacks of stream subscription. Only the callback
+// matching subscribed stream is used. OnError, if set, is called with
+// malformed messages errors and with the error which stopped the stream.
+//
+// Callbacks are called sequentially from single goroutine per subscription.
+type StreamHandler struct {
+	OnDepth    func(*DepthEvent)
+	OnKline    func(*KlineEvent)
+	OnTrade    func(*AggTradeEvent)
+	OnUserData func(UserDataEvent)
+	OnError    func(error)
+}
+
+// Subscription represents single running stream.
+type Subscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	// handling is 1 while handler is running.
+	handling int32
+
+	mu  sync.Mutex
+	err error
+}
+
+func newSubscription(ctx context.Context, cancel context.CancelFunc) *Subscription {
+	return &Subscription{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Close stops the stream and waits until its handlers return. While handler
+// is running, e.g. when Close is called from it, Close returns without
+// waiting; no more handlers are called once the running one returns and Done
+// is closed after that.
+func (s *Subscription) Close() error {
+	s.cancel()
+	if atomic.LoadInt32(&s.handling) == 1 {
+		return nil
+	}
+	<-s.done
+	return nil
+}
+
+// deliver passes events popped from q to handle until q or the stream is
+// closed. It must be run in its own goroutine.
+func (s *Subscription) deliver(q *eventQueue, handle func(event interface{})) {
+	for {
+		event, ok := q.pop()
+		if !ok || s.ctx.Err() != nil {
+			break
+		}
+		atomic.StoreInt32(&s.handling, 1)
+		handle(event)
+		atomic.StoreInt32(&s.handling, 0)
+	}
+	q.discard()
+}
+
+// Done returns channel closed when the stream stops.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns error which stopped the stream. It's nil while stream is
+// running and when it was stopped by Close or context cancellation.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// subscriptionGate gives handlers of channel streams the Subscription they
+// belong to, which isn't known yet when the handlers are created.
+type subscriptionGate struct {
+	ready chan struct{}
+	sub   *Subscription
+}
+
+func newSubscriptionGate() *subscriptionGate {
+	return &subscriptionGate{ready: make(chan struct{})}
+}
+
+// open makes sub available to handlers.
+func (g *subscriptionGate) open(sub *Subscription) {
+	g.sub = sub
+	close(g.ready)
+}
+
+// closing returns channel closed when the subscription is being closed, so
+// that handler blocked on consumer can return.
+func (g *subscriptionGate) closing() <-chan struct{} {
+	<-g.ready
+	return g.sub.ctx.Done()
+}
+
+// StreamFeed delivers events of stream which isn't read from websocket
+// connection, e.g. simulated by paper trading or backtesting Service, the way
+// websocket streams do, honoring StreamOptions.
+type StreamFeed struct {
+	ctx context.Context
+	q   *eventQueue
+	sub *Subscription
+}
+
+// NewStreamFeed starts feed passing its events to handle and returns it with
+// Subscription of the stream. The stream is closed when ctx is done.
+func NewStreamFeed(ctx context.Context, opts StreamOptions, handle func(event interface{})) (*StreamFeed, *Subscription) {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &StreamFeed{
+		ctx: ctx,
+		q:   newEventQueue(opts),
+		sub: newSubscription(ctx, cancel),
+	}
+	go func() {
+		<-ctx.Done()
+		f.q.discard()
+	}()
+	go func() {
+		defer close(f.sub.done)
+		defer cancel()
+		f.sub.deliver(f.q, handle)
+	}()
+	return f, f.sub
+}
+
+// Push queues event with coalescing key, see OverflowCoalesce. With
+// OverflowBlock it waits while the buffer is full.
+func (f *StreamFeed) Push(key string, event interface{}) {
+	f.q.push(key, event)
+}
+
+// End stops the stream once queued events are delivered. Non-nil err is
+// reported by Subscription.Err.
+func (f *StreamFeed) End(err error) {
+	if err != nil {
+		f.sub.setErr(err)
+	}
+	f.q.close()
+}
+
+// Done returns channel closed when the stream is closed, e.g. to stop
+// handler waiting for slow consumer.
+func (f *StreamFeed) Done() <-chan struct{} {
+	return f.ctx.Done()
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func popAll(q *eventQueue) []interface{} {
+	q.close()
+	var events []interface{}
+	for {
+		event, ok := q.pop()
+		if !ok {
+			return events
+		}
+		events = append(events, event)
+	}
+}
+
+func TestEventQueueDropOldest(t *testing.T) {
+	stats := &StreamStats{}
+	q := newEventQueue(StreamOptions{BufferSize: 2, Overflow: OverflowDropOldest, Stats: stats})
+	for i := 1; i <= 4; i++ {
+		q.push("BNBBTC", i)
+	}
+	assert.Equal(t, []interface{}{3, 4}, popAll(q))
+	assert.Equal(t, uint64(4), stats.Received())
+	assert.Equal(t, uint64(2), stats.Dropped())
+}
+
+func TestEventQueueDropNewest(t *testing.T) {
+	stats := &StreamStats{}
+	q := newEventQueue(StreamOptions{BufferSize: 2, Overflow: OverflowDropNewest, Stats: stats})
+	for i := 1; i <= 4; i++ {
+		q.push("BNBBTC", i)
+	}
+	assert.Equal(t, []interface{}{1, 2}, popAll(q))
+	assert.Equal(t, uint64(2), stats.Dropped())
+}
+
+func TestEventQueueCoalesce(t *testing.T) {
+	stats := &StreamStats{}
+	q := newEventQueue(StreamOptions{BufferSize: 2, Overflow: OverflowCoalesce, Stats: stats})
+	q.push("BNBBTC", 1)
+	q.push("BNBBTC", 2)
+	q.push("BNBBTC", 3)
+	assert.Equal(t, []interface{}{1, 3}, popAll(q))
+	assert.Equal(t, uint64(1), stats.Coalesced())
+	assert.Equal(t, uint64(0), stats.Dropped())
+}
+
+func TestEventQueueCoalesceWaitsForOtherKey(t *testing.T) {
+	q := newEventQueue(StreamOptions{BufferSize: 1, Overflow: OverflowCoalesce})
+	q.push("BNBBTC", 1)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push("ETHBTC", 2)
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push of other key didn't wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	v, _ := q.pop()
+	assert.Equal(t, 1, v)
+	<-pushed
+	v, _ = q.pop()
+	assert.Equal(t, 2, v)
+}
+
+func TestEventQueueBlock(t *testing.T) {
+	q := newEventQueue(StreamOptions{BufferSize: 1})
+	q.push("", 1)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push("", 2)
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push didn't block on full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	event, ok := q.pop()
+	assert.True(t, ok)
+	assert.Equal(t, 1, event)
+	<-pushed
+	assert.Equal(t, []interface{}{2}, popAll(q))
+}
+
+func TestEventQueueDiscardUnblocksPush(t *testing.T) {
+	q := newEventQueue(StreamOptions{BufferSize: 1})
+	q.push("", 1)
+
+	pushed := make(chan struct{})
+	go func() {
+		q.push("", 2)
+		close(pushed)
+	}()
+	q.discard()
+	<-pushed
+	_, ok := q.pop()
+	assert.False(t, ok)
+}
+
+func TestStreamFeed(t *testing.T) {
+	var events []interface{}
+	f, sub := NewStreamFeed(context.Background(), StreamOptions{BufferSize: 10}, func(event interface{}) {
+		events = append(events, event)
+	})
+	f.Push("", 1)
+	f.Push("", 2)
+	f.End(errors.New("no more data"))
+	<-sub.Done()
+	assert.Equal(t, []interface{}{1, 2}, events)
+	assert.EqualError(t, sub.Err(), "no more data")
+
+	block := make(chan struct{})
+	f, sub = NewStreamFeed(context.Background(), StreamOptions{}, func(event interface{}) {
+		select {
+		case <-block:
+		case <-f.Done():
+		}
+	})
+	f.Push("", 1)
+	assert.NoError(t, sub.Close())
+	assert.NoError(t, sub.Err())
+}
+
+func TestSubscriptionCloseFromHandler(t *testing.T) {
+	var sub *Subscription
+	subscribed := make(chan struct{})
+	var events []interface{}
+	f, sub := NewStreamFeed(context.Background(), StreamOptions{BufferSize: 10}, func(event interface{}) {
+		<-subscribed
+		events = append(events, event)
+		assert.NoError(t, sub.Close())
+	})
+	close(subscribed)
+	f.Push("", 1)
+	f.Push("", 2)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed from handler")
+	}
+	assert.Equal(t, []interface{}{1}, events)
+}
@@ -0,0 +1,204 @@
+// Package tracing instruments Binance client with OpenTelemetry.
+//
+// Every REST call made through Tracer.Middleware creates a span, child of the
+// span in the call context (see pkg.WithContext):
+//
+//	tracer := tracing.New(otel.GetTracerProvider())
+//	service := pkg.NewAPIService(url, apiKey, signer, logger, ctx,
+//		pkg.WithMiddleware(tracer.Middleware()))
+//	po, err := pkg.WithContext(service, ctx).NewOrder(or)
+//
+// Spans of order requests are remembered by client order ID, so that spans
+// of user data events of the order link to the request which placed it.
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/retirero/go-binance/pkg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is name of the tracer used by this package.
+const InstrumentationName = "github.com/retirero/go-binance/pkg/tracing"
+
+// DefaultMaxOrders is default number of orders whose spans are remembered.
+const DefaultMaxOrders = 10000
+
+// Attribute keys set on spans.
+const (
+	EndpointKey      = attribute.Key("binance.endpoint")
+	MethodKey        = attribute.Key("http.method")
+	StatusCodeKey    = attribute.Key("http.status_code")
+	SymbolKey        = attribute.Key("binance.symbol")
+	WeightKey        = attribute.Key("binance.weight")
+	ErrorCodeKey     = attribute.Key("binance.error_code")
+	ClientOrderIDKey = attribute.Key("binance.client_order_id")
+	EventTypeKey     = attribute.Key("binance.event_type")
+)
+
+// Tracer creates spans for REST calls and user data events.
+type Tracer struct {
+	// MaxOrders is number of orders whose spans are remembered for linking.
+	MaxOrders int
+
+	tracer trace.Tracer
+
+	mu     sync.Mutex
+	orders map[string]trace.SpanContext
+	queue  []string
+}
+
+// New creates Tracer using tracer provider tp.
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{
+		MaxOrders: DefaultMaxOrders,
+		tracer:    tp.Tracer(InstrumentationName),
+		orders:    make(map[string]trace.SpanContext),
+	}
+}
+
+// Middleware returns pkg.Middleware creating span for every REST call.
+func (t *Tracer) Middleware() pkg.Middleware {
+	return func(next pkg.RoundTripper) pkg.RoundTripper {
+		return func(req *pkg.APIRequest) (*pkg.APIResponse, error) {
+			ctx := req.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			attrs := []attribute.KeyValue{
+				EndpointKey.String(req.Endpoint),
+				MethodKey.String(req.Method),
+				WeightKey.Int(req.Weight),
+			}
+			if symbol := req.Params["symbol"]; symbol != "" {
+				attrs = append(attrs, SymbolKey.String(symbol))
+			}
+			ctx, span := t.tracer.Start(ctx, fmt.Sprintf("binance %s %s", req.Method, req.Endpoint),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			defer span.End()
+
+			r := *req
+			r.Ctx = ctx
+			res, err := next(&r)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return res, err
+			}
+
+			span.SetAttributes(StatusCodeKey.Int(res.StatusCode))
+			if res.StatusCode != 200 {
+				apiErr := &pkg.Error{}
+				if json.Unmarshal(res.Body, apiErr) == nil && apiErr.Code != 0 {
+					span.SetAttributes(ErrorCodeKey.Int(apiErr.Code))
+					span.SetStatus(codes.Error, apiErr.Message)
+				} else {
+					span.SetStatus(codes.Error, fmt.Sprintf("status %d", res.StatusCode))
+				}
+				return res, err
+			}
+			if req.Endpoint == "api/v3/order" && req.Method != "GET" {
+				if id := clientOrderID(req, res); id != "" {
+					span.SetAttributes(ClientOrderIDKey.String(id))
+					t.remember(id, span.SpanContext())
+				}
+			}
+			return res, err
+		}
+	}
+}
+
+// clientOrderID returns client order ID of order request, preferring the one
+// assigned by Binance in response.
+func clientOrderID(req *pkg.APIRequest, res *pkg.APIResponse) string {
+	body := struct {
+		ClientOrderID string `json:"clientOrderId"`
+	}{}
+	if json.Unmarshal(res.Body, &body) == nil && body.ClientOrderID != "" {
+		return body.ClientOrderID
+	}
+	if id := req.Params["newClientOrderId"]; id != "" {
+		return id
+	}
+	return req.Params["origClientOrderId"]
+}
+
+func (t *Tracer) remember(id string, sc trace.SpanContext) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.orders[id]; !ok {
+		t.queue = append(t.queue, id)
+	}
+	t.orders[id] = sc
+	for len(t.queue) > t.MaxOrders && len(t.queue) > 0 {
+		delete(t.orders, t.queue[0])
+		t.queue = t.queue[1:]
+	}
+}
+
+// OrderSpan returns span context of the last request for order with client
+// order ID id.
+func (t *Tracer) OrderSpan(id string) (trace.SpanContext, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sc, ok := t.orders[id]
+	return sc, ok
+}
+
+// StartEventSpan starts span for user data event as child of span in ctx.
+// Spans of execution reports link to span of the request which placed or
+// cancelled the order. Caller must end the returned span.
+func (t *Tracer) StartEventSpan(ctx context.Context, ude pkg.UserDataEvent) (context.Context, trace.Span) {
+	var attrs []attribute.KeyValue
+	var links []trace.Link
+	if er, ok := ude.(*pkg.ExecutionReportEvent); ok {
+		attrs = append(attrs,
+			SymbolKey.String(er.Symbol),
+			ClientOrderIDKey.String(er.ClientOrderID),
+			EventTypeKey.String(string(er.ExecutionType)),
+		)
+		for _, id := range []string{er.ClientOrderID, er.OrigClientOrderID} {
+			if sc, ok := t.OrderSpan(id); ok && id != "" {
+				links = append(links, trace.Link{SpanContext: sc})
+			}
+		}
+	}
+	return t.tracer.Start(ctx, "binance "+eventType(ude),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+		trace.WithLinks(links...))
+}
+
+// UserDataHandler wraps h, so that every user data event is handled within
+// its span started by StartEventSpan. It can be used as
+// pkg.StreamHandler.OnUserData.
+func (t *Tracer) UserDataHandler(h func(ctx context.Context, ude pkg.UserDataEvent)) func(pkg.UserDataEvent) {
+	return func(ude pkg.UserDataEvent) {
+		ctx, span := t.StartEventSpan(context.Background(), ude)
+		defer span.End()
+		h(ctx, ude)
+	}
+}
+
+func eventType(ude pkg.UserDataEvent) string {
+	switch e := ude.(type) {
+	case *pkg.AccountPositionEvent:
+		return e.Type
+	case *pkg.BalanceUpdateEvent:
+		return e.Type
+	case *pkg.ExecutionReportEvent:
+		return e.Type
+	case *pkg.ListStatusEvent:
+		return e.Type
+	case *pkg.ListenKeyExpiredEvent:
+		return e.Type
+	}
+	return fmt.Sprintf("%T", ude)
+}
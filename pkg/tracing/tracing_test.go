@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/retirero/go-binance/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestService(t *testing.T, handler http.HandlerFunc) (*Tracer, *tracetest.InMemoryExporter, *sdktrace.TracerProvider, pkg.Service) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := New(tp)
+	service := pkg.NewAPIService(srv.URL, "api-key", &pkg.HmacSigner{Key: []byte("secret")}, nil, context.Background(),
+		pkg.WithMiddleware(tracer.Middleware()))
+	return tracer, exporter, tp, service
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestOrderSpanLinkedFromExecutionReport(t *testing.T) {
+	tracer, exporter, tp, service := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"symbol":"BNBBTC","orderId":1,"clientOrderId":"6gCrw2kRUAF9CvJDGP16IP","transactTime":1499827319559}`))
+	})
+
+	ctx, parent := tp.Tracer("strategy").Start(context.Background(), "decision")
+	_, err := pkg.WithContext(service, ctx).NewOrder(pkg.NewOrderRequest{Symbol: "BNBBTC", Side: pkg.SideBuy, Type: pkg.TypeMarket, Quantity: 1})
+	require.NoError(t, err)
+	parent.End()
+
+	var handled bool
+	tracer.UserDataHandler(func(ctx context.Context, ude pkg.UserDataEvent) {
+		handled = true
+	})(&pkg.ExecutionReportEvent{
+		WSEvent:       pkg.WSEvent{Type: "executionReport", Symbol: "BNBBTC"},
+		ClientOrderID: "6gCrw2kRUAF9CvJDGP16IP",
+		ExecutionType: pkg.ExecutionTrade,
+	})
+	assert.True(t, handled)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	orderSpan, decision, report := spans[0], spans[1], spans[2]
+	assert.Equal(t, "binance POST api/v3/order", orderSpan.Name)
+	assert.Equal(t, decision.SpanContext.SpanID(), orderSpan.Parent.SpanID())
+	attrs := attributes(orderSpan)
+	assert.Equal(t, "BNBBTC", attrs[SymbolKey].AsString())
+	assert.Equal(t, int64(1), attrs[WeightKey].AsInt64())
+	assert.Equal(t, int64(200), attrs[StatusCodeKey].AsInt64())
+	assert.Equal(t, "6gCrw2kRUAF9CvJDGP16IP", attrs[ClientOrderIDKey].AsString())
+
+	assert.Equal(t, "binance executionReport", report.Name)
+	require.Len(t, report.Links, 1)
+	assert.Equal(t, orderSpan.SpanContext.SpanID(), report.Links[0].SpanContext.SpanID())
+}
+
+func TestErrorCodeAttribute(t *testing.T) {
+	_, exporter, _, service := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+	})
+
+	_, err := service.OrderBook(pkg.OrderBookRequest{Symbol: "XXX", Limit: 1000})
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	attrs := attributes(spans[0])
+	assert.Equal(t, int64(-1121), attrs[ErrorCodeKey].AsInt64())
+	assert.Equal(t, int64(50), attrs[WeightKey].AsInt64())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+}
+
+func TestMaxOrders(t *testing.T) {
+	tracer := New(sdktrace.NewTracerProvider())
+	tracer.MaxOrders = 1
+	tracer.remember("a", tracer.orders["x"])
+	tracer.remember("b", tracer.orders["x"])
+	_, ok := tracer.OrderSpan("a")
+	assert.False(t, ok)
+	_, ok = tracer.OrderSpan("b")
+	assert.True(t, ok)
+}
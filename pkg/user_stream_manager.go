@@ -0,0 +1,291 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// DefaultKeepAliveInterval is interval of listen key prolonging. Binance
+// expires listen keys after 60 minutes without keepalive.
+const DefaultKeepAliveInterval = 30 * time.Minute
+
+// UserDataStreamManager maintains user data stream and its listen key.
+//
+// Manager obtains listen key and keeps it alive on a timer. When connection
+// is lost or can't be established, it reconnects with the same key after
+// RetryInterval, doubled with every consecutive failure up to
+// MaxRetryInterval. Whenever the key expires or keepalive fails, it obtains
+// fresh key and reconnects. Events from all consecutive connections are
+// delivered to single channel returned by Events. ListenKeyExpiredEvent is
+// delivered too, so consumers know that some events might have been missed
+// during rotation.
+type UserDataStreamManager struct {
+	Service           Service
+	Logger            log.Logger
+	KeepAliveInterval time.Duration
+	RetryInterval     time.Duration
+	MaxRetryInterval  time.Duration
+	// Observer, if set, is notified when the stream is reconnected.
+	Observer StreamObserver
+
+	events chan UserDataEvent
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	stream *Stream
+}
+
+// NewUserDataStreamManager returns UserDataStreamManager using service for
+// listen key management and stream connections.
+//
+// If logger is not provided, NopLogger is used as default.
+func NewUserDataStreamManager(service Service, logger log.Logger) *UserDataStreamManager {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &UserDataStreamManager{
+		Service:           service,
+		Logger:            logger,
+		KeepAliveInterval: DefaultKeepAliveInterval,
+		RetryInterval:     5 * time.Second,
+		MaxRetryInterval:  5 * time.Minute,
+		events:            make(chan UserDataEvent),
+		done:              make(chan struct{}),
+	}
+}
+
+// Start obtains listen key, connects to user data stream and keeps it running
+// until ctx is cancelled or Close is called.
+func (m *UserDataStreamManager) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s, err := m.Service.StartUserDataStream()
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "unable to start user data stream")
+	}
+	m.cancel = cancel
+	m.setStream(s)
+
+	go m.run(ctx)
+	return nil
+}
+
+// Events returns channel with events from user data stream. The channel stays
+// the same across listen key rotations and is closed when manager stops.
+func (m *UserDataStreamManager) Events() <-chan UserDataEvent {
+	return m.events
+}
+
+// Done returns channel closed when manager stops.
+func (m *UserDataStreamManager) Done() <-chan struct{} {
+	return m.done
+}
+
+// ListenKey returns listen key of current stream.
+func (m *UserDataStreamManager) ListenKey() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stream == nil {
+		return ""
+	}
+	return m.stream.ListenKey
+}
+
+// Close stops the manager and closes current listen key.
+func (m *UserDataStreamManager) Close() error {
+	if m.cancel == nil {
+		return errors.New("user data stream manager not started")
+	}
+	m.cancel()
+	<-m.done
+
+	m.mu.Lock()
+	s := m.stream
+	m.stream = nil
+	m.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	return m.Service.CloseUserDataStream(s)
+}
+
+// streamEnd tells how to continue after connection of user data stream ends.
+type streamEnd int
+
+const (
+	stopStream streamEnd = iota
+	reconnectStream
+	rotateStream
+)
+
+func (m *UserDataStreamManager) run(ctx context.Context) {
+	defer close(m.done)
+	defer close(m.events)
+
+	retry := m.newBackoff()
+	for {
+		s := m.currentStream()
+		udech := make(chan UserDataEvent)
+		stop := make(chan struct{})
+		sub, err := m.Service.SubscribeUserData(UserDataWebsocketRequest{
+			ListenKey: s.ListenKey,
+		}, StreamHandler{
+			OnUserData: func(ude UserDataEvent) {
+				select {
+				case udech <- ude:
+				case <-stop:
+				}
+			},
+		})
+		if err != nil {
+			level.Error(m.Logger).Log("userDataStream", "connect", "err", err)
+			if !retry.wait(ctx) {
+				return
+			}
+			// Key might have expired while disconnected.
+			if err := m.Service.KeepAliveUserDataStream(s); err != nil {
+				level.Error(m.Logger).Log("userDataStream", "keepalive", "err", err)
+				if !m.rotate(ctx) {
+					return
+				}
+			}
+			continue
+		}
+
+		connected := time.Now()
+		end := m.consume(ctx, udech, sub.Done())
+		close(stop)
+		sub.Close()
+		switch end {
+		case stopStream:
+			return
+		case rotateStream:
+			retry.reset()
+			if !m.rotate(ctx) {
+				return
+			}
+		case reconnectStream:
+			// Connection which drops as soon as it opens keeps backing off.
+			if time.Since(connected) > retry.delay {
+				retry.reset()
+			}
+			if !retry.wait(ctx) {
+				return
+			}
+			if m.Observer != nil {
+				m.Observer.Reconnected(UserDataStreamLabel)
+			}
+		}
+	}
+}
+
+// consume forwards events from single connection until it ends and tells how
+// to continue.
+func (m *UserDataStreamManager) consume(ctx context.Context, udech chan UserDataEvent, sdone <-chan struct{}) streamEnd {
+	keepAlive := time.NewTicker(m.KeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return stopStream
+		case <-sdone:
+			level.Info(m.Logger).Log("userDataStream", "connection closed")
+			return reconnectStream
+		case <-keepAlive.C:
+			if err := m.Service.KeepAliveUserDataStream(m.currentStream()); err != nil {
+				level.Error(m.Logger).Log("userDataStream", "keepalive", "err", err)
+				return rotateStream
+			}
+		case ude := <-udech:
+			select {
+			case m.events <- ude:
+			case <-ctx.Done():
+				return stopStream
+			}
+			if _, ok := ude.(*ListenKeyExpiredEvent); ok {
+				level.Info(m.Logger).Log("userDataStream", "listen key expired")
+				return rotateStream
+			}
+		}
+	}
+}
+
+// rotate closes current listen key and obtains new one, retrying with
+// backoff until it succeeds. It returns false when manager should stop.
+func (m *UserDataStreamManager) rotate(ctx context.Context) bool {
+	if old := m.currentStream(); old != nil {
+		if err := m.Service.CloseUserDataStream(old); err != nil {
+			level.Debug(m.Logger).Log("userDataStream", "close", "err", err)
+		}
+	}
+
+	retry := m.newBackoff()
+	for {
+		s, err := m.Service.StartUserDataStream()
+		if err == nil {
+			m.setStream(s)
+			if m.Observer != nil {
+				m.Observer.Reconnected(UserDataStreamLabel)
+			}
+			return true
+		}
+		level.Error(m.Logger).Log("userDataStream", "start", "err", err)
+		if !retry.wait(ctx) {
+			m.setStream(nil)
+			return false
+		}
+	}
+}
+
+// backoff is retry delay doubled after every wait, from min up to max.
+type backoff struct {
+	min, max, delay time.Duration
+}
+
+func (m *UserDataStreamManager) newBackoff() *backoff {
+	max := m.MaxRetryInterval
+	if max < m.RetryInterval {
+		max = m.RetryInterval
+	}
+	return &backoff{min: m.RetryInterval, max: max, delay: m.RetryInterval}
+}
+
+// wait sleeps for current delay and doubles it. It returns false if ctx is
+// done first.
+func (b *backoff) wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+	b.delay *= 2
+	if b.delay > b.max {
+		b.delay = b.max
+	}
+	return true
+}
+
+func (b *backoff) reset() {
+	b.delay = b.min
+}
+
+func (m *UserDataStreamManager) currentStream() *Stream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stream
+}
+
+func (m *UserDataStreamManager) setStream(s *Stream) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stream = s
+}
@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// userDataFeed is user data stream subscription faked with StreamFeed.
+type userDataFeed struct {
+	feed     *StreamFeed
+	sub      *Subscription
+	handlers chan StreamHandler
+	handler  StreamHandler
+}
+
+func newUserDataFeed() *userDataFeed {
+	f := &userDataFeed{handlers: make(chan StreamHandler, 1)}
+	f.feed, f.sub = NewStreamFeed(context.Background(), StreamOptions{}, func(event interface{}) {
+		f.handler.OnUserData(event.(UserDataEvent))
+	})
+	return f
+}
+
+// subscribed is Run function of SubscribeUserData call returning the feed.
+func (f *userDataFeed) subscribed(args mock.Arguments) {
+	f.handlers <- args.Get(1).(StreamHandler)
+}
+
+// push delivers ude once the feed is subscribed.
+func (f *userDataFeed) push(ude UserDataEvent) {
+	if f.handler.OnUserData == nil {
+		f.handler = <-f.handlers
+	}
+	f.feed.Push("", ude)
+}
+
+func (f *userDataFeed) closed(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.feed.Done():
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed")
+	}
+}
+
+func TestUserDataStreamManagerRotatesExpiredKey(t *testing.T) {
+	binanceService := &ServiceMock{}
+	s1 := &Stream{ListenKey: "key1"}
+	s2 := &Stream{ListenKey: "key2"}
+	feed1, feed2 := newUserDataFeed(), newUserDataFeed()
+
+	binanceService.On("StartUserDataStream").Return(s1, nil).Once()
+	binanceService.On("StartUserDataStream").Return(s2, nil).Once()
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key1"}, mock.Anything).
+		Return(feed1.sub, nil).Run(feed1.subscribed)
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key2"}, mock.Anything).
+		Return(feed2.sub, nil).Run(feed2.subscribed)
+	binanceService.On("CloseUserDataStream", s1).Return(errors.New("listen key expired"))
+	binanceService.On("CloseUserDataStream", s2).Return(nil)
+
+	m := NewUserDataStreamManager(binanceService, nil)
+	assert.Nil(t, m.Start(context.Background()))
+	assert.Equal(t, "key1", m.ListenKey())
+
+	feed1.push(&ListenKeyExpiredEvent{ListenKey: "key1"})
+	ude := <-m.Events()
+	assert.IsType(t, &ListenKeyExpiredEvent{}, ude)
+
+	ere := &ExecutionReportEvent{OrderID: 1}
+	feed2.push(ere)
+	assert.Equal(t, ere, <-m.Events())
+	assert.Equal(t, "key2", m.ListenKey())
+	feed1.closed(t)
+
+	assert.Nil(t, m.Close())
+	feed2.closed(t)
+	_, ok := <-m.Events()
+	assert.False(t, ok)
+	binanceService.AssertExpectations(t)
+}
+
+func TestUserDataStreamManagerKeepAlive(t *testing.T) {
+	binanceService := &ServiceMock{}
+	s1 := &Stream{ListenKey: "key1"}
+	s2 := &Stream{ListenKey: "key2"}
+	feed1, feed2 := newUserDataFeed(), newUserDataFeed()
+	keepAliveFailed := make(chan struct{})
+
+	binanceService.On("StartUserDataStream").Return(s1, nil).Once()
+	binanceService.On("StartUserDataStream").Return(s2, nil).Once()
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key1"}, mock.Anything).
+		Return(feed1.sub, nil).Run(feed1.subscribed)
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key2"}, mock.Anything).
+		Return(feed2.sub, nil).Run(feed2.subscribed)
+	binanceService.On("KeepAliveUserDataStream", s1).Return(nil).Once()
+	binanceService.On("KeepAliveUserDataStream", s1).Return(errors.New("unknown listen key")).Once()
+	binanceService.On("KeepAliveUserDataStream", s2).Return(nil)
+	binanceService.On("CloseUserDataStream", s1).Return(nil).Run(func(mock.Arguments) {
+		close(keepAliveFailed)
+	})
+	binanceService.On("CloseUserDataStream", s2).Return(nil)
+
+	m := NewUserDataStreamManager(binanceService, nil)
+	m.KeepAliveInterval = 10 * time.Millisecond
+	assert.Nil(t, m.Start(context.Background()))
+
+	select {
+	case <-keepAliveFailed:
+	case <-time.After(time.Second):
+		t.Fatal("listen key was not rotated after keepalive failure")
+	}
+	ere := &ExecutionReportEvent{OrderID: 2}
+	feed2.push(ere)
+	assert.Equal(t, ere, <-m.Events())
+	feed1.closed(t)
+
+	assert.Nil(t, m.Close())
+	<-m.Done()
+	binanceService.AssertCalled(t, "CloseUserDataStream", s2)
+}
+
+func TestUserDataStreamManagerReconnectsWithSameKey(t *testing.T) {
+	binanceService := &ServiceMock{}
+	s1 := &Stream{ListenKey: "key1"}
+	feed1, feed2 := newUserDataFeed(), newUserDataFeed()
+
+	binanceService.On("StartUserDataStream").Return(s1, nil).Once()
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key1"}, mock.Anything).
+		Return(feed1.sub, nil).Run(feed1.subscribed).Once()
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key1"}, mock.Anything).
+		Return(feed2.sub, nil).Run(feed2.subscribed).Once()
+	binanceService.On("CloseUserDataStream", s1).Return(nil).Once()
+
+	m := NewUserDataStreamManager(binanceService, nil)
+	m.RetryInterval = 10 * time.Millisecond
+	assert.Nil(t, m.Start(context.Background()))
+
+	<-feed1.handlers
+	assert.Nil(t, feed1.sub.Close())
+	ere := &ExecutionReportEvent{OrderID: 3}
+	feed2.push(ere)
+	assert.Equal(t, ere, <-m.Events())
+	assert.Equal(t, "key1", m.ListenKey())
+
+	assert.Nil(t, m.Close())
+	binanceService.AssertExpectations(t)
+	binanceService.AssertNumberOfCalls(t, "StartUserDataStream", 1)
+}
+
+func TestUserDataStreamManagerBacksOff(t *testing.T) {
+	binanceService := &ServiceMock{}
+	s1 := &Stream{ListenKey: "key1"}
+	attempts := make(chan time.Time, 10)
+
+	binanceService.On("StartUserDataStream").Return(s1, nil).Once()
+	binanceService.On("SubscribeUserData", UserDataWebsocketRequest{ListenKey: "key1"}, mock.Anything).
+		Return(nil, errors.New("dial failed")).Run(func(mock.Arguments) {
+		attempts <- time.Now()
+	})
+	binanceService.On("KeepAliveUserDataStream", s1).Return(nil)
+	binanceService.On("CloseUserDataStream", s1).Return(nil).Once()
+
+	m := NewUserDataStreamManager(binanceService, nil)
+	m.RetryInterval = 20 * time.Millisecond
+	m.MaxRetryInterval = 40 * time.Millisecond
+	assert.Nil(t, m.Start(context.Background()))
+
+	var times []time.Time
+	for i := 0; i < 4; i++ {
+		times = append(times, <-attempts)
+	}
+	assert.Nil(t, m.Close())
+	assert.GreaterOrEqual(t, int64(times[1].Sub(times[0])), int64(20*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(times[2].Sub(times[1])), int64(40*time.Millisecond))
+	assert.GreaterOrEqual(t, int64(times[3].Sub(times[2])), int64(40*time.Millisecond))
+	binanceService.AssertExpectations(t)
+	binanceService.AssertNumberOfCalls(t, "StartUserDataStream", 1)
+}